@@ -11,11 +11,14 @@ import (
 	otelconsumer "go.opentelemetry.io/collector/consumer"
 	"gopkg.in/yaml.v3"
 
+	"github.com/grafana/beyla/pkg/export/accesslog"
 	"github.com/grafana/beyla/pkg/export/attributes"
 	"github.com/grafana/beyla/pkg/export/debug"
 	"github.com/grafana/beyla/pkg/export/instrumentations"
 	"github.com/grafana/beyla/pkg/export/otel"
 	"github.com/grafana/beyla/pkg/export/prom"
+	"github.com/grafana/beyla/pkg/export/statsd"
+	"github.com/grafana/beyla/pkg/export/zipkin"
 	ebpfcommon "github.com/grafana/beyla/pkg/internal/ebpf/common"
 	"github.com/grafana/beyla/pkg/internal/filter"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
@@ -63,13 +66,14 @@ var DefaultConfig = Config{
 		CacheTTL: 5 * time.Minute,
 	},
 	Metrics: otel.MetricsConfig{
-		Protocol:             otel.ProtocolUnset,
-		MetricsProtocol:      otel.ProtocolUnset,
-		Interval:             5 * time.Second,
-		Buckets:              otel.DefaultBuckets,
-		ReportersCacheLen:    ReporterLRUSize,
-		HistogramAggregation: otel.AggregationExplicit,
-		Features:             []string{otel.FeatureApplication},
+		Protocol:              otel.ProtocolUnset,
+		MetricsProtocol:       otel.ProtocolUnset,
+		Interval:              5 * time.Second,
+		Buckets:               otel.DefaultBuckets,
+		ReportersCacheLen:     ReporterLRUSize,
+		HistogramAggregation:  otel.AggregationExplicit,
+		TemporalityPreference: otel.TemporalityCumulative,
+		Features:              []string{otel.FeatureApplication},
 		Instrumentations: []string{
 			instrumentations.InstrumentationALL,
 		},
@@ -86,6 +90,22 @@ var DefaultConfig = Config{
 		Instrumentations: []string{
 			instrumentations.InstrumentationALL,
 		},
+		TailSampling: otel.TailSamplingConfig{
+			DecisionWait:      5 * time.Second,
+			MaxSpans:          100_000,
+			DecisionsCacheLen: 100_000,
+		},
+	},
+	Zipkin: zipkin.TracesConfig{
+		Encoding: zipkin.EncodingJSON,
+		Timeout:  10 * time.Second,
+	},
+	AccessLog: accesslog.Config{
+		Format: accesslog.FormatJSON,
+		File: accesslog.FileConfig{
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+		},
 	},
 	Prometheus: prom.PrometheusConfig{
 		Path:     "/metrics",
@@ -96,6 +116,27 @@ var DefaultConfig = Config{
 		},
 		TTL:                         defaultMetricsTTL,
 		SpanMetricsServiceCacheSize: 10000,
+		RemoteWrite: prom.RemoteWriteConfig{
+			Interval:          15 * time.Second,
+			Timeout:           10 * time.Second,
+			MaxSamplesPerSend: 2000,
+			QueueCapacity:     50,
+			MaxRetries:        3,
+			MinBackoff:        30 * time.Millisecond,
+			MaxBackoff:        5 * time.Second,
+		},
+	},
+	OTLPFile: otel.FileConfig{
+		Signals:    []string{"traces", "metrics"},
+		MaxSizeMB:  100,
+		MaxBackups: 5,
+	},
+	StatsD: statsd.Config{
+		Flavor:        statsd.FlavorStatsD,
+		MaxPacketSize: 1432,
+		Instrumentations: []string{
+			instrumentations.InstrumentationALL,
+		},
 	},
 	Printer:      false, // Deprecated: use TracePrinter instead
 	TracePrinter: debug.TracePrinterDisabled,
@@ -146,10 +187,17 @@ type Config struct {
 	NameResolver *transform.NameResolverConfig `yaml:"name_resolver"`
 	Metrics      otel.MetricsConfig            `yaml:"otel_metrics_export"`
 	Traces       otel.TracesConfig             `yaml:"otel_traces_export"`
+	OTLPFile     otel.FileConfig               `yaml:"otlp_file_export"`
+	Zipkin       zipkin.TracesConfig           `yaml:"zipkin_export"`
+	AccessLog    accesslog.Config              `yaml:"access_log"`
 	Prometheus   prom.PrometheusConfig         `yaml:"prometheus_export"`
+	StatsD       statsd.Config                 `yaml:"statsd_export"`
 	Printer      debug.PrintEnabled            `yaml:"print_traces" env:"BEYLA_PRINT_TRACES"`
 	TracePrinter debug.TracePrinter            `yaml:"trace_printer" env:"BEYLA_TRACE_PRINTER"`
 
+	// Redact scrubs sensitive values from the spans before they are forwarded to the exporters.
+	Redact transform.RedactConfig `yaml:"redact"`
+
 	// Exec allows selecting the instrumented executable whose complete path contains the Exec value.
 	Exec       services.RegexpAttr `yaml:"executable_name" env:"BEYLA_EXECUTABLE_NAME"`
 	ExecOtelGo services.RegexpAttr `env:"OTEL_GO_AUTO_TARGET_EXE"`
@@ -193,14 +241,25 @@ type Consumer interface {
 	otelconsumer.Traces
 }
 
+type MetricsConsumer interface {
+	otelconsumer.Metrics
+}
+
 type TracesReceiverConfig struct {
 	Traces []Consumer
+	// Metrics consumers receive the application and process metrics, according to
+	// the features and instrumentations of the otel_metrics_export section
+	Metrics []MetricsConsumer
 }
 
 func (t TracesReceiverConfig) Enabled() bool {
 	return len(t.Traces) > 0
 }
 
+func (t TracesReceiverConfig) MetricsEnabled() bool {
+	return len(t.Metrics) > 0
+}
+
 // Attributes configures the decoration of some extra attributes that will be
 // added to each span
 type Attributes struct {
@@ -252,6 +311,48 @@ func (c *Config) Validate() error {
 			" purposes, you can also set BEYLA_NETWORK_PRINT_FLOWS=true")
 	}
 
+	if c.Routes != nil {
+		if err := c.Routes.Validate(); err != nil {
+			return ConfigError(fmt.Sprintf("error in routes section: %s", err.Error()))
+		}
+	}
+
+	if err := c.Redact.Validate(); err != nil {
+		return ConfigError(fmt.Sprintf("error in redact section: %s", err.Error()))
+	}
+
+	if err := c.Traces.Routing.Validate(); err != nil {
+		return ConfigError(fmt.Sprintf("error in otel_traces_export routing: %s", err.Error()))
+	}
+
+	if err := c.Traces.TailSampling.Validate(); err != nil {
+		return ConfigError(fmt.Sprintf("error in otel_traces_export tail_sampling: %s", err.Error()))
+	}
+
+	if err := c.Metrics.Routing.Validate(); err != nil {
+		return ConfigError(fmt.Sprintf("error in otel_metrics_export routing: %s", err.Error()))
+	}
+
+	if err := c.OTLPFile.Validate(); err != nil {
+		return ConfigError(err.Error())
+	}
+
+	if err := c.Zipkin.Validate(); err != nil {
+		return ConfigError(err.Error())
+	}
+
+	if err := c.AccessLog.Validate(); err != nil {
+		return ConfigError(err.Error())
+	}
+
+	if err := c.Prometheus.RemoteWrite.Validate(); err != nil {
+		return ConfigError(err.Error())
+	}
+
+	if err := c.StatsD.Validate(); err != nil {
+		return ConfigError(err.Error())
+	}
+
 	if !c.TracePrinter.Valid() {
 		return ConfigError(fmt.Sprintf("invalid value for trace_printer: '%s'", c.TracePrinter))
 	}
@@ -269,10 +370,10 @@ func (c *Config) Validate() error {
 
 	if c.Enabled(FeatureAppO11y) && !c.Printer.Enabled() &&
 		!c.Grafana.OTLP.MetricsEnabled() && !c.Grafana.OTLP.TracesEnabled() &&
-		!c.Metrics.Enabled() && !c.Traces.Enabled() &&
-		!c.Prometheus.Enabled() && !c.TracePrinter.Enabled() {
+		!c.Metrics.Enabled() && !c.Traces.Enabled() && !c.OTLPFile.Enabled() && !c.Zipkin.Enabled() &&
+		!c.AccessLog.Enabled() && !c.Prometheus.Enabled() && !c.StatsD.Enabled() && !c.TracePrinter.Enabled() {
 		return ConfigError("you need to define at least one exporter: trace_printer," +
-			" grafana, otel_metrics_export, otel_traces_export or prometheus_export")
+			" grafana, otel_metrics_export, otel_traces_export, otlp_file_export, zipkin_export, access_log, prometheus_export or statsd_export")
 	}
 
 	return nil
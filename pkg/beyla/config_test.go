@@ -14,11 +14,14 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/grafana/beyla/pkg/export/accesslog"
 	"github.com/grafana/beyla/pkg/export/attributes"
 	"github.com/grafana/beyla/pkg/export/debug"
 	"github.com/grafana/beyla/pkg/export/instrumentations"
 	"github.com/grafana/beyla/pkg/export/otel"
 	"github.com/grafana/beyla/pkg/export/prom"
+	"github.com/grafana/beyla/pkg/export/statsd"
+	"github.com/grafana/beyla/pkg/export/zipkin"
 	ebpfcommon "github.com/grafana/beyla/pkg/internal/ebpf/common"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
 	"github.com/grafana/beyla/pkg/internal/infraolly/process"
@@ -137,8 +140,9 @@ network:
 			Instrumentations: []string{
 				instrumentations.InstrumentationALL,
 			},
-			HistogramAggregation: "base2_exponential_bucket_histogram",
-			TTL:                  defaultMetricsTTL,
+			HistogramAggregation:  "base2_exponential_bucket_histogram",
+			TemporalityPreference: otel.TemporalityCumulative,
+			TTL:                   defaultMetricsTTL,
 		},
 		Traces: otel.TracesConfig{
 			Protocol:           otel.ProtocolUnset,
@@ -150,6 +154,22 @@ network:
 			Instrumentations: []string{
 				instrumentations.InstrumentationALL,
 			},
+			TailSampling: otel.TailSamplingConfig{
+				DecisionWait:      5 * time.Second,
+				MaxSpans:          100_000,
+				DecisionsCacheLen: 100_000,
+			},
+		},
+		Zipkin: zipkin.TracesConfig{
+			Encoding: zipkin.EncodingJSON,
+			Timeout:  10 * time.Second,
+		},
+		AccessLog: accesslog.Config{
+			Format: accesslog.FormatJSON,
+			File: accesslog.FileConfig{
+				MaxSizeMB:  100,
+				MaxBackups: 5,
+			},
 		},
 		Prometheus: prom.PrometheusConfig{
 			Path:     "/metrics",
@@ -159,10 +179,31 @@ network:
 			},
 			TTL:                         time.Second,
 			SpanMetricsServiceCacheSize: 10000,
+			RemoteWrite: prom.RemoteWriteConfig{
+				Interval:          15 * time.Second,
+				Timeout:           10 * time.Second,
+				MaxSamplesPerSend: 2000,
+				QueueCapacity:     50,
+				MaxRetries:        3,
+				MinBackoff:        30 * time.Millisecond,
+				MaxBackoff:        5 * time.Second,
+			},
 			Buckets: otel.Buckets{
 				DurationHistogram:    otel.DefaultBuckets.DurationHistogram,
 				RequestSizeHistogram: []float64{0, 10, 20, 22},
 			}},
+		OTLPFile: otel.FileConfig{
+			Signals:    []string{"traces", "metrics"},
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+		},
+		StatsD: statsd.Config{
+			Flavor:        statsd.FlavorStatsD,
+			MaxPacketSize: 1432,
+			Instrumentations: []string{
+				instrumentations.InstrumentationALL,
+			},
+		},
 		InternalMetrics: imetrics.Config{
 			Prometheus: imetrics.PrometheusConfig{
 				Port: 3210,
@@ -328,7 +369,7 @@ func TestConfigValidate_TracePrinter(t *testing.T) {
 		},
 		{
 			env:      envMap{"BEYLA_EXECUTABLE_NAME": "foo"},
-			errorMsg: "you need to define at least one exporter: trace_printer, grafana, otel_metrics_export, otel_traces_export or prometheus_export",
+			errorMsg: "you need to define at least one exporter: trace_printer, grafana, otel_metrics_export, otel_traces_export, otlp_file_export, zipkin_export, access_log, prometheus_export or statsd_export",
 		},
 	}
 
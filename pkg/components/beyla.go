@@ -146,7 +146,7 @@ func attributeGroups(config *beyla.Config, ctxInfo *global.ContextInfo) {
 	if ctxInfo.K8sInformer.IsKubeEnabled() {
 		ctxInfo.MetricAttributeGroups.Add(attributes.GroupKubernetes)
 	}
-	if config.Routes != nil {
+	if config.Routes != nil || config.Discovery.Services.HasRoutes() {
 		ctxInfo.MetricAttributeGroups.Add(attributes.GroupHTTPRoutes)
 	}
 	if config.Metrics.ReportPeerInfo || config.Prometheus.ReportPeerInfo {
@@ -0,0 +1,194 @@
+// Package accesslog provides an export node that writes an access log entry for each HTTP and gRPC
+// request that is received by the instrumented services.
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/mariomac/pipes/pipe"
+
+	"github.com/grafana/beyla/pkg/export/otel"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/rotate"
+)
+
+func alog() *slog.Logger {
+	return slog.With("component", "accesslog.Exporter")
+}
+
+// Output of the access log entries
+type Output string
+
+const (
+	OutputDisabled = Output("")
+	OutputStdout   = Output("stdout")
+	OutputFile     = Output("file")
+	OutputOTLP     = Output("otlp")
+)
+
+// Format of each access log entry
+type Format string
+
+const (
+	FormatCombined = Format("combined")
+	FormatJSON     = Format("json")
+	FormatLogfmt   = Format("logfmt")
+)
+
+type Config struct {
+	// Output of the access log: stdout, file or otlp. If empty, the access log is disabled.
+	Output Output `yaml:"output" env:"BEYLA_ACCESS_LOG_OUTPUT"`
+
+	// Format of each entry: combined (Apache combined log format), json or logfmt
+	Format Format `yaml:"format" env:"BEYLA_ACCESS_LOG_FORMAT"`
+
+	File FileConfig `yaml:"file"`
+	OTLP OTLPConfig `yaml:"otlp"`
+}
+
+type FileConfig struct {
+	// Path of the access log file, when the output is "file"
+	Path string `yaml:"path" env:"BEYLA_ACCESS_LOG_FILE_PATH"`
+	// MaxSizeMB is the size, in megabytes, that the file reaches before being rotated
+	MaxSizeMB int `yaml:"max_size_mb" env:"BEYLA_ACCESS_LOG_FILE_MAX_SIZE_MB"`
+	// MaxBackups is the number of rotated files that are kept
+	MaxBackups int `yaml:"max_backups" env:"BEYLA_ACCESS_LOG_FILE_MAX_BACKUPS"`
+}
+
+type OTLPConfig struct {
+	// Endpoint of the OTLP logs receiver, e.g. http://otelcol:4318
+	Endpoint string `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"`
+	// Protocol of the OTLP logs receiver: http/protobuf (default) or grpc
+	Protocol otel.Protocol `yaml:"protocol" env:"OTEL_EXPORTER_OTLP_LOGS_PROTOCOL"`
+	// Headers that are added to each export request
+	Headers map[string]string `yaml:"headers" env:"BEYLA_ACCESS_LOG_OTLP_HEADERS"`
+	// InsecureSkipVerify skips the verification of the server certificate
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify" env:"BEYLA_ACCESS_LOG_OTLP_INSECURE_SKIP_VERIFY"`
+}
+
+// Enabled specifies that the access log node is enabled if and only if an output is defined
+func (c *Config) Enabled() bool {
+	return c.Output != OutputDisabled
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	switch c.Format {
+	case FormatCombined, FormatJSON, FormatLogfmt:
+	default:
+		return fmt.Errorf("invalid access log format %q. Accepted values are: %s, %s, %s",
+			c.Format, FormatCombined, FormatJSON, FormatLogfmt)
+	}
+	switch c.Output {
+	case OutputStdout:
+	case OutputFile:
+		if c.File.Path == "" {
+			return fmt.Errorf("access log output is %q but no file path is defined", OutputFile)
+		}
+	case OutputOTLP:
+		if c.OTLP.Endpoint == "" {
+			return fmt.Errorf("access log output is %q but no OTLP logs endpoint is defined", OutputOTLP)
+		}
+		switch c.OTLP.Protocol {
+		case otel.ProtocolUnset, otel.ProtocolHTTPProtobuf, otel.ProtocolGRPC:
+		default:
+			return fmt.Errorf("invalid access log OTLP protocol %q. Accepted values are: %s, %s",
+				c.OTLP.Protocol, otel.ProtocolHTTPProtobuf, otel.ProtocolGRPC)
+		}
+	default:
+		return fmt.Errorf("invalid access log output %q. Accepted values are: %s, %s, %s",
+			c.Output, OutputStdout, OutputFile, OutputOTLP)
+	}
+	return nil
+}
+
+// Exporter creates a terminal node that writes an access log entry for each HTTP and gRPC
+// server span
+func Exporter(ctx context.Context, ctxInfo *global.ContextInfo, cfg *Config) pipe.FinalProvider[[]request.Span] {
+	return (&accessLogger{ctx: ctx, cfg: cfg, hostID: ctxInfo.HostID, stdout: os.Stdout}).provideLoop
+}
+
+type accessLogger struct {
+	ctx    context.Context
+	cfg    *Config
+	hostID string
+	stdout io.Writer
+}
+
+func (e *accessLogger) provideLoop() (pipe.FinalFunc[[]request.Span], error) {
+	if !e.cfg.Enabled() {
+		return pipe.IgnoreFinal[[]request.Span](), nil
+	}
+	if err := e.cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if e.cfg.Output == OutputOTLP {
+		logs, err := newOTLPSender(e.ctx, &e.cfg.OTLP, e.hostID)
+		if err != nil {
+			return nil, fmt.Errorf("instantiating OTLP logs exporter: %w", err)
+		}
+		return func(in <-chan []request.Span) {
+			defer logs.shutdown()
+			e.exportOTLP(in, logs)
+		}, nil
+	}
+	if e.cfg.Output == OutputFile {
+		file := &rotate.File{
+			Path:       e.cfg.File.Path,
+			MaxSize:    int64(e.cfg.File.MaxSizeMB) * 1024 * 1024,
+			MaxBackups: e.cfg.File.MaxBackups,
+		}
+		return func(in <-chan []request.Span) {
+			defer file.Close()
+			e.write(in, file)
+		}, nil
+	}
+	return func(in <-chan []request.Span) {
+		e.write(in, e.stdout)
+	}, nil
+}
+
+// write the entries of each batch with a single write operation
+func (e *accessLogger) write(in <-chan []request.Span, out io.Writer) {
+	log := alog()
+	var buf []byte
+	for spans := range in {
+		buf = buf[:0]
+		for i := range spans {
+			if !logged(&spans[i]) {
+				continue
+			}
+			buf = appendEntry(buf, e.cfg.Format, entryFields(&spans[i]))
+			buf = append(buf, '\n')
+		}
+		if len(buf) == 0 {
+			continue
+		}
+		if _, err := out.Write(buf); err != nil {
+			log.Error("error writing access log", "error", err)
+		}
+	}
+}
+
+func (e *accessLogger) exportOTLP(in <-chan []request.Span, logs *otlpSender) {
+	log := alog()
+	for spans := range in {
+		if err := logs.send(e.ctx, e.cfg.Format, spans); err != nil {
+			log.Error("error submitting access log to the OTLP endpoint", "error", err)
+		}
+	}
+}
+
+// logged returns whether the span must be written in the access log: only HTTP and gRPC
+// server spans whose traces aren't ignored.
+func logged(span *request.Span) bool {
+	return (span.Type == request.EventTypeHTTP || span.Type == request.EventTypeGRPC) &&
+		!span.IgnoreTraces()
+}
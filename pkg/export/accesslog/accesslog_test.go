@@ -0,0 +1,277 @@
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	trace2 "go.opentelemetry.io/otel/trace"
+
+	attr "github.com/grafana/beyla/pkg/export/attributes/names"
+	"github.com/grafana/beyla/pkg/export/otel"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+const timeout = 5 * time.Second
+
+var (
+	traceID, _ = trace2.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _  = trace2.SpanIDFromHex("0102030405060708")
+)
+
+func httpSpan() request.Span {
+	return request.Span{
+		Type:           request.EventTypeHTTP,
+		Method:         "GET",
+		Path:           "/users/1",
+		Route:          "/users/{id}",
+		Status:         404,
+		Peer:           "10.0.0.1",
+		Host:           "10.0.0.2",
+		HostPort:       8080,
+		ContentLength:  12,
+		ResponseLength: 345,
+		RequestStart:   10_000_000,
+		Start:          10_000_000,
+		End:            35_000_000,
+		TraceID:        traceID,
+		SpanID:         spanID,
+		ServiceID: svc.ID{
+			UID:       "svc-1",
+			Name:      "users",
+			Namespace: "shop",
+			Metadata: map[attr.Name]string{
+				attr.K8sPodName:       "users-abcde",
+				attr.K8sNamespaceName: "default",
+			},
+		},
+	}
+}
+
+func TestEntryFields(t *testing.T) {
+	span := httpSpan()
+	fields := entryFields(&span)
+	require.IsType(t, time.Time{}, fields[0].value)
+	assert.Equal(t, []field{
+		{key: "service.name", value: "users", resource: true},
+		{key: "service.namespace", value: "shop", resource: true},
+		{key: "k8s.namespace.name", value: "default", resource: true},
+		{key: "k8s.pod.name", value: "users-abcde", resource: true},
+		{key: "client.address", value: "10.0.0.1"},
+		{key: "server.address", value: "10.0.0.2"},
+		{key: "server.port", value: 8080},
+		{key: "http.request.method", value: "GET"},
+		{key: "url.path", value: "/users/1"},
+		{key: "http.route", value: "/users/{id}"},
+		{key: "http.response.status_code", value: 404},
+		{key: "http.request.body.size", value: 12},
+		{key: "http.response.body.size", value: 345},
+		{key: "duration", value: 0.025},
+		{key: "trace_id", value: "0102030405060708090a0b0c0d0e0f10"},
+		{key: "span_id", value: "0102030405060708"},
+	}, fields[1:])
+
+	// gRPC spans use the RPC attributes, and spans without trace don't include the IDs
+	span = request.Span{Type: request.EventTypeGRPC, Path: "/shop.Users/Get", Status: 5, PeerName: "frontend",
+		ServiceID: svc.ID{Name: "users"}}
+	fields = entryFields(&span)
+	assert.Equal(t, []field{
+		{key: "service.name", value: "users", resource: true},
+		{key: "client.address", value: "frontend"},
+		{key: "server.address", value: ""},
+		{key: "server.port", value: 0},
+		{key: "rpc.system", value: "grpc"},
+		{key: "rpc.method", value: "/shop.Users/Get"},
+		{key: "rpc.grpc.status_code", value: 5},
+		{key: "duration", value: float64(0)},
+	}, fields[1:])
+}
+
+func TestAppendEntry(t *testing.T) {
+	start := time.Date(2024, 10, 5, 13, 55, 36, 123_000_000, time.FixedZone("", -7*3600))
+	httpFields := []field{
+		{key: "time", value: start},
+		{key: "service.name", value: "users", resource: true},
+		{key: "k8s.pod.name", value: "users-abcde", resource: true},
+		{key: "client.address", value: "10.0.0.1"},
+		{key: "http.request.method", value: "GET"},
+		{key: "url.path", value: "/search"},
+		{key: "http.route", value: "/search"},
+		{key: "http.response.status_code", value: 200},
+		{key: "http.response.body.size", value: 2326},
+		{key: "duration", value: 0.025},
+		{key: "user.comment", value: `say "hi" a=b`},
+		{key: "trace_id", value: "0102030405060708090a0b0c0d0e0f10"},
+	}
+	grpcFields := []field{
+		{key: "time", value: start},
+		{key: "client.address", value: ""},
+		{key: "rpc.system", value: "grpc"},
+		{key: "rpc.method", value: "/shop.Users/Get"},
+		{key: "rpc.grpc.status_code", value: 5},
+	}
+	testCases := []struct {
+		format   Format
+		fields   []field
+		expected string
+	}{{
+		format: FormatCombined,
+		fields: httpFields,
+		expected: `10.0.0.1 - - [05/Oct/2024:13:55:36 -0700] "GET /search HTTP/1.1" 200 2326 "-" "-" ` +
+			`service.name=users k8s.pod.name=users-abcde http.route=/search duration=0.025 ` +
+			`user.comment="say \"hi\" a=b" trace_id=0102030405060708090a0b0c0d0e0f10`,
+	}, {
+		format: FormatLogfmt,
+		fields: httpFields,
+		expected: `time=2024-10-05T20:55:36.123Z service.name=users k8s.pod.name=users-abcde client.address=10.0.0.1 ` +
+			`http.request.method=GET url.path=/search http.route=/search http.response.status_code=200 ` +
+			`http.response.body.size=2326 duration=0.025 user.comment="say \"hi\" a=b" trace_id=0102030405060708090a0b0c0d0e0f10`,
+	}, {
+		format: FormatJSON,
+		fields: httpFields,
+		expected: `{"time":"2024-10-05T20:55:36.123Z","service.name":"users","k8s.pod.name":"users-abcde",` +
+			`"client.address":"10.0.0.1","http.request.method":"GET","url.path":"/search","http.route":"/search",` +
+			`"http.response.status_code":200,"http.response.body.size":2326,"duration":0.025,` +
+			`"user.comment":"say \"hi\" a=b","trace_id":"0102030405060708090a0b0c0d0e0f10"}`,
+	}, {
+		format: FormatCombined,
+		fields: grpcFields,
+		expected: `- - - [05/Oct/2024:13:55:36 -0700] "POST /shop.Users/Get HTTP/2.0" 200 - "-" "-" ` +
+			`rpc.system=grpc rpc.grpc.status_code=5`,
+	}, {
+		format:   FormatLogfmt,
+		fields:   grpcFields,
+		expected: `time=2024-10-05T20:55:36.123Z client.address="" rpc.system=grpc rpc.method=/shop.Users/Get rpc.grpc.status_code=5`,
+	}}
+	for _, tc := range testCases {
+		t.Run(string(tc.format), func(t *testing.T) {
+			assert.Equal(t, tc.expected, string(appendEntry(nil, tc.format, tc.fields)))
+		})
+	}
+	// the JSON output is valid
+	entry := map[string]any{}
+	require.NoError(t, json.Unmarshal(appendEntry(nil, FormatJSON, httpFields), &entry))
+	assert.Equal(t, `say "hi" a=b`, entry["user.comment"])
+}
+
+func runExporter(t *testing.T, cfg *Config, out io.Writer, batches ...[]request.Span) {
+	t.Helper()
+	exporter := &accessLogger{ctx: context.Background(), cfg: cfg, hostID: "host-id", stdout: out}
+	node, err := exporter.provideLoop()
+	require.NoError(t, err)
+	in := make(chan []request.Span, len(batches))
+	for _, b := range batches {
+		in <- b
+	}
+	close(in)
+	// the node returns after processing all the batches
+	node(in)
+}
+
+func TestExporter_Stdout(t *testing.T) {
+	out := &bytes.Buffer{}
+	ignored := httpSpan()
+	ignored.SetIgnoreTraces()
+	runExporter(t, &Config{Output: OutputStdout, Format: FormatLogfmt}, out,
+		[]request.Span{httpSpan(), {Type: request.EventTypeSQLClient}, ignored},
+		[]request.Span{{Type: request.EventTypeGRPC, Path: "/shop.Users/Get"}},
+	)
+	// only the HTTP and gRPC server spans are logged
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], " url.path=/users/1 ")
+	assert.Contains(t, lines[1], " rpc.method=/shop.Users/Get ")
+}
+
+func TestExporter_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	runExporter(t, &Config{Output: OutputFile, Format: FormatCombined, File: FileConfig{Path: path}}, nil,
+		[]request.Span{httpSpan()},
+		[]request.Span{httpSpan()},
+	)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	assert.Regexp(t, `^10\.0\.0\.1 - - \[.+\] "GET /users/1 HTTP/1\.1" 404 345 "-" "-" service\.name=users `, lines[0])
+}
+
+func TestExporter_OTLP(t *testing.T) {
+	requests := make(chan plogotlp.ExportRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/v1/logs", req.URL.Path)
+		assert.Equal(t, "tenant-1", req.Header.Get("X-Scope-OrgID"))
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		er := plogotlp.NewExportRequest()
+		require.NoError(t, er.UnmarshalProto(body))
+		requests <- er
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	span := httpSpan()
+	runExporter(t, &Config{Output: OutputOTLP, Format: FormatJSON, OTLP: OTLPConfig{
+		Endpoint: srv.URL,
+		Protocol: otel.ProtocolHTTPProtobuf,
+		Headers:  map[string]string{"X-Scope-OrgID": "tenant-1"},
+	}}, nil, []request.Span{span, {Type: request.EventTypeSQLClient}})
+
+	var er plogotlp.ExportRequest
+	select {
+	case er = <-requests:
+	case <-time.After(timeout):
+		require.Fail(t, "timeout while waiting for logs")
+	}
+	logs := er.Logs()
+	require.Equal(t, 1, logs.LogRecordCount())
+	rl := logs.ResourceLogs().At(0)
+	res := rl.Resource().Attributes().AsRaw()
+	assert.Equal(t, "users", res["service.name"])
+	assert.Equal(t, "shop", res["service.namespace"])
+	assert.Equal(t, "users-abcde", res["k8s.pod.name"])
+	assert.Equal(t, "host-id", res["host.id"])
+
+	record := rl.ScopeLogs().At(0).LogRecords().At(0)
+	assert.Equal(t, plog.SeverityNumberInfo, record.SeverityNumber())
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", record.TraceID().String())
+	assert.Equal(t, "0102030405060708", record.SpanID().String())
+	assert.NotZero(t, record.Timestamp())
+	attrs := record.Attributes().AsRaw()
+	assert.Equal(t, "/users/{id}", attrs["http.route"])
+	assert.EqualValues(t, 404, attrs["http.response.status_code"])
+	assert.NotContains(t, attrs, "service.name")
+	assert.NotContains(t, attrs, "trace_id")
+
+	entry := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(record.Body().Str()), &entry))
+	assert.Equal(t, "/users/1", entry["url.path"])
+	assert.Equal(t, "users", entry["service.name"])
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&Config{}).Validate())
+	assert.NoError(t, (&Config{Output: OutputStdout, Format: FormatCombined}).Validate())
+	assert.NoError(t, (&Config{Output: OutputFile, Format: FormatJSON, File: FileConfig{Path: "/var/log/access.log"}}).Validate())
+	assert.NoError(t, (&Config{Output: OutputOTLP, Format: FormatLogfmt, OTLP: OTLPConfig{Endpoint: "http://otelcol:4318"}}).Validate())
+
+	assert.Error(t, (&Config{Output: "syslog", Format: FormatJSON}).Validate())
+	assert.Error(t, (&Config{Output: OutputStdout, Format: "xml"}).Validate())
+	assert.Error(t, (&Config{Output: OutputFile, Format: FormatJSON}).Validate())
+	assert.Error(t, (&Config{Output: OutputOTLP, Format: FormatJSON}).Validate())
+	assert.Error(t, (&Config{Output: OutputOTLP, Format: FormatJSON,
+		OTLP: OTLPConfig{Endpoint: "http://otelcol:4318", Protocol: otel.ProtocolHTTPJSON}}).Validate())
+}
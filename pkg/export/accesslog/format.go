@@ -0,0 +1,240 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	attr "github.com/grafana/beyla/pkg/export/attributes/names"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+const combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// field of an access log entry. The value is a string, an int, a float64 or a time.Time
+type field struct {
+	key   string
+	value any
+	// resource is true for the fields that describe the service instead of the request
+	resource bool
+}
+
+const (
+	keyTime         = "time"
+	keyClientAddr   = "client.address"
+	keyMethod       = "http.request.method"
+	keyPath         = "url.path"
+	keyStatus       = "http.response.status_code"
+	keyResponseSize = "http.response.body.size"
+	keyRPCMethod    = "rpc.method"
+	keyRPCSystem    = "rpc.system"
+	keyRPCStatus    = "rpc.grpc.status_code"
+	keyDuration     = "duration"
+	keyTraceID      = "trace_id"
+	keySpanID       = "span_id"
+	keyServiceName  = "service.name"
+	keyServiceNS    = "service.namespace"
+	keyServerAddr   = "server.address"
+	keyServerPort   = "server.port"
+	keyRoute        = "http.route"
+	keyRequestSize  = "http.request.body.size"
+)
+
+// the fields that are part of the Apache combined log format, so they aren't
+// appended at the end of the line
+var combinedKeys = map[string]struct{}{
+	keyTime: {}, keyClientAddr: {}, keyMethod: {}, keyPath: {}, keyStatus: {}, keyResponseSize: {}, keyRPCMethod: {},
+}
+
+// entryFields returns the fields of the access log entry of a span, in the order they are written.
+// The field names follow the OpenTelemetry semantic conventions
+func entryFields(span *request.Span) []field {
+	t := span.Timings()
+	fields := []field{
+		{key: keyTime, value: t.RequestStart},
+		{key: keyServiceName, value: span.ServiceID.Name, resource: true},
+	}
+	if span.ServiceID.Namespace != "" {
+		fields = append(fields, field{key: keyServiceNS, value: span.ServiceID.Namespace, resource: true})
+	}
+	// Kubernetes metadata, if any
+	metadata := make([]attr.Name, 0, len(span.ServiceID.Metadata))
+	for k := range span.ServiceID.Metadata {
+		metadata = append(metadata, k)
+	}
+	slices.Sort(metadata)
+	for _, k := range metadata {
+		fields = append(fields, field{key: string(k), value: span.ServiceID.Metadata[k], resource: true})
+	}
+	fields = append(fields,
+		field{key: keyClientAddr, value: request.SpanPeer(span)},
+		field{key: keyServerAddr, value: request.SpanHost(span)},
+		field{key: keyServerPort, value: span.HostPort},
+	)
+	switch span.Type {
+	case request.EventTypeGRPC:
+		fields = append(fields,
+			field{key: keyRPCSystem, value: "grpc"},
+			field{key: keyRPCMethod, value: span.Path},
+			field{key: keyRPCStatus, value: span.Status},
+		)
+	default:
+		fields = append(fields,
+			field{key: keyMethod, value: span.Method},
+			field{key: keyPath, value: span.Path},
+		)
+		if span.Route != "" {
+			fields = append(fields, field{key: keyRoute, value: span.Route})
+		}
+		fields = append(fields,
+			field{key: keyStatus, value: span.Status},
+			field{key: keyRequestSize, value: int(span.RequestLength())},
+			field{key: keyResponseSize, value: int(max(span.ResponseLength, 0))},
+		)
+	}
+	fields = append(fields, field{key: keyDuration, value: t.End.Sub(t.RequestStart).Seconds()})
+	if trace.TraceID(span.TraceID).IsValid() {
+		fields = append(fields,
+			field{key: keyTraceID, value: trace.TraceID(span.TraceID).String()},
+			field{key: keySpanID, value: trace.SpanID(span.SpanID).String()},
+		)
+	}
+	return fields
+}
+
+func appendEntry(dst []byte, format Format, fields []field) []byte {
+	switch format {
+	case FormatCombined:
+		return appendCombined(dst, fields)
+	case FormatLogfmt:
+		return appendLogfmt(dst, fields)
+	default:
+		return appendJSON(dst, fields)
+	}
+}
+
+// appendCombined follows the Apache combined log format:
+// client - - [time] "method path protocol" status response_size "referer" "user_agent"
+// Beyla doesn't know the referer and the user agent, so they are written as "-".
+// The rest of fields are appended at the end of the line, in logfmt format.
+// gRPC requests are written as POST HTTP/2.0 requests with a 200 status, as they would be seen
+// by an HTTP server, and the actual gRPC status is appended as an extra field.
+func appendCombined(dst []byte, fields []field) []byte {
+	var start time.Time
+	client, method, path, protocol := "-", "-", "-", "HTTP/1.1"
+	status, size := 0, 0
+	var extra []field
+	for _, f := range fields {
+		switch f.key {
+		case keyTime:
+			start = f.value.(time.Time)
+		case keyClientAddr:
+			if s := f.value.(string); s != "" {
+				client = s
+			}
+		case keyMethod:
+			method = f.value.(string)
+		case keyPath:
+			path = f.value.(string)
+		case keyRPCMethod:
+			method, path, protocol, status = "POST", f.value.(string), "HTTP/2.0", 200
+		case keyStatus:
+			status = f.value.(int)
+		case keyResponseSize:
+			size = f.value.(int)
+		}
+		if _, ok := combinedKeys[f.key]; !ok {
+			extra = append(extra, f)
+		}
+	}
+	dst = append(dst, client...)
+	dst = append(dst, " - - ["...)
+	dst = start.AppendFormat(dst, combinedTimeLayout)
+	dst = append(dst, `] "`...)
+	dst = append(dst, method...)
+	dst = append(dst, ' ')
+	dst = append(dst, path...)
+	dst = append(dst, ' ')
+	dst = append(dst, protocol...)
+	dst = append(dst, `" `...)
+	dst = strconv.AppendInt(dst, int64(status), 10)
+	dst = append(dst, ' ')
+	if size > 0 {
+		dst = strconv.AppendInt(dst, int64(size), 10)
+	} else {
+		dst = append(dst, '-')
+	}
+	dst = append(dst, ` "-" "-"`...)
+	if len(extra) > 0 {
+		dst = append(dst, ' ')
+		dst = appendLogfmt(dst, extra)
+	}
+	return dst
+}
+
+func appendLogfmt(dst []byte, fields []field) []byte {
+	for i, f := range fields {
+		if i > 0 {
+			dst = append(dst, ' ')
+		}
+		dst = append(dst, f.key...)
+		dst = append(dst, '=')
+		switch v := f.value.(type) {
+		case string:
+			if v == "" || strings.ContainsAny(v, " \"=\\") || !strconv.CanBackquote(v) {
+				dst = strconv.AppendQuote(dst, v)
+			} else {
+				dst = append(dst, v...)
+			}
+		default:
+			dst = appendValue(dst, v)
+		}
+	}
+	return dst
+}
+
+func appendJSON(dst []byte, fields []field) []byte {
+	dst = append(dst, '{')
+	for i, f := range fields {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, f.key)
+		dst = append(dst, ':')
+		switch v := f.value.(type) {
+		case string:
+			dst = appendJSONString(dst, v)
+		case time.Time:
+			dst = append(dst, '"')
+			dst = appendValue(dst, v)
+			dst = append(dst, '"')
+		default:
+			dst = appendValue(dst, v)
+		}
+	}
+	return append(dst, '}')
+}
+
+func appendValue(dst []byte, value any) []byte {
+	switch v := value.(type) {
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10)
+	case float64:
+		return strconv.AppendFloat(dst, v, 'f', -1, 64)
+	case time.Time:
+		return v.UTC().AppendFormat(dst, time.RFC3339Nano)
+	case string:
+		return append(dst, v...)
+	}
+	return dst
+}
+
+func appendJSONString(dst []byte, s string) []byte {
+	// json.Marshal can't fail for strings
+	b, _ := json.Marshal(s)
+	return append(dst, b...)
+}
@@ -0,0 +1,168 @@
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configgrpc"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configtelemetry"
+	"go.opentelemetry.io/collector/config/configtls"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/otlpexporter"
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/otel/sdk/metric"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+
+	"github.com/grafana/beyla/pkg/export/otel"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+const scopeName = "github.com/grafana/beyla/accesslog"
+
+// otlpSender submits the access log entries as OTLP log records. Each record contains the
+// access log line in its body, and the entry fields as attributes.
+type otlpSender struct {
+	exporter exporter.Logs
+	hostID   string
+}
+
+func newOTLPSender(ctx context.Context, cfg *OTLPConfig, hostID string) (*otlpSender, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing OTLP logs endpoint %q: %w", cfg.Endpoint, err)
+	}
+	headers := make(map[string]configopaque.String, len(cfg.Headers))
+	for k, v := range cfg.Headers {
+		headers[k] = configopaque.String(v)
+	}
+	tls := configtls.ClientConfig{
+		Insecure:           endpoint.Scheme == "http",
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	set := exporter.Settings{
+		ID: component.NewIDWithName(component.DataTypeLogs, "accesslog"),
+		TelemetrySettings: component.TelemetrySettings{
+			Logger:         zap.NewNop(),
+			MeterProvider:  metric.NewMeterProvider(),
+			TracerProvider: tracenoop.NewTracerProvider(),
+			MetricsLevel:   configtelemetry.LevelNone,
+		},
+	}
+	var exp exporter.Logs
+	switch cfg.Protocol {
+	case otel.ProtocolGRPC:
+		factory := otlpexporter.NewFactory()
+		config := factory.CreateDefaultConfig().(*otlpexporter.Config)
+		config.QueueConfig.Enabled = false
+		config.ClientConfig = configgrpc.ClientConfig{
+			Endpoint:   endpoint.Host,
+			TLSSetting: tls,
+			Headers:    headers,
+		}
+		exp, err = factory.CreateLogsExporter(ctx, set, config)
+	default:
+		factory := otlphttpexporter.NewFactory()
+		config := factory.CreateDefaultConfig().(*otlphttpexporter.Config)
+		config.QueueConfig.Enabled = false
+		config.LogsEndpoint = logsURL(endpoint)
+		config.ClientConfig = confighttp.ClientConfig{
+			Endpoint:   cfg.Endpoint,
+			TLSSetting: tls,
+			Headers:    headers,
+		}
+		exp, err = factory.CreateLogsExporter(ctx, set, config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := exp.Start(ctx, nil); err != nil {
+		return nil, fmt.Errorf("starting OTLP logs exporter: %w", err)
+	}
+	return &otlpSender{exporter: exp, hostID: hostID}, nil
+}
+
+// logsURL appends the default /v1/logs path if the endpoint doesn't specify any
+func logsURL(endpoint *url.URL) string {
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		u := *endpoint
+		u.Path = "/v1/logs"
+		return u.String()
+	}
+	return endpoint.String()
+}
+
+func (s *otlpSender) send(ctx context.Context, format Format, spans []request.Span) error {
+	logs := plog.NewLogs()
+	// the records of the same service are grouped under the same resource
+	scopes := map[svc.UID]plog.ScopeLogs{}
+	now := pcommon.NewTimestampFromTime(time.Now())
+	var line []byte
+	for i := range spans {
+		span := &spans[i]
+		if !logged(span) {
+			continue
+		}
+		scope, ok := scopes[span.ServiceID.UID]
+		if !ok {
+			rl := logs.ResourceLogs().AppendEmpty()
+			attrs := rl.Resource().Attributes()
+			for _, kv := range otel.AppResourceAttrs(s.hostID, &span.ServiceID) {
+				attrs.PutStr(string(kv.Key), kv.Value.Emit())
+			}
+			scope = rl.ScopeLogs().AppendEmpty()
+			scope.Scope().SetName(scopeName)
+			scopes[span.ServiceID.UID] = scope
+		}
+		fields := entryFields(span)
+		line = appendEntry(line[:0], format, fields)
+		record := scope.LogRecords().AppendEmpty()
+		record.SetObservedTimestamp(now)
+		record.SetSeverityNumber(plog.SeverityNumberInfo)
+		record.SetSeverityText(plog.SeverityNumberInfo.String())
+		record.Body().SetStr(string(line))
+		record.SetTraceID(pcommon.TraceID(span.TraceID))
+		record.SetSpanID(pcommon.SpanID(span.SpanID))
+		setRecordAttributes(record, fields)
+	}
+	if logs.LogRecordCount() == 0 {
+		return nil
+	}
+	return s.exporter.ConsumeLogs(ctx, logs)
+}
+
+// setRecordAttributes copies the entry fields into the record. The time is stored as the
+// record timestamp, the trace and span IDs in their own record fields, and the service
+// fields are already part of the resource.
+func setRecordAttributes(record plog.LogRecord, fields []field) {
+	attrs := record.Attributes()
+	for _, f := range fields {
+		if f.resource || f.key == keyTraceID || f.key == keySpanID {
+			continue
+		}
+		switch v := f.value.(type) {
+		case time.Time:
+			record.SetTimestamp(pcommon.NewTimestampFromTime(v))
+		case string:
+			attrs.PutStr(f.key, v)
+		case int:
+			attrs.PutInt(f.key, int64(v))
+		case float64:
+			attrs.PutDouble(f.key, v)
+		}
+	}
+}
+
+func (s *otlpSender) shutdown() {
+	if err := s.exporter.Shutdown(context.Background()); err != nil {
+		alog().Warn("error shutting down OTLP logs exporter", "error", err)
+	}
+}
@@ -0,0 +1,46 @@
+package alloy
+
+import (
+	"context"
+
+	"github.com/mariomac/pipes/pipe"
+	"go.opentelemetry.io/collector/consumer"
+
+	"github.com/grafana/beyla/pkg/beyla"
+	"github.com/grafana/beyla/pkg/export/attributes"
+	"github.com/grafana/beyla/pkg/export/otel"
+	"github.com/grafana/beyla/pkg/internal/infraolly/process"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// MetricsReceiver creates a terminal node that consumes request.Spans and sends the OpenTelemetry application
+// metrics to the configured consumers. The metrics are generated according to the OTEL metrics configuration
+// (features, instrumentations, interval, buckets...), even if no OTLP endpoint is defined.
+func MetricsReceiver(
+	ctx context.Context,
+	ctxInfo *global.ContextInfo,
+	cfg *beyla.TracesReceiverConfig,
+	metricsCfg *otel.MetricsConfig,
+	userAttribSelection attributes.Selection,
+) pipe.FinalProvider[[]request.Span] {
+	return otel.ConsumerMetricsReporter(ctx, ctxInfo, metricsCfg, userAttribSelection, metricsConsumers(cfg))
+}
+
+// ProcMetricsReceiver creates a terminal node that sends the OpenTelemetry process metrics to the configured consumers.
+func ProcMetricsReceiver(
+	ctx context.Context,
+	ctxInfo *global.ContextInfo,
+	cfg *beyla.TracesReceiverConfig,
+	procCfg *otel.ProcMetricsConfig,
+) pipe.FinalProvider[[]*process.Status] {
+	return otel.ConsumerProcMetricsProvider(ctx, ctxInfo, procCfg, metricsConsumers(cfg))
+}
+
+func metricsConsumers(cfg *beyla.TracesReceiverConfig) []consumer.Metrics {
+	consumers := make([]consumer.Metrics, 0, len(cfg.Metrics))
+	for _, mc := range cfg.Metrics {
+		consumers = append(consumers, mc)
+	}
+	return consumers
+}
@@ -0,0 +1,109 @@
+package alloy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mariomac/guara/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/grafana/beyla/pkg/beyla"
+	"github.com/grafana/beyla/pkg/export/attributes"
+	"github.com/grafana/beyla/pkg/export/instrumentations"
+	"github.com/grafana/beyla/pkg/export/otel"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func TestMetricsReceiver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sink := &metricsSink{}
+	mc, err := consumer.NewMetrics(sink.consume)
+	require.NoError(t, err)
+
+	exporter, err := MetricsReceiver(ctx, &global.ContextInfo{},
+		&beyla.TracesReceiverConfig{Metrics: []beyla.MetricsConsumer{mc}},
+		&otel.MetricsConfig{
+			Interval:             10 * time.Millisecond,
+			Features:             []string{otel.FeatureApplication},
+			Instrumentations:     []string{instrumentations.InstrumentationALL},
+			Buckets:              otel.DefaultBuckets,
+			HistogramAggregation: otel.AggregationExplicit,
+			ReportersCacheLen:    10,
+			TTL:                  time.Minute,
+		}, attributes.Selection{})()
+	require.NoError(t, err)
+
+	spans := make(chan []request.Span, 10)
+	defer close(spans)
+	go exporter(spans)
+	spans <- []request.Span{
+		{Type: request.EventTypeHTTP, Method: "GET", Status: 200, ServiceID: svc.ID{Name: "svc", UID: "svc-1"},
+			End: 2 * time.Second.Nanoseconds()},
+	}
+
+	test.Eventually(t, 5*time.Second, func(t require.TestingT) {
+		names := sink.metricNames("svc")
+		assert.Contains(t, names, attributes.HTTPServerDuration.OTEL)
+	}, test.Interval(10*time.Millisecond))
+}
+
+func TestMetricsReceiver_Disabled(t *testing.T) {
+	metricsCfg := &otel.MetricsConfig{Features: []string{otel.FeatureApplication}}
+	// no consumers
+	exporter, err := MetricsReceiver(context.Background(), &global.ContextInfo{},
+		&beyla.TracesReceiverConfig{}, metricsCfg, attributes.Selection{})()
+	require.NoError(t, err)
+	assert.Nil(t, exporter)
+
+	// no application metrics features
+	mc, err := consumer.NewMetrics((&metricsSink{}).consume)
+	require.NoError(t, err)
+	metricsCfg.Features = []string{otel.FeatureNetwork}
+	exporter, err = MetricsReceiver(context.Background(), &global.ContextInfo{},
+		&beyla.TracesReceiverConfig{Metrics: []beyla.MetricsConsumer{mc}}, metricsCfg, attributes.Selection{})()
+	require.NoError(t, err)
+	assert.Nil(t, exporter)
+}
+
+type metricsSink struct {
+	mt      sync.Mutex
+	metrics []pmetric.Metrics
+}
+
+func (ms *metricsSink) consume(_ context.Context, md pmetric.Metrics) error {
+	ms.mt.Lock()
+	defer ms.mt.Unlock()
+	ms.metrics = append(ms.metrics, md)
+	return nil
+}
+
+// metricNames returns the names of the received metrics for the given service name
+func (ms *metricsSink) metricNames(serviceName string) []string {
+	ms.mt.Lock()
+	defer ms.mt.Unlock()
+	var names []string
+	for _, md := range ms.metrics {
+		for i := 0; i < md.ResourceMetrics().Len(); i++ {
+			rm := md.ResourceMetrics().At(i)
+			if sn, ok := rm.Resource().Attributes().Get("service.name"); !ok || sn.Str() != serviceName {
+				continue
+			}
+			for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+				sm := rm.ScopeMetrics().At(j).Metrics()
+				for k := 0; k < sm.Len(); k++ {
+					names = append(names, sm.At(k).Name())
+				}
+			}
+		}
+	}
+	return names
+}
@@ -153,6 +153,8 @@ func getDefinitions(groups AttrGroups) map[Section]AttrReportGroup {
 			attr.HTTPResponseStatusCode: true,
 			attr.HTTPUrlPath:            false,
 		},
+		// captured HTTP request headers
+		Prefixes: []string{attr.HTTPRequestHeaderPrefix},
 	}
 
 	// TODO: populate it with host resource attributes in https://opentelemetry.io/docs/specs/semconv/resource/host/
@@ -250,8 +252,17 @@ func getDefinitions(groups AttrGroups) map[Section]AttrReportGroup {
 				attr.DBOperation: true,
 				attr.DBSystem:    true,
 				attr.ErrorType:   true,
+				attr.DBNamespace: false,
+				// hit or miss of cache lookups
+				attr.CacheOutcome: false,
 			},
 		},
+		TCPClientDuration.Section: {
+			SubGroups: []*AttrReportGroup{&appAttributes, &appKubeAttributes, &httpClientInfo},
+		},
+		TCPServerDuration.Section: {
+			SubGroups: []*AttrReportGroup{&appAttributes, &appKubeAttributes, &serverInfo},
+		},
 		MessagingPublishDuration.Section: {
 			SubGroups: []*AttrReportGroup{&messagingAttributes},
 		},
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"maps"
 	"slices"
+	"strings"
 
 	attr "github.com/grafana/beyla/pkg/export/attributes/names"
 	maps2 "github.com/grafana/beyla/pkg/internal/helpers/maps"
@@ -23,6 +24,9 @@ type AttrReportGroup struct {
 	SubGroups []*AttrReportGroup
 	// Attributes map of name: enabled for this group
 	Attributes map[attr.Name]Default
+	// Prefixes of the attribute names that are not known in advance (e.g. the captured HTTP headers).
+	// They are never reported by default, but they can be included by their full name.
+	Prefixes []string
 }
 
 // AttrSelector returns, for each metric, the attributes that have to be reported
@@ -87,6 +91,34 @@ func (p *AttrSelector) addIncludedAttributes(
 			matchingAttrs[attrName] = struct{}{}
 		}
 	}
+	for _, prefix := range attributeNames.AllPrefixes() {
+		for _, incl := range inclusionLists.Include {
+			if attrName, ok := prefixedAttribute(prefix, incl); ok {
+				matchingAttrs[attrName] = struct{}{}
+			}
+		}
+	}
+}
+
+// prefixedAttribute returns the attribute name of an inclusion entry that explicitly names an attribute
+// with the given prefix (in any of the Prometheus or OTEL formats). Wildcards are not accepted, as the
+// attribute names with this prefix are not known in advance.
+// As the OTEL attribute names might contain dashes (e.g. http.request.header.user-agent), the
+// underscores of the entries in Prometheus format (e.g. http_request_header_user_agent) are
+// considered dashes.
+func prefixedAttribute(prefix, include string) (attr.Name, bool) {
+	var suffix string
+	var ok bool
+	if promFormat := !strings.Contains(include, "."); promFormat {
+		suffix, ok = strings.CutPrefix(include, asProm(prefix))
+		suffix = strings.ReplaceAll(suffix, "_", "-")
+	} else {
+		suffix, ok = strings.CutPrefix(include, prefix)
+	}
+	if !ok || suffix == "" || strings.ContainsAny(suffix, "*?[") {
+		return "", false
+	}
+	return attr.Name(prefix + strings.ToLower(suffix)), true
 }
 
 func (p *AttrSelector) rmExcludedAttributes(matchingAttrs map[attr.Name]struct{}, inclusionLists InclusionLists) {
@@ -110,6 +142,18 @@ func (p *AttrReportGroup) All() map[attr.Name]struct{} {
 	return attrs
 }
 
+// AllPrefixes of the attribute names for this group and their subgroups, unless they are disabled.
+func (p *AttrReportGroup) AllPrefixes() []string {
+	if p.Disabled {
+		return nil
+	}
+	var prefixes []string
+	for _, parent := range p.SubGroups {
+		prefixes = append(prefixes, parent.AllPrefixes()...)
+	}
+	return append(prefixes, p.Prefixes...)
+}
+
 // Default attributes for this group and their subgroups, unless they are disabled.
 func (p *AttrReportGroup) Default() map[attr.Name]struct{} {
 	attrs := map[attr.Name]struct{}{}
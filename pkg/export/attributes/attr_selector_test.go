@@ -43,6 +43,30 @@ func TestFor(t *testing.T) {
 	}, p.For(BeylaNetworkFlow))
 }
 
+func TestFor_HTTPHeaders(t *testing.T) {
+	p, err := NewAttrSelector(0, Selection{
+		"http_server_request_duration_seconds": InclusionLists{
+			Include: []string{"http.request.method", "http.request.header.X-Tenant", "http_request_header_user_agent",
+				// wildcards are not accepted for attributes that are not known in advance
+				"http.request.header.*"},
+		},
+		"rpc_server_duration_seconds": InclusionLists{
+			Include: []string{"rpc.method", "http.request.header.x-tenant"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []attr.Name{
+		"http.request.header.user-agent",
+		"http.request.header.x-tenant",
+		"http.request.method",
+	}, p.For(HTTPServerDuration))
+	assert.Equal(t, "http_request_header_user_agent", attr.HTTPRequestHeader("User-Agent").Prom())
+	// the header attributes can be only selected for HTTP metrics
+	assert.Equal(t, []attr.Name{"rpc.method"}, p.For(RPCServerDuration))
+	// they are never reported by default
+	assert.NotContains(t, p.For(HTTPClientDuration), attr.HTTPRequestHeader("x-tenant"))
+}
+
 func TestFor_GlobEntries(t *testing.T) {
 	// include all groups just to verify that other attributes aren't anyway selected
 	p, err := NewAttrSelector(GroupKubernetes, Selection{
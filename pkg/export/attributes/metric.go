@@ -61,6 +61,16 @@ var (
 		Prom:    "db_client_operation_duration_seconds",
 		OTEL:    "db.client.operation.duration",
 	}
+	TCPClientDuration = Name{
+		Section: "beyla.tcp.client.duration",
+		Prom:    "beyla_tcp_client_duration_seconds",
+		OTEL:    "beyla.tcp.client.duration",
+	}
+	TCPServerDuration = Name{
+		Section: "beyla.tcp.server.duration",
+		Prom:    "beyla_tcp_server_duration_seconds",
+		OTEL:    "beyla.tcp.server.duration",
+	}
 	ProcessCPUTime = Name{
 		Section: "process.cpu.time",
 		Prom:    "process_cpu_time_seconds_total",
@@ -14,12 +14,15 @@ import (
 // which can be converted to OTEL or Prometheus format right before exporting them.
 type Name attribute.Key
 
+var promReplacer = strings.NewReplacer(".", "_", "-", "_")
+
 func (an Name) OTEL() attribute.Key {
 	return attribute.Key(an)
 }
 
 func (an Name) Prom() string {
-	return strings.ReplaceAll(string(an), ".", "_")
+	// dashes are only expected in attributes whose name is user-provided, such as HTTP headers
+	return promReplacer.Replace(string(an))
 }
 
 // OpenTelemetry 1.23 semantic convention
@@ -45,6 +48,8 @@ const (
 	DBOperation            = Name("db.operation.name")
 	DBCollectionName       = Name("db.collection.name")
 	DBSystem               = Name(semconv.DBSystemKey)
+	DBNamespace            = Name("db.namespace")
+	CacheOutcome           = Name("cache.outcome")
 	ErrorType              = Name("error.type")
 	RPCMethod              = Name(semconv.RPCMethodKey)
 	RPCSystem              = Name(semconv.RPCSystemKey)
@@ -147,5 +152,26 @@ const (
 // traces related attributes
 const (
 	// SQL
-	DBQueryText = Name("db.query.text")
+	DBQueryText          = Name("db.query.text")
+	DBResponseStatusCode = Name("db.response.status_code")
+	// Memcached
+	DBOperationBatchSize = Name("db.operation.batch.size")
+	// unclassified TCP
+	TCPRequestBytes  = Name("beyla.tcp.request.bytes")
+	TCPResponseBytes = Name("beyla.tcp.response.bytes")
 )
+
+// HTTPRequestHeaderPrefix is the prefix of the attributes that report the value of the captured HTTP request headers
+const HTTPRequestHeaderPrefix = "http.request.header."
+
+// HTTPHeaderKey normalizes an HTTP header name to be used as suffix of the HTTPRequestHeaderPrefix, as defined
+// by the OpenTelemetry semantic conventions: lowercase, keeping the dashes. The Prom() method of the resulting
+// attribute name replaces the dashes by underscores.
+func HTTPHeaderKey(header string) string {
+	return strings.ToLower(strings.TrimSpace(header))
+}
+
+// HTTPRequestHeader returns the attribute name for the given HTTP request header (e.g. http.request.header.user-agent)
+func HTTPRequestHeader(header string) Name {
+	return Name(HTTPRequestHeaderPrefix + HTTPHeaderKey(header))
+}
@@ -3,12 +3,20 @@ package instrumentations
 type InstrumentationSelection uint64
 
 const (
-	InstrumentationALL   = "*"
-	InstrumentationHTTP  = "http"
-	InstrumentationGRPC  = "grpc"
-	InstrumentationSQL   = "sql"
-	InstrumentationRedis = "redis"
-	InstrumentationKafka = "kafka"
+	InstrumentationALL       = "*"
+	InstrumentationHTTP      = "http"
+	InstrumentationGRPC      = "grpc"
+	InstrumentationSQL       = "sql"
+	InstrumentationRedis     = "redis"
+	InstrumentationKafka     = "kafka"
+	InstrumentationMongo     = "mongo"
+	InstrumentationAMQP      = "amqp"
+	InstrumentationMemcached = "memcached"
+	InstrumentationCassandra = "cassandra"
+	InstrumentationNATS      = "nats"
+	InstrumentationMQTT      = "mqtt"
+	InstrumentationTCP       = "tcp"
+	InstrumentationThrift    = "thrift"
 )
 
 const (
@@ -18,6 +26,14 @@ const (
 	flagSQL
 	flagRedis
 	flagKafka
+	flagMongo
+	flagAMQP
+	flagMemcached
+	flagCassandra
+	flagNATS
+	flagMQTT
+	flagTCP
+	flagThrift
 )
 
 func strToFlag(str string) InstrumentationSelection {
@@ -34,6 +50,22 @@ func strToFlag(str string) InstrumentationSelection {
 		return flagRedis
 	case InstrumentationKafka:
 		return flagKafka
+	case InstrumentationMongo:
+		return flagMongo
+	case InstrumentationAMQP:
+		return flagAMQP
+	case InstrumentationMemcached:
+		return flagMemcached
+	case InstrumentationCassandra:
+		return flagCassandra
+	case InstrumentationNATS:
+		return flagNATS
+	case InstrumentationMQTT:
+		return flagMQTT
+	case InstrumentationTCP:
+		return flagTCP
+	case InstrumentationThrift:
+		return flagThrift
 	}
 	return 0
 }
@@ -55,6 +87,14 @@ func (s InstrumentationSelection) GRPCEnabled() bool {
 	return s&flagGRPC != 0
 }
 
+func (s InstrumentationSelection) ThriftEnabled() bool {
+	return s&flagThrift != 0
+}
+
+func (s InstrumentationSelection) RPCEnabled() bool {
+	return s.GRPCEnabled() || s.ThriftEnabled()
+}
+
 func (s InstrumentationSelection) SQLEnabled() bool {
 	return s&flagSQL != 0
 }
@@ -63,14 +103,42 @@ func (s InstrumentationSelection) RedisEnabled() bool {
 	return s&flagRedis != 0
 }
 
+func (s InstrumentationSelection) MongoEnabled() bool {
+	return s&flagMongo != 0
+}
+
+func (s InstrumentationSelection) MemcachedEnabled() bool {
+	return s&flagMemcached != 0
+}
+
+func (s InstrumentationSelection) CassandraEnabled() bool {
+	return s&flagCassandra != 0
+}
+
 func (s InstrumentationSelection) DBEnabled() bool {
-	return s.SQLEnabled() || s.RedisEnabled()
+	return s.SQLEnabled() || s.RedisEnabled() || s.MongoEnabled() || s.MemcachedEnabled() || s.CassandraEnabled()
 }
 
 func (s InstrumentationSelection) KafkaEnabled() bool {
 	return s&flagKafka != 0
 }
 
+func (s InstrumentationSelection) AMQPEnabled() bool {
+	return s&flagAMQP != 0
+}
+
+func (s InstrumentationSelection) NATSEnabled() bool {
+	return s&flagNATS != 0
+}
+
+func (s InstrumentationSelection) MQTTEnabled() bool {
+	return s&flagMQTT != 0
+}
+
 func (s InstrumentationSelection) MQEnabled() bool {
-	return s.KafkaEnabled()
+	return s.KafkaEnabled() || s.AMQPEnabled() || s.NATSEnabled() || s.MQTTEnabled()
+}
+
+func (s InstrumentationSelection) TCPEnabled() bool {
+	return s&flagTCP != 0
 }
@@ -12,10 +12,26 @@ func TestInstrumentationSelection(t *testing.T) {
 	assert.True(t, is.SQLEnabled())
 	assert.True(t, is.DBEnabled())
 	assert.True(t, is.RedisEnabled())
+	assert.False(t, is.MongoEnabled())
 	assert.False(t, is.GRPCEnabled())
 	assert.False(t, is.KafkaEnabled())
 	assert.False(t, is.MQEnabled())
 
+	is = NewInstrumentationSelection([]string{"mongo"})
+	assert.True(t, is.MongoEnabled())
+	assert.True(t, is.DBEnabled())
+	assert.False(t, is.SQLEnabled())
+
+	is = NewInstrumentationSelection([]string{"memcached"})
+	assert.True(t, is.MemcachedEnabled())
+	assert.True(t, is.DBEnabled())
+	assert.False(t, is.RedisEnabled())
+
+	is = NewInstrumentationSelection([]string{"cassandra"})
+	assert.True(t, is.CassandraEnabled())
+	assert.True(t, is.DBEnabled())
+	assert.False(t, is.SQLEnabled())
+
 	is = NewInstrumentationSelection([]string{"grpc", "kafka"})
 	assert.False(t, is.HTTPEnabled())
 	assert.False(t, is.SQLEnabled())
@@ -23,7 +39,29 @@ func TestInstrumentationSelection(t *testing.T) {
 	assert.False(t, is.RedisEnabled())
 	assert.True(t, is.GRPCEnabled())
 	assert.True(t, is.KafkaEnabled())
+	assert.False(t, is.AMQPEnabled())
 	assert.True(t, is.MQEnabled())
+
+	is = NewInstrumentationSelection([]string{"amqp"})
+	assert.True(t, is.AMQPEnabled())
+	assert.True(t, is.MQEnabled())
+	assert.False(t, is.KafkaEnabled())
+
+	is = NewInstrumentationSelection([]string{"nats", "mqtt"})
+	assert.True(t, is.NATSEnabled())
+	assert.True(t, is.MQTTEnabled())
+	assert.True(t, is.MQEnabled())
+	assert.False(t, is.AMQPEnabled())
+
+	is = NewInstrumentationSelection([]string{"thrift"})
+	assert.True(t, is.ThriftEnabled())
+	assert.True(t, is.RPCEnabled())
+	assert.False(t, is.GRPCEnabled())
+
+	is = NewInstrumentationSelection([]string{"tcp"})
+	assert.True(t, is.TCPEnabled())
+	assert.False(t, is.MQEnabled())
+	assert.False(t, is.DBEnabled())
 }
 
 func TestInstrumentationSelection_All(t *testing.T) {
@@ -32,9 +70,18 @@ func TestInstrumentationSelection_All(t *testing.T) {
 	assert.True(t, is.SQLEnabled())
 	assert.True(t, is.DBEnabled())
 	assert.True(t, is.RedisEnabled())
+	assert.True(t, is.MongoEnabled())
+	assert.True(t, is.MemcachedEnabled())
+	assert.True(t, is.CassandraEnabled())
 	assert.True(t, is.GRPCEnabled())
 	assert.True(t, is.KafkaEnabled())
+	assert.True(t, is.AMQPEnabled())
+	assert.True(t, is.NATSEnabled())
+	assert.True(t, is.MQTTEnabled())
 	assert.True(t, is.MQEnabled())
+	assert.True(t, is.TCPEnabled())
+	assert.True(t, is.ThriftEnabled())
+	assert.True(t, is.RPCEnabled())
 }
 
 func TestInstrumentationSelection_None(t *testing.T) {
@@ -43,7 +90,16 @@ func TestInstrumentationSelection_None(t *testing.T) {
 	assert.False(t, is.SQLEnabled())
 	assert.False(t, is.DBEnabled())
 	assert.False(t, is.RedisEnabled())
+	assert.False(t, is.MongoEnabled())
+	assert.False(t, is.MemcachedEnabled())
+	assert.False(t, is.CassandraEnabled())
 	assert.False(t, is.GRPCEnabled())
 	assert.False(t, is.KafkaEnabled())
+	assert.False(t, is.AMQPEnabled())
+	assert.False(t, is.NATSEnabled())
+	assert.False(t, is.MQTTEnabled())
 	assert.False(t, is.MQEnabled())
+	assert.False(t, is.TCPEnabled())
+	assert.False(t, is.ThriftEnabled())
+	assert.False(t, is.RPCEnabled())
 }
@@ -42,7 +42,9 @@ const (
 	envProtocol        = "OTEL_EXPORTER_OTLP_PROTOCOL"
 	envHeaders         = "OTEL_EXPORTER_OTLP_HEADERS"
 	envTracesHeaders   = "OTEL_EXPORTER_OTLP_TRACES_HEADERS"
+	envMetricsHeaders  = "OTEL_EXPORTER_OTLP_METRICS_HEADERS"
 	envResourceAttrs   = "OTEL_RESOURCE_ATTRIBUTES"
+	envExemplars       = "OTEL_GO_X_EXEMPLAR"
 )
 
 // Buckets defines the histograms bucket boundaries, and allows users to
@@ -66,6 +68,12 @@ func getAppResourceAttrs(hostID string, service *svc.ID) []attribute.KeyValue {
 	)
 }
 
+// AppResourceAttrs returns the resource attributes of an instrumented service, as they are
+// reported in the OTEL traces
+func AppResourceAttrs(hostID string, service *svc.ID) []attribute.KeyValue {
+	return traceAppResourceAttrs(hostID, service)
+}
+
 func getResourceAttrs(hostID string, service *svc.ID) []attribute.KeyValue {
 	attrs := []attribute.KeyValue{
 		semconv.ServiceName(service.Name),
@@ -170,6 +178,14 @@ func (rp *ReporterPool[K, T]) For(service K) (T, error) {
 	return rp.lastReporter.value, nil
 }
 
+// Purge removes all the items from the pool, invoking the eviction callback for each of them
+func (rp *ReporterPool[K, T]) Purge() {
+	rp.pool.Purge()
+	rp.lastServiceUID = ""
+	rp.lastService = nil
+	rp.lastReporter = nil
+}
+
 // expireOldReporters will remove the metrics reporters that haven't been accessed
 // during the last TTL period
 func (rp *ReporterPool[K, T]) expireOldReporters() {
@@ -242,6 +258,9 @@ func (o *otlpOptions) AsMetricGRPC() []otlpmetricgrpc.Option {
 	if o.SkipTLSVerify {
 		opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})))
 	}
+	if len(o.HTTPHeaders) > 0 {
+		opts = append(opts, otlpmetricgrpc.WithHeaders(o.HTTPHeaders))
+	}
 	return opts
 }
 
@@ -274,6 +293,9 @@ func (o *otlpOptions) AsTraceGRPC() []otlptracegrpc.Option {
 	if o.SkipTLSVerify {
 		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})))
 	}
+	if len(o.HTTPHeaders) > 0 {
+		opts = append(opts, otlptracegrpc.WithHeaders(o.HTTPHeaders))
+	}
 	return opts
 }
 
@@ -0,0 +1,102 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mariomac/pipes/pipe"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/grafana/beyla/pkg/export/attributes"
+	"github.com/grafana/beyla/pkg/internal/infraolly/process"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// ConsumerMetricsReporter creates a terminal node that reports the same application, span and service graph
+// metrics as the OTEL metrics exporter, according to its configuration, but forwarding them to the provided
+// OpenTelemetry Collector consumers instead of an OTLP endpoint.
+func ConsumerMetricsReporter(
+	ctx context.Context,
+	ctxInfo *global.ContextInfo,
+	cfg *MetricsConfig,
+	userAttribSelection attributes.Selection,
+	consumers []consumer.Metrics,
+) pipe.FinalProvider[[]request.Span] {
+	return func() (pipe.FinalFunc[[]request.Span], error) {
+		if len(consumers) == 0 ||
+			!(cfg.OTelMetricsEnabled() || cfg.SpanMetricsEnabled() || cfg.ServiceGraphMetricsEnabled()) {
+			return pipe.IgnoreFinal[[]request.Span](), nil
+		}
+		mr, err := newMetricsReporter(ctx, ctxInfo, cfg, userAttribSelection,
+			func() (metric.Exporter, error) {
+				return newConsumerMetricsExporter(consumers, cfg.TemporalityPreference)
+			})
+		if err != nil {
+			return nil, fmt.Errorf("instantiating metrics consumer reporter: %w", err)
+		}
+		return mr.reportMetrics, nil
+	}
+}
+
+// ConsumerProcMetricsProvider creates a terminal node that reports the same process metrics as
+// ProcMetricsExporterProvider, but forwarding them to the provided OpenTelemetry Collector consumers.
+func ConsumerProcMetricsProvider(
+	ctx context.Context,
+	ctxInfo *global.ContextInfo,
+	cfg *ProcMetricsConfig,
+	consumers []consumer.Metrics,
+) pipe.FinalProvider[[]*process.Status] {
+	return func() (pipe.FinalFunc[[]*process.Status], error) {
+		if len(consumers) == 0 || !cfg.featuresEnabled() {
+			return pipe.IgnoreFinal[[]*process.Status](), nil
+		}
+		return newProcMetricsExporter(ctx, ctxInfo, cfg, func() (metric.Exporter, error) {
+			return newConsumerMetricsExporter(consumers, cfg.Metrics.TemporalityPreference)
+		})
+	}
+}
+
+// consumerMetricsExporter forwards each export of the OTEL SDK to the consumers, converted to the pdata format
+type consumerMetricsExporter struct {
+	consumers   []consumer.Metrics
+	temporality metric.TemporalitySelector
+}
+
+func newConsumerMetricsExporter(consumers []consumer.Metrics, temporalityPreference string) (*consumerMetricsExporter, error) {
+	temporality, err := temporalitySelector(temporalityPreference)
+	if err != nil {
+		return nil, err
+	}
+	return &consumerMetricsExporter{consumers: consumers, temporality: temporality}, nil
+}
+
+func (e *consumerMetricsExporter) Temporality(kind metric.InstrumentKind) metricdata.Temporality {
+	return e.temporality(kind)
+}
+
+func (e *consumerMetricsExporter) Aggregation(kind metric.InstrumentKind) metric.Aggregation {
+	return metric.DefaultAggregationSelector(kind)
+}
+
+func (e *consumerMetricsExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	var errs []error
+	for _, c := range e.consumers {
+		// each consumer gets its own copy, as the consumers are allowed to modify the data
+		if err := c.ConsumeMetrics(ctx, toPMetrics(rm)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *consumerMetricsExporter) ForceFlush(_ context.Context) error {
+	return nil
+}
+
+func (e *consumerMetricsExporter) Shutdown(_ context.Context) error {
+	return nil
+}
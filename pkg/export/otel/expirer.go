@@ -96,7 +96,11 @@ func (ex *Expirer[Record, Metric, ValType]) recordAttributes(m Record, extraAttr
 
 	for _, attr := range ex.attrs {
 		kv := attr.Get(m)
-		keyVals = append(keyVals, kv)
+		// getters return an invalid attribute when it doesn't apply to the record
+		// (e.g. rpc.grpc.status_code for Thrift spans)
+		if kv.Valid() {
+			keyVals = append(keyVals, kv)
+		}
 		vals = append(vals, kv.Value.Emit())
 	}
 	keyVals = append(keyVals, extraAttrs...)
@@ -9,8 +9,11 @@ import (
 	"github.com/mariomac/guara/pkg/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.19.0"
 
 	"github.com/grafana/beyla/pkg/export/attributes"
+	attr "github.com/grafana/beyla/pkg/export/attributes/names"
 	"github.com/grafana/beyla/pkg/export/instrumentations"
 	"github.com/grafana/beyla/pkg/internal/netolly/ebpf"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
@@ -128,6 +131,69 @@ func TestNetMetricsExpiration(t *testing.T) {
 	})
 }
 
+// with delta temporality, the attribute sets that aren't updated during an export interval
+// are not reported anymore, so expiration works without removing them from the OTEL SDK
+func TestNetMetricsExpiration_DeltaTemporality(t *testing.T) {
+	defer restoreEnvAfterExecution()()
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+
+	otlp, err := collector.Start(ctx)
+	require.NoError(t, err)
+
+	otelExporter, err := NetMetricsExporterProvider(
+		ctx,
+		&global.ContextInfo{}, &NetMetricsConfig{
+			Metrics: &MetricsConfig{
+				Interval:              50 * time.Millisecond,
+				CommonEndpoint:        otlp.ServerEndpoint,
+				MetricsProtocol:       ProtocolHTTPProtobuf,
+				Features:              []string{FeatureNetwork},
+				TTL:                   3 * time.Minute,
+				TemporalityPreference: TemporalityDelta,
+				Instrumentations: []string{
+					instrumentations.InstrumentationALL,
+				},
+			}, AttributeSelectors: attributes.Selection{
+				attributes.BeylaNetworkFlow.Section: attributes.InclusionLists{
+					Include: []string{"src.name", "dst.name"},
+				},
+			},
+		})
+	require.NoError(t, err)
+
+	metrics := make(chan []*ebpf.Record, 20)
+	go otelExporter(metrics)
+
+	// WHEN it receives metrics
+	metrics <- []*ebpf.Record{
+		{Attrs: ebpf.RecordAttrs{SrcName: "foo", DstName: "bar"},
+			NetFlowRecordT: ebpf.NetFlowRecordT{Metrics: ebpf.NetFlowMetrics{Bytes: 123}}},
+		{Attrs: ebpf.RecordAttrs{SrcName: "baz", DstName: "bae"},
+			NetFlowRecordT: ebpf.NetFlowRecordT{Metrics: ebpf.NetFlowMetrics{Bytes: 456}}},
+	}
+
+	// THEN the metrics are exported as deltas
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		metric := readChan(t, otlp.Records(), timeout)
+		assert.Equal(t, map[string]string{"src.name": "baz", "dst.name": "bae"}, metric.Attributes)
+		assert.EqualValues(t, 456, metric.IntVal)
+	})
+
+	// AND WHEN it keeps receiving only a subset of the initial metrics
+	otlp.ResetRecords()
+	for i := 0; i < 5; i++ {
+		metrics <- []*ebpf.Record{
+			{Attrs: ebpf.RecordAttrs{SrcName: "foo", DstName: "bar"},
+				NetFlowRecordT: ebpf.NetFlowRecordT{Metrics: ebpf.NetFlowMetrics{Bytes: 100}}},
+		}
+		// THEN only the updated metrics are forwarded, without accumulating the previous values
+		metric := readChan(t, otlp.Records(), timeout)
+		require.Equal(t, map[string]string{"src.name": "foo", "dst.name": "bar"}, metric.Attributes)
+		require.EqualValues(t, 100, metric.IntVal)
+	}
+}
+
 // the expiration logic is held at two levels:
 // (1) by group of attributes within the same service ID,
 // (2) by metric set of a given service ID
@@ -399,3 +465,21 @@ func readChan(t require.TestingT, inCh <-chan collector.MetricRecord, timeout ti
 	}
 	return collector.MetricRecord{}
 }
+
+func TestExpirer_OmitsNotApplicableAttributes(t *testing.T) {
+	exp := NewExpirer[*request.Span, any, float64](context.Background(), nil,
+		attributes.OpenTelemetryGetters(request.SpanOTELGetters, []attr.Name{attr.RPCSystem, attr.RPCGRPCStatusCode}),
+		time.Now, time.Minute)
+
+	_, grpcAttrs := exp.ForRecord(&request.Span{Type: request.EventTypeGRPC, Status: 3})
+	assert.Equal(t, []attribute.KeyValue{
+		semconv.RPCGRPCStatusCodeKey.Int(3),
+		semconv.RPCSystemGRPC,
+	}, grpcAttrs.ToSlice())
+
+	// Thrift spans don't have a gRPC status code
+	_, thriftAttrs := exp.ForRecord(&request.Span{Type: request.EventTypeGRPC, RPCKind: request.RPCThrift, Status: 1})
+	assert.Equal(t, []attribute.KeyValue{
+		semconv.RPCSystemKey.String("thrift"),
+	}, thriftAttrs.ToSlice())
+}
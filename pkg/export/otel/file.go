@@ -0,0 +1,205 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/mariomac/pipes/pipe"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/grafana/beyla/pkg/export/attributes"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/rotate"
+)
+
+const (
+	tracesFileName  = "traces.jsonl"
+	metricsFileName = "metrics.jsonl"
+)
+
+func flog() *slog.Logger {
+	return slog.With("component", "otel.FileExporter")
+}
+
+// FileConfig enables writing the traces and metrics into local files, as OTLP-JSON lines.
+// It follows the same format as the OpenTelemetry Collector file exporter, so the files can
+// be replayed later into a collector (for example, with the otlpjsonfile receiver).
+type FileConfig struct {
+	// Directory where the traces.jsonl and metrics.jsonl files are written. If empty, the exporter is disabled.
+	Directory string `yaml:"directory" env:"BEYLA_OTLP_FILE_DIRECTORY"`
+	// Signals that are written. Accepted values are "traces" and "metrics".
+	Signals []string `yaml:"signals" env:"BEYLA_OTLP_FILE_SIGNALS" envSeparator:","`
+	// MaxSizeMB is the size, in megabytes, that a file reaches before being rotated. If 0, the files
+	// are not rotated by size.
+	MaxSizeMB int `yaml:"max_size_mb" env:"BEYLA_OTLP_FILE_MAX_SIZE_MB"`
+	// RotationInterval is the time since a file is created until it is rotated. If 0, the files
+	// are not rotated by time.
+	RotationInterval time.Duration `yaml:"rotation_interval" env:"BEYLA_OTLP_FILE_ROTATION_INTERVAL"`
+	// MaxBackups is the number of rotated files that are kept
+	MaxBackups int `yaml:"max_backups" env:"BEYLA_OTLP_FILE_MAX_BACKUPS"`
+	// Compress the rotated files with gzip
+	Compress bool `yaml:"compress" env:"BEYLA_OTLP_FILE_COMPRESS"`
+}
+
+func (c *FileConfig) Enabled() bool {
+	return c.Directory != ""
+}
+
+func (c *FileConfig) TracesEnabled() bool {
+	return c.Enabled() && slices.Contains(c.Signals, submitTraces)
+}
+
+func (c *FileConfig) MetricsEnabled() bool {
+	return c.Enabled() && slices.Contains(c.Signals, submitMetrics)
+}
+
+func (c *FileConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	for _, s := range c.Signals {
+		if s != submitTraces && s != submitMetrics {
+			return fmt.Errorf("invalid OTLP file signal %q. Accepted values are: %s, %s", s, submitTraces, submitMetrics)
+		}
+	}
+	if c.MaxSizeMB < 0 || c.RotationInterval < 0 || c.MaxBackups < 0 {
+		return fmt.Errorf("OTLP file max_size_mb, rotation_interval and max_backups can't be negative")
+	}
+	return nil
+}
+
+func (c *FileConfig) file(name string) *rotate.File {
+	return &rotate.File{
+		Path:       filepath.Join(c.Directory, name),
+		MaxSize:    int64(c.MaxSizeMB) * 1024 * 1024,
+		Interval:   c.RotationInterval,
+		MaxBackups: c.MaxBackups,
+		Compress:   c.Compress,
+	}
+}
+
+// FileTracesReceiver creates a terminal node that writes each batch of request.Spans as an OTLP-JSON line.
+// It accepts the same instrumentations as the OTEL traces exporter.
+func FileTracesReceiver(
+	ctx context.Context, fileCfg *FileConfig, cfg TracesConfig, ctxInfo *global.ContextInfo, userAttribSelection attributes.Selection,
+) pipe.FinalProvider[[]request.Span] {
+	return func() (pipe.FinalFunc[[]request.Span], error) {
+		if !fileCfg.TracesEnabled() {
+			return pipe.IgnoreFinal[[]request.Span](), nil
+		}
+		if err := fileCfg.Validate(); err != nil {
+			return nil, err
+		}
+		traceAttrs, err := GetUserSelectedAttributes(userAttribSelection)
+		if err != nil {
+			return nil, fmt.Errorf("selecting user trace attributes: %w", err)
+		}
+		tr := makeTracesReceiver(ctx, cfg, ctxInfo, userAttribSelection)
+		file := fileCfg.file(tracesFileName)
+		return func(in <-chan []request.Span) {
+			defer file.Close()
+			log := flog()
+			envResourceAttrs := ResourceAttrsFromEnv()
+			marshaler := ptrace.JSONMarshaler{}
+			for spans := range in {
+				batch := ptrace.NewTraces()
+				for i := range spans {
+					span := &spans[i]
+					if tr.spanDiscarded(span) {
+						continue
+					}
+					traces := GenerateTraces(span, ctxInfo.HostID, traceAttrs, envResourceAttrs)
+					traces.ResourceSpans().MoveAndAppendTo(batch.ResourceSpans())
+				}
+				if batch.SpanCount() == 0 {
+					continue
+				}
+				line, err := marshaler.MarshalTraces(batch)
+				if err != nil {
+					log.Error("error marshaling traces", "error", err)
+					continue
+				}
+				if _, err := file.Write(append(line, '\n')); err != nil {
+					log.Error("error writing traces file", "error", err)
+				}
+			}
+		}, nil
+	}
+}
+
+// FileMetricsReporter creates a terminal node that reports the same metrics as the OTEL metrics exporter,
+// according to its configuration, but writing them periodically as OTLP-JSON lines.
+func FileMetricsReporter(
+	ctx context.Context,
+	ctxInfo *global.ContextInfo,
+	fileCfg *FileConfig,
+	cfg *MetricsConfig,
+	userAttribSelection attributes.Selection,
+) pipe.FinalProvider[[]request.Span] {
+	return func() (pipe.FinalFunc[[]request.Span], error) {
+		if !fileCfg.MetricsEnabled() ||
+			!(cfg.OTelMetricsEnabled() || cfg.SpanMetricsEnabled() || cfg.ServiceGraphMetricsEnabled()) {
+			return pipe.IgnoreFinal[[]request.Span](), nil
+		}
+		if err := fileCfg.Validate(); err != nil {
+			return nil, err
+		}
+		mr, err := newMetricsReporter(ctx, ctxInfo, cfg, userAttribSelection,
+			func() (metric.Exporter, error) {
+				return newFileMetricsExporter(fileCfg.file(metricsFileName), cfg.TemporalityPreference)
+			})
+		if err != nil {
+			return nil, fmt.Errorf("instantiating OTLP file metrics reporter: %w", err)
+		}
+		return mr.reportMetrics, nil
+	}
+}
+
+// fileMetricsExporter writes each export of the OTEL SDK as an OTLP-JSON line
+type fileMetricsExporter struct {
+	file        *rotate.File
+	temporality metric.TemporalitySelector
+	marshaler   pmetric.JSONMarshaler
+}
+
+func newFileMetricsExporter(file *rotate.File, temporalityPreference string) (*fileMetricsExporter, error) {
+	temporality, err := temporalitySelector(temporalityPreference)
+	if err != nil {
+		return nil, err
+	}
+	return &fileMetricsExporter{file: file, temporality: temporality}, nil
+}
+
+func (e *fileMetricsExporter) Temporality(kind metric.InstrumentKind) metricdata.Temporality {
+	return e.temporality(kind)
+}
+
+func (e *fileMetricsExporter) Aggregation(kind metric.InstrumentKind) metric.Aggregation {
+	return metric.DefaultAggregationSelector(kind)
+}
+
+func (e *fileMetricsExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	line, err := e.marshaler.MarshalMetrics(toPMetrics(rm))
+	if err != nil {
+		return fmt.Errorf("marshaling metrics: %w", err)
+	}
+	// a single write, so the lines of the different providers aren't mixed
+	_, err = e.file.Write(append(line, '\n'))
+	return err
+}
+
+func (e *fileMetricsExporter) ForceFlush(_ context.Context) error {
+	return nil
+}
+
+func (e *fileMetricsExporter) Shutdown(_ context.Context) error {
+	return e.file.Close()
+}
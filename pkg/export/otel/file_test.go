@@ -0,0 +1,130 @@
+package otel
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mariomac/guara/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/grafana/beyla/pkg/export/attributes"
+	"github.com/grafana/beyla/pkg/export/instrumentations"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func TestFileTracesReceiver(t *testing.T) {
+	dir := t.TempDir()
+	fileCfg := FileConfig{Directory: dir, Signals: []string{submitTraces}}
+	exporter, err := FileTracesReceiver(context.Background(), &fileCfg,
+		TracesConfig{Instrumentations: []string{instrumentations.InstrumentationHTTP}},
+		&global.ContextInfo{HostID: "host-id"}, attributes.Selection{})()
+	require.NoError(t, err)
+
+	spans := make(chan []request.Span, 10)
+	spans <- []request.Span{
+		{Type: request.EventTypeHTTP, Method: "GET", Route: "/foo", ServiceID: svc.ID{Name: "svc"}},
+		{Type: request.EventTypeHTTPClient, Method: "POST", Path: "/bar", ServiceID: svc.ID{Name: "svc"}},
+		// not written, as the SQL instrumentation is not enabled
+		{Type: request.EventTypeSQLClient, Method: "SELECT", ServiceID: svc.ID{Name: "svc"}},
+	}
+	spans <- []request.Span{
+		{Type: request.EventTypeHTTP, Method: "GET", Route: "/baz", ServiceID: svc.ID{Name: "other"}},
+	}
+	close(spans)
+	exporter(spans)
+
+	// each batch is written as a line
+	lines := readLines(t, filepath.Join(dir, tracesFileName))
+	require.Len(t, lines, 2)
+	unmarshaler := ptrace.JSONUnmarshaler{}
+	traces, err := unmarshaler.UnmarshalTraces(lines[0])
+	require.NoError(t, err)
+	assert.Equal(t, 2, traces.SpanCount())
+	traces, err = unmarshaler.UnmarshalTraces(lines[1])
+	require.NoError(t, err)
+	assert.Equal(t, 1, traces.SpanCount())
+	svcName, _ := traces.ResourceSpans().At(0).Resource().Attributes().Get("service.name")
+	assert.Equal(t, "other", svcName.Str())
+
+	assert.NoFileExists(t, filepath.Join(dir, metricsFileName))
+}
+
+func TestFileMetricsReporter(t *testing.T) {
+	dir := t.TempDir()
+	fileCfg := FileConfig{Directory: dir, Signals: []string{submitMetrics}}
+	exporter, err := FileMetricsReporter(context.Background(), &global.ContextInfo{}, &fileCfg, &MetricsConfig{
+		Interval:             10 * time.Millisecond,
+		Features:             []string{FeatureApplication},
+		Instrumentations:     []string{instrumentations.InstrumentationALL},
+		Buckets:              DefaultBuckets,
+		HistogramAggregation: AggregationExplicit,
+		ReportersCacheLen:    10,
+		TTL:                  time.Minute,
+	}, attributes.Selection{})()
+	require.NoError(t, err)
+
+	spans := make(chan []request.Span, 10)
+	go exporter(spans)
+	spans <- []request.Span{
+		{Type: request.EventTypeHTTP, Method: "GET", Status: 200, ServiceID: svc.ID{Name: "svc", UID: "svc-1"},
+			End: 2 * time.Second.Nanoseconds()},
+	}
+
+	path := filepath.Join(dir, metricsFileName)
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		require.FileExists(t, path)
+		lines := readLines(t, path)
+		require.NotEmpty(t, lines)
+		metrics, err := (&pmetric.JSONUnmarshaler{}).UnmarshalMetrics(lines[len(lines)-1])
+		require.NoError(t, err)
+		require.Equal(t, 1, metrics.ResourceMetrics().Len())
+		rm := metrics.ResourceMetrics().At(0)
+		svcName, _ := rm.Resource().Attributes().Get("service.name")
+		assert.Equal(t, "svc", svcName.Str())
+		var names []string
+		for i := 0; i < rm.ScopeMetrics().Len(); i++ {
+			sm := rm.ScopeMetrics().At(i).Metrics()
+			for j := 0; j < sm.Len(); j++ {
+				names = append(names, sm.At(j).Name())
+			}
+		}
+		assert.Contains(t, names, attributes.HTTPServerDuration.OTEL)
+	}, test.Interval(10*time.Millisecond))
+	close(spans)
+}
+
+func TestFileConfig(t *testing.T) {
+	assert.False(t, (&FileConfig{Signals: []string{submitTraces}}).TracesEnabled())
+	cfg := FileConfig{Directory: "/tmp", Signals: []string{submitTraces}}
+	assert.True(t, cfg.TracesEnabled())
+	assert.False(t, cfg.MetricsEnabled())
+	assert.NoError(t, cfg.Validate())
+	cfg.Signals = []string{"logs"}
+	assert.Error(t, cfg.Validate())
+	cfg.Signals = []string{submitMetrics}
+	cfg.MaxSizeMB = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func readLines(t require.TestingT, path string) [][]byte {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var lines [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, append([]byte{}, scanner.Bytes()...))
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
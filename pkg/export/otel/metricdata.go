@@ -0,0 +1,168 @@
+package otel
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// toPMetrics converts the metrics collected by the OTEL SDK into the pdata format of the OTEL collector
+func toPMetrics(rm *metricdata.ResourceMetrics) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	prm := md.ResourceMetrics().AppendEmpty()
+	if rm.Resource != nil {
+		attrsToMap(rm.Resource.Attributes()).CopyTo(prm.Resource().Attributes())
+		prm.SetSchemaUrl(rm.Resource.SchemaURL())
+	}
+	for i := range rm.ScopeMetrics {
+		sm := &rm.ScopeMetrics[i]
+		psm := prm.ScopeMetrics().AppendEmpty()
+		psm.Scope().SetName(sm.Scope.Name)
+		psm.Scope().SetVersion(sm.Scope.Version)
+		psm.SetSchemaUrl(sm.Scope.SchemaURL)
+		for j := range sm.Metrics {
+			m := &sm.Metrics[j]
+			pm := psm.Metrics().AppendEmpty()
+			pm.SetName(m.Name)
+			pm.SetDescription(m.Description)
+			pm.SetUnit(m.Unit)
+			setMetricData(pm, m.Data)
+		}
+	}
+	return md
+}
+
+func setMetricData(pm pmetric.Metric, data metricdata.Aggregation) {
+	switch d := data.(type) {
+	case metricdata.Gauge[int64]:
+		numberDataPoints(pm.SetEmptyGauge().DataPoints(), d.DataPoints)
+	case metricdata.Gauge[float64]:
+		numberDataPoints(pm.SetEmptyGauge().DataPoints(), d.DataPoints)
+	case metricdata.Sum[int64]:
+		sum := pm.SetEmptySum()
+		sum.SetIsMonotonic(d.IsMonotonic)
+		sum.SetAggregationTemporality(toPTemporality(d.Temporality))
+		numberDataPoints(sum.DataPoints(), d.DataPoints)
+	case metricdata.Sum[float64]:
+		sum := pm.SetEmptySum()
+		sum.SetIsMonotonic(d.IsMonotonic)
+		sum.SetAggregationTemporality(toPTemporality(d.Temporality))
+		numberDataPoints(sum.DataPoints(), d.DataPoints)
+	case metricdata.Histogram[int64]:
+		h := pm.SetEmptyHistogram()
+		h.SetAggregationTemporality(toPTemporality(d.Temporality))
+		histogramDataPoints(h.DataPoints(), d.DataPoints)
+	case metricdata.Histogram[float64]:
+		h := pm.SetEmptyHistogram()
+		h.SetAggregationTemporality(toPTemporality(d.Temporality))
+		histogramDataPoints(h.DataPoints(), d.DataPoints)
+	case metricdata.ExponentialHistogram[int64]:
+		h := pm.SetEmptyExponentialHistogram()
+		h.SetAggregationTemporality(toPTemporality(d.Temporality))
+		expHistogramDataPoints(h.DataPoints(), d.DataPoints)
+	case metricdata.ExponentialHistogram[float64]:
+		h := pm.SetEmptyExponentialHistogram()
+		h.SetAggregationTemporality(toPTemporality(d.Temporality))
+		expHistogramDataPoints(h.DataPoints(), d.DataPoints)
+	}
+}
+
+func toPTemporality(t metricdata.Temporality) pmetric.AggregationTemporality {
+	switch t {
+	case metricdata.CumulativeTemporality:
+		return pmetric.AggregationTemporalityCumulative
+	case metricdata.DeltaTemporality:
+		return pmetric.AggregationTemporalityDelta
+	}
+	return pmetric.AggregationTemporalityUnspecified
+}
+
+func numberDataPoints[N int64 | float64](dst pmetric.NumberDataPointSlice, dps []metricdata.DataPoint[N]) {
+	for i := range dps {
+		dp := &dps[i]
+		pdp := dst.AppendEmpty()
+		setAttributes(pdp.Attributes(), &dp.Attributes)
+		pdp.SetStartTimestamp(pcommon.NewTimestampFromTime(dp.StartTime))
+		pdp.SetTimestamp(pcommon.NewTimestampFromTime(dp.Time))
+		switch v := any(dp.Value).(type) {
+		case int64:
+			pdp.SetIntValue(v)
+		case float64:
+			pdp.SetDoubleValue(v)
+		}
+		exemplars(pdp.Exemplars(), dp.Exemplars)
+	}
+}
+
+func histogramDataPoints[N int64 | float64](dst pmetric.HistogramDataPointSlice, dps []metricdata.HistogramDataPoint[N]) {
+	for i := range dps {
+		dp := &dps[i]
+		pdp := dst.AppendEmpty()
+		setAttributes(pdp.Attributes(), &dp.Attributes)
+		pdp.SetStartTimestamp(pcommon.NewTimestampFromTime(dp.StartTime))
+		pdp.SetTimestamp(pcommon.NewTimestampFromTime(dp.Time))
+		pdp.SetCount(dp.Count)
+		pdp.SetSum(float64(dp.Sum))
+		if v, ok := dp.Min.Value(); ok {
+			pdp.SetMin(float64(v))
+		}
+		if v, ok := dp.Max.Value(); ok {
+			pdp.SetMax(float64(v))
+		}
+		pdp.ExplicitBounds().FromRaw(dp.Bounds)
+		pdp.BucketCounts().FromRaw(dp.BucketCounts)
+		exemplars(pdp.Exemplars(), dp.Exemplars)
+	}
+}
+
+func expHistogramDataPoints[N int64 | float64](dst pmetric.ExponentialHistogramDataPointSlice, dps []metricdata.ExponentialHistogramDataPoint[N]) {
+	for i := range dps {
+		dp := &dps[i]
+		pdp := dst.AppendEmpty()
+		setAttributes(pdp.Attributes(), &dp.Attributes)
+		pdp.SetStartTimestamp(pcommon.NewTimestampFromTime(dp.StartTime))
+		pdp.SetTimestamp(pcommon.NewTimestampFromTime(dp.Time))
+		pdp.SetCount(dp.Count)
+		pdp.SetSum(float64(dp.Sum))
+		if v, ok := dp.Min.Value(); ok {
+			pdp.SetMin(float64(v))
+		}
+		if v, ok := dp.Max.Value(); ok {
+			pdp.SetMax(float64(v))
+		}
+		pdp.SetScale(dp.Scale)
+		pdp.SetZeroCount(dp.ZeroCount)
+		pdp.SetZeroThreshold(dp.ZeroThreshold)
+		pdp.Positive().SetOffset(dp.PositiveBucket.Offset)
+		pdp.Positive().BucketCounts().FromRaw(dp.PositiveBucket.Counts)
+		pdp.Negative().SetOffset(dp.NegativeBucket.Offset)
+		pdp.Negative().BucketCounts().FromRaw(dp.NegativeBucket.Counts)
+		exemplars(pdp.Exemplars(), dp.Exemplars)
+	}
+}
+
+func exemplars[N int64 | float64](dst pmetric.ExemplarSlice, exs []metricdata.Exemplar[N]) {
+	for i := range exs {
+		ex := &exs[i]
+		pex := dst.AppendEmpty()
+		attrsToMap(ex.FilteredAttributes).CopyTo(pex.FilteredAttributes())
+		pex.SetTimestamp(pcommon.NewTimestampFromTime(ex.Time))
+		switch v := any(ex.Value).(type) {
+		case int64:
+			pex.SetIntValue(v)
+		case float64:
+			pex.SetDoubleValue(v)
+		}
+		var traceID pcommon.TraceID
+		copy(traceID[:], ex.TraceID)
+		pex.SetTraceID(traceID)
+		var spanID pcommon.SpanID
+		copy(spanID[:], ex.SpanID)
+		pex.SetSpanID(spanID)
+	}
+}
+
+func setAttributes(dst pcommon.Map, set *attribute.Set) {
+	attrsToMap(set.ToSlice()).CopyTo(dst)
+}
@@ -18,8 +18,10 @@ import (
 	instrument "go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/sdk/instrumentation"
 	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.19.0"
+	trace2 "go.opentelemetry.io/otel/trace"
 
 	"github.com/grafana/beyla/pkg/export/attributes"
 	attr "github.com/grafana/beyla/pkg/export/attributes/names"
@@ -54,6 +56,10 @@ const (
 	AggregationExplicit    = "explicit_bucket_histogram"
 	AggregationExponential = "base2_exponential_bucket_histogram"
 
+	TemporalityCumulative = "cumulative"
+	TemporalityDelta      = "delta"
+	TemporalityLowMemory  = "lowmemory"
+
 	FeatureNetwork     = "network"
 	FeatureApplication = "application"
 	FeatureSpan        = "application_span"
@@ -84,8 +90,19 @@ type MetricsConfig struct {
 	Buckets              Buckets `yaml:"buckets"`
 	HistogramAggregation string  `yaml:"histogram_aggregation" env:"OTEL_EXPORTER_OTLP_METRICS_DEFAULT_HISTOGRAM_AGGREGATION"`
 
+	// TemporalityPreference accepts the cumulative, delta and lowmemory values, as defined by the OTEL specification
+	TemporalityPreference string `yaml:"temporality_preference" env:"OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE"`
+
 	ReportersCacheLen int `yaml:"reporters_cache_len" env:"BEYLA_METRICS_REPORT_CACHE_LEN"`
 
+	// PersistentQueueDirectory enables a file-backed queue that keeps the batches that couldn't be submitted yet,
+	// so they survive collector outages and are replayed after a restart.
+	PersistentQueueDirectory string `yaml:"persistent_queue_directory" env:"BEYLA_OTLP_METRICS_PERSISTENT_QUEUE_DIRECTORY"`
+	// PersistentQueueSize is the maximum number of batches in the persistent queue
+	PersistentQueueSize int `yaml:"persistent_queue_size" env:"BEYLA_OTLP_METRICS_PERSISTENT_QUEUE_SIZE"`
+	// PersistentQueueMaxBytes is the maximum size on disk of the batches in the persistent queue. 0 means unlimited
+	PersistentQueueMaxBytes int64 `yaml:"persistent_queue_max_bytes" env:"BEYLA_OTLP_METRICS_PERSISTENT_QUEUE_MAX_BYTES"`
+
 	// SDKLogLevel works independently from the global LogLevel because it prints GBs of logs in Debug mode
 	// and the Info messages leak internal details that are not usually valuable for the final user.
 	SDKLogLevel string `yaml:"otel_sdk_log_level" env:"BEYLA_OTEL_SDK_LOG_LEVEL"`
@@ -103,6 +120,14 @@ type MetricsConfig struct {
 
 	AllowServiceGraphSelfReferences bool `yaml:"allow_service_graph_self_references" env:"BEYLA_OTEL_ALLOW_SERVICE_GRAPH_SELF_REFERENCES"`
 
+	// Exemplars attaches the trace and span IDs of the sampled spans to the application metrics
+	Exemplars bool `yaml:"exemplars" env:"BEYLA_OTEL_METRICS_EXEMPLARS"`
+
+	// Routing submits the metrics of the matching services to a different endpoint, or with different headers
+	Routing RoutingRules `yaml:"routing"`
+	// headers of the route that is being instantiated, if any
+	routeHeaders map[string]string
+
 	// Grafana configuration needs to be explicitly set up before building the graph
 	Grafana *GrafanaOTLP `yaml:"-"`
 }
@@ -174,6 +199,10 @@ type MetricsReporter struct {
 	reporters  ReporterPool[*svc.ID, *Metrics]
 	is         instrumentations.InstrumentationSelection
 
+	// routes and their exporters, for the services that must be submitted through a different exporter
+	routes         routes
+	routeExporters ReporterPool[*route, metric.Exporter]
+
 	// user-selected fields for each of the reported metrics
 	attrHTTPDuration          []attributes.Field[*request.Span, attribute.KeyValue]
 	attrHTTPClientDuration    []attributes.Field[*request.Span, attribute.KeyValue]
@@ -182,6 +211,8 @@ type MetricsReporter struct {
 	attrDBClient              []attributes.Field[*request.Span, attribute.KeyValue]
 	attrMessagingPublish      []attributes.Field[*request.Span, attribute.KeyValue]
 	attrMessagingProcess      []attributes.Field[*request.Span, attribute.KeyValue]
+	attrTCPClient             []attributes.Field[*request.Span, attribute.KeyValue]
+	attrTCPServer             []attributes.Field[*request.Span, attribute.KeyValue]
 	attrHTTPRequestSize       []attributes.Field[*request.Span, attribute.KeyValue]
 	attrHTTPClientRequestSize []attributes.Field[*request.Span, attribute.KeyValue]
 }
@@ -201,6 +232,8 @@ type Metrics struct {
 	dbClientDuration      *Expirer[*request.Span, instrument.Float64Histogram, float64]
 	msgPublishDuration    *Expirer[*request.Span, instrument.Float64Histogram, float64]
 	msgProcessDuration    *Expirer[*request.Span, instrument.Float64Histogram, float64]
+	tcpClientDuration     *Expirer[*request.Span, instrument.Float64Histogram, float64]
+	tcpServerDuration     *Expirer[*request.Span, instrument.Float64Histogram, float64]
 	httpRequestSize       *Expirer[*request.Span, instrument.Float64Histogram, float64]
 	httpClientRequestSize *Expirer[*request.Span, instrument.Float64Histogram, float64]
 	// trace span metrics
@@ -224,12 +257,28 @@ func ReportMetrics(
 		if !cfg.Enabled() {
 			return pipe.IgnoreFinal[[]request.Span](), nil
 		}
+		routes, err := cfg.Routing.compile()
+		if err != nil {
+			return nil, fmt.Errorf("invalid metrics routing rules: %w", err)
+		}
 		SetupInternalOTELSDKLogger(cfg.SDKLogLevel)
 
-		mr, err := newMetricsReporter(ctx, ctxInfo, cfg, userAttribSelection)
+		mr, err := newMetricsReporter(ctx, ctxInfo, cfg, userAttribSelection,
+			func() (metric.Exporter, error) {
+				// Instantiate the OTLP HTTP or GRPC metrics exporter
+				return InstantiateMetricsExporter(ctx, cfg, ctxInfo.Metrics, "metrics", mlog())
+			})
 		if err != nil {
 			return nil, fmt.Errorf("instantiating OTEL metrics reporter: %w", err)
 		}
+		mr.setupRoutes(routes, func(r *route) (metric.Exporter, error) {
+			exporter, err := InstantiateMetricsExporter(ctx, r.metricsConfig(cfg), ctxInfo.Metrics,
+				r.queueName("metrics"), mlog().With("route", r.Name))
+			if err != nil {
+				return nil, err
+			}
+			return instrumentMetricsExporter(ctxInfo.Metrics, exporter), nil
+		})
 		return mr.reportMetrics, nil
 	}
 }
@@ -239,6 +288,7 @@ func newMetricsReporter(
 	ctxInfo *global.ContextInfo,
 	cfg *MetricsConfig,
 	userAttribSelection attributes.Selection,
+	newExporter func() (metric.Exporter, error),
 ) (*MetricsReporter, error) {
 	log := mlog()
 
@@ -249,6 +299,10 @@ func newMetricsReporter(
 
 	is := instrumentations.NewInstrumentationSelection(cfg.Instrumentations)
 
+	if cfg.Exemplars {
+		enableExemplars()
+	}
+
 	mr := MetricsReporter{
 		ctx:        ctx,
 		cfg:        cfg,
@@ -267,7 +321,7 @@ func newMetricsReporter(
 		mr.attrHTTPClientRequestSize = attributes.OpenTelemetryGetters(
 			request.SpanOTELGetters, mr.attributes.For(attributes.HTTPClientRequestSize))
 	}
-	if is.GRPCEnabled() {
+	if is.RPCEnabled() {
 		mr.attrGRPCServer = attributes.OpenTelemetryGetters(
 			request.SpanOTELGetters, mr.attributes.For(attributes.RPCServerDuration))
 		mr.attrGRPCClient = attributes.OpenTelemetryGetters(
@@ -286,6 +340,13 @@ func newMetricsReporter(
 			request.SpanOTELGetters, mr.attributes.For(attributes.MessagingProcessDuration))
 	}
 
+	if is.TCPEnabled() {
+		mr.attrTCPClient = attributes.OpenTelemetryGetters(
+			request.SpanOTELGetters, mr.attributes.For(attributes.TCPClientDuration))
+		mr.attrTCPServer = attributes.OpenTelemetryGetters(
+			request.SpanOTELGetters, mr.attributes.For(attributes.TCPServerDuration))
+	}
+
 	mr.reporters = NewReporterPool[*svc.ID, *Metrics](cfg.ReportersCacheLen, cfg.TTL, timeNow,
 		func(id svc.UID, v *expirable[*Metrics]) {
 			if mr.cfg.SpanMetricsEnabled() {
@@ -297,13 +358,14 @@ func newMetricsReporter(
 			llog.Debug("evicting metrics reporter from cache")
 			v.value.cleanupAllMetricsInstances()
 			go func() {
-				if err := v.value.provider.ForceFlush(ctx); err != nil {
-					llog.Warn("error flushing evicted metrics provider", "error", err)
+				// shutting down the provider flushes its last metrics (especially relevant for delta
+				// temporality) and stops its periodic reader, so the evicted metrics aren't exported anymore
+				if err := v.value.provider.Shutdown(ctx); err != nil {
+					llog.Warn("error shutting down evicted metrics provider", "error", err)
 				}
 			}()
 		}, mr.newMetricSet)
-	// Instantiate the OTLP HTTP or GRPC metrics exporter
-	exporter, err := InstantiateMetricsExporter(ctx, cfg, log)
+	exporter, err := newExporter()
 	if err != nil {
 		return nil, err
 	}
@@ -312,6 +374,26 @@ func newMetricsReporter(
 	return &mr, nil
 }
 
+// setupRoutes makes the services that match any of the routes submit their metrics through the
+// exporter of the route, which is instantiated the first time that a service matches it.
+func (mr *MetricsReporter) setupRoutes(rs routes, newExporter func(r *route) (metric.Exporter, error)) {
+	mr.routes = rs
+	mr.routeExporters = NewReporterPool[*route, metric.Exporter](len(rs)+1, routeExportersTTL, timeNow,
+		func(id svc.UID, v *expirable[metric.Exporter]) {
+			if err := v.value.Shutdown(mr.ctx); err != nil {
+				mlog().Error("closing route metrics exporter", "route", id, "error", err)
+			}
+		}, newExporter)
+}
+
+// exporterFor returns the exporter of the route that matches the service, or the default exporter
+func (mr *MetricsReporter) exporterFor(service *svc.ID) (metric.Exporter, error) {
+	if r := mr.routes.forService(service); r != nil {
+		return mr.routeExporters.For(r)
+	}
+	return mr.exporter, nil
+}
+
 func (mr *MetricsReporter) otelMetricOptions(mlog *slog.Logger) []metric.Option {
 	var opts []metric.Option
 	if !mr.cfg.OTelMetricsEnabled() {
@@ -329,7 +411,7 @@ func (mr *MetricsReporter) otelMetricOptions(mlog *slog.Logger) []metric.Option
 		)
 	}
 
-	if mr.is.GRPCEnabled() {
+	if mr.is.RPCEnabled() {
 		opts = append(opts,
 			metric.WithView(otelHistogramConfig(attributes.RPCServerDuration.OTEL, mr.cfg.Buckets.DurationHistogram, useExponentialHistograms)),
 			metric.WithView(otelHistogramConfig(attributes.RPCClientDuration.OTEL, mr.cfg.Buckets.DurationHistogram, useExponentialHistograms)),
@@ -349,6 +431,13 @@ func (mr *MetricsReporter) otelMetricOptions(mlog *slog.Logger) []metric.Option
 		)
 	}
 
+	if mr.is.TCPEnabled() {
+		opts = append(opts,
+			metric.WithView(otelHistogramConfig(attributes.TCPClientDuration.OTEL, mr.cfg.Buckets.DurationHistogram, useExponentialHistograms)),
+			metric.WithView(otelHistogramConfig(attributes.TCPServerDuration.OTEL, mr.cfg.Buckets.DurationHistogram, useExponentialHistograms)),
+		)
+	}
+
 	return opts
 }
 
@@ -413,7 +502,7 @@ func (mr *MetricsReporter) setupOtelMeters(m *Metrics, meter instrument.Meter) e
 			m.ctx, httpClientRequestSize, mr.attrHTTPClientRequestSize, timeNow, mr.cfg.TTL)
 	}
 
-	if mr.is.GRPCEnabled() {
+	if mr.is.RPCEnabled() {
 		grpcDuration, err := meter.Float64Histogram(attributes.RPCServerDuration.OTEL, instrument.WithUnit("s"))
 		if err != nil {
 			return fmt.Errorf("creating grpc duration histogram metric: %w", err)
@@ -454,6 +543,22 @@ func (mr *MetricsReporter) setupOtelMeters(m *Metrics, meter instrument.Meter) e
 			m.ctx, msgProcessDuration, mr.attrMessagingProcess, timeNow, mr.cfg.TTL)
 	}
 
+	if mr.is.TCPEnabled() {
+		tcpClientDuration, err := meter.Float64Histogram(attributes.TCPClientDuration.OTEL, instrument.WithUnit("s"))
+		if err != nil {
+			return fmt.Errorf("creating tcp client duration histogram metric: %w", err)
+		}
+		m.tcpClientDuration = NewExpirer[*request.Span, instrument.Float64Histogram, float64](
+			m.ctx, tcpClientDuration, mr.attrTCPClient, timeNow, mr.cfg.TTL)
+
+		tcpServerDuration, err := meter.Float64Histogram(attributes.TCPServerDuration.OTEL, instrument.WithUnit("s"))
+		if err != nil {
+			return fmt.Errorf("creating tcp server duration histogram metric: %w", err)
+		}
+		m.tcpServerDuration = NewExpirer[*request.Span, instrument.Float64Histogram, float64](
+			m.ctx, tcpServerDuration, mr.attrTCPServer, timeNow, mr.cfg.TTL)
+	}
+
 	return nil
 }
 
@@ -548,9 +653,13 @@ func (mr *MetricsReporter) newMetricSet(service *svc.ID) (*Metrics, error) {
 	resourceAttributes := append(getAppResourceAttrs(mr.hostID, service), ResourceAttrsFromEnv()...)
 	resources := resource.NewWithAttributes(semconv.SchemaURL, resourceAttributes...)
 
+	exporter, err := mr.exporterFor(service)
+	if err != nil {
+		return nil, err
+	}
 	opts := []metric.Option{
 		metric.WithResource(resources),
-		metric.WithReader(metric.NewPeriodicReader(mr.exporter,
+		metric.WithReader(metric.NewPeriodicReader(sharedExporter{Exporter: exporter},
 			metric.WithInterval(mr.cfg.Interval))),
 	}
 
@@ -569,7 +678,6 @@ func (mr *MetricsReporter) newMetricSet(service *svc.ID) (*Metrics, error) {
 	// https://github.com/open-telemetry/opentelemetry-specification/tree/main/specification/metrics/semantic_conventions
 	// TODO: set ExplicitBucketBoundaries here and in prometheus from the previous specification
 	meter := m.provider.Meter(reporterName)
-	var err error
 	if mr.cfg.OTelMetricsEnabled() {
 		err = mr.setupOtelMeters(&m, meter)
 		if err != nil {
@@ -613,7 +721,15 @@ func isExponentialAggregation(mc *MetricsConfig, mlog *slog.Logger) bool {
 }
 
 // TODO: restore as private
-func InstantiateMetricsExporter(ctx context.Context, cfg *MetricsConfig, log *slog.Logger) (metric.Exporter, error) {
+// InstantiateMetricsExporter returns an OTLP HTTP or GRPC metrics exporter. If the persistent queue is enabled,
+// the queue name identifies the directory of its batches and its internal metrics.
+func InstantiateMetricsExporter(
+	ctx context.Context, cfg *MetricsConfig, internalMetrics imetrics.Reporter, queue string, log *slog.Logger,
+) (metric.Exporter, error) {
+	if cfg.PersistentQueueDirectory != "" {
+		log.Debug("instantiating metrics exporter with persistent queue", "directory", cfg.PersistentQueueDirectory)
+		return newQueuedMetricsExporter(ctx, cfg, internalMetrics, queue)
+	}
 	var err error
 	var exporter metric.Exporter
 	switch proto := cfg.GetProtocol(); proto {
@@ -639,7 +755,12 @@ func httpMetricsExporter(ctx context.Context, cfg *MetricsConfig) (metric.Export
 	if err != nil {
 		return nil, err
 	}
-	mexp, err := otlpmetrichttp.New(ctx, opts.AsMetricHTTP()...)
+	temporality, err := temporalitySelector(cfg.TemporalityPreference)
+	if err != nil {
+		return nil, err
+	}
+	mexp, err := otlpmetrichttp.New(ctx,
+		append(opts.AsMetricHTTP(), otlpmetrichttp.WithTemporalitySelector(temporality))...)
 	if err != nil {
 		return nil, fmt.Errorf("creating HTTP metric exporter: %w", err)
 	}
@@ -651,17 +772,67 @@ func grpcMetricsExporter(ctx context.Context, cfg *MetricsConfig) (metric.Export
 	if err != nil {
 		return nil, err
 	}
-	mexp, err := otlpmetricgrpc.New(ctx, opts.AsMetricGRPC()...)
+	temporality, err := temporalitySelector(cfg.TemporalityPreference)
+	if err != nil {
+		return nil, err
+	}
+	mexp, err := otlpmetricgrpc.New(ctx,
+		append(opts.AsMetricGRPC(), otlpmetricgrpc.WithTemporalitySelector(temporality))...)
 	if err != nil {
 		return nil, fmt.Errorf("creating GRPC metric exporter: %w", err)
 	}
 	return mexp, nil
 }
 
+// temporalitySelector returns the aggregation temporality of each instrument kind for the given
+// OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE value. UpDownCounters are always cumulative.
+func temporalitySelector(preference string) (metric.TemporalitySelector, error) {
+	switch strings.ToLower(preference) {
+	case "", TemporalityCumulative:
+		return metric.DefaultTemporalitySelector, nil
+	case TemporalityDelta:
+		return deltaTemporality, nil
+	case TemporalityLowMemory:
+		return lowMemoryTemporality, nil
+	}
+	return nil, fmt.Errorf("invalid temporality preference %q. Accepted values are: %s, %s, %s",
+		preference, TemporalityCumulative, TemporalityDelta, TemporalityLowMemory)
+}
+
+func deltaTemporality(kind metric.InstrumentKind) metricdata.Temporality {
+	switch kind {
+	case metric.InstrumentKindCounter, metric.InstrumentKindHistogram, metric.InstrumentKindObservableCounter:
+		return metricdata.DeltaTemporality
+	}
+	return metricdata.CumulativeTemporality
+}
+
+// lowMemoryTemporality avoids the memory cost of computing deltas from the asynchronous counters
+func lowMemoryTemporality(kind metric.InstrumentKind) metricdata.Temporality {
+	switch kind {
+	case metric.InstrumentKindCounter, metric.InstrumentKindHistogram:
+		return metricdata.DeltaTemporality
+	}
+	return metricdata.CumulativeTemporality
+}
+
+// sharedExporter wraps the exporter that is shared by the providers of all the reporters, so
+// the provider of an evicted reporter can be shut down without shutting down the exporter.
+type sharedExporter struct {
+	metric.Exporter
+}
+
+func (sharedExporter) Shutdown(_ context.Context) error {
+	return nil
+}
+
 func (mr *MetricsReporter) close() {
 	if err := mr.exporter.Shutdown(mr.ctx); err != nil {
 		slog.With("component", "MetricsReporter").Error("closing metrics provider", "error", err)
 	}
+	if len(mr.routes) > 0 {
+		mr.routeExporters.Purge()
+	}
 }
 
 // instrumentMetricsExporter checks whether the context is configured to report internal metrics and,
@@ -768,49 +939,67 @@ func (r *Metrics) record(span *request.Span, mr *MetricsReporter) {
 	duration := t.End.Sub(t.RequestStart).Seconds()
 
 	if otelSpanAccepted(span, mr) {
+		// the span context is provided to the instruments so the SDK can sample it as an exemplar
+		ctx := r.ctx
+		if mr.cfg.Exemplars {
+			ctx = exemplarContext(r.ctx, span)
+		}
 		switch span.Type {
 		case request.EventTypeHTTP:
 			if mr.is.HTTPEnabled() {
 				// TODO: for more accuracy, there must be a way to set the metric time from the actual span end time
 				httpDuration, attrs := r.httpDuration.ForRecord(span)
-				httpDuration.Record(r.ctx, duration, instrument.WithAttributeSet(attrs))
+				httpDuration.Record(ctx, duration, instrument.WithAttributeSet(attrs))
 
 				httpRequestSize, attrs := r.httpRequestSize.ForRecord(span)
-				httpRequestSize.Record(r.ctx, float64(span.RequestLength()), instrument.WithAttributeSet(attrs))
+				httpRequestSize.Record(ctx, float64(span.RequestLength()), instrument.WithAttributeSet(attrs))
 			}
 		case request.EventTypeGRPC:
-			if mr.is.GRPCEnabled() {
+			if mr.is.RPCEnabled() {
 				grpcDuration, attrs := r.grpcDuration.ForRecord(span)
-				grpcDuration.Record(r.ctx, duration, instrument.WithAttributeSet(attrs))
+				grpcDuration.Record(ctx, duration, instrument.WithAttributeSet(attrs))
 			}
 		case request.EventTypeGRPCClient:
-			if mr.is.GRPCEnabled() {
+			if mr.is.RPCEnabled() {
 				grpcClientDuration, attrs := r.grpcClientDuration.ForRecord(span)
-				grpcClientDuration.Record(r.ctx, duration, instrument.WithAttributeSet(attrs))
+				grpcClientDuration.Record(ctx, duration, instrument.WithAttributeSet(attrs))
 			}
 		case request.EventTypeHTTPClient:
 			if mr.is.HTTPEnabled() {
 				httpClientDuration, attrs := r.httpClientDuration.ForRecord(span)
-				httpClientDuration.Record(r.ctx, duration, instrument.WithAttributeSet(attrs))
+				httpClientDuration.Record(ctx, duration, instrument.WithAttributeSet(attrs))
 				httpClientRequestSize, attrs := r.httpClientRequestSize.ForRecord(span)
-				httpClientRequestSize.Record(r.ctx, float64(span.RequestLength()), instrument.WithAttributeSet(attrs))
+				httpClientRequestSize.Record(ctx, float64(span.RequestLength()), instrument.WithAttributeSet(attrs))
 			}
-		case request.EventTypeRedisServer, request.EventTypeRedisClient, request.EventTypeSQLClient:
+		case request.EventTypeRedisServer, request.EventTypeRedisClient, request.EventTypeSQLClient,
+			request.EventTypeMongoClient, request.EventTypeMemcachedClient:
 			if mr.is.DBEnabled() {
 				dbClientDuration, attrs := r.dbClientDuration.ForRecord(span)
-				dbClientDuration.Record(r.ctx, duration, instrument.WithAttributeSet(attrs))
+				dbClientDuration.Record(ctx, duration, instrument.WithAttributeSet(attrs))
 			}
-		case request.EventTypeKafkaClient, request.EventTypeKafkaServer:
+		case request.EventTypeKafkaClient, request.EventTypeKafkaServer,
+			request.EventTypeAMQPClient, request.EventTypeAMQPServer,
+			request.EventTypeNATSClient, request.EventTypeMQTTClient:
 			if mr.is.MQEnabled() {
 				switch span.Method {
 				case request.MessagingPublish:
 					msgPublishDuration, attrs := r.msgPublishDuration.ForRecord(span)
-					msgPublishDuration.Record(r.ctx, duration, instrument.WithAttributeSet(attrs))
+					msgPublishDuration.Record(ctx, duration, instrument.WithAttributeSet(attrs))
 				case request.MessagingProcess:
 					msgProcessDuration, attrs := r.msgProcessDuration.ForRecord(span)
-					msgProcessDuration.Record(r.ctx, duration, instrument.WithAttributeSet(attrs))
+					msgProcessDuration.Record(ctx, duration, instrument.WithAttributeSet(attrs))
 				}
 			}
+		case request.EventTypeTCPClient:
+			if mr.is.TCPEnabled() {
+				tcpClientDuration, attrs := r.tcpClientDuration.ForRecord(span)
+				tcpClientDuration.Record(ctx, duration, instrument.WithAttributeSet(attrs))
+			}
+		case request.EventTypeTCPServer:
+			if mr.is.TCPEnabled() {
+				tcpServerDuration, attrs := r.tcpServerDuration.ForRecord(span)
+				tcpServerDuration.Record(ctx, duration, instrument.WithAttributeSet(attrs))
+			}
 		}
 	}
 
@@ -899,6 +1088,7 @@ func getHTTPMetricEndpointOptions(cfg *MetricsConfig) (otlpOptions, error) {
 	}
 
 	cfg.Grafana.setupOptions(&opts)
+	opts.HTTPHeaders = withRouteHeaders(opts.HTTPHeaders, cfg.routeHeaders, envHeaders, envMetricsHeaders)
 
 	return opts, nil
 }
@@ -923,6 +1113,7 @@ func getGRPCMetricEndpointOptions(cfg *MetricsConfig) (otlpOptions, error) {
 		log.Debug("Setting InsecureSkipVerify")
 		opts.SkipTLSVerify = true
 	}
+	opts.HTTPHeaders = withRouteHeaders(nil, cfg.routeHeaders, envHeaders, envMetricsHeaders)
 	return opts, nil
 }
 
@@ -977,6 +1168,26 @@ func setMetricsProtocol(cfg *MetricsConfig) {
 	os.Setenv(envMetricsProtocol, string(cfg.GuessProtocol()))
 }
 
+// HACK: exemplars are an experimental feature of the OTEL Go SDK, which can only be
+// enabled through an environment variable. We don't override it if the user explicitly set it.
+// TODO: remove this once exemplars are enabled by default in the SDK
+func enableExemplars() {
+	if _, ok := os.LookupEnv(envExemplars); ok {
+		return
+	}
+	os.Setenv(envExemplars, "true")
+}
+
+// exemplarContext returns a context containing the span context of the span, so the OTEL SDK can
+// attach its trace and span IDs to the recorded measurements, if the span is sampled
+func exemplarContext(ctx context.Context, span *request.Span) context.Context {
+	return trace2.ContextWithSpanContext(ctx, trace2.NewSpanContext(trace2.SpanContextConfig{
+		TraceID:    span.TraceID,
+		SpanID:     span.SpanID,
+		TraceFlags: trace2.TraceFlags(span.Flags),
+	}))
+}
+
 func cleanupMetrics(ctx context.Context, m *Expirer[*request.Span, instrument.Float64Histogram, float64]) {
 	if m != nil {
 		m.RemoveAllMetrics(ctx)
@@ -991,6 +1202,8 @@ func (r *Metrics) cleanupAllMetricsInstances() {
 	cleanupMetrics(r.ctx, r.dbClientDuration)
 	cleanupMetrics(r.ctx, r.msgPublishDuration)
 	cleanupMetrics(r.ctx, r.msgProcessDuration)
+	cleanupMetrics(r.ctx, r.tcpClientDuration)
+	cleanupMetrics(r.ctx, r.tcpServerDuration)
 	cleanupMetrics(r.ctx, r.httpRequestSize)
 	cleanupMetrics(r.ctx, r.httpClientRequestSize)
 }
@@ -82,7 +82,7 @@ func NetMetricsExporterProvider(ctx context.Context, ctxInfo *global.ContextInfo
 func newMetricsExporter(ctx context.Context, ctxInfo *global.ContextInfo, cfg *NetMetricsConfig) (*netMetricsExporter, error) {
 	log := nmlog()
 	log.Debug("instantiating network metrics exporter provider")
-	exporter, err := InstantiateMetricsExporter(context.Background(), cfg.Metrics, log)
+	exporter, err := InstantiateMetricsExporter(context.Background(), cfg.Metrics, ctxInfo.Metrics, "network_metrics", log)
 	if err != nil {
 		log.Error("", "error", err)
 		return nil, err
@@ -41,7 +41,11 @@ type ProcMetricsConfig struct {
 }
 
 func (mc *ProcMetricsConfig) Enabled() bool {
-	return mc.Metrics != nil && mc.Metrics.EndpointEnabled() && mc.Metrics.OTelMetricsEnabled() &&
+	return mc.featuresEnabled() && mc.Metrics.EndpointEnabled()
+}
+
+func (mc *ProcMetricsConfig) featuresEnabled() bool {
+	return mc.Metrics != nil && mc.Metrics.OTelMetricsEnabled() &&
 		slices.Contains(mc.Metrics.Features, FeatureProcess)
 }
 
@@ -102,7 +106,9 @@ func ProcMetricsExporterProvider(
 			// This node is not going to be instantiated. Let the pipes library just ignore it.
 			return pipe.IgnoreFinal[[]*process.Status](), nil
 		}
-		return newProcMetricsExporter(ctx, ctxInfo, cfg)
+		return newProcMetricsExporter(ctx, ctxInfo, cfg, func() (metric.Exporter, error) {
+			return InstantiateMetricsExporter(ctx, cfg.Metrics, ctxInfo.Metrics, "process_metrics", pmlog())
+		})
 	}
 }
 
@@ -110,6 +116,7 @@ func newProcMetricsExporter(
 	ctx context.Context,
 	ctxInfo *global.ContextInfo,
 	cfg *ProcMetricsConfig,
+	newExporter func() (metric.Exporter, error),
 ) (pipe.FinalFunc[[]*process.Status], error) {
 	SetupInternalOTELSDKLogger(cfg.Metrics.SDKLogLevel)
 
@@ -176,13 +183,13 @@ func newProcMetricsExporter(
 			llog.Debug("evicting metrics reporter from cache")
 			v.value.cleanupAllMetricsInstances()
 			go func() {
-				if err := v.value.provider.ForceFlush(ctx); err != nil {
-					llog.Warn("error flushing evicted metrics provider", "error", err)
+				if err := v.value.provider.Shutdown(ctx); err != nil {
+					llog.Warn("error shutting down evicted metrics provider", "error", err)
 				}
 			}()
 		}, mr.newMetricSet)
 
-	mr.exporter, err = InstantiateMetricsExporter(ctx, cfg.Metrics, log)
+	mr.exporter, err = newExporter()
 	if err != nil {
 		log.Error("instantiating metrics exporter", "error", err)
 		return nil, err
@@ -212,7 +219,7 @@ func (me *procMetricsExporter) newMetricSet(procID *process.ID) (*procMetrics, e
 	resources := resource.NewWithAttributes(semconv.SchemaURL, getProcessResourceAttrs(me.hostID, procID)...)
 	opts := []metric.Option{
 		metric.WithResource(resources),
-		metric.WithReader(metric.NewPeriodicReader(me.exporter,
+		metric.WithReader(metric.NewPeriodicReader(sharedExporter{Exporter: me.exporter},
 			metric.WithInterval(me.cfg.Metrics.Interval))),
 	}
 
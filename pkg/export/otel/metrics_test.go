@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -15,6 +16,8 @@ import (
 	"github.com/mariomac/pipes/pipe"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 
 	"github.com/grafana/beyla/pkg/export/attributes"
 	"github.com/grafana/beyla/pkg/export/instrumentations"
@@ -368,6 +371,40 @@ type InstrTest struct {
 	extraColl int
 }
 
+func TestTemporalitySelector(t *testing.T) {
+	allKinds := []metric.InstrumentKind{
+		metric.InstrumentKindCounter, metric.InstrumentKindUpDownCounter, metric.InstrumentKindHistogram,
+		metric.InstrumentKindObservableCounter, metric.InstrumentKindObservableUpDownCounter,
+		metric.InstrumentKindObservableGauge, metric.InstrumentKindGauge,
+	}
+	for _, tc := range []struct {
+		preference string
+		deltaKinds []metric.InstrumentKind
+	}{
+		{preference: ""},
+		{preference: "cumulative"},
+		{preference: "Delta", deltaKinds: []metric.InstrumentKind{
+			metric.InstrumentKindCounter, metric.InstrumentKindHistogram, metric.InstrumentKindObservableCounter}},
+		{preference: "lowmemory", deltaKinds: []metric.InstrumentKind{
+			metric.InstrumentKindCounter, metric.InstrumentKindHistogram}},
+	} {
+		t.Run(tc.preference, func(t *testing.T) {
+			selector, err := temporalitySelector(tc.preference)
+			require.NoError(t, err)
+			for _, kind := range allKinds {
+				if slices.Contains(tc.deltaKinds, kind) {
+					assert.Equal(t, metricdata.DeltaTemporality, selector(kind), kind.String())
+				} else {
+					assert.Equal(t, metricdata.CumulativeTemporality, selector(kind), kind.String())
+				}
+			}
+		})
+	}
+
+	_, err := temporalitySelector("foo")
+	assert.Error(t, err)
+}
+
 func TestAppMetrics_ByInstrumentation(t *testing.T) {
 	defer restoreEnvAfterExecution()()
 
@@ -0,0 +1,367 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configgrpc"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/configtelemetry"
+	"go.opentelemetry.io/collector/config/configtls"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
+	"go.opentelemetry.io/collector/exporter/otlpexporter"
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
+	"go.opentelemetry.io/collector/extension/experimental/storage"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+)
+
+func pqlog() *slog.Logger {
+	return slog.With("component", "otel.PersistentQueue")
+}
+
+var fileStorageID = component.MustNewID("beyla_file_storage")
+
+var errPersistentQueueFull = errors.New("persistent queue is full")
+
+// persistentQueueConfig returns the settings of the collector's exporterhelper queue to store the
+// pending batches in the storage extension provided by persistentQueueHost
+func persistentQueueConfig(size int) exporterhelper.QueueSettings {
+	qs := exporterhelper.NewDefaultQueueSettings()
+	qs.Enabled = true
+	if size > 0 {
+		qs.QueueSize = size
+	}
+	id := fileStorageID
+	qs.StorageID = &id
+	return qs
+}
+
+// persistentQueueHost returns the component.Host that needs to be passed to the Start method of an exporter
+// with a persistent queue, as it provides the storage extension that keeps each pending batch in a file of
+// the provided directory. The stored batches are replayed when Beyla is restarted.
+// The queue name identifies the exporter in the internal metrics.
+func persistentQueueHost(directory string, maxBytes int64, queue string, internalMetrics imetrics.Reporter) component.Host {
+	if internalMetrics == nil {
+		internalMetrics = imetrics.NoopReporter{}
+	}
+	return storageHost{fileStorageID: &fileStorage{
+		directory: directory,
+		maxBytes:  maxBytes,
+		onLength: func(length int) {
+			internalMetrics.OTELExportQueueLength(queue, length)
+		},
+	}}
+}
+
+// storageHost provides the storage extension to the exporters
+type storageHost map[component.ID]component.Component
+
+func (sh storageHost) GetExtensions() map[component.ID]component.Component {
+	return sh
+}
+
+// fileStorage is a minimal implementation of the storage extension of the OpenTelemetry collector, which
+// allows the persistent queue of the exporterhelper to store each batch in its own file.
+type fileStorage struct {
+	component.StartFunc
+	component.ShutdownFunc
+	directory string
+	// maxBytes of the stored batches. If 0, the storage size is not limited
+	maxBytes int64
+	onLength func(length int)
+}
+
+func (fs *fileStorage) GetClient(_ context.Context, kind component.Kind, id component.ID, name string) (storage.Client, error) {
+	dir := filepath.Join(fs.directory, url.PathEscape(strings.ToLower(kind.String())+"_"+id.String()+"_"+name))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating persistent queue directory: %w", err)
+	}
+	fc := &fileClient{dir: dir, maxBytes: fs.maxBytes, onLength: fs.onLength, items: map[string]int64{}}
+	if err := fc.load(); err != nil {
+		return nil, err
+	}
+	pqlog().Debug("persistent queue loaded", "dir", dir, "batches", len(fc.items), "bytes", fc.bytes)
+	fc.onLength(len(fc.items))
+	return fc, nil
+}
+
+type fileClient struct {
+	mt       sync.Mutex
+	dir      string
+	maxBytes int64
+	onLength func(length int)
+	// size of the stored batches, by key
+	items map[string]int64
+	bytes int64
+}
+
+// isItem returns whether the key belongs to a batch. The rest of keys
+// are the read and write indices of the queue, and other metadata.
+func isItem(key string) bool {
+	_, err := strconv.ParseUint(key, 10, 64)
+	return err == nil
+}
+
+func (fc *fileClient) path(key string) string {
+	return filepath.Join(fc.dir, url.PathEscape(key))
+}
+
+// load accounts the batches that were stored by a previous execution, and removes
+// the temporary files that weren't completely written
+func (fc *fileClient) load() error {
+	entries, err := os.ReadDir(fc.dir)
+	if err != nil {
+		return fmt.Errorf("reading persistent queue directory: %w", err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			_ = os.Remove(filepath.Join(fc.dir, entry.Name()))
+			continue
+		}
+		key, err := url.PathUnescape(entry.Name())
+		if err != nil || !isItem(key) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		fc.items[key] = info.Size()
+		fc.bytes += info.Size()
+	}
+	return nil
+}
+
+func (fc *fileClient) Get(ctx context.Context, key string) ([]byte, error) {
+	op := storage.GetOperation(key)
+	err := fc.Batch(ctx, op)
+	return op.Value, err
+}
+
+func (fc *fileClient) Set(ctx context.Context, key string, value []byte) error {
+	return fc.Batch(ctx, storage.SetOperation(key, value))
+}
+
+func (fc *fileClient) Delete(ctx context.Context, key string) error {
+	return fc.Batch(ctx, storage.DeleteOperation(key))
+}
+
+// Batch runs the operations, after verifying that the stored batches won't exceed the maximum size.
+// The operations over the batches run before the operations over the indices, so a crash never leaves
+// an index pointing to a batch that hasn't been written.
+func (fc *fileClient) Batch(_ context.Context, ops ...storage.Operation) error {
+	fc.mt.Lock()
+	defer fc.mt.Unlock()
+
+	if fc.maxBytes > 0 {
+		newBytes := fc.bytes
+		for _, op := range ops {
+			if !isItem(op.Key) {
+				continue
+			}
+			switch op.Type {
+			case storage.Set:
+				newBytes += int64(len(op.Value)) - fc.items[op.Key]
+			case storage.Delete:
+				newBytes -= fc.items[op.Key]
+			}
+		}
+		if newBytes > fc.bytes && newBytes > fc.maxBytes {
+			return fmt.Errorf("%w: it can't exceed %d bytes", errPersistentQueueFull, fc.maxBytes)
+		}
+	}
+
+	defer func() { fc.onLength(len(fc.items)) }()
+	for _, items := range []bool{true, false} {
+		for _, op := range ops {
+			if isItem(op.Key) != items {
+				continue
+			}
+			if err := fc.run(op); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (fc *fileClient) run(op storage.Operation) error {
+	switch op.Type {
+	case storage.Get:
+		value, err := os.ReadFile(fc.path(op.Key))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("reading %s from persistent queue: %w", op.Key, err)
+		}
+		op.Value = value
+	case storage.Set:
+		if err := writeFileSync(fc.path(op.Key), op.Value); err != nil {
+			return fmt.Errorf("writing %s into persistent queue: %w", op.Key, err)
+		}
+		if isItem(op.Key) {
+			fc.bytes += int64(len(op.Value)) - fc.items[op.Key]
+			fc.items[op.Key] = int64(len(op.Value))
+		}
+	case storage.Delete:
+		if err := os.Remove(fc.path(op.Key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("deleting %s from persistent queue: %w", op.Key, err)
+		}
+		fc.bytes -= fc.items[op.Key]
+		delete(fc.items, op.Key)
+	}
+	return nil
+}
+
+func (fc *fileClient) Close(_ context.Context) error {
+	return nil
+}
+
+// writeFileSync writes the file into a temporary file that is renamed once it is flushed to disk,
+// so a crash never leaves a partially written file
+func writeFileSync(path string, value []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(value); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// queuedMetricsExporter is an SDK metrics exporter that submits the metrics through an exporter of the
+// OTEL collector, whose persistent queue keeps the batches that couldn't be submitted yet
+type queuedMetricsExporter struct {
+	temporality metric.TemporalitySelector
+	exporter    exporter.Metrics
+	queue       string
+	internal    imetrics.Reporter
+}
+
+func newQueuedMetricsExporter(
+	ctx context.Context, cfg *MetricsConfig, internalMetrics imetrics.Reporter, queue string,
+) (*queuedMetricsExporter, error) {
+	temporality, err := temporalitySelector(cfg.TemporalityPreference)
+	if err != nil {
+		return nil, err
+	}
+	if internalMetrics == nil {
+		internalMetrics = imetrics.NoopReporter{}
+	}
+	set := exporter.Settings{
+		ID: component.NewIDWithName(component.DataTypeMetrics, queue),
+		TelemetrySettings: component.TelemetrySettings{
+			Logger:         zap.NewNop(),
+			MeterProvider:  metric.NewMeterProvider(),
+			TracerProvider: tracenoop.NewTracerProvider(),
+			MetricsLevel:   configtelemetry.LevelNone,
+		},
+	}
+	var exp exporter.Metrics
+	switch proto := cfg.GetProtocol(); proto {
+	case ProtocolHTTPJSON, ProtocolHTTPProtobuf, "":
+		opts, err := getHTTPMetricEndpointOptions(cfg)
+		if err != nil {
+			return nil, err
+		}
+		scheme := "https"
+		if opts.Insecure {
+			scheme = "http"
+		}
+		factory := otlphttpexporter.NewFactory()
+		config := factory.CreateDefaultConfig().(*otlphttpexporter.Config)
+		config.QueueConfig = persistentQueueConfig(cfg.PersistentQueueSize)
+		config.MetricsEndpoint = scheme + "://" + opts.Endpoint + opts.URLPath
+		config.ClientConfig = confighttp.ClientConfig{
+			Endpoint: scheme + "://" + opts.Endpoint,
+			TLSSetting: configtls.ClientConfig{
+				Insecure:           opts.Insecure,
+				InsecureSkipVerify: opts.SkipTLSVerify,
+			},
+			Headers: convertHeaders(opts.HTTPHeaders),
+		}
+		if exp, err = factory.CreateMetricsExporter(ctx, set, config); err != nil {
+			return nil, fmt.Errorf("creating HTTP metrics exporter: %w", err)
+		}
+	case ProtocolGRPC:
+		opts, err := getGRPCMetricEndpointOptions(cfg)
+		if err != nil {
+			return nil, err
+		}
+		endpoint, _, err := parseMetricsEndpoint(cfg)
+		if err != nil {
+			return nil, err
+		}
+		factory := otlpexporter.NewFactory()
+		config := factory.CreateDefaultConfig().(*otlpexporter.Config)
+		config.QueueConfig = persistentQueueConfig(cfg.PersistentQueueSize)
+		config.ClientConfig = configgrpc.ClientConfig{
+			Endpoint: endpoint.String(),
+			TLSSetting: configtls.ClientConfig{
+				Insecure:           opts.Insecure,
+				InsecureSkipVerify: opts.SkipTLSVerify,
+			},
+			Headers: convertHeaders(opts.HTTPHeaders),
+		}
+		if exp, err = factory.CreateMetricsExporter(ctx, set, config); err != nil {
+			return nil, fmt.Errorf("creating GRPC metrics exporter: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid protocol value: %q. Accepted values are: %s, %s, %s",
+			proto, ProtocolGRPC, ProtocolHTTPJSON, ProtocolHTTPProtobuf)
+	}
+	host := persistentQueueHost(cfg.PersistentQueueDirectory, cfg.PersistentQueueMaxBytes, queue, internalMetrics)
+	if err := exp.Start(ctx, host); err != nil {
+		return nil, fmt.Errorf("starting metrics exporter: %w", err)
+	}
+	return &queuedMetricsExporter{temporality: temporality, exporter: exp, queue: queue, internal: internalMetrics}, nil
+}
+
+func (qe *queuedMetricsExporter) Temporality(kind metric.InstrumentKind) metricdata.Temporality {
+	return qe.temporality(kind)
+}
+
+func (qe *queuedMetricsExporter) Aggregation(kind metric.InstrumentKind) metric.Aggregation {
+	return metric.DefaultAggregationSelector(kind)
+}
+
+func (qe *queuedMetricsExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	md := toPMetrics(rm)
+	if err := qe.exporter.ConsumeMetrics(ctx, md); err != nil {
+		// with a queue, the metrics are only rejected if they can't be enqueued
+		qe.internal.OTELExportQueueDrop(qe.queue, md.DataPointCount())
+		return err
+	}
+	return nil
+}
+
+func (qe *queuedMetricsExporter) ForceFlush(_ context.Context) error {
+	return nil
+}
+
+func (qe *queuedMetricsExporter) Shutdown(ctx context.Context) error {
+	return qe.exporter.Shutdown(ctx)
+}
@@ -0,0 +1,274 @@
+package otel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mariomac/guara/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/extension/experimental/storage"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+type fakeQueueMetrics struct {
+	imetrics.NoopReporter
+	mt      sync.Mutex
+	length  map[string]int
+	dropped map[string]int
+}
+
+func newFakeQueueMetrics() *fakeQueueMetrics {
+	return &fakeQueueMetrics{length: map[string]int{}, dropped: map[string]int{}}
+}
+
+func (f *fakeQueueMetrics) OTELExportQueueLength(queue string, len int) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.length[queue] = len
+}
+
+func (f *fakeQueueMetrics) OTELExportQueueDrop(queue string, len int) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.dropped[queue] += len
+}
+
+func (f *fakeQueueMetrics) Length(queue string) int {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	return f.length[queue]
+}
+
+// collector that rejects all the requests until it is marked as up
+type flakyCollector struct {
+	up       atomic.Bool
+	accepted atomic.Int32
+	rejected atomic.Int32
+}
+
+func (fc *flakyCollector) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	if !fc.up.Load() {
+		fc.rejected.Add(1)
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	fc.accepted.Add(1)
+	rw.WriteHeader(http.StatusOK)
+}
+
+func TestFileStorage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	length := 0
+	fs := &fileStorage{directory: dir, maxBytes: 10, onLength: func(l int) { length = l }}
+	client, err := fs.GetClient(ctx, component.KindExporter, component.MustNewID("test"), "traces")
+	require.NoError(t, err)
+
+	// missing keys return nil
+	v, err := client.Get(ctx, "wi")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	require.NoError(t, client.Batch(ctx,
+		storage.SetOperation("wi", []byte{1}),
+		storage.SetOperation("0", []byte("12345"))))
+	assert.Equal(t, 1, length)
+	v, err = client.Get(ctx, "0")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("12345"), v)
+
+	// the batches can't exceed the maximum size
+	err = client.Batch(ctx,
+		storage.SetOperation("wi", []byte{2}),
+		storage.SetOperation("1", []byte("123456")))
+	require.ErrorIs(t, err, errPersistentQueueFull)
+	// and the rejected batch doesn't modify anything
+	v, err = client.Get(ctx, "wi")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1}, v)
+	require.NoError(t, client.Set(ctx, "1", []byte("12345")))
+	assert.Equal(t, 2, length)
+
+	// WHEN the storage is loaded again, it keeps the stored batches
+	// and removes the partially written files
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "exporter_test_traces", "2.tmp"), []byte("123"), 0o600))
+	fs = &fileStorage{directory: dir, maxBytes: 10, onLength: func(l int) { length = l }}
+	client, err = fs.GetClient(ctx, component.KindExporter, component.MustNewID("test"), "traces")
+	require.NoError(t, err)
+	assert.Equal(t, 2, length)
+	assert.NoFileExists(t, filepath.Join(dir, "exporter_test_traces", "2.tmp"))
+	require.Error(t, client.Set(ctx, "2", []byte("1")))
+
+	require.NoError(t, client.Delete(ctx, "0"))
+	assert.Equal(t, 1, length)
+	require.NoError(t, client.Set(ctx, "2", []byte("1")))
+	assert.Equal(t, 2, length)
+}
+
+func TestTracesPersistentQueue_Replay(t *testing.T) {
+	defer restoreEnvAfterExecution()()
+	ctx := context.Background()
+	collector := &flakyCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	internalMetrics := newFakeQueueMetrics()
+	cfg := TracesConfig{
+		TracesEndpoint:           srv.URL + "/v1/traces",
+		Protocol:                 ProtocolHTTPProtobuf,
+		PersistentQueueDirectory: t.TempDir(),
+		BackOffInitialInterval:   10 * time.Millisecond,
+		BackOffMaxInterval:       10 * time.Millisecond,
+		BackOffMaxElapsedTime:    time.Hour,
+	}
+	startExporter := func() func(ctx context.Context) error {
+		exp, err := getTracesExporter(ctx, cfg, &global.ContextInfo{Metrics: internalMetrics})
+		require.NoError(t, err)
+		require.NoError(t, exp.Start(ctx, persistentQueueHost(
+			cfg.PersistentQueueDirectory, cfg.PersistentQueueMaxBytes, "traces", internalMetrics)))
+		span := request.Span{Type: request.EventTypeHTTP, Method: "GET", Route: "/foo", ServiceID: svc.ID{Name: "svc"}}
+		require.NoError(t, exp.ConsumeTraces(ctx, GenerateTraces(&span, "host-id", nil, nil)))
+		return exp.Shutdown
+	}
+
+	// GIVEN an exporter whose collector is down
+	shutdown := startExporter()
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		assert.Positive(t, collector.rejected.Load())
+	})
+	// WHEN Beyla is stopped before the collector is back
+	require.NoError(t, shutdown(ctx))
+	// THEN the batch is kept in disk
+	assert.Equal(t, 1, internalMetrics.Length("traces"))
+	assert.Zero(t, collector.accepted.Load())
+
+	// AND WHEN the collector is up and Beyla is restarted
+	collector.up.Store(true)
+	shutdown = startExporter()
+	defer func() { require.NoError(t, shutdown(ctx)) }()
+
+	// THEN both the stored and the new batches are submitted
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		assert.EqualValues(t, 2, collector.accepted.Load())
+		assert.Zero(t, internalMetrics.Length("traces"))
+	})
+}
+
+func TestMetricsPersistentQueue(t *testing.T) {
+	defer restoreEnvAfterExecution()()
+	ctx := context.Background()
+	collector := &flakyCollector{}
+	collector.up.Store(true)
+	var path atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		path.Store(req.URL.Path)
+		collector.ServeHTTP(rw, req)
+	}))
+	defer srv.Close()
+
+	internalMetrics := newFakeQueueMetrics()
+	exp, err := InstantiateMetricsExporter(ctx, &MetricsConfig{
+		MetricsEndpoint:          srv.URL + "/otlp/v1/metrics",
+		Protocol:                 ProtocolHTTPProtobuf,
+		PersistentQueueDirectory: t.TempDir(),
+	}, internalMetrics, "metrics", mlog())
+	require.NoError(t, err)
+	defer exp.Shutdown(ctx)
+	require.IsType(t, &queuedMetricsExporter{}, exp)
+
+	require.NoError(t, exp.Export(ctx, &metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(attribute.String("service.name", "svc")),
+		ScopeMetrics: []metricdata.ScopeMetrics{{Metrics: []metricdata.Metrics{{
+			Name: "requests",
+			Data: metricdata.Sum[int64]{IsMonotonic: true, Temporality: metricdata.CumulativeTemporality,
+				DataPoints: []metricdata.DataPoint[int64]{{Value: 3}}},
+		}}}},
+	}))
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		assert.EqualValues(t, 1, collector.accepted.Load())
+	})
+	assert.Equal(t, "/otlp/v1/metrics", path.Load())
+}
+
+func TestToPMetrics(t *testing.T) {
+	now := time.Now()
+	md := toPMetrics(&metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(attribute.String("service.name", "svc")),
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: instrumentation.Scope{Name: "beyla"},
+			Metrics: []metricdata.Metrics{{
+				Name: "calls",
+				Unit: "1",
+				Data: metricdata.Sum[float64]{IsMonotonic: true, Temporality: metricdata.DeltaTemporality,
+					DataPoints: []metricdata.DataPoint[float64]{{
+						Attributes: attribute.NewSet(attribute.String("url.path", "/foo")),
+						Time:       now,
+						Value:      2.5,
+					}}},
+			}, {
+				Name: "duration",
+				Data: metricdata.Histogram[float64]{Temporality: metricdata.CumulativeTemporality,
+					DataPoints: []metricdata.HistogramDataPoint[float64]{{
+						Count:        3,
+						Sum:          6,
+						Bounds:       []float64{1, 2},
+						BucketCounts: []uint64{1, 1, 1},
+						Min:          metricdata.NewExtrema[float64](1),
+						Exemplars: []metricdata.Exemplar[float64]{{
+							Value:   3,
+							TraceID: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+							SpanID:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+						}},
+					}}},
+			}},
+		}},
+	})
+
+	require.Equal(t, 1, md.ResourceMetrics().Len())
+	rm := md.ResourceMetrics().At(0)
+	svcName, _ := rm.Resource().Attributes().Get("service.name")
+	assert.Equal(t, "svc", svcName.Str())
+	sm := rm.ScopeMetrics().At(0)
+	assert.Equal(t, "beyla", sm.Scope().Name())
+	require.Equal(t, 2, sm.Metrics().Len())
+
+	calls := sm.Metrics().At(0)
+	assert.Equal(t, "calls", calls.Name())
+	assert.Equal(t, pmetric.MetricTypeSum, calls.Type())
+	assert.True(t, calls.Sum().IsMonotonic())
+	assert.Equal(t, pmetric.AggregationTemporalityDelta, calls.Sum().AggregationTemporality())
+	dp := calls.Sum().DataPoints().At(0)
+	assert.Equal(t, 2.5, dp.DoubleValue())
+	assert.Equal(t, now.UnixNano(), int64(dp.Timestamp()))
+	path, _ := dp.Attributes().Get("url.path")
+	assert.Equal(t, "/foo", path.Str())
+
+	duration := sm.Metrics().At(1)
+	assert.Equal(t, pmetric.MetricTypeHistogram, duration.Type())
+	hdp := duration.Histogram().DataPoints().At(0)
+	assert.EqualValues(t, 3, hdp.Count())
+	assert.EqualValues(t, 6, hdp.Sum())
+	assert.EqualValues(t, 1, hdp.Min())
+	assert.False(t, hdp.HasMax())
+	assert.Equal(t, []float64{1, 2}, hdp.ExplicitBounds().AsRaw())
+	assert.Equal(t, []uint64{1, 1, 1}, hdp.BucketCounts().AsRaw())
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", hdp.Exemplars().At(0).TraceID().String())
+}
@@ -0,0 +1,180 @@
+package otel
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gobwas/glob"
+
+	attr "github.com/grafana/beyla/pkg/export/attributes/names"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+// the route exporters are never expired, as they are bounded by the number of routing rules and
+// the expiration of a metrics exporter would break the providers of the services that still use it
+const routeExportersTTL = time.Duration(math.MaxInt64)
+
+var validRouteName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// RoutingRule submits the telemetry of the services that match all the Match entries to a different
+// endpoint, or with different headers. For example, to send the data of each team to a different
+// tenant of a multi-tenant backend, by setting the X-Scope-OrgID header.
+type RoutingRule struct {
+	// Name identifies the route in the logs and in the persistent queue subdirectories.
+	// It must only contain letters, numbers, dashes and underscores.
+	Name string `yaml:"name"`
+	// Match maps service attribute names to the glob patterns that their values must match.
+	// Accepted attributes are service.name, service.namespace and any metadata attribute of the
+	// service, such as k8s.namespace.name, k8s.deployment.name or k8s.cluster.name.
+	Match map[string]string `yaml:"match"`
+	// Endpoint overrides the endpoint of the default exporter. It is interpreted in the same way
+	// as the OTEL_EXPORTER_OTLP_ENDPOINT variable, so the signal path is appended to it for the
+	// HTTP protocols. If empty, the route submits the data to the default endpoint.
+	Endpoint string `yaml:"endpoint"`
+	// Headers are added to the requests of the route, overriding any header with the same name.
+	Headers map[string]string `yaml:"headers"`
+}
+
+// RoutingRules are evaluated in order. The first rule that matches a service determines where its
+// telemetry is submitted. The services that don't match any rule use the default exporter.
+type RoutingRules []RoutingRule
+
+func (rr RoutingRules) Validate() error {
+	names := map[string]struct{}{}
+	for i := range rr {
+		r := &rr[i]
+		if !validRouteName.MatchString(r.Name) {
+			return fmt.Errorf("invalid routing rule name %q. It must only contain letters, numbers, '-' and '_'", r.Name)
+		}
+		if _, ok := names[r.Name]; ok {
+			return fmt.Errorf("duplicate routing rule name %q", r.Name)
+		}
+		names[r.Name] = struct{}{}
+		if len(r.Match) == 0 {
+			return fmt.Errorf("routing rule %q must define at least a match entry", r.Name)
+		}
+		if r.Endpoint == "" && len(r.Headers) == 0 {
+			return fmt.Errorf("routing rule %q must define an endpoint or headers", r.Name)
+		}
+	}
+	_, err := rr.compile()
+	return err
+}
+
+// route is a compiled RoutingRule
+type route struct {
+	*RoutingRule
+	matchers map[attr.Name]glob.Glob
+}
+
+// GetUID allows using the route as a ReporterPool key
+func (r *route) GetUID() svc.UID {
+	return svc.UID(r.Name)
+}
+
+func (r *route) matches(service *svc.ID) bool {
+	for name, g := range r.matchers {
+		if !g.Match(serviceAttribute(service, name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func serviceAttribute(service *svc.ID, name attr.Name) string {
+	switch name {
+	case attr.ServiceName:
+		return service.Name
+	case attr.ServiceNamespace:
+		return service.Namespace
+	}
+	return service.Metadata[name]
+}
+
+// tracesConfig returns the configuration of the exporter of the route, based on the default configuration
+func (r *route) tracesConfig(cfg TracesConfig) TracesConfig {
+	if r.Endpoint != "" {
+		cfg.CommonEndpoint, cfg.TracesEndpoint = r.Endpoint, ""
+		// avoid leaking the Grafana Cloud credentials to a different endpoint
+		cfg.Grafana = nil
+	}
+	cfg.routeHeaders = r.Headers
+	if cfg.persistentQueueEnabled() {
+		cfg.PersistentQueueDirectory = filepath.Join(cfg.PersistentQueueDirectory, "routes", r.Name)
+	}
+	return cfg
+}
+
+// metricsConfig returns the configuration of the exporter of the route, based on the default configuration
+func (r *route) metricsConfig(cfg *MetricsConfig) *MetricsConfig {
+	rc := *cfg
+	if r.Endpoint != "" {
+		rc.CommonEndpoint, rc.MetricsEndpoint = r.Endpoint, ""
+		// avoid leaking the Grafana Cloud credentials to a different endpoint
+		rc.Grafana = nil
+	}
+	rc.routeHeaders = r.Headers
+	if rc.PersistentQueueDirectory != "" {
+		rc.PersistentQueueDirectory = filepath.Join(rc.PersistentQueueDirectory, "routes", r.Name)
+	}
+	return &rc
+}
+
+// queueName identifies the persistent queue of the route in the internal metrics
+func (r *route) queueName(signal string) string {
+	return signal + "/" + r.Name
+}
+
+type routes []*route
+
+func (rr RoutingRules) compile() (routes, error) {
+	rs := make(routes, 0, len(rr))
+	var errs []error
+	for i := range rr {
+		r := &route{RoutingRule: &rr[i], matchers: map[attr.Name]glob.Glob{}}
+		for name, pattern := range rr[i].Match {
+			g, err := glob.Compile(pattern)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("routing rule %q: invalid glob %q for %s: %w", r.Name, pattern, name, err))
+				continue
+			}
+			// accept also the Prometheus-like underscore notation
+			r.matchers[attr.Name(strings.ReplaceAll(name, "_", "."))] = g
+		}
+		rs = append(rs, r)
+	}
+	return rs, errors.Join(errs...)
+}
+
+// forService returns the first route that matches the service, or nil if the service
+// must be submitted through the default exporter.
+func (rs routes) forService(service *svc.ID) *route {
+	for _, r := range rs {
+		if r.matches(service) {
+			return r
+		}
+	}
+	return nil
+}
+
+// withRouteHeaders adds the route headers to the exporter headers. As explicitly setting the headers
+// of the OTEL SDK exporters overrides the headers from the environment, the headers from the
+// provided environment variables are also added.
+func withRouteHeaders(headers, routeHeaders map[string]string, envVars ...string) map[string]string {
+	if len(routeHeaders) == 0 {
+		return headers
+	}
+	merged := map[string]string{}
+	for _, envVar := range envVars {
+		maps.Copy(merged, headersFromEnv(envVar))
+	}
+	maps.Copy(merged, headers)
+	maps.Copy(merged, routeHeaders)
+	return merged
+}
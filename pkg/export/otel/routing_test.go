@@ -0,0 +1,190 @@
+package otel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mariomac/guara/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/export/attributes"
+	attr "github.com/grafana/beyla/pkg/export/attributes/names"
+	"github.com/grafana/beyla/pkg/export/instrumentations"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func TestRoutingRules_Validate(t *testing.T) {
+	valid := RoutingRule{
+		Name:    "team-a",
+		Match:   map[string]string{"k8s.namespace.name": "team-a-*"},
+		Headers: map[string]string{"X-Scope-OrgID": "team-a"},
+	}
+	assert.NoError(t, RoutingRules{}.Validate())
+	assert.NoError(t, RoutingRules{valid}.Validate())
+
+	for name, rule := range map[string]func(r *RoutingRule){
+		"missing name":          func(r *RoutingRule) { r.Name = "" },
+		"invalid name":          func(r *RoutingRule) { r.Name = "../team" },
+		"missing match":         func(r *RoutingRule) { r.Match = nil },
+		"missing destination":   func(r *RoutingRule) { r.Headers = nil },
+		"invalid match pattern": func(r *RoutingRule) { r.Match = map[string]string{"service.name": "[abc"} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := valid
+			rule(&r)
+			assert.Error(t, RoutingRules{r}.Validate())
+		})
+	}
+	t.Run("duplicate name", func(t *testing.T) {
+		assert.Error(t, RoutingRules{valid, valid}.Validate())
+	})
+}
+
+func TestRoutes_ForService(t *testing.T) {
+	rs, err := RoutingRules{
+		{Name: "payments", Match: map[string]string{"service.name": "payment*", "k8s_namespace_name": "team-a"}},
+		{Name: "team-a", Match: map[string]string{"k8s.namespace.name": "team-a"}},
+		{Name: "shop", Match: map[string]string{"service.namespace": "shop-{eu,us}"}},
+	}.compile()
+	require.NoError(t, err)
+
+	routeName := func(id svc.ID) string {
+		if r := rs.forService(&id); r != nil {
+			return r.Name
+		}
+		return ""
+	}
+	teamA := map[attr.Name]string{attr.K8sNamespaceName: "team-a"}
+	// the first matching rule wins
+	assert.Equal(t, "payments", routeName(svc.ID{Name: "payment-gw", Metadata: teamA}))
+	assert.Equal(t, "team-a", routeName(svc.ID{Name: "cart", Metadata: teamA}))
+	assert.Equal(t, "shop", routeName(svc.ID{Name: "cart", Namespace: "shop-eu"}))
+	// all the match entries must match
+	assert.Empty(t, routeName(svc.ID{Name: "payment-gw"}))
+	assert.Empty(t, routeName(svc.ID{Name: "cart", Namespace: "shop-asia"}))
+}
+
+func TestRoute_EndpointOptions(t *testing.T) {
+	defer restoreEnvAfterExecution()()
+	require.NoError(t, os.Setenv(envHeaders, "Foo=Bar"))
+
+	r := &route{RoutingRule: &RoutingRule{
+		Name:     "team-a",
+		Endpoint: "http://team-a:4318",
+		Headers:  map[string]string{"X-Scope-OrgID": "team-a"},
+	}}
+	grafana := &GrafanaOTLP{CloudZone: "eu-west-0", InstanceID: "123", APIKey: "456"}
+
+	t.Run("HTTP traces", func(t *testing.T) {
+		opts, err := getHTTPTracesEndpointOptions(ptr(r.tracesConfig(TracesConfig{Grafana: grafana})))
+		require.NoError(t, err)
+		assert.Equal(t, "team-a:4318", opts.Endpoint)
+		assert.Equal(t, "/v1/traces", opts.URLPath)
+		// the Grafana credentials are not submitted to the route endpoint
+		assert.Equal(t, map[string]string{"Foo": "Bar", "X-Scope-OrgID": "team-a"}, opts.HTTPHeaders)
+	})
+	t.Run("GRPC traces", func(t *testing.T) {
+		opts, err := getGRPCTracesEndpointOptions(ptr(r.tracesConfig(TracesConfig{TracesEndpoint: "http://default:4317"})))
+		require.NoError(t, err)
+		assert.Equal(t, "team-a:4318", opts.Endpoint)
+		assert.Equal(t, map[string]string{"Foo": "Bar", "X-Scope-OrgID": "team-a"}, opts.HTTPHeaders)
+	})
+	t.Run("HTTP metrics", func(t *testing.T) {
+		headersOnly := &route{RoutingRule: &RoutingRule{Name: "team-b", Headers: map[string]string{"X-Scope-OrgID": "team-b"}}}
+		opts, err := getHTTPMetricEndpointOptions(headersOnly.metricsConfig(&MetricsConfig{Grafana: grafana}))
+		require.NoError(t, err)
+		assert.Equal(t, "otlp-gateway-eu-west-0.grafana.net", opts.Endpoint)
+		// the route keeps the Grafana credentials if it doesn't override the endpoint
+		assert.Equal(t, map[string]string{
+			"Foo": "Bar", "X-Scope-OrgID": "team-b", "Authorization": "Basic MTIzOjQ1Ng==",
+		}, opts.HTTPHeaders)
+	})
+	t.Run("GRPC metrics", func(t *testing.T) {
+		opts, err := getGRPCMetricEndpointOptions(r.metricsConfig(&MetricsConfig{MetricsEndpoint: "http://default:4317"}))
+		require.NoError(t, err)
+		assert.Equal(t, "team-a:4318", opts.Endpoint)
+		assert.Equal(t, map[string]string{"Foo": "Bar", "X-Scope-OrgID": "team-a"}, opts.HTTPHeaders)
+	})
+	t.Run("no routes", func(t *testing.T) {
+		opts, err := getGRPCMetricEndpointOptions(&MetricsConfig{MetricsEndpoint: "http://default:4317"})
+		require.NoError(t, err)
+		// the OTEL SDK takes the headers from the environment by itself
+		assert.Empty(t, opts.HTTPHeaders)
+	})
+}
+
+func TestTracesReceiver_Routing(t *testing.T) {
+	defer restoreEnvAfterExecution()()
+	defaultColl := newHeadersCollector()
+	defer defaultColl.Close()
+	routeColl := newHeadersCollector()
+	defer routeColl.Close()
+
+	exporter, err := TracesReceiver(context.Background(), TracesConfig{
+		CommonEndpoint:   defaultColl.URL,
+		Instrumentations: []string{instrumentations.InstrumentationALL},
+		Routing: RoutingRules{{
+			Name:     "team-a",
+			Match:    map[string]string{"k8s.namespace.name": "team-a"},
+			Endpoint: routeColl.URL,
+			Headers:  map[string]string{"X-Scope-OrgID": "team-a"},
+		}, {
+			Name:    "team-b",
+			Match:   map[string]string{"k8s.namespace.name": "team-b"},
+			Headers: map[string]string{"X-Scope-OrgID": "team-b"},
+		}},
+	}, &global.ContextInfo{}, attributes.Selection{})()
+	require.NoError(t, err)
+
+	spans := make(chan []request.Span, 10)
+	spans <- []request.Span{
+		{Type: request.EventTypeHTTP, ServiceID: svc.ID{Name: "a",
+			Metadata: map[attr.Name]string{attr.K8sNamespaceName: "team-a"}}},
+		{Type: request.EventTypeHTTP, ServiceID: svc.ID{Name: "b",
+			Metadata: map[attr.Name]string{attr.K8sNamespaceName: "team-b"}}},
+		{Type: request.EventTypeHTTP, ServiceID: svc.ID{Name: "c"}},
+	}
+	close(spans)
+	exporter(spans)
+
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		assert.Equal(t, []string{"team-a"}, routeColl.OrgIDs())
+		assert.ElementsMatch(t, []string{"team-b", ""}, defaultColl.OrgIDs())
+	}, test.Interval(10*time.Millisecond))
+}
+
+// headersCollector is a fake OTLP collector that records the X-Scope-OrgID header of each request
+type headersCollector struct {
+	*httptest.Server
+	mt     sync.Mutex
+	orgIDs []string
+}
+
+func newHeadersCollector() *headersCollector {
+	hc := &headersCollector{}
+	hc.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		hc.mt.Lock()
+		hc.orgIDs = append(hc.orgIDs, req.Header.Get("X-Scope-OrgID"))
+		hc.mt.Unlock()
+		rw.WriteHeader(http.StatusOK)
+	}))
+	return hc
+}
+
+func (hc *headersCollector) OrgIDs() []string {
+	hc.mt.Lock()
+	defer hc.mt.Unlock()
+	return append([]string{}, hc.orgIDs...)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
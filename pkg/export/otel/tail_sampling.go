@@ -0,0 +1,358 @@
+package otel
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gobwas/glob"
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	"github.com/mariomac/pipes/pipe"
+	"go.opentelemetry.io/otel/codes"
+	trace2 "go.opentelemetry.io/otel/trace"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+func tslog() *slog.Logger {
+	return slog.With("component", "otel.TailSampler")
+}
+
+// TailSamplingConfig enables the tail-based sampling of the traces that are submitted to the OTEL traces
+// exporter. The spans are buffered by trace ID during the DecisionWait time, and then the whole trace is
+// submitted if it matches any of the policies, or discarded otherwise.
+type TailSamplingConfig struct {
+	// DecisionWait is the time since the first span of a trace is received until the sampling decision is taken
+	DecisionWait time.Duration `yaml:"decision_wait" env:"BEYLA_OTEL_TAIL_SAMPLING_DECISION_WAIT"`
+	// MaxSpans is the maximum number of spans that are buffered. When it is reached, the decision
+	// for the oldest traces is taken before the DecisionWait time.
+	MaxSpans int `yaml:"max_spans" env:"BEYLA_OTEL_TAIL_SAMPLING_MAX_SPANS"`
+	// DecisionsCacheLen is the number of decided trace IDs that are remembered, so the spans arriving after
+	// the decision follow the same decision as the rest of their trace.
+	DecisionsCacheLen int `yaml:"decisions_cache_len" env:"BEYLA_OTEL_TAIL_SAMPLING_DECISIONS_CACHE_LEN"`
+	// Policies are evaluated in order. A trace is sampled if it matches any of them. If no policies are
+	// defined, the tail sampling is disabled.
+	Policies []TailSamplingPolicy `yaml:"policies"`
+}
+
+// TailSamplingPolicy samples the traces that match all its defined conditions.
+type TailSamplingPolicy struct {
+	// Name of the policy, as reported in the internal metrics
+	Name string `yaml:"name"`
+	// Errors matches the traces with at least one errored span
+	Errors bool `yaml:"errors"`
+	// MinDuration matches the traces with at least one span whose duration is equal or above it
+	MinDuration time.Duration `yaml:"min_duration"`
+	// Routes matches the traces with at least one span whose http.route matches any of the glob patterns
+	Routes []string `yaml:"routes"`
+	// Services matches the traces with at least one span whose service name matches any of the glob patterns
+	Services []string `yaml:"services"`
+	// Probability, if set, only samples the given fraction of the traces that match the rest of the conditions.
+	// A policy with only the probability condition samples a fraction of the traces that haven't been
+	// sampled by the previous policies.
+	Probability *float64 `yaml:"probability"`
+}
+
+func (c *TailSamplingConfig) Enabled() bool {
+	return len(c.Policies) > 0
+}
+
+func (c *TailSamplingConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.DecisionWait <= 0 {
+		return errors.New("tail sampling decision_wait must be greater than 0")
+	}
+	if c.MaxSpans <= 0 || c.DecisionsCacheLen <= 0 {
+		return errors.New("tail sampling max_spans and decisions_cache_len must be greater than 0")
+	}
+	_, err := compilePolicies(c.Policies)
+	return err
+}
+
+// samplingPolicy is a compiled TailSamplingPolicy
+type samplingPolicy struct {
+	name        string
+	errors      bool
+	minDuration time.Duration
+	routes      []glob.Glob
+	services    []glob.Glob
+	// threshold that the trace ID must be below to be sampled. If nil, the traces are always sampled
+	threshold *uint64
+}
+
+func compilePolicies(policies []TailSamplingPolicy) ([]samplingPolicy, error) {
+	compiled := make([]samplingPolicy, 0, len(policies))
+	for i := range policies {
+		p := &policies[i]
+		if p.Name == "" {
+			return nil, fmt.Errorf("tail sampling policy #%d must have a name", i)
+		}
+		sp := samplingPolicy{name: p.Name, errors: p.Errors, minDuration: p.MinDuration}
+		if !p.Errors && p.MinDuration <= 0 && len(p.Routes) == 0 && len(p.Services) == 0 && p.Probability == nil {
+			return nil, fmt.Errorf("tail sampling policy %q must define at least one condition", p.Name)
+		}
+		var err error
+		if sp.routes, err = compileGlobs(p.Routes); err != nil {
+			return nil, fmt.Errorf("tail sampling policy %q routes: %w", p.Name, err)
+		}
+		if sp.services, err = compileGlobs(p.Services); err != nil {
+			return nil, fmt.Errorf("tail sampling policy %q services: %w", p.Name, err)
+		}
+		if p.Probability != nil {
+			if *p.Probability < 0 || *p.Probability > 1 {
+				return nil, fmt.Errorf("tail sampling policy %q probability must be between 0 and 1", p.Name)
+			}
+			if *p.Probability < 1 {
+				threshold := uint64(*p.Probability * (1 << 63))
+				sp.threshold = &threshold
+			}
+		}
+		compiled = append(compiled, sp)
+	}
+	return compiled, nil
+}
+
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, 0, len(patterns))
+	for _, p := range patterns {
+		g, err := glob.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", p, err)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+func matchesAny(globs []glob.Glob, value string) bool {
+	for _, g := range globs {
+		if g.Match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns whether the policy samples the trace with the given spans
+func (p *samplingPolicy) matches(traceID trace2.TraceID, spans []request.Span) bool {
+	if p.errors && !anySpan(spans, func(s *request.Span) bool {
+		return request.SpanStatusCode(s) == codes.Error
+	}) {
+		return false
+	}
+	if p.minDuration > 0 && !anySpan(spans, func(s *request.Span) bool {
+		return time.Duration(s.End-s.RequestStart) >= p.minDuration
+	}) {
+		return false
+	}
+	if len(p.routes) > 0 && !anySpan(spans, func(s *request.Span) bool {
+		return matchesAny(p.routes, s.Route)
+	}) {
+		return false
+	}
+	if len(p.services) > 0 && !anySpan(spans, func(s *request.Span) bool {
+		return matchesAny(p.services, s.ServiceID.Name)
+	}) {
+		return false
+	}
+	// as in the OTEL TraceIDRatioBased sampler, the decision only depends on the trace ID,
+	// so the different Beyla instances take the same decision for the same trace
+	return p.threshold == nil || binary.BigEndian.Uint64(traceID[8:16])>>1 < *p.threshold
+}
+
+func anySpan(spans []request.Span, cond func(s *request.Span) bool) bool {
+	for i := range spans {
+		if cond(&spans[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingTrace buffers the spans of a trace until the sampling decision is taken
+type pendingTrace struct {
+	traceID   trace2.TraceID
+	firstSeen time.Time
+	spans     []request.Span
+}
+
+type tailSampler struct {
+	cfg      *TailSamplingConfig
+	policies []samplingPolicy
+	metrics  imetrics.Reporter
+	clock    func() time.Time
+	log      *slog.Logger
+
+	// pending traces, sorted by arrival time of their first span
+	pending      *list.List
+	pendingByID  map[trace2.TraceID]*list.Element
+	pendingSpans int
+	// decisions of the already decided traces. True if sampled
+	decisions *simplelru.LRU[trace2.TraceID, bool]
+
+	// spans to be forwarded in the next batch
+	sampled []request.Span
+}
+
+// TailSamplerProvider returns a pipeline node that forwards only the spans of the traces that match any of
+// the tail sampling policies. The node is bypassed if the OTEL traces exporter or the tail sampling is disabled.
+func TailSamplerProvider(
+	ctx context.Context, cfg *TracesConfig, ctxInfo *global.ContextInfo,
+) pipe.MiddleProvider[[]request.Span, []request.Span] {
+	return func() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
+		if !cfg.Enabled() || !cfg.TailSampling.Enabled() {
+			return pipe.Bypass[[]request.Span](), nil
+		}
+		ts, err := newTailSampler(&cfg.TailSampling, ctxInfo.Metrics)
+		if err != nil {
+			return nil, err
+		}
+		return func(in <-chan []request.Span, out chan<- []request.Span) {
+			ts.run(ctx, in, out)
+		}, nil
+	}
+}
+
+func newTailSampler(cfg *TailSamplingConfig, metrics imetrics.Reporter) (*tailSampler, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	policies, err := compilePolicies(cfg.Policies)
+	if err != nil {
+		return nil, err
+	}
+	decisions, err := simplelru.NewLRU[trace2.TraceID, bool](cfg.DecisionsCacheLen, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating tail sampling decisions cache: %w", err)
+	}
+	if metrics == nil {
+		metrics = imetrics.NoopReporter{}
+	}
+	return &tailSampler{
+		cfg:         cfg,
+		policies:    policies,
+		metrics:     metrics,
+		clock:       timeNow,
+		log:         tslog(),
+		pending:     list.New(),
+		pendingByID: map[trace2.TraceID]*list.Element{},
+		decisions:   decisions,
+	}, nil
+}
+
+func (ts *tailSampler) run(ctx context.Context, in <-chan []request.Span, out chan<- []request.Span) {
+	// checking the pending traces at a fraction of the decision wait time, to avoid delaying
+	// the decisions much longer than the configured time
+	ticker := time.NewTicker(ts.cfg.DecisionWait / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case spans, ok := <-in:
+			if !ok {
+				// flush the pending traces before finishing
+				ts.decideOlderThan(time.Time{}, true)
+				ts.flush(out)
+				return
+			}
+			for i := range spans {
+				ts.add(&spans[i])
+			}
+			ts.metrics.TailSamplingBufferedSpans(ts.pendingSpans)
+		case <-ticker.C:
+			ts.decideOlderThan(ts.clock().Add(-ts.cfg.DecisionWait), false)
+			ts.metrics.TailSamplingBufferedSpans(ts.pendingSpans)
+		}
+		ts.flush(out)
+	}
+}
+
+func (ts *tailSampler) add(span *request.Span) {
+	if !span.TraceID.IsValid() {
+		// without trace ID, the span is considered as a whole trace
+		ts.decide(&pendingTrace{traceID: span.TraceID, spans: []request.Span{*span}})
+		return
+	}
+	if sampled, ok := ts.decisions.Get(span.TraceID); ok {
+		// late span of an already decided trace
+		if sampled {
+			ts.sampled = append(ts.sampled, *span)
+		}
+		return
+	}
+	if elem, ok := ts.pendingByID[span.TraceID]; ok {
+		pt := elem.Value.(*pendingTrace)
+		pt.spans = append(pt.spans, *span)
+	} else {
+		ts.pendingByID[span.TraceID] = ts.pending.PushBack(&pendingTrace{
+			traceID:   span.TraceID,
+			firstSeen: ts.clock(),
+			spans:     []request.Span{*span},
+		})
+	}
+	ts.pendingSpans++
+	// memory cap: taking early decisions for the oldest traces
+	for ts.pendingSpans > ts.cfg.MaxSpans {
+		oldest := ts.pending.Front()
+		ts.log.Debug("too many buffered spans. Taking an early decision for the oldest trace",
+			"traceID", oldest.Value.(*pendingTrace).traceID)
+		ts.decideElement(oldest)
+	}
+}
+
+// decideOlderThan takes the decision for all the traces whose first span was received before the provided time,
+// or for all the pending traces if all is true
+func (ts *tailSampler) decideOlderThan(limit time.Time, all bool) {
+	for elem := ts.pending.Front(); elem != nil; elem = ts.pending.Front() {
+		if !all && !elem.Value.(*pendingTrace).firstSeen.Before(limit) {
+			return
+		}
+		ts.decideElement(elem)
+	}
+}
+
+func (ts *tailSampler) decideElement(elem *list.Element) {
+	pt := ts.pending.Remove(elem).(*pendingTrace)
+	delete(ts.pendingByID, pt.traceID)
+	ts.pendingSpans -= len(pt.spans)
+	ts.decide(pt)
+}
+
+func (ts *tailSampler) decide(pt *pendingTrace) {
+	sampled := false
+	for i := range ts.policies {
+		p := &ts.policies[i]
+		if p.matches(pt.traceID, pt.spans) {
+			sampled = true
+			ts.metrics.TailSamplingDecision(p.name, true)
+			break
+		}
+	}
+	if !sampled {
+		ts.metrics.TailSamplingDecision("", false)
+	}
+	if pt.traceID.IsValid() {
+		ts.decisions.Add(pt.traceID, sampled)
+	}
+	if sampled {
+		ts.sampled = append(ts.sampled, pt.spans...)
+	}
+}
+
+// flush forwards the sampled spans, if any
+func (ts *tailSampler) flush(out chan<- []request.Span) {
+	if len(ts.sampled) == 0 {
+		return
+	}
+	out <- ts.sampled
+	ts.sampled = nil
+}
@@ -0,0 +1,226 @@
+package otel
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	trace2 "go.opentelemetry.io/otel/trace"
+
+	"github.com/grafana/beyla/pkg/internal/imetrics"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func TestTailSamplingConfig_Validate(t *testing.T) {
+	valid := func() TailSamplingConfig {
+		return TailSamplingConfig{
+			DecisionWait:      time.Second,
+			MaxSpans:          100,
+			DecisionsCacheLen: 100,
+			Policies:          []TailSamplingPolicy{{Name: "errors", Errors: true}},
+		}
+	}
+	cfg := valid()
+	assert.NoError(t, cfg.Validate())
+	// disabled configuration is not validated
+	assert.NoError(t, (&TailSamplingConfig{}).Validate())
+
+	for name, modify := range map[string]func(c *TailSamplingConfig){
+		"missing decision wait":   func(c *TailSamplingConfig) { c.DecisionWait = 0 },
+		"missing max spans":       func(c *TailSamplingConfig) { c.MaxSpans = 0 },
+		"missing policy name":     func(c *TailSamplingConfig) { c.Policies[0].Name = "" },
+		"missing conditions":      func(c *TailSamplingConfig) { c.Policies[0].Errors = false },
+		"invalid probability":     func(c *TailSamplingConfig) { c.Policies[0].Probability = ptr(1.5) },
+		"invalid route pattern":   func(c *TailSamplingConfig) { c.Policies[0].Routes = []string{"/users/[abc"} },
+		"invalid service pattern": func(c *TailSamplingConfig) { c.Policies[0].Services = []string{"[abc"} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := valid()
+			modify(&cfg)
+			assert.Error(t, cfg.Validate())
+		})
+	}
+}
+
+func TestTailSampler_Policies(t *testing.T) {
+	metrics := &decisionsRecorder{}
+	ts := testTailSampler(t, metrics, TailSamplingPolicy{Name: "errors", Errors: true},
+		TailSamplingPolicy{Name: "slow-checkout", MinDuration: time.Second,
+			Routes: []string{"/checkout/*"}, Services: []string{"shop-*"}},
+		TailSamplingPolicy{Name: "remainder", Probability: ptr(0.5)})
+
+	shop := svc.ID{Name: "shop-frontend"}
+	// errored trace: the whole trace is sampled
+	ts.add(&request.Span{TraceID: traceID(1, 0xff), Type: request.EventTypeHTTP, Status: 200, ServiceID: shop})
+	ts.add(&request.Span{TraceID: traceID(1, 0xff), Type: request.EventTypeHTTP, Status: 500, ServiceID: shop})
+	// slow checkout trace
+	ts.add(&request.Span{TraceID: traceID(2, 0xff), Type: request.EventTypeHTTP, Status: 200, Route: "/checkout/pay",
+		ServiceID: shop, End: 2 * time.Second.Nanoseconds()})
+	// slow trace not matching the route: dropped
+	ts.add(&request.Span{TraceID: traceID(3, 0xff), Type: request.EventTypeHTTP, Status: 200, Route: "/users",
+		ServiceID: shop, End: 2 * time.Second.Nanoseconds()})
+	// fast checkout trace: dropped
+	ts.add(&request.Span{TraceID: traceID(4, 0xff), Type: request.EventTypeHTTP, Status: 200, Route: "/checkout/pay",
+		ServiceID: shop, End: time.Millisecond.Nanoseconds()})
+	// trace ID below the probability threshold
+	ts.add(&request.Span{TraceID: traceID(5, 0x00), Type: request.EventTypeHTTP, Status: 200, ServiceID: shop})
+	assert.Empty(t, ts.sampled)
+	assert.Equal(t, 6, ts.pendingSpans)
+
+	ts.decideOlderThan(time.Time{}, true)
+	assert.Equal(t, []trace2.TraceID{traceID(1, 0xff), traceID(1, 0xff), traceID(2, 0xff), traceID(5, 0x00)},
+		traceIDs(ts.sampled))
+	assert.Zero(t, ts.pendingSpans)
+	assert.Equal(t, map[string]int{
+		"sampled/errors": 1, "sampled/slow-checkout": 1, "sampled/remainder": 1, "dropped/": 2,
+	}, metrics.Decisions())
+}
+
+func TestTailSampler_Probability(t *testing.T) {
+	never := testTailSampler(t, nil, TailSamplingPolicy{Name: "never", Probability: ptr(0.0)})
+	always := testTailSampler(t, nil, TailSamplingPolicy{Name: "always", Probability: ptr(1.0)})
+	for _, id := range []trace2.TraceID{traceID(1, 0x00), traceID(2, 0x80), traceID(3, 0xff)} {
+		never.add(&request.Span{TraceID: id})
+		always.add(&request.Span{TraceID: id})
+	}
+	never.decideOlderThan(time.Time{}, true)
+	always.decideOlderThan(time.Time{}, true)
+	assert.Empty(t, never.sampled)
+	assert.Len(t, always.sampled, 3)
+}
+
+func TestTailSampler_DecisionWait(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts := testTailSampler(t, nil, TailSamplingPolicy{Name: "errors", Errors: true})
+	ts.clock = func() time.Time { return now }
+
+	ts.add(&request.Span{TraceID: traceID(1, 0), Type: request.EventTypeHTTP, Status: 500})
+	now = now.Add(3 * time.Second)
+	ts.add(&request.Span{TraceID: traceID(2, 0), Type: request.EventTypeHTTP, Status: 500})
+	now = now.Add(3 * time.Second)
+	// spans from already pending traces are buffered with the rest of their trace
+	ts.add(&request.Span{TraceID: traceID(1, 0), Type: request.EventTypeHTTP, Status: 200})
+
+	// only the first trace exceeded the decision wait time
+	ts.decideOlderThan(now.Add(-ts.cfg.DecisionWait), false)
+	assert.Equal(t, []trace2.TraceID{traceID(1, 0), traceID(1, 0)}, traceIDs(ts.sampled))
+	assert.Equal(t, 1, ts.pendingSpans)
+
+	// late spans follow the decision that was taken for their trace
+	ts.sampled = nil
+	ts.add(&request.Span{TraceID: traceID(1, 0), Type: request.EventTypeHTTP, Status: 200})
+	assert.Equal(t, []trace2.TraceID{traceID(1, 0)}, traceIDs(ts.sampled))
+	assert.Equal(t, 1, ts.pendingSpans)
+}
+
+func TestTailSampler_MaxSpans(t *testing.T) {
+	ts := testTailSampler(t, nil, TailSamplingPolicy{Name: "errors", Errors: true})
+	ts.cfg.MaxSpans = 2
+
+	ts.add(&request.Span{TraceID: traceID(1, 0), Type: request.EventTypeHTTP, Status: 500})
+	ts.add(&request.Span{TraceID: traceID(2, 0), Type: request.EventTypeHTTP, Status: 500})
+	assert.Empty(t, ts.sampled)
+	// exceeding the maximum buffered spans forces the decision of the oldest trace
+	ts.add(&request.Span{TraceID: traceID(3, 0), Type: request.EventTypeHTTP, Status: 500})
+	assert.Equal(t, []trace2.TraceID{traceID(1, 0)}, traceIDs(ts.sampled))
+	assert.Equal(t, 2, ts.pendingSpans)
+}
+
+func TestTailSamplerProvider(t *testing.T) {
+	cfg := &TracesConfig{
+		CommonEndpoint: "http://localhost:4318",
+		TailSampling: TailSamplingConfig{
+			DecisionWait:      time.Hour,
+			MaxSpans:          100,
+			DecisionsCacheLen: 100,
+			Policies:          []TailSamplingPolicy{{Name: "errors", Errors: true}},
+		},
+	}
+	sampler, err := TailSamplerProvider(context.Background(), cfg, &global.ContextInfo{})()
+	require.NoError(t, err)
+
+	in := make(chan []request.Span, 10)
+	out := make(chan []request.Span, 10)
+	in <- []request.Span{
+		{TraceID: traceID(1, 0), Type: request.EventTypeHTTP, Status: 200},
+		{TraceID: traceID(2, 0), Type: request.EventTypeHTTP, Status: 500},
+		{TraceID: traceID(1, 0), Type: request.EventTypeHTTP, Status: 200},
+	}
+	close(in)
+	// the pending traces are decided when the input is closed
+	sampler(in, out)
+	require.Len(t, out, 1)
+	assert.Equal(t, []trace2.TraceID{traceID(2, 0)}, traceIDs(<-out))
+
+	t.Run("bypassed if disabled", func(t *testing.T) {
+		sampler, err := TailSamplerProvider(context.Background(), &TracesConfig{CommonEndpoint: "http://localhost:4318"},
+			&global.ContextInfo{})()
+		require.NoError(t, err)
+		assert.Nil(t, sampler)
+
+		cfg := *cfg
+		cfg.CommonEndpoint = ""
+		sampler, err = TailSamplerProvider(context.Background(), &cfg, &global.ContextInfo{})()
+		require.NoError(t, err)
+		assert.Nil(t, sampler)
+	})
+}
+
+func testTailSampler(t *testing.T, metrics imetrics.Reporter, policies ...TailSamplingPolicy) *tailSampler {
+	ts, err := newTailSampler(&TailSamplingConfig{
+		DecisionWait:      5 * time.Second,
+		MaxSpans:          100,
+		DecisionsCacheLen: 100,
+		Policies:          policies,
+	}, metrics)
+	require.NoError(t, err)
+	return ts
+}
+
+// traceID returns a trace ID whose first byte is the given id, and its lower 8 bytes
+// (which are used for the probabilistic sampling) are filled with the ratio byte
+func traceID(id, ratio byte) trace2.TraceID {
+	tid := trace2.TraceID{id}
+	for i := 8; i < len(tid); i++ {
+		tid[i] = ratio
+	}
+	return tid
+}
+
+func traceIDs(spans []request.Span) []trace2.TraceID {
+	ids := make([]trace2.TraceID, 0, len(spans))
+	for i := range spans {
+		ids = append(ids, spans[i].TraceID)
+	}
+	return ids
+}
+
+type decisionsRecorder struct {
+	imetrics.NoopReporter
+	mt        sync.Mutex
+	decisions map[string]int
+}
+
+func (d *decisionsRecorder) TailSamplingDecision(policy string, sampled bool) {
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	if d.decisions == nil {
+		d.decisions = map[string]int{}
+	}
+	decision := "dropped/"
+	if sampled {
+		decision = "sampled/"
+	}
+	d.decisions[decision+policy]++
+}
+
+func (d *decisionsRecorder) Decisions() map[string]int {
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	return d.decisions
+}
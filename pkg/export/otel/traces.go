@@ -7,6 +7,7 @@ import (
 	"maps"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -68,6 +69,9 @@ type TracesConfig struct {
 
 	Sampler Sampler `yaml:"sampler"`
 
+	// TailSampling buffers the spans of each trace to decide, once the trace is complete, whether it is exported
+	TailSampling TailSamplingConfig `yaml:"tail_sampling"`
+
 	// Configuration options below this line will remain undocumented at the moment,
 	// but can be useful for performance-tuning of some customers.
 	MaxExportBatchSize int           `yaml:"max_export_batch_size" env:"BEYLA_OTLP_TRACES_MAX_EXPORT_BATCH_SIZE"`
@@ -84,8 +88,21 @@ type TracesConfig struct {
 	// BackOffMaxElapsedTime is the maximum amount of time (including retries) spent trying to send a request/batch.
 	BackOffMaxElapsedTime time.Duration `yaml:"backoff_max_elapsed_time" env:"BEYLA_BACKOFF_MAX_ELAPSED_TIME"`
 
+	// PersistentQueueDirectory enables a file-backed queue that keeps the batches that couldn't be submitted yet,
+	// so they survive collector outages and are replayed after a restart.
+	PersistentQueueDirectory string `yaml:"persistent_queue_directory" env:"BEYLA_OTLP_TRACES_PERSISTENT_QUEUE_DIRECTORY"`
+	// PersistentQueueSize is the maximum number of batches in the persistent queue
+	PersistentQueueSize int `yaml:"persistent_queue_size" env:"BEYLA_OTLP_TRACES_PERSISTENT_QUEUE_SIZE"`
+	// PersistentQueueMaxBytes is the maximum size on disk of the batches in the persistent queue. 0 means unlimited
+	PersistentQueueMaxBytes int64 `yaml:"persistent_queue_max_bytes" env:"BEYLA_OTLP_TRACES_PERSISTENT_QUEUE_MAX_BYTES"`
+
 	ReportersCacheLen int `yaml:"reporters_cache_len" env:"BEYLA_TRACES_REPORT_CACHE_LEN"`
 
+	// Routing submits the traces of the matching services to a different endpoint, or with different headers
+	Routing RoutingRules `yaml:"routing"`
+	// headers of the route that is being instantiated, if any
+	routeHeaders map[string]string
+
 	// SDKLogLevel works independently from the global LogLevel because it prints GBs of logs in Debug mode
 	// and the Info messages leak internal details that are not usually valuable for the final user.
 	SDKLogLevel string `yaml:"otel_sdk_log_level" env:"BEYLA_OTEL_SDK_LOG_LEVEL"`
@@ -101,6 +118,10 @@ func (m *TracesConfig) Enabled() bool { //nolint:gocritic
 	return m.CommonEndpoint != "" || m.TracesEndpoint != "" || m.Grafana.TracesEnabled()
 }
 
+func (m *TracesConfig) persistentQueueEnabled() bool {
+	return m.PersistentQueueDirectory != ""
+}
+
 func (m *TracesConfig) getProtocol() Protocol {
 	if m.TracesProtocol != "" {
 		return m.TracesProtocol
@@ -173,24 +194,26 @@ func (tr *tracesOTELReceiver) provideLoop() (pipe.FinalFunc[[]request.Span], err
 	if !tr.cfg.Enabled() {
 		return pipe.IgnoreFinal[[]request.Span](), nil
 	}
+	routes, err := tr.cfg.Routing.compile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid traces routing rules: %w", err)
+	}
 	SetupInternalOTELSDKLogger(tr.cfg.SDKLogLevel)
 	return func(in <-chan []request.Span) {
-		exp, err := getTracesExporter(tr.ctx, tr.cfg, tr.ctxInfo)
+		exp, err := tr.startExporter(tr.cfg, "traces")
 		if err != nil {
 			slog.Error("error creating traces exporter", "error", err)
 			return
 		}
-		defer func() {
-			err := exp.Shutdown(tr.ctx)
-			if err != nil {
-				slog.Error("error shutting down traces exporter", "error", err)
-			}
-		}()
-		err = exp.Start(tr.ctx, nil)
-		if err != nil {
-			slog.Error("error starting traces exporter", "error", err)
-			return
-		}
+		defer tr.shutdownExporter(exp)
+		// one exporter for each route, instantiated the first time that a service matches it
+		routeExporters := NewReporterPool[*route, exporter.Traces](len(routes)+1, routeExportersTTL, timeNow,
+			func(_ svc.UID, v *expirable[exporter.Traces]) {
+				tr.shutdownExporter(v.value)
+			}, func(r *route) (exporter.Traces, error) {
+				return tr.startExporter(r.tracesConfig(tr.cfg), r.queueName("traces"))
+			})
+		defer routeExporters.Purge()
 
 		traceAttrs, err := GetUserSelectedAttributes(tr.attributes)
 		if err != nil {
@@ -206,16 +229,51 @@ func (tr *tracesOTELReceiver) provideLoop() (pipe.FinalFunc[[]request.Span], err
 				if tr.spanDiscarded(span) {
 					continue
 				}
+				spanExp, queue := exp, "traces"
+				if r := routes.forService(&span.ServiceID); r != nil {
+					if spanExp, err = routeExporters.For(r); err != nil {
+						slog.Error("error creating traces exporter", "route", r.Name, "error", err)
+						continue
+					}
+					queue = r.queueName(queue)
+				}
 				traces := GenerateTraces(span, tr.ctxInfo.HostID, traceAttrs, envResourceAttrs)
-				err := exp.ConsumeTraces(tr.ctx, traces)
+				err := spanExp.ConsumeTraces(tr.ctx, traces)
 				if err != nil {
 					slog.Error("error sending trace to consumer", "error", err)
+					if tr.cfg.persistentQueueEnabled() && tr.ctxInfo.Metrics != nil {
+						// with a queue, the traces are only rejected if they can't be enqueued
+						tr.ctxInfo.Metrics.OTELExportQueueDrop(queue, traces.SpanCount())
+					}
 				}
 			}
 		}
 	}, nil
 }
 
+// startExporter instantiates and starts a traces exporter. If the persistent queue is enabled,
+// the queue name identifies it in the internal metrics.
+func (tr *tracesOTELReceiver) startExporter(cfg TracesConfig, queue string) (exporter.Traces, error) {
+	exp, err := getTracesExporter(tr.ctx, cfg, tr.ctxInfo)
+	if err != nil {
+		return nil, err
+	}
+	var host component.Host
+	if cfg.persistentQueueEnabled() {
+		host = persistentQueueHost(cfg.PersistentQueueDirectory, cfg.PersistentQueueMaxBytes, queue, tr.ctxInfo.Metrics)
+	}
+	if err := exp.Start(tr.ctx, host); err != nil {
+		return nil, fmt.Errorf("starting traces exporter: %w", err)
+	}
+	return exp, nil
+}
+
+func (tr *tracesOTELReceiver) shutdownExporter(exp exporter.Traces) {
+	if err := exp.Shutdown(tr.ctx); err != nil {
+		slog.Error("error shutting down traces exporter", "error", err)
+	}
+}
+
 func getTracesExporter(ctx context.Context, cfg TracesConfig, ctxInfo *global.ContextInfo) (exporter.Traces, error) {
 	switch proto := cfg.getProtocol(); proto {
 	case ProtocolHTTPJSON, ProtocolHTTPProtobuf, "": // zero value defaults to HTTP for backwards-compatibility
@@ -235,6 +293,9 @@ func getTracesExporter(ctx context.Context, cfg TracesConfig, ctxInfo *global.Co
 		factory := otlphttpexporter.NewFactory()
 		config := factory.CreateDefaultConfig().(*otlphttpexporter.Config)
 		config.QueueConfig.Enabled = false
+		if cfg.persistentQueueEnabled() {
+			config.QueueConfig = persistentQueueConfig(cfg.PersistentQueueSize)
+		}
 		config.RetryConfig = getRetrySettings(cfg)
 		config.ClientConfig = confighttp.ClientConfig{
 			Endpoint: opts.Scheme + "://" + opts.Endpoint + opts.BaseURLPath,
@@ -268,6 +329,9 @@ func getTracesExporter(ctx context.Context, cfg TracesConfig, ctxInfo *global.Co
 		factory := otlpexporter.NewFactory()
 		config := factory.CreateDefaultConfig().(*otlpexporter.Config)
 		config.QueueConfig.Enabled = false
+		if cfg.persistentQueueEnabled() {
+			config.QueueConfig = persistentQueueConfig(cfg.PersistentQueueSize)
+		}
 		config.RetryConfig = getRetrySettings(cfg)
 		config.ClientConfig = configgrpc.ClientConfig{
 			Endpoint: endpoint.String(),
@@ -275,6 +339,7 @@ func getTracesExporter(ctx context.Context, cfg TracesConfig, ctxInfo *global.Co
 				Insecure:           opts.Insecure,
 				InsecureSkipVerify: cfg.InsecureSkipVerify,
 			},
+			Headers: convertHeaders(opts.HTTPHeaders),
 		}
 		set := getTraceSettings(ctxInfo, cfg, t)
 		return factory.CreateTracesExporter(ctx, set, config)
@@ -429,6 +494,9 @@ func GenerateTraces(span *request.Span, hostID string, userAttrs map[attr.Name]s
 	// Set status code
 	statusCode := codeToStatusCode(request.SpanStatusCode(span))
 	s.Status().SetCode(statusCode)
+	if statusCode == ptrace.StatusCodeError && span.DBError.Description != "" {
+		s.Status().SetMessage(span.DBError.Description)
+	}
 	s.SetEndTimestamp(pcommon.NewTimestampFromTime(t.End))
 	return traces
 }
@@ -520,18 +588,44 @@ func (tr *tracesOTELReceiver) acceptSpan(span *request.Span) bool {
 	case request.EventTypeHTTP, request.EventTypeHTTPClient:
 		return tr.is.HTTPEnabled()
 	case request.EventTypeGRPC, request.EventTypeGRPCClient:
+		if span.RPCKind == request.RPCThrift {
+			return tr.is.ThriftEnabled()
+		}
 		return tr.is.GRPCEnabled()
 	case request.EventTypeSQLClient:
+		if span.SQLKind == request.DBCassandra {
+			return tr.is.CassandraEnabled()
+		}
 		return tr.is.SQLEnabled()
 	case request.EventTypeRedisClient, request.EventTypeRedisServer:
 		return tr.is.RedisEnabled()
 	case request.EventTypeKafkaClient, request.EventTypeKafkaServer:
 		return tr.is.KafkaEnabled()
+	case request.EventTypeMongoClient:
+		return tr.is.MongoEnabled()
+	case request.EventTypeAMQPClient, request.EventTypeAMQPServer:
+		return tr.is.AMQPEnabled()
+	case request.EventTypeNATSClient:
+		return tr.is.NATSEnabled()
+	case request.EventTypeMQTTClient:
+		return tr.is.MQTTEnabled()
+	case request.EventTypeMemcachedClient:
+		return tr.is.MemcachedEnabled()
+	case request.EventTypeTCPClient, request.EventTypeTCPServer:
+		return tr.is.TCPEnabled()
 	}
 
 	return false
 }
 
+// appendRequestHeaders adds the captured HTTP request headers, sorted by name
+func appendRequestHeaders(attrs []attribute.KeyValue, span *request.Span) []attribute.KeyValue {
+	for _, key := range slices.Sorted(maps.Keys(span.RequestHeaders)) {
+		attrs = append(attrs, attribute.String(attr.HTTPRequestHeaderPrefix+key, span.RequestHeaders[key]))
+	}
+	return attrs
+}
+
 // nolint:cyclop
 func traceAttributes(span *request.Span, optionalAttrs map[attr.Name]struct{}) []attribute.KeyValue {
 	var attrs []attribute.KeyValue
@@ -550,15 +644,18 @@ func traceAttributes(span *request.Span, optionalAttrs map[attr.Name]struct{}) [
 		if span.Route != "" {
 			attrs = append(attrs, semconv.HTTPRoute(span.Route))
 		}
+		attrs = appendRequestHeaders(attrs, span)
 	case request.EventTypeGRPC:
 		attrs = []attribute.KeyValue{
 			semconv.RPCMethod(span.Path),
-			semconv.RPCSystemGRPC,
-			semconv.RPCGRPCStatusCodeKey.Int(span.Status),
+			request.RPCSystemName(span),
 			request.ClientAddr(request.SpanPeer(span)),
 			request.ServerAddr(request.SpanHost(span)),
 			request.ServerPort(span.HostPort),
 		}
+		if span.RPCKind == request.RPCGRPC {
+			attrs = append(attrs, semconv.RPCGRPCStatusCodeKey.Int(span.Status))
+		}
 	case request.EventTypeHTTPClient:
 		attrs = []attribute.KeyValue{
 			request.HTTPRequestMethod(span.Method),
@@ -568,19 +665,22 @@ func traceAttributes(span *request.Span, optionalAttrs map[attr.Name]struct{}) [
 			request.ServerPort(span.HostPort),
 			request.HTTPRequestBodySize(int(span.RequestLength())),
 		}
+		attrs = appendRequestHeaders(attrs, span)
 	case request.EventTypeGRPCClient:
 		attrs = []attribute.KeyValue{
 			semconv.RPCMethod(span.Path),
-			semconv.RPCSystemGRPC,
-			semconv.RPCGRPCStatusCodeKey.Int(span.Status),
+			request.RPCSystemName(span),
 			request.ServerAddr(request.SpanHost(span)),
 			request.ServerPort(span.HostPort),
 		}
+		if span.RPCKind == request.RPCGRPC {
+			attrs = append(attrs, semconv.RPCGRPCStatusCodeKey.Int(span.Status))
+		}
 	case request.EventTypeSQLClient:
 		attrs = []attribute.KeyValue{
 			request.ServerAddr(request.SpanHost(span)),
 			request.ServerPort(span.HostPort),
-			semconv.DBSystemOtherSQL, // We can distinguish in the future for MySQL, Postgres etc
+			request.DBSystemName(span),
 		}
 		if _, ok := optionalAttrs[attr.DBQueryText]; ok {
 			attrs = append(attrs, request.DBQueryText(span.Statement))
@@ -593,6 +693,18 @@ func traceAttributes(span *request.Span, optionalAttrs map[attr.Name]struct{}) [
 				attrs = append(attrs, request.DBCollectionName(table))
 			}
 		}
+		if span.DBNamespace != "" {
+			attrs = append(attrs, request.DBNamespace(span.DBNamespace))
+		}
+		if span.DBConsistency != "" {
+			attrs = append(attrs, semconv.DBCassandraConsistencyLevelKey.String(span.DBConsistency))
+		}
+		if span.DBBatchSize > 1 {
+			attrs = append(attrs, request.DBOperationBatchSize(span.DBBatchSize))
+		}
+		if span.DBError.ErrorCode != "" {
+			attrs = append(attrs, request.DBResponseStatusCode(span.DBError.ErrorCode))
+		}
 	case request.EventTypeRedisServer, request.EventTypeRedisClient:
 		attrs = []attribute.KeyValue{
 			request.ServerAddr(request.SpanHost(span)),
@@ -619,6 +731,72 @@ func traceAttributes(span *request.Span, optionalAttrs map[attr.Name]struct{}) [
 			semconv.MessagingClientID(span.OtherNamespace),
 			operation,
 		}
+	case request.EventTypeMemcachedClient:
+		attrs = []attribute.KeyValue{
+			request.ServerAddr(request.SpanHost(span)),
+			request.ServerPort(span.HostPort),
+			semconv.DBSystemMemcached,
+		}
+		if span.Method != "" {
+			attrs = append(attrs, request.DBOperationName(span.Method))
+			if _, ok := optionalAttrs[attr.DBQueryText]; ok && span.Path != "" {
+				attrs = append(attrs, request.DBQueryText(span.Path))
+			}
+		}
+		if span.KeyCount > 1 {
+			attrs = append(attrs, request.DBOperationBatchSize(span.KeyCount))
+		}
+		if span.CacheOutcome != request.CacheUnknown {
+			attrs = append(attrs, request.CacheOutcomeMetric(span.CacheOutcome.String()))
+		}
+	case request.EventTypeAMQPServer, request.EventTypeAMQPClient:
+		attrs = []attribute.KeyValue{
+			request.ServerAddr(request.SpanHost(span)),
+			request.ServerPort(span.HostPort),
+			semconv.MessagingSystemRabbitmq,
+			semconv.MessagingDestinationName(span.Path),
+			request.MessagingOperationType(span.Method),
+		}
+		if span.Statement != "" {
+			attrs = append(attrs, semconv.MessagingRabbitmqDestinationRoutingKey(span.Statement))
+		}
+	case request.EventTypeNATSClient, request.EventTypeMQTTClient:
+		attrs = []attribute.KeyValue{
+			request.ServerAddr(request.SpanHost(span)),
+			request.ServerPort(span.HostPort),
+			semconv.MessagingSystemKey.String(request.MessagingSystemName(span)),
+			semconv.MessagingDestinationName(span.Path),
+			request.MessagingOperationType(span.Method),
+		}
+	case request.EventTypeMongoClient:
+		attrs = []attribute.KeyValue{
+			request.ServerAddr(request.SpanHost(span)),
+			request.ServerPort(span.HostPort),
+			semconv.DBSystemMongoDB,
+		}
+		if span.Method != "" {
+			attrs = append(attrs, request.DBOperationName(span.Method))
+		}
+		if span.Path != "" {
+			attrs = append(attrs, request.DBCollectionName(span.Path))
+		}
+		if span.DBNamespace != "" {
+			attrs = append(attrs, request.DBNamespace(span.DBNamespace))
+		}
+		if span.DBError.ErrorCode != "" {
+			attrs = append(attrs, request.DBResponseStatusCode(span.DBError.ErrorCode))
+		}
+	case request.EventTypeTCPClient, request.EventTypeTCPServer:
+		attrs = []attribute.KeyValue{
+			semconv.NetworkTransportTCP,
+			request.ServerAddr(request.SpanHost(span)),
+			request.ServerPort(span.HostPort),
+			request.TCPRequestBytes(span.RequestLength()),
+			request.TCPResponseBytes(span.ResponseLength),
+		}
+		if span.Type == request.EventTypeTCPServer {
+			attrs = append(attrs, request.ClientAddr(request.SpanPeer(span)))
+		}
 	}
 
 	return attrs
@@ -626,11 +804,13 @@ func traceAttributes(span *request.Span, optionalAttrs map[attr.Name]struct{}) [
 
 func spanKind(span *request.Span) trace2.SpanKind {
 	switch span.Type {
-	case request.EventTypeHTTP, request.EventTypeGRPC, request.EventTypeRedisServer:
+	case request.EventTypeHTTP, request.EventTypeGRPC, request.EventTypeRedisServer, request.EventTypeTCPServer:
 		return trace2.SpanKindServer
-	case request.EventTypeHTTPClient, request.EventTypeGRPCClient, request.EventTypeSQLClient, request.EventTypeRedisClient:
+	case request.EventTypeHTTPClient, request.EventTypeGRPCClient, request.EventTypeSQLClient, request.EventTypeRedisClient,
+		request.EventTypeMongoClient, request.EventTypeMemcachedClient, request.EventTypeTCPClient:
 		return trace2.SpanKindClient
-	case request.EventTypeKafkaClient, request.EventTypeKafkaServer:
+	case request.EventTypeKafkaClient, request.EventTypeKafkaServer, request.EventTypeAMQPClient, request.EventTypeAMQPServer,
+		request.EventTypeNATSClient, request.EventTypeMQTTClient:
 		switch span.Method {
 		case request.MessagingPublish:
 			return trace2.SpanKindProducer
@@ -711,6 +891,7 @@ func getHTTPTracesEndpointOptions(cfg *TracesConfig) (otlpOptions, error) {
 	cfg.Grafana.setupOptions(&opts)
 	maps.Copy(opts.HTTPHeaders, headersFromEnv(envHeaders))
 	maps.Copy(opts.HTTPHeaders, headersFromEnv(envTracesHeaders))
+	maps.Copy(opts.HTTPHeaders, cfg.routeHeaders)
 
 	return opts, nil
 }
@@ -735,6 +916,7 @@ func getGRPCTracesEndpointOptions(cfg *TracesConfig) (otlpOptions, error) {
 		log.Debug("Setting InsecureSkipVerify")
 		opts.SkipTLSVerify = true
 	}
+	opts.HTTPHeaders = withRouteHeaders(nil, cfg.routeHeaders, envHeaders, envTracesHeaders)
 
 	return opts, nil
 }
@@ -586,6 +586,31 @@ func TestGenerateTracesAttributes(t *testing.T) {
 		ensureTraceStrAttr(t, attrs, semconv.MessagingClientIDKey, "test")
 
 	})
+	t.Run("test Thrift trace generation", func(t *testing.T) {
+		span := request.Span{Type: request.EventTypeGRPCClient, RPCKind: request.RPCThrift, Path: "getUser", Status: 1}
+		traces := GenerateTraces(&span, "host-id", map[attr.Name]struct{}{}, []attribute.KeyValue{})
+
+		assert.Equal(t, 1, traces.ResourceSpans().Len())
+		spans := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans()
+		assert.Equal(t, "getUser", spans.At(0).Name())
+		assert.Equal(t, ptrace.StatusCodeError, spans.At(0).Status().Code())
+
+		attrs := spans.At(0).Attributes()
+		ensureTraceStrAttr(t, attrs, semconv.RPCMethodKey, "getUser")
+		ensureTraceStrAttr(t, attrs, semconv.RPCSystemKey, "thrift")
+		ensureTraceAttrNotExists(t, attrs, semconv.RPCGRPCStatusCodeKey)
+	})
+	t.Run("test HTTP request headers", func(t *testing.T) {
+		for _, spanType := range []request.EventType{request.EventTypeHTTP, request.EventTypeHTTPClient} {
+			span := request.Span{Type: spanType, Method: "GET", Path: "/test", Status: 200,
+				RequestHeaders: map[string]string{"user-agent": "curl/8.0", "x-tenant": "acme"}}
+			traces := GenerateTraces(&span, "host-id", map[attr.Name]struct{}{}, []attribute.KeyValue{})
+
+			attrs := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Attributes()
+			ensureTraceStrAttr(t, attrs, "http.request.header.user-agent", "curl/8.0")
+			ensureTraceStrAttr(t, attrs, "http.request.header.x-tenant", "acme")
+		}
+	})
 	t.Run("test env var resource attributes", func(t *testing.T) {
 		defer restoreEnvAfterExecution()()
 		require.NoError(t, os.Setenv(envResourceAttrs, "deployment.environment=productions,source.upstream=beyla"))
@@ -1065,7 +1090,7 @@ func restoreEnvAfterExecution() func() {
 		exists bool
 	}{
 		{name: envTracesProtocol}, {name: envMetricsProtocol}, {name: envProtocol},
-		{name: envHeaders}, {name: envTracesHeaders},
+		{name: envHeaders}, {name: envTracesHeaders}, {name: envMetricsHeaders},
 	}
 	for _, v := range vals {
 		v.val, v.exists = os.LookupEnv(v.name)
@@ -12,6 +12,7 @@ import (
 	"github.com/mariomac/pipes/pipe"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel/codes"
+	trace2 "go.opentelemetry.io/otel/trace"
 
 	"github.com/grafana/beyla/pkg/buildinfo"
 	"github.com/grafana/beyla/pkg/export/attributes"
@@ -74,6 +75,10 @@ const (
 	serverNamespaceKey = "server_service_namespace"
 	connectionTypeKey  = "connection_type"
 
+	// exemplar labels
+	traceIDKey = "trace_id"
+	spanIDKey  = "span_id"
+
 	// default values for the histogram configuration
 	// from https://grafana.com/docs/mimir/latest/send/native-histograms/#migrate-from-classic-histograms
 	defaultHistogramBucketFactor     = 1.1
@@ -117,6 +122,14 @@ type PrometheusConfig struct {
 
 	AllowServiceGraphSelfReferences bool `yaml:"allow_service_graph_self_references" env:"BEYLA_PROMETHEUS_ALLOW_SERVICE_GRAPH_SELF_REFERENCES"`
 
+	// Exemplars attaches the trace and span IDs of the sampled spans to the duration histograms.
+	// They are only exposed when the scraper accepts the OpenMetrics format.
+	Exemplars bool `yaml:"exemplars" env:"BEYLA_PROMETHEUS_EXEMPLARS"`
+
+	// RemoteWrite pushes the exported metrics to a Prometheus remote-write endpoint,
+	// in addition to exposing them in the scrape endpoint, if the port is defined
+	RemoteWrite RemoteWriteConfig `yaml:"remote_write"`
+
 	// Registry is only used for embedding Beyla within the Grafana Agent.
 	// It must be nil when Beyla runs as standalone
 	Registry *prometheus.Registry `yaml:"-"`
@@ -139,7 +152,7 @@ func (p *PrometheusConfig) NetworkMetricsEnabled() bool {
 }
 
 func (p *PrometheusConfig) EndpointEnabled() bool {
-	return p.Port != 0 || p.Registry != nil
+	return p.Port != 0 || p.Registry != nil || p.RemoteWrite.Enabled()
 }
 
 // nolint:gocritic
@@ -158,6 +171,8 @@ type metricsReporter struct {
 	dbClientDuration      *Expirer[prometheus.Histogram]
 	msgPublishDuration    *Expirer[prometheus.Histogram]
 	msgProcessDuration    *Expirer[prometheus.Histogram]
+	tcpClientDuration     *Expirer[prometheus.Histogram]
+	tcpServerDuration     *Expirer[prometheus.Histogram]
 	httpRequestSize       *Expirer[prometheus.Histogram]
 	httpClientRequestSize *Expirer[prometheus.Histogram]
 	targetInfo            *Expirer[prometheus.Gauge]
@@ -170,6 +185,8 @@ type metricsReporter struct {
 	attrDBClientDuration      []attributes.Field[*request.Span, string]
 	attrMsgPublishDuration    []attributes.Field[*request.Span, string]
 	attrMsgProcessDuration    []attributes.Field[*request.Span, string]
+	attrTCPClientDuration     []attributes.Field[*request.Span, string]
+	attrTCPServerDuration     []attributes.Field[*request.Span, string]
 	attrHTTPRequestSize       []attributes.Field[*request.Span, string]
 	attrHTTPClientRequestSize []attributes.Field[*request.Span, string]
 
@@ -252,7 +269,7 @@ func newReporter(
 
 	var attrGRPCDuration, attrGRPCClientDuration []attributes.Field[*request.Span, string]
 
-	if is.GRPCEnabled() {
+	if is.RPCEnabled() {
 		attrGRPCDuration = attributes.PrometheusGetters(request.SpanPromGetters,
 			attrsProvider.For(attributes.RPCServerDuration))
 		attrGRPCClientDuration = attributes.PrometheusGetters(request.SpanPromGetters,
@@ -275,6 +292,15 @@ func newReporter(
 			attrsProvider.For(attributes.MessagingProcessDuration))
 	}
 
+	var attrTCPClientDuration, attrTCPServerDuration []attributes.Field[*request.Span, string]
+
+	if is.TCPEnabled() {
+		attrTCPClientDuration = attributes.PrometheusGetters(request.SpanPromGetters,
+			attrsProvider.For(attributes.TCPClientDuration))
+		attrTCPServerDuration = attributes.PrometheusGetters(request.SpanPromGetters,
+			attrsProvider.For(attributes.TCPServerDuration))
+	}
+
 	clock := expire.NewCachedClock(timeNow)
 	kubeEnabled := ctxInfo.K8sInformer.IsKubeEnabled()
 	// If service name is not explicitly set, we take the service name as set by the
@@ -295,6 +321,8 @@ func newReporter(
 		attrDBClientDuration:      attrDBClientDuration,
 		attrMsgPublishDuration:    attrMessagingPublishDuration,
 		attrMsgProcessDuration:    attrMessagingProcessDuration,
+		attrTCPClientDuration:     attrTCPClientDuration,
+		attrTCPServerDuration:     attrTCPServerDuration,
 		attrHTTPRequestSize:       attrHTTPRequestSize,
 		attrHTTPClientRequestSize: attrHTTPClientRequestSize,
 		beylaInfo: NewExpirer[prometheus.Gauge](prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -330,7 +358,7 @@ func newReporter(
 				NativeHistogramMinResetDuration: defaultHistogramMinResetDuration,
 			}, labelNames(attrHTTPClientDuration)).MetricVec, clock.Time, cfg.TTL)
 		}),
-		grpcDuration: optionalHistogramProvider(is.GRPCEnabled(), func() *Expirer[prometheus.Histogram] {
+		grpcDuration: optionalHistogramProvider(is.RPCEnabled(), func() *Expirer[prometheus.Histogram] {
 			return NewExpirer[prometheus.Histogram](prometheus.NewHistogramVec(prometheus.HistogramOpts{
 				Name:                            attributes.RPCServerDuration.Prom,
 				Help:                            "duration of RCP service calls from the server side, in seconds",
@@ -340,7 +368,7 @@ func newReporter(
 				NativeHistogramMinResetDuration: defaultHistogramMinResetDuration,
 			}, labelNames(attrGRPCDuration)).MetricVec, clock.Time, cfg.TTL)
 		}),
-		grpcClientDuration: optionalHistogramProvider(is.GRPCEnabled(), func() *Expirer[prometheus.Histogram] {
+		grpcClientDuration: optionalHistogramProvider(is.RPCEnabled(), func() *Expirer[prometheus.Histogram] {
 			return NewExpirer[prometheus.Histogram](prometheus.NewHistogramVec(prometheus.HistogramOpts{
 				Name:                            attributes.RPCClientDuration.Prom,
 				Help:                            "duration of GRPC service calls from the client side, in seconds",
@@ -380,6 +408,26 @@ func newReporter(
 				NativeHistogramMinResetDuration: defaultHistogramMinResetDuration,
 			}, labelNames(attrMessagingProcessDuration)).MetricVec, clock.Time, cfg.TTL)
 		}),
+		tcpClientDuration: optionalHistogramProvider(is.TCPEnabled(), func() *Expirer[prometheus.Histogram] {
+			return NewExpirer[prometheus.Histogram](prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:                            attributes.TCPClientDuration.Prom,
+				Help:                            "duration of unclassified TCP requests from the client side, in seconds",
+				Buckets:                         cfg.Buckets.DurationHistogram,
+				NativeHistogramBucketFactor:     defaultHistogramBucketFactor,
+				NativeHistogramMaxBucketNumber:  defaultHistogramMaxBucketNumber,
+				NativeHistogramMinResetDuration: defaultHistogramMinResetDuration,
+			}, labelNames(attrTCPClientDuration)).MetricVec, clock.Time, cfg.TTL)
+		}),
+		tcpServerDuration: optionalHistogramProvider(is.TCPEnabled(), func() *Expirer[prometheus.Histogram] {
+			return NewExpirer[prometheus.Histogram](prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:                            attributes.TCPServerDuration.Prom,
+				Help:                            "duration of unclassified TCP requests from the server side, in seconds",
+				Buckets:                         cfg.Buckets.DurationHistogram,
+				NativeHistogramBucketFactor:     defaultHistogramBucketFactor,
+				NativeHistogramMaxBucketNumber:  defaultHistogramMaxBucketNumber,
+				NativeHistogramMinResetDuration: defaultHistogramMinResetDuration,
+			}, labelNames(attrTCPServerDuration)).MetricVec, clock.Time, cfg.TTL)
+		}),
 		httpRequestSize: optionalHistogramProvider(is.HTTPEnabled(), func() *Expirer[prometheus.Histogram] {
 			return NewExpirer[prometheus.Histogram](prometheus.NewHistogramVec(prometheus.HistogramOpts{
 				Name:                            attributes.HTTPServerRequestSize.Prom,
@@ -489,7 +537,7 @@ func newReporter(
 			)
 		}
 
-		if is.GRPCEnabled() {
+		if is.RPCEnabled() {
 			registeredMetrics = append(registeredMetrics,
 				mr.grpcClientDuration,
 				mr.grpcDuration,
@@ -508,6 +556,13 @@ func newReporter(
 				mr.msgPublishDuration,
 			)
 		}
+
+		if is.TCPEnabled() {
+			registeredMetrics = append(registeredMetrics,
+				mr.tcpClientDuration,
+				mr.tcpServerDuration,
+			)
+		}
 	}
 
 	if cfg.SpanMetricsEnabled() {
@@ -528,10 +583,10 @@ func newReporter(
 		)
 	}
 
-	if mr.cfg.Registry != nil {
-		mr.cfg.Registry.MustRegister(registeredMetrics...)
-	} else {
-		mr.promConnect.Register(cfg.Port, cfg.Path, registeredMetrics...)
+	registerMetrics(mr.promConnect, cfg, registeredMetrics...)
+	if cfg.Registry == nil && cfg.Exemplars {
+		// exemplars are only exposed in the OpenMetrics format
+		mr.promConnect.EnableOpenMetrics(cfg.Port, cfg.Path)
 	}
 
 	return mr, nil
@@ -577,6 +632,21 @@ func (r *metricsReporter) collectMetrics(input <-chan []request.Span) {
 	}
 }
 
+// observeDuration records the duration of a span, attaching its trace and span IDs as an exemplar
+// if exemplars are enabled and the span is sampled
+func (r *metricsReporter) observeDuration(h prometheus.Histogram, duration float64, span *request.Span) {
+	if r.cfg.Exemplars && span.TraceID.IsValid() && trace2.TraceFlags(span.Flags).IsSampled() {
+		if eo, ok := h.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(duration, prometheus.Labels{
+				traceIDKey: span.TraceID.String(),
+				spanIDKey:  span.SpanID.String(),
+			})
+			return
+		}
+	}
+	h.Observe(duration)
+}
+
 func (r *metricsReporter) otelSpanObserved(span *request.Span) bool {
 	return r.cfg.OTelMetricsEnabled() && !span.ServiceID.ExportsOTelMetrics()
 }
@@ -594,53 +664,68 @@ func (r *metricsReporter) observe(span *request.Span) {
 		switch span.Type {
 		case request.EventTypeHTTP:
 			if r.is.HTTPEnabled() {
-				r.httpDuration.WithLabelValues(
+				r.observeDuration(r.httpDuration.WithLabelValues(
 					labelValues(span, r.attrHTTPDuration)...,
-				).metric.Observe(duration)
+				).metric, duration, span)
 				r.httpRequestSize.WithLabelValues(
 					labelValues(span, r.attrHTTPRequestSize)...,
 				).metric.Observe(float64(span.RequestLength()))
 			}
 		case request.EventTypeHTTPClient:
 			if r.is.HTTPEnabled() {
-				r.httpClientDuration.WithLabelValues(
+				r.observeDuration(r.httpClientDuration.WithLabelValues(
 					labelValues(span, r.attrHTTPClientDuration)...,
-				).metric.Observe(duration)
+				).metric, duration, span)
 				r.httpClientRequestSize.WithLabelValues(
 					labelValues(span, r.attrHTTPClientRequestSize)...,
 				).metric.Observe(float64(span.RequestLength()))
 			}
 		case request.EventTypeGRPC:
-			if r.is.GRPCEnabled() {
-				r.grpcDuration.WithLabelValues(
+			if r.is.RPCEnabled() {
+				r.observeDuration(r.grpcDuration.WithLabelValues(
 					labelValues(span, r.attrGRPCDuration)...,
-				).metric.Observe(duration)
+				).metric, duration, span)
 			}
 		case request.EventTypeGRPCClient:
-			if r.is.GRPCEnabled() {
-				r.grpcClientDuration.WithLabelValues(
+			if r.is.RPCEnabled() {
+				r.observeDuration(r.grpcClientDuration.WithLabelValues(
 					labelValues(span, r.attrGRPCClientDuration)...,
-				).metric.Observe(duration)
+				).metric, duration, span)
 			}
-		case request.EventTypeRedisClient, request.EventTypeSQLClient, request.EventTypeRedisServer:
+		case request.EventTypeRedisClient, request.EventTypeSQLClient, request.EventTypeRedisServer,
+			request.EventTypeMongoClient, request.EventTypeMemcachedClient:
 			if r.is.DBEnabled() {
-				r.dbClientDuration.WithLabelValues(
+				r.observeDuration(r.dbClientDuration.WithLabelValues(
 					labelValues(span, r.attrDBClientDuration)...,
-				).metric.Observe(duration)
+				).metric, duration, span)
 			}
-		case request.EventTypeKafkaClient, request.EventTypeKafkaServer:
+		case request.EventTypeKafkaClient, request.EventTypeKafkaServer,
+			request.EventTypeAMQPClient, request.EventTypeAMQPServer,
+			request.EventTypeNATSClient, request.EventTypeMQTTClient:
 			if r.is.MQEnabled() {
 				switch span.Method {
 				case request.MessagingPublish:
-					r.msgPublishDuration.WithLabelValues(
+					r.observeDuration(r.msgPublishDuration.WithLabelValues(
 						labelValues(span, r.attrMsgPublishDuration)...,
-					).metric.Observe(duration)
+					).metric, duration, span)
 				case request.MessagingProcess:
-					r.msgProcessDuration.WithLabelValues(
+					r.observeDuration(r.msgProcessDuration.WithLabelValues(
 						labelValues(span, r.attrMsgProcessDuration)...,
-					).metric.Observe(duration)
+					).metric, duration, span)
 				}
 			}
+		case request.EventTypeTCPClient:
+			if r.is.TCPEnabled() {
+				r.observeDuration(r.tcpClientDuration.WithLabelValues(
+					labelValues(span, r.attrTCPClientDuration)...,
+				).metric, duration, span)
+			}
+		case request.EventTypeTCPServer:
+			if r.is.TCPEnabled() {
+				r.observeDuration(r.tcpServerDuration.WithLabelValues(
+					labelValues(span, r.attrTCPServerDuration)...,
+				).metric, duration, span)
+			}
 		}
 	}
 
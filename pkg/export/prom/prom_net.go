@@ -25,7 +25,7 @@ type NetPrometheusConfig struct {
 
 // nolint:gocritic
 func (p NetPrometheusConfig) Enabled() bool {
-	return p.Config != nil && p.Config.Port != 0 && (p.Config.NetworkMetricsEnabled() || p.GloballyEnabled)
+	return p.Config != nil && (p.Config.Port != 0 || p.Config.RemoteWrite.Enabled()) && (p.Config.NetworkMetricsEnabled() || p.GloballyEnabled)
 }
 
 type netMetricsReporter struct {
@@ -98,11 +98,7 @@ func newNetReporter(
 			Help: "bytes submitted from a source network endpoint to a destination network endpoint",
 		}, labelNames).MetricVec, clock.Time, cfg.Config.TTL),
 	}
-	if cfg.Config.Registry != nil {
-		cfg.Config.Registry.MustRegister(mr.flowBytes)
-	} else {
-		mr.promConnect.Register(cfg.Config.Port, cfg.Config.Path, mr.flowBytes)
-	}
+	registerMetrics(mr.promConnect, cfg.Config, mr.flowBytes)
 
 	return mr, nil
 }
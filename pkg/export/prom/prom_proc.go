@@ -27,7 +27,7 @@ type ProcPrometheusConfig struct {
 
 // nolint:gocritic
 func (p ProcPrometheusConfig) Enabled() bool {
-	return p.Metrics != nil && (p.Metrics.Port != 0 || p.Metrics.Registry != nil) && p.Metrics.OTelMetricsEnabled() &&
+	return p.Metrics != nil && p.Metrics.EndpointEnabled() && p.Metrics.OTelMetricsEnabled() &&
 		slices.Contains(p.Metrics.Features, otel.FeatureProcess)
 }
 
@@ -180,19 +180,10 @@ func newProcReporter(
 		mr.netObserver = mr.observeAggregatedNet
 	}
 
-	if cfg.Metrics.Registry != nil {
-		cfg.Metrics.Registry.MustRegister(
-			mr.cpuUtilization, mr.cpuTime,
-			mr.memory, mr.memoryVirtual,
-			mr.disk, mr.net,
-		)
-	} else {
-		mr.promConnect.Register(cfg.Metrics.Port, cfg.Metrics.Path,
-			mr.cpuUtilization, mr.cpuTime,
-			mr.memory, mr.memoryVirtual,
-			mr.disk,
-			mr.net)
-	}
+	registerMetrics(mr.promConnect, cfg.Metrics,
+		mr.cpuUtilization, mr.cpuTime,
+		mr.memory, mr.memoryVirtual,
+		mr.disk, mr.net)
 
 	return mr, nil
 }
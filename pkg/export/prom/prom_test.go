@@ -18,6 +18,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	trace2 "go.opentelemetry.io/otel/trace"
 
 	"github.com/grafana/beyla/pkg/export/attributes"
 	"github.com/grafana/beyla/pkg/export/instrumentations"
@@ -112,6 +113,82 @@ func TestAppMetricsExpiration(t *testing.T) {
 	assert.Regexp(t, containsTargetInfo, exported)
 }
 
+func TestAppMetricsExemplars(t *testing.T) {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+	openPort, err := test.FreeTCPPort()
+	require.NoError(t, err)
+	promURL := fmt.Sprintf("http://127.0.0.1:%d/metrics", openPort)
+
+	// GIVEN a Prometheus Metrics Exporter with exemplars enabled
+	exporter, err := PrometheusEndpoint(
+		ctx, &global.ContextInfo{Prometheus: &connector.PrometheusManager{}},
+		&PrometheusConfig{
+			Port:                        openPort,
+			Path:                        "/metrics",
+			TTL:                         300 * time.Minute,
+			SpanMetricsServiceCacheSize: 10,
+			Features:                    []string{otel.FeatureApplication},
+			Instrumentations:            []string{instrumentations.InstrumentationALL},
+			Exemplars:                   true,
+		},
+		attributes.Selection{},
+	)()
+	require.NoError(t, err)
+
+	metrics := make(chan []request.Span, 20)
+	go exporter(metrics)
+
+	traceID, _ := trace2.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _ := trace2.SpanIDFromHex("0102030405060708")
+	// WHEN it receives a sampled and a non-sampled span
+	metrics <- []request.Span{
+		{Type: request.EventTypeHTTP, Method: "GET", Status: 200, End: 2 * time.Second.Nanoseconds(),
+			TraceID: traceID, SpanID: spanID, Flags: 1},
+		{Type: request.EventTypeSQLClient, Method: "SELECT", End: time.Second.Nanoseconds(),
+			TraceID: traceID, SpanID: spanID, Flags: 0},
+	}
+
+	// THEN the exemplar of the sampled span is exposed in the OpenMetrics format
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		exported := getOpenMetrics(t, promURL)
+		// the exemplar labels are not sorted, so we just check that both are there
+		assert.Regexp(t, `http_server_request_duration_seconds_bucket\{.*\} 1 # \{.*trace_id="0102030405060708090a0b0c0d0e0f10".*\} 2`, exported)
+		assert.Regexp(t, `http_server_request_duration_seconds_bucket\{.*\} 1 # \{.*span_id="0102030405060708".*\} 2`, exported)
+		assert.Contains(t, exported, `db_client_operation_duration_seconds_count`)
+		assert.NotRegexp(t, `db_client_operation_duration_seconds_bucket.* # \{`, exported)
+	})
+	// AND they aren't exposed in the Prometheus text format
+	exported := getMetrics(t, promURL)
+	assert.NotContains(t, exported, `trace_id=`)
+}
+
+func TestAppMetrics_RPCStatusCode(t *testing.T) {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+	openPort, err := test.FreeTCPPort()
+	require.NoError(t, err)
+	promURL := fmt.Sprintf("http://127.0.0.1:%d/metrics", openPort)
+
+	exporter := makePromExporter(ctx, t, []string{instrumentations.InstrumentationALL}, openPort)
+	metrics := make(chan []request.Span, 20)
+	go exporter(metrics)
+
+	metrics <- []request.Span{
+		{ServiceID: svc.ID{UID: "foo"}, Type: request.EventTypeGRPC, Path: "/foo", Status: 3, RequestStart: 100, End: 200},
+		{ServiceID: svc.ID{UID: "foo"}, Type: request.EventTypeGRPC, RPCKind: request.RPCThrift, Path: "getUser",
+			Status: 1, RequestStart: 100, End: 200},
+	}
+
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		exported := getMetrics(t, promURL)
+		assert.Regexp(t, `rpc_server_duration_seconds_count\{[^}]*rpc_grpc_status_code="3"[^}]*rpc_system="grpc"`, exported)
+		// the gRPC status code doesn't apply to Thrift spans
+		assert.Regexp(t, `rpc_server_duration_seconds_count\{[^}]*rpc_system="thrift"`, exported)
+		assert.NotRegexp(t, `rpc_server_duration_seconds_count\{[^}]*rpc_grpc_status_code="[0-9]+"[^}]*rpc_system="thrift"`, exported)
+	})
+}
+
 type InstrTest struct {
 	name       string
 	instr      []string
@@ -408,6 +485,20 @@ func getMetrics(t require.TestingT, promURL string) string {
 	return string(body)
 }
 
+func getOpenMetrics(t require.TestingT, promURL string) string {
+	mmux.Lock()
+	defer mmux.Unlock()
+	req, err := http.NewRequest(http.MethodGet, promURL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
 type syncedClock struct {
 	mt  sync.Mutex
 	now time.Time
@@ -0,0 +1,390 @@
+package prom
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/grafana/beyla/pkg/buildinfo"
+	"github.com/grafana/beyla/pkg/internal/connector"
+)
+
+func rwlog() *slog.Logger {
+	return slog.With("component", "prom.RemoteWriter")
+}
+
+// staleNaN is the special NaN value that Prometheus uses to mark a series as stale
+// https://github.com/prometheus/prometheus/blob/main/model/value/value.go
+const staleNaN = 0x7ff0000000000002
+
+// RemoteWriteConfig configures the periodic push of the Prometheus metrics to an endpoint
+// that implements the Prometheus remote-write protocol (Prometheus, Mimir, Cortex, Thanos...)
+type RemoteWriteConfig struct {
+	// URL of the remote-write endpoint, e.g. http://mimir:9009/api/v1/push
+	URL string `yaml:"url" env:"BEYLA_PROMETHEUS_REMOTE_WRITE_URL"`
+
+	// Headers that are added to each request, e.g. Authorization or X-Scope-OrgID
+	Headers map[string]string `yaml:"headers" env:"BEYLA_PROMETHEUS_REMOTE_WRITE_HEADERS"`
+
+	// Interval between two consecutive pushes of the whole metrics set
+	Interval time.Duration `yaml:"interval" env:"BEYLA_PROMETHEUS_REMOTE_WRITE_INTERVAL"`
+
+	// Timeout of each request to the remote-write endpoint
+	Timeout time.Duration `yaml:"timeout" env:"BEYLA_PROMETHEUS_REMOTE_WRITE_TIMEOUT"`
+
+	// MaxSamplesPerSend is the maximum number of samples that are sent in a single request
+	MaxSamplesPerSend int `yaml:"max_samples_per_send" env:"BEYLA_PROMETHEUS_REMOTE_WRITE_MAX_SAMPLES_PER_SEND"`
+
+	// QueueCapacity is the maximum number of requests that are kept in memory waiting to be sent.
+	// When the queue is full, the oldest request is discarded.
+	QueueCapacity int `yaml:"queue_capacity" env:"BEYLA_PROMETHEUS_REMOTE_WRITE_QUEUE_CAPACITY"`
+
+	// MaxRetries is the number of times that a request is retried after a network error, a 5xx
+	// or a 429 response, before discarding it
+	MaxRetries int           `yaml:"max_retries" env:"BEYLA_PROMETHEUS_REMOTE_WRITE_MAX_RETRIES"`
+	MinBackoff time.Duration `yaml:"min_backoff" env:"BEYLA_PROMETHEUS_REMOTE_WRITE_MIN_BACKOFF"`
+	MaxBackoff time.Duration `yaml:"max_backoff" env:"BEYLA_PROMETHEUS_REMOTE_WRITE_MAX_BACKOFF"`
+
+	// InsecureSkipVerify skips the verification of the server certificate
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify" env:"BEYLA_PROMETHEUS_REMOTE_WRITE_INSECURE_SKIP_VERIFY"`
+}
+
+// Enabled specifies that the remote-write push is enabled if and only if its URL is defined
+func (c *RemoteWriteConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+func (c *RemoteWriteConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid Prometheus remote-write URL %q", c.URL)
+	}
+	if c.Interval <= 0 {
+		return errors.New("the Prometheus remote-write interval must be greater than 0s")
+	}
+	if c.MaxSamplesPerSend <= 0 || c.QueueCapacity <= 0 {
+		return errors.New("the Prometheus remote-write max_samples_per_send and queue_capacity must be greater than 0")
+	}
+	return nil
+}
+
+// registerMetrics registers the collectors in the Alloy registry, if any, or in the Prometheus manager.
+// In the latter case, the registered metrics are also pushed to the remote-write endpoint, if enabled.
+func registerMetrics(promConnect *connector.PrometheusManager, cfg *PrometheusConfig, collectors ...prometheus.Collector) {
+	if cfg.Registry != nil {
+		cfg.Registry.MustRegister(collectors...)
+		return
+	}
+	promConnect.Register(cfg.Port, cfg.Path, collectors...)
+	if cfg.RemoteWrite.Enabled() {
+		promConnect.AddPusher(cfg.Port, cfg.Path, newRemoteWriter(&cfg.RemoteWrite).run)
+	}
+}
+
+type rwLabel struct {
+	name  string
+	value string
+}
+
+type rwSample struct {
+	labels      []rwLabel
+	value       float64
+	timestampMs int64
+	exemplar    *dto.Exemplar
+}
+
+// remoteWriter periodically gathers the metrics of a registry, and pushes them to the
+// remote-write endpoint. Since it gathers the same registry as the scrape endpoint, it pushes the
+// same series that the Expirer collectors expose, and it marks as stale the series that have
+// been removed by them since the previous push. The requests are kept in a bounded in-memory
+// queue, so they are lost if Beyla is restarted.
+type remoteWriter struct {
+	cfg    *RemoteWriteConfig
+	log    *slog.Logger
+	client *http.Client
+	queue  chan []rwSample
+	// labels of the series sent in the previous push, keyed by their string representation
+	lastSeries map[string][]rwLabel
+}
+
+func newRemoteWriter(cfg *RemoteWriteConfig) *remoteWriter {
+	return &remoteWriter{
+		cfg: cfg,
+		log: rwlog().With("url", cfg.URL),
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+			},
+		},
+		queue:      make(chan []rwSample, cfg.QueueCapacity),
+		lastSeries: map[string][]rwLabel{},
+	}
+}
+
+func (rw *remoteWriter) run(ctx context.Context, gatherer prometheus.Gatherer) {
+	rw.log.Info("pushing metrics to Prometheus remote-write endpoint", "interval", rw.cfg.Interval)
+	go rw.sendLoop(ctx)
+	ticker := time.NewTicker(rw.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rw.push(gatherer, timeNow())
+		}
+	}
+}
+
+// push gathers the metrics and enqueues them in batches of at most MaxSamplesPerSend samples
+func (rw *remoteWriter) push(gatherer prometheus.Gatherer, now time.Time) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		// Gather returns as many metrics as possible even on error
+		rw.log.Warn("error gathering metrics", "error", err)
+	}
+	samples := rw.samples(families, now.UnixMilli())
+	for len(samples) > 0 {
+		n := min(len(samples), rw.cfg.MaxSamplesPerSend)
+		rw.enqueue(samples[:n])
+		samples = samples[n:]
+	}
+}
+
+// enqueue adds the batch to the queue, dropping the oldest batch if the queue is full
+func (rw *remoteWriter) enqueue(batch []rwSample) {
+	for {
+		select {
+		case rw.queue <- batch:
+			return
+		default:
+		}
+		select {
+		case dropped := <-rw.queue:
+			rw.log.Warn("remote-write queue is full. Dropping the oldest samples", "samples", len(dropped))
+		default:
+		}
+	}
+}
+
+func (rw *remoteWriter) sendLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch := <-rw.queue:
+			if err := rw.sendWithRetries(ctx, encodeWriteRequest(batch)); err != nil {
+				rw.log.Error("error sending samples to the remote-write endpoint",
+					"error", err, "samples", len(batch))
+			}
+		}
+	}
+}
+
+func (rw *remoteWriter) sendWithRetries(ctx context.Context, body []byte) error {
+	backoff := rw.cfg.MinBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := rw.send(ctx, body)
+		if err == nil || !retry || attempt >= rw.cfg.MaxRetries {
+			return err
+		}
+		rw.log.Debug("retrying remote-write request", "error", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, rw.cfg.MaxBackoff)
+	}
+}
+
+// send submits the snappy-compressed WriteRequest, and returns whether it can be retried if it failed
+func (rw *remoteWriter) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rw.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("creating request: %w", err)
+	}
+	for k, v := range rw.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "Beyla/"+buildinfo.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := rw.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	// drain the body to allow reusing the connection
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		fmt.Errorf("unexpected response from %s: %s", rw.cfg.URL, resp.Status)
+}
+
+// samples converts the gathered metric families into remote-write samples, following the same
+// naming as the text exposition format, and appends a stale marker for each series that was
+// sent in the previous push but that isn't gathered anymore.
+func (rw *remoteWriter) samples(families []*dto.MetricFamily, ts int64) []rwSample {
+	var samples []rwSample
+	add := func(name string, m *dto.Metric, value float64, exemplar *dto.Exemplar, extra ...rwLabel) {
+		labels := make([]rwLabel, 0, len(m.GetLabel())+len(extra)+1)
+		labels = append(labels, rwLabel{name: "__name__", value: name})
+		for _, l := range m.GetLabel() {
+			labels = append(labels, rwLabel{name: l.GetName(), value: l.GetValue()})
+		}
+		labels = append(labels, extra...)
+		// remote-write requires the labels to be sorted by name
+		slices.SortFunc(labels, func(a, b rwLabel) int { return strings.Compare(a.name, b.name) })
+		sampleTS := ts
+		if m.TimestampMs != nil {
+			sampleTS = m.GetTimestampMs()
+		}
+		samples = append(samples, rwSample{labels: labels, value: value, timestampMs: sampleTS, exemplar: exemplar})
+	}
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m, m.GetCounter().GetValue(), m.GetCounter().GetExemplar())
+			case dto.MetricType_GAUGE:
+				add(name, m, m.GetGauge().GetValue(), nil)
+			case dto.MetricType_UNTYPED:
+				add(name, m, m.GetUntyped().GetValue(), nil)
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, m, q.GetValue(), nil, rwLabel{name: "quantile", value: formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", m, s.GetSampleSum(), nil)
+				add(name+"_count", m, float64(s.GetSampleCount()), nil)
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				// only the classic buckets are sent. Native histograms aren't supported by the 1.0
+				// version of the remote-write protocol
+				h := m.GetHistogram()
+				infSeen := false
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						infSeen = true
+					}
+					add(name+"_bucket", m, float64(b.GetCumulativeCount()), b.GetExemplar(),
+						rwLabel{name: "le", value: formatFloat(b.GetUpperBound())})
+				}
+				if !infSeen {
+					add(name+"_bucket", m, float64(h.GetSampleCount()), nil, rwLabel{name: "le", value: "+Inf"})
+				}
+				add(name+"_sum", m, h.GetSampleSum(), nil)
+				add(name+"_count", m, float64(h.GetSampleCount()), nil)
+			}
+		}
+	}
+
+	current := make(map[string][]rwLabel, len(samples))
+	for i := range samples {
+		current[labelsKey(samples[i].labels)] = samples[i].labels
+	}
+	for key, labels := range rw.lastSeries {
+		if _, ok := current[key]; !ok {
+			samples = append(samples, rwSample{labels: labels, value: math.Float64frombits(staleNaN), timestampMs: ts})
+		}
+	}
+	rw.lastSeries = current
+	return samples
+}
+
+func labelsKey(labels []rwLabel) string {
+	sb := strings.Builder{}
+	for _, l := range labels {
+		sb.WriteString(l.name)
+		sb.WriteByte(0xff)
+		sb.WriteString(l.value)
+		sb.WriteByte(0xff)
+	}
+	return sb.String()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes the samples as a snappy-compressed prometheus.WriteRequest message
+// https://github.com/prometheus/prometheus/blob/main/prompb/remote.proto
+func encodeWriteRequest(samples []rwSample) []byte {
+	var out []byte
+	for i := range samples {
+		out = protowire.AppendTag(out, 1, protowire.BytesType)
+		out = protowire.AppendBytes(out, protoTimeSeries(&samples[i]))
+	}
+	return snappy.Encode(nil, out)
+}
+
+// protoTimeSeries encodes a prometheus.TimeSeries message with a single sample
+// https://github.com/prometheus/prometheus/blob/main/prompb/types.proto
+func protoTimeSeries(s *rwSample) []byte {
+	var b []byte
+	b = appendProtoLabels(b, s.labels)
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(s.timestampMs))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, sample)
+	if s.exemplar != nil {
+		var ex []byte
+		exLabels := make([]rwLabel, 0, len(s.exemplar.GetLabel()))
+		for _, l := range s.exemplar.GetLabel() {
+			exLabels = append(exLabels, rwLabel{name: l.GetName(), value: l.GetValue()})
+		}
+		ex = appendProtoLabels(ex, exLabels)
+		ex = protowire.AppendTag(ex, 2, protowire.Fixed64Type)
+		ex = protowire.AppendFixed64(ex, math.Float64bits(s.exemplar.GetValue()))
+		exTS := s.timestampMs
+		if s.exemplar.Timestamp != nil {
+			exTS = s.exemplar.GetTimestamp().AsTime().UnixMilli()
+		}
+		ex = protowire.AppendTag(ex, 3, protowire.VarintType)
+		ex = protowire.AppendVarint(ex, uint64(exTS))
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, ex)
+	}
+	return b
+}
+
+func appendProtoLabels(b []byte, labels []rwLabel) []byte {
+	for _, l := range labels {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, l.name)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, l.value)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, label)
+	}
+	return b
+}
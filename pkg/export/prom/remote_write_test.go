@@ -0,0 +1,264 @@
+package prom
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/mariomac/guara/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/grafana/beyla/pkg/export/attributes"
+	"github.com/grafana/beyla/pkg/export/instrumentations"
+	"github.com/grafana/beyla/pkg/export/otel"
+	"github.com/grafana/beyla/pkg/internal/connector"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// remoteWriteServer stores the last value received for each series, indexed by its
+// labels in the text exposition format, e.g. foo_sum{url_path="/foo"}
+type remoteWriteServer struct {
+	mt         sync.Mutex
+	series     map[string]float64
+	maxSamples int
+	headers    http.Header
+}
+
+func (rs *remoteWriteServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	compressed, _ := io.ReadAll(req.Body)
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	series := decodeWriteRequest(body)
+	rs.mt.Lock()
+	defer rs.mt.Unlock()
+	rs.headers = req.Header
+	rs.maxSamples = max(rs.maxSamples, len(series))
+	for k, v := range series {
+		rs.series[k] = v
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *remoteWriteServer) value(key string) (float64, bool) {
+	rs.mt.Lock()
+	defer rs.mt.Unlock()
+	v, ok := rs.series[key]
+	return v, ok
+}
+
+func decodeWriteRequest(b []byte) map[string]float64 {
+	series := map[string]float64{}
+	forEachField(b, func(_ protowire.Number, ts []byte) {
+		name := ""
+		var labels []string
+		var value float64
+		forEachField(ts, func(num protowire.Number, field []byte) {
+			switch num {
+			case 1:
+				var lname, lvalue string
+				forEachField(field, func(num protowire.Number, v []byte) {
+					if num == 1 {
+						lname = string(v)
+					} else {
+						lvalue = string(v)
+					}
+				})
+				if lname == "__name__" {
+					name = lvalue
+				} else {
+					labels = append(labels, lname+`="`+lvalue+`"`)
+				}
+			case 2:
+				v, _ := protowire.ConsumeFixed64(field[1:])
+				value = math.Float64frombits(v)
+			}
+		})
+		sort.Strings(labels)
+		series[name+"{"+strings.Join(labels, ",")+"}"] = value
+	})
+	return series
+}
+
+// forEachField iterates over the fields of a message. Only the length-delimited fields are decoded,
+// and the rest of fields are passed with their tag
+func forEachField(b []byte, fn func(num protowire.Number, field []byte)) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if typ != protowire.BytesType {
+			m := protowire.ConsumeFieldValue(num, typ, b[n:])
+			fn(num, b[:n+m])
+			b = b[n+m:]
+			continue
+		}
+		v, m := protowire.ConsumeBytes(b[n:])
+		fn(num, v)
+		b = b[n+m:]
+	}
+}
+
+func TestRemoteWrite(t *testing.T) {
+	now := syncedClock{now: time.Now()}
+	timeNow = now.Now
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+
+	rs := &remoteWriteServer{series: map[string]float64{}}
+	srv := httptest.NewServer(rs)
+	defer srv.Close()
+
+	// GIVEN a push-only Prometheus exporter, with a metrics expire time of 3 minutes
+	exporter, err := PrometheusEndpoint(
+		ctx, &global.ContextInfo{Prometheus: &connector.PrometheusManager{}},
+		&PrometheusConfig{
+			Path:                        "/metrics",
+			TTL:                         3 * time.Minute,
+			SpanMetricsServiceCacheSize: 10,
+			Features:                    []string{otel.FeatureApplication},
+			Instrumentations:            []string{instrumentations.InstrumentationALL},
+			RemoteWrite: RemoteWriteConfig{
+				URL:               srv.URL,
+				Headers:           map[string]string{"X-Scope-OrgID": "tenant-1"},
+				Interval:          50 * time.Millisecond,
+				Timeout:           timeout,
+				MaxSamplesPerSend: 20,
+				QueueCapacity:     100,
+			},
+		},
+		attributes.Selection{
+			attributes.HTTPServerDuration.Section: attributes.InclusionLists{
+				Include: []string{"url_path"},
+			},
+		},
+	)()
+	require.NoError(t, err)
+
+	metrics := make(chan []request.Span, 20)
+	go exporter(metrics)
+
+	// WHEN it receives metrics
+	metrics <- []request.Span{
+		{Type: request.EventTypeHTTP, Path: "/foo", End: 123 * time.Second.Nanoseconds()},
+		{Type: request.EventTypeHTTP, Path: "/baz", End: 456 * time.Second.Nanoseconds()},
+	}
+
+	// THEN the same series as in the scrape endpoint are pushed
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		v, ok := rs.value(`http_server_request_duration_seconds_sum{url_path="/foo"}`)
+		assert.True(t, ok)
+		assert.EqualValues(t, 123, v)
+		v, ok = rs.value(`http_server_request_duration_seconds_sum{url_path="/baz"}`)
+		assert.True(t, ok)
+		assert.EqualValues(t, 456, v)
+		v, ok = rs.value(`http_server_request_duration_seconds_bucket{le="+Inf",url_path="/foo"}`)
+		assert.True(t, ok)
+		assert.EqualValues(t, 1, v)
+	}, test.Interval(10*time.Millisecond))
+	rs.mt.Lock()
+	assert.Equal(t, "tenant-1", rs.headers.Get("X-Scope-OrgID"))
+	assert.Equal(t, "snappy", rs.headers.Get("Content-Encoding"))
+	assert.Equal(t, "0.1.0", rs.headers.Get("X-Prometheus-Remote-Write-Version"))
+	// AND the samples are sent in batches
+	assert.LessOrEqual(t, rs.maxSamples, 20)
+	rs.mt.Unlock()
+
+	// AND WHEN only a subset of the metrics is received during the timeout
+	now.Advance(2 * time.Minute)
+	metrics <- []request.Span{
+		{Type: request.EventTypeHTTP, Path: "/foo", End: 123 * time.Second.Nanoseconds()},
+	}
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		v, _ := rs.value(`http_server_request_duration_seconds_sum{url_path="/foo"}`)
+		assert.EqualValues(t, 246, v)
+	}, test.Interval(10*time.Millisecond))
+	now.Advance(2 * time.Minute)
+	// the clock is updated when a new batch of spans is received
+	metrics <- []request.Span{
+		{Type: request.EventTypeHTTP, Path: "/foo", End: 123 * time.Second.Nanoseconds()},
+	}
+
+	// THEN the expired series are marked as stale
+	test.Eventually(t, timeout, func(t require.TestingT) {
+		v, _ := rs.value(`http_server_request_duration_seconds_sum{url_path="/foo"}`)
+		assert.EqualValues(t, 369, v)
+		v, _ = rs.value(`http_server_request_duration_seconds_sum{url_path="/baz"}`)
+		assert.Equal(t, uint64(staleNaN), math.Float64bits(v))
+	}, test.Interval(10*time.Millisecond))
+}
+
+func TestRemoteWrite_Retries(t *testing.T) {
+	var requests atomic.Int32
+	status := atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		// the first request always fails
+		if requests.Add(1) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	rw := newRemoteWriter(&RemoteWriteConfig{
+		URL: srv.URL, Timeout: timeout, QueueCapacity: 1, MaxSamplesPerSend: 1,
+		MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond,
+	})
+	body := encodeWriteRequest([]rwSample{{labels: []rwLabel{{name: "__name__", value: "foo"}}, value: 1}})
+
+	// 5xx responses are retried
+	status.Store(http.StatusOK)
+	require.NoError(t, rw.sendWithRetries(context.Background(), body))
+	assert.EqualValues(t, 2, requests.Load())
+
+	// 4xx responses are not retried
+	requests.Store(1)
+	status.Store(http.StatusBadRequest)
+	require.Error(t, rw.sendWithRetries(context.Background(), body))
+	assert.EqualValues(t, 2, requests.Load())
+
+	// the request is discarded after the maximum number of retries
+	requests.Store(0)
+	status.Store(http.StatusServiceUnavailable)
+	require.Error(t, rw.sendWithRetries(context.Background(), body))
+	assert.EqualValues(t, 3, requests.Load())
+}
+
+func TestRemoteWrite_QueueDropsOldest(t *testing.T) {
+	rw := newRemoteWriter(&RemoteWriteConfig{URL: "http://localhost", QueueCapacity: 2, MaxSamplesPerSend: 1})
+	for i := 0; i < 3; i++ {
+		rw.enqueue([]rwSample{{value: float64(i)}})
+	}
+	assert.EqualValues(t, 1, (<-rw.queue)[0].value)
+	assert.EqualValues(t, 2, (<-rw.queue)[0].value)
+}
+
+func TestRemoteWriteConfig_Validate(t *testing.T) {
+	valid := RemoteWriteConfig{URL: "https://mimir/api/v1/push", Interval: time.Second, MaxSamplesPerSend: 1, QueueCapacity: 1}
+	assert.NoError(t, valid.Validate())
+	assert.NoError(t, (&RemoteWriteConfig{}).Validate())
+
+	invalid := valid
+	invalid.URL = "mimir:9009"
+	assert.Error(t, invalid.Validate())
+	invalid = valid
+	invalid.Interval = 0
+	assert.Error(t, invalid.Validate())
+	invalid = valid
+	invalid.MaxSamplesPerSend = 0
+	assert.Error(t, invalid.Validate())
+}
@@ -0,0 +1,108 @@
+package statsd
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// kind of StatsD metric, as written after the pipe character of each line
+type kind string
+
+const (
+	kindTimer        = kind("ms")
+	kindHistogram    = kind("h")
+	kindDistribution = kind("d")
+)
+
+// unknownValue replaces the empty attribute values in the plain StatsD metric names
+const unknownValue = "unknown"
+
+// replaces the characters that have a meaning in the StatsD line protocol
+var statsdEscaper = strings.NewReplacer(
+	".", "_", "/", "_", ":", "_", "|", "_", "@", "_", "#", "_", ",", "_", " ", "_", "\n", "_",
+)
+
+// replaces the characters that have a meaning in the DogStatsD tags section
+var tagEscaper = strings.NewReplacer(
+	"|", "_", ",", "_", "#", "_", "\n", "_",
+)
+
+// appendStatsDLine appends a plain StatsD line: name.value1.value2:value|kind
+// As plain StatsD doesn't support tags, the selected attribute values are appended
+// to the metric name, sorted by attribute name.
+func appendStatsDLine(dst []byte, m *metric, span *request.Span, value float64) []byte {
+	dst = append(dst, m.name...)
+	for _, attr := range m.attrs {
+		dst = append(dst, '.')
+		if v := attr.Get(span); v != "" {
+			dst = append(dst, statsdEscaper.Replace(v)...)
+		} else {
+			dst = append(dst, unknownValue...)
+		}
+	}
+	return appendValue(dst, m.kind, value)
+}
+
+// appendDogStatsDLine appends a DogStatsD line: name:value|kind|#key1:value1,key2:value2
+// The attributes with empty values are not added as tags.
+func appendDogStatsDLine(dst []byte, m *metric, span *request.Span, value float64) []byte {
+	dst = append(dst, m.name...)
+	dst = appendValue(dst, m.kind, value)
+	first := true
+	for _, attr := range m.attrs {
+		v := attr.Get(span)
+		if v == "" {
+			continue
+		}
+		if first {
+			dst = append(dst, "|#"...)
+			first = false
+		} else {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, attr.ExposedName...)
+		dst = append(dst, ':')
+		dst = append(dst, tagEscaper.Replace(v)...)
+	}
+	return dst
+}
+
+func appendValue(dst []byte, k kind, value float64) []byte {
+	dst = append(dst, ':')
+	dst = strconv.AppendFloat(dst, value, 'f', -1, 64)
+	dst = append(dst, '|')
+	return append(dst, k...)
+}
+
+// packetWriter packs the newline-separated metric lines into packets of up to maxSize bytes.
+// A line that is larger than maxSize is sent alone in its own packet.
+type packetWriter struct {
+	out     io.Writer
+	maxSize int
+	buf     []byte
+}
+
+func (p *packetWriter) write(line []byte) error {
+	var err error
+	if len(p.buf) > 0 && len(p.buf)+1+len(line) > p.maxSize {
+		err = p.flush()
+	}
+	if len(p.buf) > 0 {
+		p.buf = append(p.buf, '\n')
+	}
+	p.buf = append(p.buf, line...)
+	return err
+}
+
+// flush sends the pending lines, if any
+func (p *packetWriter) flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	_, err := p.out.Write(p.buf)
+	p.buf = p.buf[:0]
+	return err
+}
@@ -0,0 +1,264 @@
+// Package statsd provides an export node that submits the application metrics to a StatsD agent,
+// optionally using the DogStatsD extension for the metric tags.
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/mariomac/pipes/pipe"
+
+	"github.com/grafana/beyla/pkg/export/attributes"
+	"github.com/grafana/beyla/pkg/export/instrumentations"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+func mlog() *slog.Logger {
+	return slog.With("component", "statsd.MetricsReporter")
+}
+
+// Flavor of the StatsD protocol
+type Flavor string
+
+const (
+	// FlavorStatsD is the plain StatsD protocol. As it doesn't support tags, the values of the
+	// selected attributes are appended to the metric name.
+	FlavorStatsD = Flavor("statsd")
+	// FlavorDogStatsD extends the StatsD protocol with tags and distributions.
+	FlavorDogStatsD = Flavor("dogstatsd")
+)
+
+type Config struct {
+	// Endpoint of the StatsD agent, in host:port format. If empty, the exporter is disabled.
+	Endpoint string `yaml:"endpoint" env:"BEYLA_STATSD_ENDPOINT"`
+	// Flavor of the protocol: statsd or dogstatsd
+	Flavor Flavor `yaml:"flavor" env:"BEYLA_STATSD_FLAVOR"`
+	// Prefix that is prepended to all the metric names
+	Prefix string `yaml:"prefix" env:"BEYLA_STATSD_PREFIX"`
+	// MaxPacketSize is the maximum size, in bytes, of each UDP packet sent to the agent
+	MaxPacketSize int `yaml:"max_packet_size" env:"BEYLA_STATSD_MAX_PACKET_SIZE"`
+	// Allows configuration of which instrumentations should be enabled, e.g. http, grpc, sql...
+	Instrumentations []string `yaml:"instrumentations" env:"BEYLA_STATSD_INSTRUMENTATIONS" envSeparator:","`
+}
+
+// Enabled specifies that the StatsD exporter is enabled if and only if an endpoint is defined
+func (c *Config) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.Endpoint); err != nil {
+		return fmt.Errorf("invalid StatsD endpoint %q. It must be in host:port format: %w", c.Endpoint, err)
+	}
+	switch c.Flavor {
+	case FlavorStatsD, FlavorDogStatsD:
+	default:
+		return fmt.Errorf("invalid StatsD flavor %q. Accepted values are: %s, %s",
+			c.Flavor, FlavorStatsD, FlavorDogStatsD)
+	}
+	if c.MaxPacketSize <= 0 {
+		return fmt.Errorf("StatsD max_packet_size must be greater than 0")
+	}
+	return nil
+}
+
+// metric of a given type, and the user-selected attributes that are reported with it
+type metric struct {
+	name  string
+	kind  kind
+	attrs []attributes.Field[*request.Span, string]
+}
+
+type metricsReporter struct {
+	cfg *Config
+	is  instrumentations.InstrumentationSelection
+
+	httpDuration          *metric
+	httpClientDuration    *metric
+	httpRequestSize       *metric
+	httpClientRequestSize *metric
+	grpcDuration          *metric
+	grpcClientDuration    *metric
+	dbClientDuration      *metric
+	msgPublishDuration    *metric
+	msgProcessDuration    *metric
+	tcpClientDuration     *metric
+	tcpServerDuration     *metric
+
+	packets *packetWriter
+	// reused buffer for each metric line
+	line []byte
+}
+
+// ReportMetrics creates a terminal node that submits the application metrics of each span
+// to a StatsD agent. The duration histograms are reported as timers (or distributions for
+// DogStatsD), in milliseconds.
+func ReportMetrics(
+	ctx context.Context,
+	ctxInfo *global.ContextInfo,
+	cfg *Config,
+	attrSelect attributes.Selection,
+) pipe.FinalProvider[[]request.Span] {
+	return func() (pipe.FinalFunc[[]request.Span], error) {
+		if !cfg.Enabled() {
+			return pipe.IgnoreFinal[[]request.Span](), nil
+		}
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		conn, err := (&net.Dialer{}).DialContext(ctx, "udp", cfg.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to StatsD agent: %w", err)
+		}
+		reporter, err := newReporter(ctxInfo, cfg, attrSelect, conn)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("instantiating StatsD metrics reporter: %w", err)
+		}
+		return func(in <-chan []request.Span) {
+			defer conn.Close()
+			reporter.reportMetrics(in)
+		}, nil
+	}
+}
+
+func newReporter(
+	ctxInfo *global.ContextInfo,
+	cfg *Config,
+	selector attributes.Selection,
+	conn net.Conn,
+) (*metricsReporter, error) {
+	attrsProvider, err := attributes.NewAttrSelector(ctxInfo.MetricAttributeGroups, selector)
+	if err != nil {
+		return nil, fmt.Errorf("selecting metrics attributes: %w", err)
+	}
+	is := instrumentations.NewInstrumentationSelection(cfg.Instrumentations)
+	durationKind, sizeKind := kindTimer, kindHistogram
+	if cfg.Flavor == FlavorDogStatsD {
+		durationKind, sizeKind = kindDistribution, kindDistribution
+	}
+	newMetric := func(enabled bool, name attributes.Name, k kind) *metric {
+		if !enabled {
+			return nil
+		}
+		return &metric{
+			name: metricName(cfg.Prefix, name.OTEL),
+			kind: k,
+			// StatsD has no typed attributes, so we take the same string values as the Prometheus exporter
+			attrs: attributes.OpenTelemetryGetters(request.SpanPromGetters, attrsProvider.For(name)),
+		}
+	}
+	return &metricsReporter{
+		cfg:                   cfg,
+		is:                    is,
+		httpDuration:          newMetric(is.HTTPEnabled(), attributes.HTTPServerDuration, durationKind),
+		httpClientDuration:    newMetric(is.HTTPEnabled(), attributes.HTTPClientDuration, durationKind),
+		httpRequestSize:       newMetric(is.HTTPEnabled(), attributes.HTTPServerRequestSize, sizeKind),
+		httpClientRequestSize: newMetric(is.HTTPEnabled(), attributes.HTTPClientRequestSize, sizeKind),
+		grpcDuration:          newMetric(is.RPCEnabled(), attributes.RPCServerDuration, durationKind),
+		grpcClientDuration:    newMetric(is.RPCEnabled(), attributes.RPCClientDuration, durationKind),
+		dbClientDuration:      newMetric(is.DBEnabled(), attributes.DBClientDuration, durationKind),
+		msgPublishDuration:    newMetric(is.MQEnabled(), attributes.MessagingPublishDuration, durationKind),
+		msgProcessDuration:    newMetric(is.MQEnabled(), attributes.MessagingProcessDuration, durationKind),
+		tcpClientDuration:     newMetric(is.TCPEnabled(), attributes.TCPClientDuration, durationKind),
+		tcpServerDuration:     newMetric(is.TCPEnabled(), attributes.TCPServerDuration, durationKind),
+		packets:               &packetWriter{out: conn, maxSize: cfg.MaxPacketSize},
+	}, nil
+}
+
+func metricName(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// reportMetrics submits the metrics of each spans batch, packing as many lines as possible
+// in each UDP packet
+func (r *metricsReporter) reportMetrics(in <-chan []request.Span) {
+	log := mlog()
+	for spans := range in {
+		for i := range spans {
+			// If we are ignoring this span because of route patterns, don't do anything
+			if spans[i].IgnoreMetrics() {
+				continue
+			}
+			r.observe(&spans[i])
+		}
+		if err := r.packets.flush(); err != nil {
+			// the agent might be temporarily down. As StatsD is a best-effort protocol
+			// we just log it and continue with the next batch
+			log.Debug("error submitting metrics to the StatsD agent", "error", err)
+		}
+	}
+}
+
+// nolint:cyclop
+func (r *metricsReporter) observe(span *request.Span) {
+	if span.ServiceID.ExportsOTelMetrics() {
+		return
+	}
+	t := span.Timings()
+	durationMs := float64(t.End.Sub(t.RequestStart).Microseconds()) / 1000
+	switch span.Type {
+	case request.EventTypeHTTP:
+		if r.is.HTTPEnabled() {
+			r.record(r.httpDuration, span, durationMs)
+			r.record(r.httpRequestSize, span, float64(span.RequestLength()))
+		}
+	case request.EventTypeHTTPClient:
+		if r.is.HTTPEnabled() {
+			r.record(r.httpClientDuration, span, durationMs)
+			r.record(r.httpClientRequestSize, span, float64(span.RequestLength()))
+		}
+	case request.EventTypeGRPC:
+		if r.is.RPCEnabled() {
+			r.record(r.grpcDuration, span, durationMs)
+		}
+	case request.EventTypeGRPCClient:
+		if r.is.RPCEnabled() {
+			r.record(r.grpcClientDuration, span, durationMs)
+		}
+	case request.EventTypeRedisClient, request.EventTypeSQLClient, request.EventTypeRedisServer,
+		request.EventTypeMongoClient, request.EventTypeMemcachedClient:
+		if r.is.DBEnabled() {
+			r.record(r.dbClientDuration, span, durationMs)
+		}
+	case request.EventTypeKafkaClient, request.EventTypeKafkaServer,
+		request.EventTypeAMQPClient, request.EventTypeAMQPServer,
+		request.EventTypeNATSClient, request.EventTypeMQTTClient:
+		if r.is.MQEnabled() {
+			switch span.Method {
+			case request.MessagingPublish:
+				r.record(r.msgPublishDuration, span, durationMs)
+			case request.MessagingProcess:
+				r.record(r.msgProcessDuration, span, durationMs)
+			}
+		}
+	case request.EventTypeTCPClient:
+		if r.is.TCPEnabled() {
+			r.record(r.tcpClientDuration, span, durationMs)
+		}
+	case request.EventTypeTCPServer:
+		if r.is.TCPEnabled() {
+			r.record(r.tcpServerDuration, span, durationMs)
+		}
+	}
+}
+
+func (r *metricsReporter) record(m *metric, span *request.Span, value float64) {
+	if r.cfg.Flavor == FlavorDogStatsD {
+		r.line = appendDogStatsDLine(r.line[:0], m, span, value)
+	} else {
+		r.line = appendStatsDLine(r.line[:0], m, span, value)
+	}
+	if err := r.packets.write(r.line); err != nil {
+		mlog().Debug("error submitting metrics to the StatsD agent", "error", err)
+	}
+}
@@ -0,0 +1,160 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/export/attributes"
+	"github.com/grafana/beyla/pkg/export/instrumentations"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+const timeout = 5 * time.Second
+
+func TestReportMetrics_StatsD(t *testing.T) {
+	agent, endpoint := listenUDP(t)
+
+	lines := exportSpans(t, &Config{
+		Endpoint:         endpoint,
+		Flavor:           FlavorStatsD,
+		Prefix:           "beyla",
+		MaxPacketSize:    1432,
+		Instrumentations: []string{instrumentations.InstrumentationALL},
+	}, attributes.Selection{
+		attributes.HTTPServerDuration.Section: attributes.InclusionLists{
+			Include: []string{"http.request.method", "http.route"},
+		},
+		attributes.HTTPServerRequestSize.Section: attributes.InclusionLists{
+			Include: []string{"http.request.method"},
+		},
+		attributes.DBClientDuration.Section: attributes.InclusionLists{
+			Include: []string{"db.operation.name", "db.system"},
+		},
+	}, agent, 3)
+
+	assert.ElementsMatch(t, []string{
+		"beyla.http.server.request.duration.GET._foo_{id}:1.5|ms",
+		"beyla.http.server.request.body.size.GET:123|h",
+		"beyla.db.client.operation.duration.SELECT.other_sql:20|ms",
+	}, lines)
+}
+
+func TestReportMetrics_DogStatsD(t *testing.T) {
+	agent, endpoint := listenUDP(t)
+
+	lines := exportSpans(t, &Config{
+		Endpoint:         endpoint,
+		Flavor:           FlavorDogStatsD,
+		MaxPacketSize:    1432,
+		Instrumentations: []string{instrumentations.InstrumentationHTTP},
+	}, attributes.Selection{
+		attributes.HTTPServerDuration.Section: attributes.InclusionLists{
+			Include: []string{"http.request.method", "http.route", "url.path"},
+		},
+		attributes.HTTPServerRequestSize.Section: attributes.InclusionLists{
+			Include: []string{"service.name"},
+		},
+	}, agent, 2)
+
+	// the SQL span is not reported, as its instrumentation is not selected
+	assert.ElementsMatch(t, []string{
+		"http.server.request.duration:1.5|d|#http.request.method:GET,http.route:/foo/{id},url.path:/foo_bar",
+		"http.server.request.body.size:123|d|#service.name:svc",
+	}, lines)
+}
+
+func TestPacketWriter(t *testing.T) {
+	out := &packetRecorder{}
+	p := packetWriter{out: out, maxSize: 10}
+	require.NoError(t, p.write([]byte("aaaa")))
+	require.NoError(t, p.write([]byte("bbbb")))
+	require.NoError(t, p.write([]byte("cc")))
+	require.NoError(t, p.write([]byte("dddddddddddd")))
+	require.NoError(t, p.flush())
+	require.NoError(t, p.flush())
+	assert.Equal(t, []string{"aaaa\nbbbb", "cc", "dddddddddddd"}, out.packets)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&Config{}).Validate())
+	assert.NoError(t, (&Config{Endpoint: "localhost:8125", Flavor: FlavorStatsD, MaxPacketSize: 1432}).Validate())
+	assert.NoError(t, (&Config{Endpoint: "localhost:8125", Flavor: FlavorDogStatsD, MaxPacketSize: 1432}).Validate())
+	assert.Error(t, (&Config{Endpoint: "localhost", Flavor: FlavorStatsD, MaxPacketSize: 1432}).Validate())
+	assert.Error(t, (&Config{Endpoint: "localhost:8125", Flavor: "graphite", MaxPacketSize: 1432}).Validate())
+	assert.Error(t, (&Config{Endpoint: "localhost:8125", Flavor: FlavorStatsD}).Validate())
+}
+
+func exportSpans(t *testing.T, cfg *Config, sel attributes.Selection, agent net.PacketConn, expected int) []string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exporter, err := ReportMetrics(ctx, &global.ContextInfo{
+		MetricAttributeGroups: attributes.GroupHTTPRoutes,
+	}, cfg, sel)()
+	require.NoError(t, err)
+
+	spans := make(chan []request.Span, 10)
+	done := make(chan struct{})
+	go func() {
+		exporter(spans)
+		close(done)
+	}()
+	otelInstrumented := svc.ID{Name: "otel"}
+	otelInstrumented.SetExportsOTelMetrics()
+	ignored := request.Span{Type: request.EventTypeHTTP, Method: "GET", Path: "/health", Route: "/health",
+		ServiceID: svc.ID{Name: "svc"}, End: 1}
+	ignored.SetIgnoreMetrics()
+	spans <- []request.Span{
+		{Type: request.EventTypeHTTP, Method: "GET", Path: "/foo|bar", Route: "/foo/{id}", ContentLength: 123,
+			ServiceID: svc.ID{Name: "svc"}, End: 1500 * time.Microsecond.Nanoseconds()},
+		{Type: request.EventTypeSQLClient, Method: "SELECT",
+			ServiceID: svc.ID{Name: "svc"}, End: 20 * time.Millisecond.Nanoseconds()},
+		// services that already export their own metrics are ignored
+		{Type: request.EventTypeHTTP, Method: "GET", ServiceID: otelInstrumented, End: 1},
+		// spans whose metrics are ignored by the routes configuration
+		ignored,
+	}
+	close(spans)
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		require.Fail(t, "timeout while waiting for the exporter to finish")
+	}
+
+	var lines []string
+	buf := make([]byte, 2048)
+	for len(lines) < expected {
+		require.NoError(t, agent.SetReadDeadline(time.Now().Add(timeout)))
+		n, _, err := agent.ReadFrom(buf)
+		require.NoError(t, err)
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	return lines
+}
+
+func listenUDP(t *testing.T) (net.PacketConn, string) {
+	t.Helper()
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { agent.Close() })
+	return agent, agent.LocalAddr().String()
+}
+
+type packetRecorder struct {
+	packets []string
+}
+
+func (p *packetRecorder) Write(b []byte) (int, error) {
+	p.packets = append(p.packets, string(bytes.Clone(b)))
+	return len(b), nil
+}
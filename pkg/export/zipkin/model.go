@@ -0,0 +1,310 @@
+package zipkin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/netip"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// https://github.com/openzipkin/zipkin-api/blob/master/zipkin2-api.yaml
+// https://github.com/openzipkin/zipkin-api/blob/master/zipkin.proto
+type kind int
+
+const (
+	kindUnspecified kind = iota
+	kindClient
+	kindServer
+	kindProducer
+	kindConsumer
+)
+
+var kindNames = map[kind]string{
+	kindClient:   "CLIENT",
+	kindServer:   "SERVER",
+	kindProducer: "PRODUCER",
+	kindConsumer: "CONSUMER",
+}
+
+var clientKinds = map[ptrace.SpanKind]kind{
+	ptrace.SpanKindClient:   kindClient,
+	ptrace.SpanKindProducer: kindProducer,
+	ptrace.SpanKindConsumer: kindConsumer,
+}
+
+const (
+	tagStatusCode = "otel.status_code"
+	tagError      = "error"
+)
+
+type endpoint struct {
+	serviceName string
+	ip          netip.Addr
+	port        int
+}
+
+func (e *endpoint) empty() bool {
+	return e.serviceName == "" && !e.ip.IsValid() && e.port == 0
+}
+
+type zipkinSpan struct {
+	traceID   pcommon.TraceID
+	parentID  pcommon.SpanID
+	id        pcommon.SpanID
+	kind      kind
+	name      string
+	timestamp time.Time
+	duration  time.Duration
+	local     endpoint
+	remote    endpoint
+	tags      map[string]string
+}
+
+// appendZipkinSpans converts the OTEL spans that are generated for a request.Span (the span itself and,
+// if any, its "in queue" and "processing" sub-spans) into Zipkin spans. The local and remote endpoints
+// are taken from the Peer and Host of the request.Span.
+func appendZipkinSpans(dst []zipkinSpan, span *request.Span, traces ptrace.Traces) []zipkinSpan {
+	rss := traces.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		serviceName := ""
+		resourceTags := map[string]string{}
+		rs.Resource().Attributes().Range(func(k string, v pcommon.Value) bool {
+			if k == string(semconv.ServiceNameKey) {
+				serviceName = v.AsString()
+			} else {
+				resourceTags[k] = v.AsString()
+			}
+			return true
+		})
+		sss := rs.ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				dst = append(dst, toZipkinSpan(span, spans.At(k), serviceName, resourceTags))
+			}
+		}
+	}
+	return dst
+}
+
+func toZipkinSpan(span *request.Span, s ptrace.Span, serviceName string, resourceTags map[string]string) zipkinSpan {
+	zs := zipkinSpan{
+		traceID:   s.TraceID(),
+		parentID:  s.ParentSpanID(),
+		id:        s.SpanID(),
+		name:      s.Name(),
+		timestamp: s.StartTimestamp().AsTime(),
+		duration:  s.EndTimestamp().AsTime().Sub(s.StartTimestamp().AsTime()),
+		local:     endpoint{serviceName: serviceName},
+		tags:      make(map[string]string, len(resourceTags)+s.Attributes().Len()+2),
+	}
+	for k, v := range resourceTags {
+		zs.tags[k] = v
+	}
+	s.Attributes().Range(func(k string, v pcommon.Value) bool {
+		zs.tags[k] = v.AsString()
+		return true
+	})
+	switch s.Status().Code() {
+	case ptrace.StatusCodeError:
+		zs.tags[tagStatusCode] = "ERROR"
+		zs.tags[tagError] = s.Status().Message()
+		if zs.tags[tagError] == "" {
+			zs.tags[tagError] = "true"
+		}
+	case ptrace.StatusCodeOk:
+		zs.tags[tagStatusCode] = "OK"
+	}
+
+	// the queue and processing sub-spans are internal to the local service, so they don't have a kind
+	switch s.Kind() {
+	case ptrace.SpanKindServer:
+		zs.kind = kindServer
+		setEndpoint(&zs.local, span.Host, "", span.HostPort)
+		setEndpoint(&zs.remote, span.Peer, span.PeerName, span.PeerPort)
+	case ptrace.SpanKindClient, ptrace.SpanKindProducer, ptrace.SpanKindConsumer:
+		zs.kind = clientKinds[s.Kind()]
+		// the port of the client side is ephemeral, so it is not reported
+		setEndpoint(&zs.local, span.Peer, "", 0)
+		// for client and messaging spans, the Host is the server or the broker
+		setEndpoint(&zs.remote, span.Host, span.HostName, span.HostPort)
+	}
+	return zs
+}
+
+// setEndpoint sets the IP and port of the endpoint. The name of the address, or the address itself
+// if it isn't an IP, is set as the service name of the endpoint, if it wasn't already set.
+func setEndpoint(e *endpoint, addr, name string, port int) {
+	ip, err := netip.ParseAddr(addr)
+	if err == nil {
+		e.ip = ip.Unmap()
+	}
+	switch {
+	case e.serviceName != "":
+	case name != "" && name != addr:
+		e.serviceName = name
+	case err != nil:
+		// the address is already a host name
+		e.serviceName = addr
+	}
+	if port > 0 {
+		e.port = port
+	}
+}
+
+type jsonEndpoint struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	IPv4        string `json:"ipv4,omitempty"`
+	IPv6        string `json:"ipv6,omitempty"`
+	Port        int    `json:"port,omitempty"`
+}
+
+type jsonSpan struct {
+	TraceID        string            `json:"traceId"`
+	ParentID       string            `json:"parentId,omitempty"`
+	ID             string            `json:"id"`
+	Kind           string            `json:"kind,omitempty"`
+	Name           string            `json:"name,omitempty"`
+	Timestamp      int64             `json:"timestamp,omitempty"`
+	Duration       int64             `json:"duration,omitempty"`
+	LocalEndpoint  *jsonEndpoint     `json:"localEndpoint,omitempty"`
+	RemoteEndpoint *jsonEndpoint     `json:"remoteEndpoint,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+func toJSONEndpoint(e *endpoint) *jsonEndpoint {
+	if e.empty() {
+		return nil
+	}
+	je := &jsonEndpoint{ServiceName: e.serviceName, Port: e.port}
+	if e.ip.Is4() {
+		je.IPv4 = e.ip.String()
+	} else if e.ip.IsValid() {
+		je.IPv6 = e.ip.String()
+	}
+	return je
+}
+
+// durationMicros returns the duration in microseconds, which must be at least 1 for non-empty durations
+func durationMicros(d time.Duration) int64 {
+	if d > 0 && d < time.Microsecond {
+		return 1
+	}
+	return d.Microseconds()
+}
+
+// encodeJSON encodes the spans as a JSON v2 list of spans
+func encodeJSON(spans []zipkinSpan) ([]byte, error) {
+	out := make([]jsonSpan, 0, len(spans))
+	for i := range spans {
+		s := &spans[i]
+		js := jsonSpan{
+			TraceID:        hex.EncodeToString(s.traceID[:]),
+			ID:             hex.EncodeToString(s.id[:]),
+			Kind:           kindNames[s.kind],
+			Name:           s.name,
+			Timestamp:      s.timestamp.UnixMicro(),
+			Duration:       durationMicros(s.duration),
+			LocalEndpoint:  toJSONEndpoint(&s.local),
+			RemoteEndpoint: toJSONEndpoint(&s.remote),
+			Tags:           s.tags,
+		}
+		if !s.parentID.IsEmpty() {
+			js.ParentID = hex.EncodeToString(s.parentID[:])
+		}
+		out = append(out, js)
+	}
+	return json.Marshal(out)
+}
+
+// encodeProto encodes the spans as a zipkin.proto3.ListOfSpans message
+func encodeProto(spans []zipkinSpan) []byte {
+	var out []byte
+	for i := range spans {
+		out = protowire.AppendTag(out, 1, protowire.BytesType)
+		out = protowire.AppendBytes(out, protoSpan(&spans[i]))
+	}
+	return out
+}
+
+func protoSpan(s *zipkinSpan) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, s.traceID[:])
+	if !s.parentID.IsEmpty() {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, s.parentID[:])
+	}
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, s.id[:])
+	if s.kind != kindUnspecified {
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(s.kind))
+	}
+	if s.name != "" {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendString(b, s.name)
+	}
+	b = protowire.AppendTag(b, 6, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(s.timestamp.UnixMicro()))
+	if d := durationMicros(s.duration); d > 0 {
+		b = protowire.AppendTag(b, 7, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(d))
+	}
+	if !s.local.empty() {
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		b = protowire.AppendBytes(b, protoEndpoint(&s.local))
+	}
+	if !s.remote.empty() {
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, protoEndpoint(&s.remote))
+	}
+	// map entries are encoded as messages with the key in field 1 and the value in field 2.
+	// Sorting them keeps the output deterministic
+	keys := make([]string, 0, len(s.tags))
+	for k := range s.tags {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, s.tags[k])
+		b = protowire.AppendTag(b, 11, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+func protoEndpoint(e *endpoint) []byte {
+	var b []byte
+	if e.serviceName != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, e.serviceName)
+	}
+	if e.ip.Is4() {
+		ip := e.ip.As4()
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, ip[:])
+	} else if e.ip.IsValid() {
+		ip := e.ip.As16()
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, ip[:])
+	}
+	if e.port > 0 {
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(e.port))
+	}
+	return b
+}
@@ -0,0 +1,154 @@
+// Package zipkin provides a traces exporter that submits the spans to the Zipkin v2 API
+package zipkin
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/mariomac/pipes/pipe"
+
+	"github.com/grafana/beyla/pkg/export/attributes"
+	"github.com/grafana/beyla/pkg/export/otel"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+func zlog() *slog.Logger {
+	return slog.With("component", "zipkin.TracesReceiver")
+}
+
+// Encoding of the spans submitted to the Zipkin v2 API
+type Encoding string
+
+const (
+	EncodingJSON  Encoding = "json"
+	EncodingProto Encoding = "proto"
+)
+
+type TracesConfig struct {
+	// Endpoint of the Zipkin v2 spans API, e.g. http://zipkin:9411/api/v2/spans
+	Endpoint string `yaml:"endpoint" env:"BEYLA_ZIPKIN_ENDPOINT"`
+
+	// Encoding of the submitted spans. Accepted values are json and proto
+	Encoding Encoding `yaml:"encoding" env:"BEYLA_ZIPKIN_ENCODING"`
+
+	// Timeout of each request to the Zipkin endpoint
+	Timeout time.Duration `yaml:"timeout" env:"BEYLA_ZIPKIN_TIMEOUT"`
+
+	// InsecureSkipVerify skips the verification of the server certificate
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify" env:"BEYLA_ZIPKIN_INSECURE_SKIP_VERIFY"`
+}
+
+// Enabled specifies that the Zipkin traces node is enabled if and only if
+// the Zipkin endpoint is defined
+func (c *TracesConfig) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+func (c *TracesConfig) Validate() error {
+	switch c.Encoding {
+	case "", EncodingJSON, EncodingProto:
+		return nil
+	}
+	return fmt.Errorf("invalid Zipkin encoding %q. Accepted values are: %s, %s", c.Encoding, EncodingJSON, EncodingProto)
+}
+
+// TracesReceiver creates a terminal node that consumes request.Spans and submits them to a Zipkin endpoint
+func TracesReceiver(
+	ctx context.Context,
+	ctxInfo *global.ContextInfo,
+	cfg *TracesConfig,
+	userAttribSelection attributes.Selection,
+) pipe.FinalProvider[[]request.Span] {
+	return (&tracesReceiver{ctx: ctx, cfg: cfg, attributes: userAttribSelection, hostID: ctxInfo.HostID}).provideLoop
+}
+
+type tracesReceiver struct {
+	ctx        context.Context
+	cfg        *TracesConfig
+	attributes attributes.Selection
+	hostID     string
+	client     *http.Client
+}
+
+func (tr *tracesReceiver) spanDiscarded(span *request.Span) bool {
+	return span.IgnoreTraces() || span.ServiceID.ExportsOTelTraces()
+}
+
+func (tr *tracesReceiver) provideLoop() (pipe.FinalFunc[[]request.Span], error) {
+	if !tr.cfg.Enabled() {
+		return pipe.IgnoreFinal[[]request.Span](), nil
+	}
+	if err := tr.cfg.Validate(); err != nil {
+		return nil, err
+	}
+	tr.client = &http.Client{
+		Timeout: tr.cfg.Timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: tr.cfg.InsecureSkipVerify},
+		},
+	}
+	return func(in <-chan []request.Span) {
+		log := zlog()
+		traceAttrs, err := otel.GetUserSelectedAttributes(tr.attributes)
+		if err != nil {
+			log.Error("error fetching user defined attributes", "error", err)
+		}
+		envResourceAttrs := otel.ResourceAttrsFromEnv()
+
+		var batch []zipkinSpan
+		for spans := range in {
+			batch = batch[:0]
+			for i := range spans {
+				span := &spans[i]
+				if tr.spanDiscarded(span) {
+					continue
+				}
+				traces := otel.GenerateTraces(span, tr.hostID, traceAttrs, envResourceAttrs)
+				batch = appendZipkinSpans(batch, span, traces)
+			}
+			if len(batch) == 0 {
+				continue
+			}
+			if err := tr.submit(batch); err != nil {
+				log.Error("error submitting spans to Zipkin", "error", err, "spans", len(batch))
+			}
+		}
+	}, nil
+}
+
+func (tr *tracesReceiver) submit(spans []zipkinSpan) error {
+	var body []byte
+	var err error
+	contentType := "application/json"
+	if tr.cfg.Encoding == EncodingProto {
+		contentType = "application/x-protobuf"
+		body = encodeProto(spans)
+	} else if body, err = encodeJSON(spans); err != nil {
+		return fmt.Errorf("encoding spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(tr.ctx, http.MethodPost, tr.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := tr.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body to allow reusing the connection
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response from %s: %s", tr.cfg.Endpoint, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package zipkin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	trace2 "go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/grafana/beyla/pkg/export/attributes"
+	"github.com/grafana/beyla/pkg/internal/pipe/global"
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+const timeout = 5 * time.Second
+
+type submission struct {
+	contentType string
+	body        []byte
+}
+
+func zipkinServer(t *testing.T) (*httptest.Server, <-chan submission) {
+	submissions := make(chan submission, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "/api/v2/spans", req.URL.Path)
+		submissions <- submission{contentType: req.Header.Get("Content-Type"), body: body}
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, submissions
+}
+
+func startReceiver(t *testing.T, cfg *TracesConfig) chan<- []request.Span {
+	node, err := TracesReceiver(context.Background(), &global.ContextInfo{HostID: "host-id"}, cfg, attributes.Selection{})()
+	require.NoError(t, err)
+	spans := make(chan []request.Span, 10)
+	t.Cleanup(func() { close(spans) })
+	go node(spans)
+	return spans
+}
+
+func readSubmission(t *testing.T, submissions <-chan submission) submission {
+	select {
+	case s := <-submissions:
+		return s
+	case <-time.After(timeout):
+		require.Fail(t, "timeout while waiting for spans")
+	}
+	return submission{}
+}
+
+func TestTracesReceiver_JSON(t *testing.T) {
+	srv, submissions := zipkinServer(t)
+	spans := startReceiver(t, &TracesConfig{Endpoint: srv.URL + "/api/v2/spans", Encoding: EncodingJSON, Timeout: timeout})
+
+	traceID, _ := trace2.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	parentID, _ := trace2.SpanIDFromHex("0102030405060708")
+	now := int64(10_000_000)
+	// ignored spans are not submitted
+	ignored := request.Span{Type: request.EventTypeHTTP}
+	ignored.SetIgnoreTraces()
+	spans <- []request.Span{ignored, {
+		Type:         request.EventTypeHTTP,
+		Method:       "GET",
+		Path:         "/users/1",
+		Route:        "/users/{id}",
+		Status:       500,
+		Peer:         "10.0.0.1",
+		PeerName:     "frontend",
+		PeerPort:     45678,
+		Host:         "10.0.0.2",
+		HostPort:     8080,
+		RequestStart: now,
+		Start:        now + 1000_000,
+		End:          now + 3000_000,
+		TraceID:      traceID,
+		ParentSpanID: parentID,
+		ServiceID:    svc.ID{Name: "users", Namespace: "shop", UID: "users-1"},
+	}, {
+		Type:         request.EventTypeHTTPClient,
+		Method:       "POST",
+		Path:         "/payments",
+		Status:       200,
+		Peer:         "10.0.0.2",
+		PeerPort:     56789,
+		Host:         "10.0.0.3",
+		HostName:     "payments",
+		HostPort:     80,
+		RequestStart: now,
+		Start:        now,
+		End:          now + 2000_000,
+		TraceID:      traceID,
+		ServiceID:    svc.ID{Name: "users", Namespace: "shop", UID: "users-1"},
+	}}
+
+	s := readSubmission(t, submissions)
+	assert.Equal(t, "application/json", s.contentType)
+	var zspans []map[string]any
+	require.NoError(t, json.Unmarshal(s.body, &zspans))
+	// the server span has two sub-spans: in queue and processing
+	require.Len(t, zspans, 4)
+
+	inQueue, processing, server, client := zspans[0], zspans[1], zspans[2], zspans[3]
+	assert.Equal(t, "in queue", inQueue["name"])
+	assert.Equal(t, "processing", processing["name"])
+	assert.NotContains(t, inQueue, "kind")
+	assert.Equal(t, server["id"], inQueue["parentId"])
+	assert.Equal(t, server["id"], processing["parentId"])
+	assert.Equal(t, map[string]any{"serviceName": "users"}, inQueue["localEndpoint"])
+
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", server["traceId"])
+	assert.Equal(t, "0102030405060708", server["parentId"])
+	assert.Equal(t, "SERVER", server["kind"])
+	assert.Equal(t, "GET /users/{id}", server["name"])
+	assert.Equal(t, inQueue["timestamp"], server["timestamp"])
+	assert.EqualValues(t, 1000, processing["timestamp"].(float64)-inQueue["timestamp"].(float64))
+	assert.EqualValues(t, 3000, server["duration"])
+	assert.Equal(t, map[string]any{"serviceName": "users", "ipv4": "10.0.0.2", "port": 8080.0}, server["localEndpoint"])
+	assert.Equal(t, map[string]any{"serviceName": "frontend", "ipv4": "10.0.0.1", "port": 45678.0}, server["remoteEndpoint"])
+	tags := server["tags"].(map[string]any)
+	assert.Equal(t, "GET", tags["http.request.method"])
+	assert.Equal(t, "500", tags["http.response.status_code"])
+	assert.Equal(t, "shop", tags["service.namespace"])
+	assert.Equal(t, "ERROR", tags["otel.status_code"])
+	assert.Equal(t, "true", tags["error"])
+
+	assert.Equal(t, "CLIENT", client["kind"])
+	assert.NotContains(t, client, "parentId")
+	assert.Equal(t, map[string]any{"serviceName": "users", "ipv4": "10.0.0.2"}, client["localEndpoint"])
+	assert.Equal(t, map[string]any{"serviceName": "payments", "ipv4": "10.0.0.3", "port": 80.0}, client["remoteEndpoint"])
+	assert.NotContains(t, client["tags"], "error")
+}
+
+func TestTracesReceiver_Proto(t *testing.T) {
+	srv, submissions := zipkinServer(t)
+	spans := startReceiver(t, &TracesConfig{Endpoint: srv.URL + "/api/v2/spans", Encoding: EncodingProto, Timeout: timeout})
+
+	traceID, _ := trace2.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _ := trace2.SpanIDFromHex("1112131415161718")
+	spans <- []request.Span{{
+		Type:         request.EventTypeRedisClient,
+		Method:       "GET",
+		Peer:         "::ffff:10.0.0.2",
+		Host:         "redis.local",
+		HostPort:     6379,
+		RequestStart: 1000_000,
+		Start:        1000_000,
+		End:          3000_000,
+		TraceID:      traceID,
+		SpanID:       spanID,
+		ServiceID:    svc.ID{Name: "users", UID: "users-1"},
+	}}
+
+	s := readSubmission(t, submissions)
+	assert.Equal(t, "application/x-protobuf", s.contentType)
+
+	// ListOfSpans with a single span
+	num, typ, n := protowire.ConsumeTag(s.body)
+	require.Equal(t, protowire.Number(1), num)
+	require.Equal(t, protowire.BytesType, typ)
+	span, m := protowire.ConsumeBytes(s.body[n:])
+	require.Equal(t, len(s.body), n+m)
+
+	fields := map[protowire.Number][]byte{}
+	var kind, timestamp, duration uint64
+	for len(span) > 0 {
+		num, typ, n := protowire.ConsumeTag(span)
+		require.GreaterOrEqual(t, n, 0)
+		span = span[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(span)
+			fields[num] = v
+			span = span[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(span)
+			if num == 4 {
+				kind = v
+			} else {
+				duration = v
+			}
+			span = span[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(span)
+			timestamp = v
+			span = span[n:]
+		}
+	}
+	assert.Equal(t, traceID[:], fields[1])
+	assert.Equal(t, spanID[:], fields[3])
+	assert.NotContains(t, fields, protowire.Number(2))
+	assert.EqualValues(t, kindClient, kind)
+	assert.Equal(t, "GET", string(fields[5]))
+	assert.NotZero(t, timestamp)
+	assert.EqualValues(t, 2000, duration)
+	// local endpoint: service name and the IPv4 address of the peer
+	assert.Equal(t, append(protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), "users"),
+		protowire.AppendBytes(protowire.AppendTag(nil, 2, protowire.BytesType), []byte{10, 0, 0, 2})...), fields[8])
+	// remote endpoint: the host name as service name, and the port
+	assert.Equal(t, append(protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), "redis.local"),
+		protowire.AppendVarint(protowire.AppendTag(nil, 4, protowire.VarintType), 6379)...), fields[9])
+}
+
+func TestTracesConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&TracesConfig{}).Validate())
+	assert.NoError(t, (&TracesConfig{Encoding: EncodingJSON}).Validate())
+	assert.NoError(t, (&TracesConfig{Encoding: EncodingProto}).Validate())
+	assert.Error(t, (&TracesConfig{Encoding: "thrift"}).Validate())
+}
@@ -27,6 +27,10 @@ type PrometheusManager struct {
 	started atomic.Bool
 	// key 1: port. Key 2: path
 	registries map[int]map[string]*prometheus.Registry
+	// key 1: port. Key 2: path
+	openMetrics map[int]map[string]struct{}
+	// key 1: port. Key 2: path
+	pushers map[int]map[string]Pusher
 
 	metrics internalIntrumenter
 }
@@ -60,19 +64,72 @@ func (pm *PrometheusManager) Register(port int, path string, collectors ...prome
 	reg.MustRegister(collectors...)
 }
 
-// StartHTTP serves metrics in background. Its invocation won't have effect if it has been invoked previously,
-// so invoke it only after you are sure that all the collectors have been registered via the Register method.
+// EnableOpenMetrics allows the scrapers of the given port and path to negotiate the OpenMetrics
+// exposition format, which is required to expose the exemplars of the registered metrics.
+// This method is not thread-safe
+func (pm *PrometheusManager) EnableOpenMetrics(port int, path string) {
+	if pm.openMetrics == nil {
+		pm.openMetrics = map[int]map[string]struct{}{}
+	}
+	paths, ok := pm.openMetrics[port]
+	if !ok {
+		paths = map[string]struct{}{}
+		pm.openMetrics[port] = paths
+	}
+	paths[path] = struct{}{}
+}
+
+// Pusher periodically gathers the metrics of a registry and submits them to an external endpoint
+// until the context is cancelled.
+type Pusher func(ctx context.Context, gatherer prometheus.Gatherer)
+
+// AddPusher adds a Pusher for the metrics registered in the given port and path. Only the first Pusher
+// for each port and path is kept, so different registrars can add a Pusher for the same registry.
+// If the port is 0, the metrics are only pushed and they aren't exposed through an HTTP endpoint.
+// This method is not thread-safe
+func (pm *PrometheusManager) AddPusher(port int, path string, pusher Pusher) {
+	if pm.pushers == nil {
+		pm.pushers = map[int]map[string]Pusher{}
+	}
+	paths, ok := pm.pushers[port]
+	if !ok {
+		paths = map[string]Pusher{}
+		pm.pushers[port] = paths
+	}
+	if _, ok := paths[path]; !ok {
+		paths[path] = pusher
+	}
+}
+
+// StartHTTP serves metrics in background, and starts the registered pushers. Its invocation won't have
+// effect if it has been invoked previously, so invoke it only after you are sure that all the collectors
+// have been registered via the Register method.
 func (pm *PrometheusManager) StartHTTP(ctx context.Context) {
 	if pm.started.Swap(true) {
 		return
 	}
 	log := log()
+	for port, paths := range pm.pushers {
+		for path, pusher := range paths {
+			if registry, ok := pm.registries[port][path]; ok {
+				go pusher(ctx, registry)
+			}
+		}
+	}
 	// Creating a serve mux for each port
 	for port, paths := range pm.registries {
+		if port == 0 {
+			// push-only metrics
+			continue
+		}
 		mux := http.NewServeMux()
 		for path, registry := range paths {
 			log.With("port", port, "path", path).Info("opening prometheus scrape endpoint")
-			promHandler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+			_, openMetrics := pm.openMetrics[port][path]
+			promHandler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+				Registry:          registry,
+				EnableOpenMetrics: openMetrics,
+			})
 			promHandler = wrapDebugHandler(log, promHandler)
 			promHandler = wrapInstrumentedHandler(pm.metrics, port, path, promHandler)
 			mux.Handle(path, promHandler)
@@ -22,7 +22,7 @@ func CriteriaMatcherProvider(cfg *beyla.Config) pipe.MiddleProvider[[]Event[proc
 			log:             slog.With("component", "discover.CriteriaMatcher"),
 			criteria:        FindingCriteria(cfg),
 			excludeCriteria: cfg.Discovery.ExcludeServices,
-			processHistory:  map[PID]*services.ProcessInfo{},
+			processHistory:  map[PID]matchedProcess{},
 		}
 		return m.run, nil
 	}
@@ -35,13 +35,22 @@ type matcher struct {
 	// processHistory keeps track of the processes that have been already matched and submitted for
 	// instrumentation.
 	// This avoids keep inspecting again and again client processes each time they open a new connection port
-	processHistory map[PID]*services.ProcessInfo
+	processHistory map[PID]matchedProcess
+}
+
+// matchedProcess is a process that has been submitted for instrumentation, with the position
+// of the selection criteria that it matched
+type matchedProcess struct {
+	proc          *services.ProcessInfo
+	criteriaIndex int
 }
 
 // ProcessMatch matches a found process with the first selection criteria it fulfilled.
 type ProcessMatch struct {
 	Criteria *services.Attributes
-	Process  *services.ProcessInfo
+	// CriteriaIndex is the position of the Criteria in the discovery services criteria list
+	CriteriaIndex int
+	Process       *services.ProcessInfo
 }
 
 func (m *matcher) run(in <-chan []Event[processAttrs], out chan<- []Event[ProcessMatch]) {
@@ -85,21 +94,26 @@ func (m *matcher) filterCreated(obj processAttrs) (Event[ProcessMatch], bool) {
 	for i := range m.criteria {
 		if m.matchProcess(&obj, proc, &m.criteria[i]) && !m.isExcluded(&obj, proc) {
 			m.log.Debug("found process", "pid", proc.Pid, "comm", proc.ExePath, "metadata", obj.metadata, "podLabels", obj.podLabels)
-			m.processHistory[obj.pid] = proc
+			m.processHistory[obj.pid] = matchedProcess{proc: proc, criteriaIndex: i}
 			return Event[ProcessMatch]{
 				Type: EventCreated,
-				Obj:  ProcessMatch{Criteria: &m.criteria[i], Process: proc},
+				Obj:  ProcessMatch{Criteria: &m.criteria[i], CriteriaIndex: i, Process: proc},
 			}, true
 		}
 	}
 
 	// We didn't match the process, but let's see if the parent PID is tracked, it might be the child hasn't opened the port yet
-	if _, ok := m.processHistory[PID(proc.PPid)]; ok {
+	// The child inherits the selection criteria of its parent
+	if parent, ok := m.processHistory[PID(proc.PPid)]; ok {
 		m.log.Debug("found process by matching the process parent id", "pid", proc.Pid, "ppid", proc.PPid, "comm", proc.ExePath, "metadata", obj.metadata)
-		m.processHistory[obj.pid] = proc
+		m.processHistory[obj.pid] = matchedProcess{proc: proc, criteriaIndex: parent.criteriaIndex}
 		return Event[ProcessMatch]{
 			Type: EventCreated,
-			Obj:  ProcessMatch{Criteria: &m.criteria[0], Process: proc},
+			Obj: ProcessMatch{
+				Criteria:      &m.criteria[parent.criteriaIndex],
+				CriteriaIndex: parent.criteriaIndex,
+				Process:       proc,
+			},
 		}, true
 	}
 
@@ -107,16 +121,16 @@ func (m *matcher) filterCreated(obj processAttrs) (Event[ProcessMatch], bool) {
 }
 
 func (m *matcher) filterDeleted(obj processAttrs) (Event[ProcessMatch], bool) {
-	proc, ok := m.processHistory[obj.pid]
+	matched, ok := m.processHistory[obj.pid]
 	if !ok {
 		m.log.Debug("deleted untracked process. Ignoring", "pid", obj.pid)
 		return Event[ProcessMatch]{}, false
 	}
 	delete(m.processHistory, obj.pid)
-	m.log.Debug("stopped process", "pid", proc.Pid, "comm", proc.ExePath)
+	m.log.Debug("stopped process", "pid", matched.proc.Pid, "comm", matched.proc.ExePath)
 	return Event[ProcessMatch]{
 		Type: EventDeleted,
-		Obj:  ProcessMatch{Process: proc},
+		Obj:  ProcessMatch{Process: matched.proc},
 	}, true
 }
 
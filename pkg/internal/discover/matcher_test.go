@@ -275,3 +275,46 @@ func TestCriteriaMatcherMissingPort(t *testing.T) {
 	assert.Equal(t, "foo", m.Obj.Criteria.Namespace)
 	assert.Equal(t, services.ProcessInfo{Pid: 3, ExePath: "/bin/weird33", OpenPorts: []uint32{}, PPid: 1}, *m.Obj.Process)
 }
+
+func TestCriteriaMatcherChildProcess(t *testing.T) {
+	pipeConfig := beyla.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(`discovery:
+  services:
+  - name: frontend
+    open_ports: 8080
+  - name: backend
+    open_ports: 9090
+`), &pipeConfig))
+
+	matcherFunc, err := CriteriaMatcherProvider(&pipeConfig)()
+	require.NoError(t, err)
+	discoveredProcesses := make(chan []Event[processAttrs], 10)
+	filteredProcesses := make(chan []Event[ProcessMatch], 10)
+	go matcherFunc(discoveredProcesses, filteredProcesses)
+	defer close(discoveredProcesses)
+
+	processInfo = func(pp processAttrs) (*services.ProcessInfo, error) {
+		ppid := map[PID]int32{1: 0, 2: 1}[pp.pid]
+		return &services.ProcessInfo{Pid: int32(pp.pid), ExePath: "/bin/backend", PPid: ppid, OpenPorts: pp.openPorts}, nil
+	}
+	discoveredProcesses <- []Event[processAttrs]{
+		{Type: EventCreated, Obj: processAttrs{pid: 1, openPorts: []uint32{9090}}}, // the parent matches the second criteria
+		{Type: EventCreated, Obj: processAttrs{pid: 2}},                            // the child hasn't opened any port
+	}
+
+	matches := testutil.ReadChannel(t, filteredProcesses, testTimeout)
+	require.Len(t, matches, 2)
+	for _, m := range matches {
+		assert.Equal(t, EventCreated, m.Type)
+		assert.Equal(t, "backend", m.Obj.Criteria.Name)
+		assert.Equal(t, 1, m.Obj.CriteriaIndex)
+	}
+	assert.EqualValues(t, 2, matches[1].Obj.Process.Pid)
+
+	// the child is tracked as any other matched process
+	discoveredProcesses <- []Event[processAttrs]{{Type: EventDeleted, Obj: processAttrs{pid: 2}}}
+	matches = testutil.ReadChannel(t, filteredProcesses, testTimeout)
+	require.Len(t, matches, 1)
+	assert.Equal(t, EventDeleted, matches[0].Type)
+	assert.EqualValues(t, 2, matches[0].Obj.Process.Pid)
+}
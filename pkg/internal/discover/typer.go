@@ -83,6 +83,9 @@ func (t *typer) FilterClassify(evs []Event[ProcessMatch]) []Event[Instrumentable
 				Namespace: ev.Obj.Criteria.Namespace,
 				ProcPID:   ev.Obj.Process.Pid,
 			}
+			if ev.Obj.Criteria.Routes != nil {
+				svcID.RoutesCriteria = ev.Obj.CriteriaIndex + 1
+			}
 			if elfFile, err := exec.FindExecELF(ev.Obj.Process, svcID); err != nil {
 				t.log.Warn("error finding process ELF. Ignoring", "error", err)
 			} else {
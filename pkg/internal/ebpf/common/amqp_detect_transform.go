@@ -0,0 +1,306 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unsafe"
+
+	trace2 "go.opentelemetry.io/otel/trace"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// https://www.rabbitmq.com/resources/specs/amqp0-9-1.pdf
+const (
+	amqpFrameHeaderLen = 7 // type + channel + size
+	amqpFrameEnd       = 0xce
+	amqpMaxFrameLen    = 128 * 1024 * 1024
+)
+
+var amqpProtocolHeader = []byte("AMQP\x00\x00\x09\x01")
+
+// frame types
+const (
+	amqpFrameMethod    = 1
+	amqpFrameHeader    = 2
+	amqpFrameBody      = 3
+	amqpFrameHeartbeat = 8
+)
+
+// classes
+const (
+	amqpClassConnection = 10
+	amqpClassChannel    = 20
+	amqpClassExchange   = 40
+	amqpClassQueue      = 50
+	amqpClassBasic      = 60
+	amqpClassConfirm    = 85
+	amqpClassTx         = 90
+)
+
+// methods that close the connection or the channel, and the reply code of a normal close
+const (
+	amqpConnectionClose = 50
+	amqpChannelClose    = 40
+	amqpReplySuccess    = 200
+)
+
+// basic class methods that carry messages
+const (
+	amqpBasicPublish = 40
+	amqpBasicDeliver = 60
+	amqpBasicGet     = 70
+	amqpBasicGetOk   = 71
+)
+
+type AMQPInfo struct {
+	Operation  string
+	Exchange   string
+	RoutingKey string
+	Queue      string
+	// ClientSide is true if the traced process is the client of the broker
+	ClientSide bool
+	// ReplyCode is the error code of the channel or connection exception raised while
+	// handling the message (e.g. 404 if the exchange doesn't exist), or 0
+	ReplyCode int
+}
+
+// Destination returns the messaging.destination.name of the message: the exchange, or the
+// routing key or queue when it's sent through the default (nameless) exchange.
+func (a *AMQPInfo) Destination() string {
+	switch {
+	case a.Exchange != "":
+		return a.Exchange
+	case a.RoutingKey != "":
+		return a.RoutingKey
+	}
+	return a.Queue
+}
+
+func isAMQPClass(class uint16) bool {
+	switch class {
+	case amqpClassConnection, amqpClassChannel, amqpClassExchange, amqpClassQueue,
+		amqpClassBasic, amqpClassConfirm, amqpClassTx:
+		return true
+	}
+	return false
+}
+
+// amqpFrames iterates the frames of the buffer, invoking the provided function for the
+// method frames, with the payload truncated to the buffer length. It returns false if the
+// buffer doesn't look like a sequence of AMQP frames.
+// nolint:cyclop
+func amqpFrames(buf []byte, onMethod func(class, method uint16, args []byte)) bool {
+	buf = bytes.TrimPrefix(buf, amqpProtocolHeader)
+	if len(buf) < amqpFrameHeaderLen {
+		return false
+	}
+	for first := true; len(buf) >= amqpFrameHeaderLen; first = false {
+		t := buf[0]
+		size := int(binary.BigEndian.Uint32(buf[3:amqpFrameHeaderLen]))
+		if size > amqpMaxFrameLen {
+			return false
+		}
+		end := amqpFrameHeaderLen + size
+		payload := buf[amqpFrameHeaderLen:min(end, len(buf))]
+		switch t {
+		case amqpFrameMethod, amqpFrameHeader:
+			// both method and content header frames start with the class ID
+			if len(payload) < 2 {
+				return false
+			}
+			if !isAMQPClass(binary.BigEndian.Uint16(payload)) {
+				return false
+			}
+		case amqpFrameBody, amqpFrameHeartbeat:
+			// a truncated frame without class ID isn't enough to tell that it's AMQP
+			if first && end >= len(buf) {
+				return false
+			}
+		default:
+			return false
+		}
+		// the last frame might be truncated by the size of the eBPF buffer
+		if end < len(buf) && buf[end] != amqpFrameEnd {
+			return false
+		}
+		if t == amqpFrameMethod && len(payload) >= 4 && onMethod != nil {
+			onMethod(binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:]), payload[4:])
+		}
+		if end >= len(buf) {
+			break
+		}
+		buf = buf[end+1:]
+	}
+	return true
+}
+
+// amqpShortStrings decodes n consecutive short strings (one length octet followed by
+// the string), returning as many as the buffer contains
+func amqpShortStrings(buf []byte, n int) []string {
+	var res []string
+	for len(buf) > 0 && len(res) < n {
+		l := int(buf[0])
+		if 1+l > len(buf) {
+			break
+		}
+		res = append(res, string(buf[1:1+l]))
+		buf = buf[1+l:]
+	}
+	return res
+}
+
+// amqpBasicMethod decodes the messaging information of the basic class methods.
+// sent is true if the frame was sent by the traced process.
+func amqpBasicMethod(method uint16, args []byte, sent bool) *AMQPInfo {
+	switch method {
+	case amqpBasicPublish:
+		// short reserved, shortstr exchange, shortstr routing-key, bits
+		if len(args) < 2 {
+			return nil
+		}
+		info := &AMQPInfo{Operation: request.MessagingPublish, ClientSide: sent}
+		if s := amqpShortStrings(args[2:], 2); len(s) > 0 {
+			info.Exchange = s[0]
+			if len(s) > 1 {
+				info.RoutingKey = s[1]
+			}
+		}
+		return info
+	case amqpBasicDeliver:
+		// shortstr consumer-tag, longlong delivery-tag, bit redelivered, shortstr exchange, shortstr routing-key
+		tag := amqpShortStrings(args, 1)
+		if len(tag) == 0 || len(args) < 1+len(tag[0])+9 {
+			return nil
+		}
+		info := &AMQPInfo{Operation: request.MessagingProcess, ClientSide: !sent}
+		if s := amqpShortStrings(args[1+len(tag[0])+9:], 2); len(s) > 0 {
+			info.Exchange = s[0]
+			if len(s) > 1 {
+				info.RoutingKey = s[1]
+			}
+		}
+		return info
+	case amqpBasicGet:
+		// short reserved, shortstr queue, bit no-ack
+		if len(args) < 2 {
+			return nil
+		}
+		info := &AMQPInfo{Operation: request.MessagingProcess, ClientSide: sent}
+		if s := amqpShortStrings(args[2:], 1); len(s) > 0 {
+			info.Queue = s[0]
+		}
+		return info
+	}
+	return nil
+}
+
+// ProcessAMQPEvent decodes the AMQP frames of the request and the response, looking for
+// the basic.publish, basic.deliver and basic.get methods. It returns false if the buffers
+// don't belong to an AMQP conversation. A nil AMQPInfo means that the frames don't carry
+// any message (e.g. connection setup, acknowledgements or heartbeats) and the event should
+// be ignored.
+func ProcessAMQPEvent(event *TCPRequestInfo, req, resp []byte) (*AMQPInfo, bool) {
+	if !amqpFrames(req, nil) || (len(resp) > 0 && !amqpFrames(resp, nil)) {
+		return nil, false
+	}
+
+	// the request was sent by the traced process if its direction is TCP_SEND
+	reqSent := event.Direction == 1
+	var info *AMQPInfo
+	for _, b := range []struct {
+		buf  []byte
+		sent bool
+	}{{req, reqSent}, {resp, !reqSent}} {
+		amqpFrames(b.buf, func(class, method uint16, args []byte) {
+			if info != nil || class != amqpClassBasic {
+				return
+			}
+			info = amqpBasicMethod(method, args, b.sent)
+		})
+		if info != nil {
+			break
+		}
+	}
+	if info == nil {
+		return nil, true
+	}
+
+	if info.Queue != "" {
+		// the exchange and routing key of a basic.get message come in the basic.get-ok response
+		amqpFrames(resp, func(class, method uint16, args []byte) {
+			if class != amqpClassBasic || method != amqpBasicGetOk || len(args) < 9 {
+				return
+			}
+			if s := amqpShortStrings(args[9:], 2); len(s) == 2 {
+				info.Exchange, info.RoutingKey = s[0], s[1]
+			}
+		})
+	}
+
+	// errors are reported by closing the channel, or the whole connection, with a reply code
+	for _, buf := range [][]byte{req, resp} {
+		amqpFrames(buf, func(class, method uint16, args []byte) {
+			if info.ReplyCode != 0 || len(args) < 2 || !amqpCloseMethod(class, method) {
+				return
+			}
+			if code := int(binary.BigEndian.Uint16(args)); code != amqpReplySuccess {
+				info.ReplyCode = code
+			}
+		})
+	}
+
+	// the connection info is oriented according to the direction of the first buffer
+	// of the event: make sure the broker is the server side of the span
+	if info.ClientSide != reqSent {
+		reverseTCPEvent(event)
+	}
+
+	return info, true
+}
+
+func amqpCloseMethod(class, method uint16) bool {
+	return (class == amqpClassChannel && method == amqpChannelClose) ||
+		(class == amqpClassConnection && method == amqpConnectionClose)
+}
+
+func TCPToAMQPToSpan(trace *TCPRequestInfo, data *AMQPInfo) request.Span {
+	peer := ""
+	hostname := ""
+	hostPort := 0
+
+	if trace.ConnInfo.S_port != 0 || trace.ConnInfo.D_port != 0 {
+		peer, hostname = (*BPFConnInfo)(unsafe.Pointer(&trace.ConnInfo)).reqHostInfo()
+		hostPort = int(trace.ConnInfo.D_port)
+	}
+
+	reqType := request.EventTypeAMQPClient
+	if !data.ClientSide {
+		reqType = request.EventTypeAMQPServer
+	}
+
+	return request.Span{
+		Type:          reqType,
+		Method:        data.Operation,
+		Path:          data.Destination(),
+		Statement:     data.RoutingKey,
+		Peer:          peer,
+		PeerPort:      int(trace.ConnInfo.S_port),
+		Host:          hostname,
+		HostPort:      hostPort,
+		ContentLength: 0,
+		RequestStart:  int64(trace.StartMonotimeNs),
+		Start:         int64(trace.StartMonotimeNs),
+		End:           int64(trace.EndMonotimeNs),
+		Status:        data.ReplyCode,
+		TraceID:       trace2.TraceID(trace.Tp.TraceId),
+		SpanID:        trace2.SpanID(trace.Tp.SpanId),
+		ParentSpanID:  trace2.SpanID(trace.Tp.ParentId),
+		Flags:         trace.Tp.Flags,
+		Pid: request.PidInfo{
+			HostPID:   trace.Pid.HostPid,
+			UserPID:   trace.Pid.UserPid,
+			Namespace: trace.Pid.Ns,
+		},
+	}
+}
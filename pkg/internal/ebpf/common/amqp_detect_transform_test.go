@@ -0,0 +1,168 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func amqpFrame(t byte, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	frame := []byte{t, 0, 1, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[3:], uint32(len(body)))
+	return append(append(frame, body...), amqpFrameEnd)
+}
+
+func amqpMethod(class, method uint16, args ...[]byte) []byte {
+	ids := make([]byte, 4)
+	binary.BigEndian.PutUint16(ids, class)
+	binary.BigEndian.PutUint16(ids[2:], method)
+	return amqpFrame(amqpFrameMethod, append([][]byte{ids}, args...)...)
+}
+
+func amqpShortStr(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func amqpPublish(exchange, routingKey string) []byte {
+	return bytes.Join([][]byte{
+		amqpMethod(amqpClassBasic, amqpBasicPublish, []byte{0, 0}, amqpShortStr(exchange), amqpShortStr(routingKey), []byte{0}),
+		amqpFrame(amqpFrameHeader, []byte{0, amqpClassBasic, 0, 0}, make([]byte, 10)),
+		amqpFrame(amqpFrameBody, []byte("hello")),
+	}, nil)
+}
+
+func amqpDeliver(exchange, routingKey string) []byte {
+	return bytes.Join([][]byte{
+		amqpMethod(amqpClassBasic, amqpBasicDeliver, amqpShortStr("ctag-1"), make([]byte, 8), []byte{0},
+			amqpShortStr(exchange), amqpShortStr(routingKey)),
+		amqpFrame(amqpFrameHeader, []byte{0, amqpClassBasic, 0, 0}, make([]byte, 10)),
+		amqpFrame(amqpFrameBody, []byte("hello")),
+	}, nil)
+}
+
+var amqpHeartbeat = amqpFrame(amqpFrameHeartbeat)
+
+func TestAMQPPublish(t *testing.T) {
+	req := amqpPublish("orders", "orders.created")
+	r := tcpExchange(req, nil, tcpSend, 44001, 5672)
+
+	info, ok := ProcessAMQPEvent(&r, req, nil)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, request.MessagingPublish, info.Operation)
+	assert.Equal(t, "orders", info.Exchange)
+	assert.Equal(t, "orders.created", info.RoutingKey)
+	assert.True(t, info.ClientSide)
+
+	s := TCPToAMQPToSpan(&r, info)
+	assert.Equal(t, request.EventTypeAMQPClient, s.Type)
+	assert.Equal(t, request.MessagingPublish, s.Method)
+	assert.Equal(t, "orders", s.Path)
+	assert.Equal(t, "orders.created", s.Statement)
+	assert.Equal(t, 5672, s.HostPort)
+	assert.Equal(t, "SPAN_KIND_PRODUCER", s.ServiceGraphKind())
+}
+
+func TestAMQPPublishDefaultExchange(t *testing.T) {
+	// messages sent to the default exchange are routed to the queue named as the routing key
+	req := amqpPublish("", "tasks")
+	r := tcpExchange(req, amqpHeartbeat, tcpSend, 44002, 5672)
+
+	info, ok := ProcessAMQPEvent(&r, req, amqpHeartbeat)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "tasks", info.Destination())
+}
+
+func TestAMQPDeliver(t *testing.T) {
+	// the consumer receives the message first, so the connection info is oriented as if
+	// the consumer was the server
+	req := amqpDeliver("orders", "orders.created")
+	ack := amqpMethod(amqpClassBasic, 80, make([]byte, 9))
+	r := tcpExchange(req, ack, tcpRecv, 5672, 44003)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeAMQPClient, span.Type)
+	assert.Equal(t, request.MessagingProcess, span.Method)
+	assert.Equal(t, "orders", span.Path)
+	assert.Equal(t, "orders.created", span.Statement)
+	assert.Equal(t, 5672, span.HostPort)
+	assert.Equal(t, 44003, span.PeerPort)
+	assert.Equal(t, "SPAN_KIND_CONSUMER", span.ServiceGraphKind())
+}
+
+func TestAMQPGet(t *testing.T) {
+	req := amqpMethod(amqpClassBasic, amqpBasicGet, []byte{0, 0}, amqpShortStr("tasks"), []byte{0})
+	resp := bytes.Join([][]byte{
+		amqpMethod(amqpClassBasic, amqpBasicGetOk, make([]byte, 9), amqpShortStr("jobs"), amqpShortStr("jobs.high"), []byte{0, 0, 0, 3}),
+		amqpFrame(amqpFrameHeader, []byte{0, amqpClassBasic, 0, 0}, make([]byte, 10)),
+	}, nil)
+	r := tcpExchange(req, resp, tcpSend, 44004, 5672)
+
+	info, ok := ProcessAMQPEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, request.MessagingProcess, info.Operation)
+	assert.Equal(t, "tasks", info.Queue)
+	assert.Equal(t, "jobs", info.Exchange)
+	assert.Equal(t, "jobs.high", info.RoutingKey)
+	assert.True(t, info.ClientSide)
+}
+
+func TestAMQPChannelError(t *testing.T) {
+	// the broker closes the channel when the message is published to a missing exchange
+	req := amqpPublish("nonexisting", "orders.created")
+	resp := amqpMethod(amqpClassChannel, amqpChannelClose, []byte{0x01, 0x94},
+		amqpShortStr("NOT_FOUND - no exchange 'nonexisting' in vhost '/'"), []byte{0, amqpClassBasic, 0, amqpBasicPublish})
+	r := tcpExchange(req, resp, tcpSend, 44008, 5672)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeAMQPClient, span.Type)
+	assert.Equal(t, 404, span.Status)
+	assert.Equal(t, codes.Error, request.SpanStatusCode(&span))
+
+	// closing the connection normally isn't an error
+	resp = amqpMethod(amqpClassConnection, amqpConnectionClose, []byte{0, amqpReplySuccess}, amqpShortStr("OK"), make([]byte, 4))
+	r = tcpExchange(req, resp, tcpSend, 44009, 5672)
+	span, ignore, err = ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, 0, span.Status)
+	assert.Equal(t, codes.Unset, request.SpanStatusCode(&span))
+}
+
+func TestAMQPWithoutMessages(t *testing.T) {
+	connStart := append(append([]byte{}, amqpProtocolHeader...),
+		amqpMethod(10, 10, []byte{0, 9}, make([]byte, 20))...)
+	for _, ts := range []struct {
+		name string
+		req  []byte
+		resp []byte
+	}{
+		{name: "heartbeat", req: amqpHeartbeat, resp: amqpHeartbeat},
+		{name: "connection start", req: connStart, resp: nil},
+		{name: "queue declare", req: amqpMethod(amqpClassQueue, 10, []byte{0, 0}, amqpShortStr("tasks")),
+			resp: amqpMethod(amqpClassQueue, 11, amqpShortStr("tasks"))},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			r := tcpExchange(ts.req, ts.resp, tcpSend, 44006, 5672)
+			info, ok := ProcessAMQPEvent(&r, ts.req, ts.resp)
+			assert.True(t, ok)
+			assert.Nil(t, info)
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package ebpfcommon
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/sqlprune"
+)
+
+// https://github.com/apache/cassandra/blob/trunk/doc/native_protocol_v4.spec
+// https://github.com/apache/cassandra/blob/trunk/doc/native_protocol_v5.spec
+const (
+	cqlHeaderLen        = 9
+	cqlResponseFlag     = 0x80
+	cqlMinVersion       = 4
+	cqlMaxVersion       = 5
+	cqlMaxBodyLen       = 256 * 1024 * 1024
+	cqlSegmentHeaderLen = 6
+	cqlSegmentMaxLen    = 128*1024 - 1
+	cqlCRC24Init        = 0x875060
+	cqlCRC24Poly        = 0x1974F0B
+)
+
+// opcodes
+const (
+	cqlOpError         = 0x00
+	cqlOpStartup       = 0x01
+	cqlOpReady         = 0x02
+	cqlOpAuthenticate  = 0x03
+	cqlOpOptions       = 0x05
+	cqlOpSupported     = 0x06
+	cqlOpQuery         = 0x07
+	cqlOpResult        = 0x08
+	cqlOpPrepare       = 0x09
+	cqlOpExecute       = 0x0a
+	cqlOpRegister      = 0x0b
+	cqlOpEvent         = 0x0c
+	cqlOpBatch         = 0x0d
+	cqlOpAuthChallenge = 0x0e
+	cqlOpAuthResponse  = 0x0f
+	cqlOpAuthSuccess   = 0x10
+)
+
+// header flags
+const (
+	cqlFlagCompression   = 0x01
+	cqlFlagTracing       = 0x02
+	cqlFlagCustomPayload = 0x04
+	cqlFlagWarning       = 0x08
+	cqlFlagsMask         = 0x1f
+)
+
+// RESULT kinds
+const (
+	cqlResultSetKeyspace = 0x0003
+	cqlResultPrepared    = 0x0004
+)
+
+const cqlPrepareWithKeyspace = 0x01
+
+var cqlConsistencyLevels = []string{
+	"any", "one", "two", "three", "quorum", "all", "local_quorum",
+	"each_quorum", "serial", "local_serial", "local_one",
+}
+
+// prepared statement IDs are a hash of the query, so they are valid for any connection
+// to the cluster, and drivers might execute them from a different connection
+var cqlStatements, _ = lru.New[string, string](1024 * 10)
+
+// the keyspace is set per connection by the USE statement
+var cqlKeyspaces, _ = lru.New[BPFConnInfo, string](1024)
+
+type cqlFrame struct {
+	version byte
+	flags   byte
+	stream  int16
+	opcode  byte
+	// body might be truncated by the size of the captured buffer
+	body []byte
+}
+
+// cqlReader decodes the notation types of the native protocol. Any read beyond
+// the end of the buffer marks the reader as invalid.
+type cqlReader struct {
+	buf []byte
+	ok  bool
+}
+
+func newCQLReader(buf []byte) *cqlReader {
+	return &cqlReader{buf: buf, ok: true}
+}
+
+func (r *cqlReader) next(n int) []byte {
+	if !r.ok || n < 0 || n > len(r.buf) {
+		r.ok = false
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *cqlReader) readByte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *cqlReader) readShort() int {
+	if b := r.next(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *cqlReader) readInt() int {
+	if b := r.next(4); b != nil {
+		return int(int32(binary.BigEndian.Uint32(b)))
+	}
+	return 0
+}
+
+func (r *cqlReader) readString() string {
+	return string(r.next(r.readShort()))
+}
+
+func (r *cqlReader) readShortBytes() []byte {
+	return r.next(r.readShort())
+}
+
+// readLongString returns the available part of the string if it's truncated,
+// as it's usually the query text.
+func (r *cqlReader) readLongString() string {
+	n := r.readInt()
+	if !r.ok || n < 0 {
+		r.ok = false
+		return ""
+	}
+	if n > len(r.buf) {
+		s := string(r.buf)
+		r.buf, r.ok = nil, false
+		return s
+	}
+	return string(r.next(n))
+}
+
+// skipBytes skips a [bytes] value. Negative lengths are null or unset values.
+func (r *cqlReader) skipBytes() {
+	if n := r.readInt(); n > 0 {
+		r.next(n)
+	}
+}
+
+func (r *cqlReader) skipBytesMap() {
+	for n := r.readShort(); n > 0 && r.ok; n-- {
+		r.readString()
+		r.skipBytes()
+	}
+}
+
+func (r *cqlReader) skipStringList() {
+	for n := r.readShort(); n > 0 && r.ok; n-- {
+		r.readString()
+	}
+}
+
+func (r *cqlReader) readConsistency() string {
+	c := r.readShort()
+	if !r.ok || c >= len(cqlConsistencyLevels) {
+		return ""
+	}
+	return cqlConsistencyLevels[c]
+}
+
+func isCQLRequestOpcode(op byte) bool {
+	switch op {
+	case cqlOpStartup, cqlOpOptions, cqlOpQuery, cqlOpPrepare, cqlOpExecute,
+		cqlOpRegister, cqlOpBatch, cqlOpAuthResponse:
+		return true
+	}
+	return false
+}
+
+func isCQLResponseOpcode(op byte) bool {
+	switch op {
+	case cqlOpError, cqlOpReady, cqlOpAuthenticate, cqlOpSupported, cqlOpResult,
+		cqlOpEvent, cqlOpAuthChallenge, cqlOpAuthSuccess:
+		return true
+	}
+	return false
+}
+
+func cqlCRC24(header uint32) uint32 {
+	crc := uint32(cqlCRC24Init)
+	for i := 0; i < 3; i++ {
+		crc ^= (header & 0xff) << 16
+		header >>= 8
+		for j := 0; j < 8; j++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= cqlCRC24Poly
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+// cqlUnwrapSegment removes the framing that protocol v5 adds around the messages once
+// the connection is established. Only uncompressed segments are supported, whose header
+// contains the payload length and a self-contained flag, followed by their CRC24.
+func cqlUnwrapSegment(buf []byte) []byte {
+	if len(buf) < cqlSegmentHeaderLen {
+		return buf
+	}
+	header := uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16
+	crc := uint32(buf[3]) | uint32(buf[4])<<8 | uint32(buf[5])<<16
+	if cqlCRC24(header) != crc {
+		return buf
+	}
+	payload := buf[cqlSegmentHeaderLen:]
+	if l := int(header & cqlSegmentMaxLen); l < len(payload) {
+		payload = payload[:l]
+	}
+	return payload
+}
+
+// cqlFrames iterates the frames of the buffer. It returns false if the buffer doesn't
+// look like a sequence of CQL request or response frames (according to the response
+// argument) of the protocol versions we support.
+func cqlFrames(buf []byte, response bool, onFrame func(f *cqlFrame)) bool {
+	buf = cqlUnwrapSegment(buf)
+	if len(buf) < cqlHeaderLen {
+		return false
+	}
+	for len(buf) >= cqlHeaderLen {
+		version := buf[0] &^ cqlResponseFlag
+		isResponse := buf[0]&cqlResponseFlag != 0
+		f := cqlFrame{
+			version: version,
+			flags:   buf[1],
+			stream:  int16(binary.BigEndian.Uint16(buf[2:4])),
+			opcode:  buf[4],
+		}
+		bodyLen := int(binary.BigEndian.Uint32(buf[5:9]))
+		if isResponse != response || version < cqlMinVersion || version > cqlMaxVersion ||
+			f.flags&^cqlFlagsMask != 0 || bodyLen > cqlMaxBodyLen {
+			return false
+		}
+		if (response && !isCQLResponseOpcode(f.opcode)) || (!response && !isCQLRequestOpcode(f.opcode)) {
+			return false
+		}
+		end := cqlHeaderLen + bodyLen
+		f.body = buf[cqlHeaderLen:min(end, len(buf))]
+		if onFrame != nil {
+			onFrame(&f)
+		}
+		if end >= len(buf) {
+			break
+		}
+		buf = buf[end:]
+	}
+	return true
+}
+
+// ProcessCassandraEvent decodes the CQL native protocol requests sent by a client and the
+// server response. It returns false if the buffers don't belong to a CQL conversation.
+// A nil SQLWireInfo means that the event doesn't need to be reported as a span (e.g. it's
+// a handshake, it's compressed, or the traced process is the Cassandra server).
+func ProcessCassandraEvent(event *TCPRequestInfo, req, resp []byte) (*SQLWireInfo, bool) {
+	reversed := false
+	if !cqlFrames(req, false, nil) || (len(resp) > 0 && !cqlFrames(resp, true, nil)) {
+		// we might have caught the event reversed in the middle of communication
+		if !cqlFrames(resp, false, nil) || !cqlFrames(req, true, nil) {
+			return nil, false
+		}
+		req, resp = resp, req
+		reversed = true
+	}
+
+	// the request was sent by the traced process if its direction is TCP_SEND
+	if (event.Direction == 1) == reversed {
+		return nil, true
+	}
+	if reversed {
+		reverseTCPEvent(event)
+	}
+	conn := BPFConnInfo(event.ConnInfo)
+
+	var reqFrame *cqlFrame
+	cqlFrames(req, false, func(f *cqlFrame) {
+		if reqFrame == nil && f.flags&cqlFlagCompression == 0 {
+			switch f.opcode {
+			case cqlOpQuery, cqlOpPrepare, cqlOpExecute, cqlOpBatch:
+				reqFrame = f
+			}
+		}
+	})
+	if reqFrame == nil {
+		return nil, true
+	}
+
+	var respFrame *cqlFrame
+	cqlFrames(resp, true, func(f *cqlFrame) {
+		if respFrame == nil && f.stream == reqFrame.stream && f.flags&cqlFlagCompression == 0 {
+			respFrame = f
+		}
+	})
+
+	var cqlErr *request.DBError
+	preparedID := ""
+	if respFrame != nil {
+		cqlErr, preparedID = parseCQLResponse(conn, respFrame)
+	}
+
+	info := parseCQLRequest(reqFrame)
+	if reqFrame.opcode == cqlOpPrepare && preparedID != "" {
+		cqlStatements.Add(preparedID, info.Statement)
+	}
+	if keyspace, table, ok := strings.Cut(info.Table, "."); ok {
+		info.Database, info.Table = keyspace, table
+	}
+	if info.Database == "" {
+		info.Database, _ = cqlKeyspaces.Get(conn)
+	}
+	info.Error = cqlErr
+
+	return info, true
+}
+
+// nolint:cyclop
+func parseCQLRequest(f *cqlFrame) *SQLWireInfo {
+	r := newCQLReader(f.body)
+	if f.flags&cqlFlagCustomPayload != 0 {
+		r.skipBytesMap()
+	}
+
+	info := &SQLWireInfo{Kind: request.DBCassandra}
+	setStatement := func(op, stmt string) {
+		cqlOp, table := sqlprune.SQLParseOperationAndTable(stmt)
+		if op == "" {
+			op = cqlOp
+		}
+		info.Operation, info.Table, info.Statement = op, table, stmt
+	}
+
+	switch f.opcode {
+	case cqlOpQuery:
+		setStatement("", r.readLongString())
+		info.Consistency = r.readConsistency()
+	case cqlOpPrepare:
+		setStatement("PREPARE", r.readLongString())
+		if f.version >= 5 && r.readInt()&cqlPrepareWithKeyspace != 0 && r.ok {
+			info.Database = r.readString()
+		}
+	case cqlOpExecute:
+		stmt, _ := cqlStatements.Get(string(r.readShortBytes()))
+		if stmt == "" {
+			setStatement("EXECUTE", "")
+		} else {
+			setStatement("", stmt)
+		}
+		if f.version >= 5 {
+			// result metadata ID
+			r.readShortBytes()
+		}
+		info.Consistency = r.readConsistency()
+	case cqlOpBatch:
+		// batch type
+		r.readByte()
+		n := r.readShort()
+		for i := 0; i < n && r.ok; i++ {
+			stmt := ""
+			if r.readByte() == 0 {
+				stmt = r.readLongString()
+			} else {
+				stmt, _ = cqlStatements.Get(string(r.readShortBytes()))
+			}
+			if i == 0 {
+				setStatement("BATCH", stmt)
+			}
+			for values := r.readShort(); values > 0 && r.ok; values-- {
+				r.skipBytes()
+			}
+		}
+		if info.Operation == "" {
+			info.Operation = "BATCH"
+		}
+		info.BatchSize = n
+		info.Consistency = r.readConsistency()
+	}
+
+	return info
+}
+
+// parseCQLResponse returns the error reported by the server and the ID of a prepared
+// statement, and keeps track of the keyspace selected by the USE statements.
+func parseCQLResponse(conn BPFConnInfo, f *cqlFrame) (*request.DBError, string) {
+	r := newCQLReader(f.body)
+	if f.flags&cqlFlagTracing != 0 {
+		// tracing session ID
+		r.next(16)
+	}
+	if f.flags&cqlFlagWarning != 0 {
+		r.skipStringList()
+	}
+	if f.flags&cqlFlagCustomPayload != 0 {
+		r.skipBytesMap()
+	}
+
+	switch f.opcode {
+	case cqlOpError:
+		code := r.readInt()
+		if !r.ok {
+			return nil, ""
+		}
+		return &request.DBError{
+			ErrorCode:   fmt.Sprintf("0x%04X", code),
+			Description: r.readString(),
+		}, ""
+	case cqlOpResult:
+		switch r.readInt() {
+		case cqlResultSetKeyspace:
+			if keyspace := r.readString(); r.ok && keyspace != "" {
+				cqlKeyspaces.Add(conn, keyspace)
+			}
+		case cqlResultPrepared:
+			if id := r.readShortBytes(); r.ok && len(id) > 0 {
+				return nil, string(id)
+			}
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,195 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func cqlMessage(version, flags byte, stream uint16, opcode byte, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	h := make([]byte, cqlHeaderLen)
+	h[0] = version
+	h[1] = flags
+	binary.BigEndian.PutUint16(h[2:], stream)
+	h[4] = opcode
+	binary.BigEndian.PutUint32(h[5:], uint32(len(b)))
+	return append(h, b...)
+}
+
+func cqlShort(n int) []byte {
+	return binary.BigEndian.AppendUint16(nil, uint16(n))
+}
+
+func cqlInt(n int) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(int32(n)))
+}
+
+func cqlStr(s string) []byte {
+	return append(cqlShort(len(s)), s...)
+}
+
+func cqlLongStr(s string) []byte {
+	return append(cqlInt(len(s)), s...)
+}
+
+// cqlSegment wraps the payload into an uncompressed, self-contained v5 segment
+func cqlSegment(payload []byte) []byte {
+	header := uint32(len(payload)) | 1<<17
+	crc := cqlCRC24(header)
+	seg := []byte{byte(header), byte(header >> 8), byte(header >> 16), byte(crc), byte(crc >> 8), byte(crc >> 16)}
+	return append(append(seg, payload...), 0, 0, 0, 0)
+}
+
+func cqlQuery(stream uint16, query string, consistency int) []byte {
+	return cqlMessage(4, 0, stream, cqlOpQuery, cqlLongStr(query), cqlShort(consistency), []byte{0})
+}
+
+var cqlVoidResult = cqlMessage(0x84, 0, 1, cqlOpResult, cqlInt(1))
+
+func TestCassandraQuery(t *testing.T) {
+	req := cqlQuery(1, "SELECT id, name FROM shop.customers WHERE id = 4", 4)
+	resp := cqlMessage(0x84, 0, 1, cqlOpResult, cqlInt(2), cqlInt(1), cqlInt(2))
+	r := tcpExchange(req, resp, tcpSend, 47001, 9042)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeSQLClient, span.Type)
+	assert.Equal(t, request.DBCassandra, span.SQLKind)
+	assert.Equal(t, "SELECT", span.Method)
+	assert.Equal(t, "customers", span.Path)
+	assert.Equal(t, "shop", span.DBNamespace)
+	assert.Equal(t, "quorum", span.DBConsistency)
+	assert.Equal(t, "SELECT id, name FROM shop.customers WHERE id = 4", span.Statement)
+	assert.Equal(t, 0, span.Status)
+	assert.Equal(t, 9042, span.HostPort)
+	assert.Equal(t, 47001, span.PeerPort)
+}
+
+func TestCassandraUseKeyspace(t *testing.T) {
+	req := cqlQuery(1, "USE inventory", 1)
+	resp := cqlMessage(0x84, 0, 1, cqlOpResult, cqlInt(cqlResultSetKeyspace), cqlStr("inventory"))
+	r := tcpExchange(req, resp, tcpSend, 47002, 9042)
+	info, ok := ProcessCassandraEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "inventory", info.Database)
+
+	// the keyspace is remembered for the following queries of the connection
+	req = cqlQuery(2, "DELETE FROM items WHERE id = 3", 10)
+	resp = cqlMessage(0x84, 0, 2, cqlOpResult, cqlInt(1))
+	r = tcpExchange(req, resp, tcpSend, 47002, 9042)
+	info, ok = ProcessCassandraEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "DELETE", info.Operation)
+	assert.Equal(t, "items", info.Table)
+	assert.Equal(t, "inventory", info.Database)
+	assert.Equal(t, "local_one", info.Consistency)
+}
+
+func TestCassandraPreparedStatement(t *testing.T) {
+	id := []byte{0xca, 0xfe, 0xba, 0xbe}
+	req := cqlMessage(4, 0, 3, cqlOpPrepare, cqlLongStr("INSERT INTO shop.orders (id, total) VALUES (?, ?)"))
+	resp := cqlMessage(0x84, 0, 3, cqlOpResult, cqlInt(cqlResultPrepared), cqlShort(len(id)), id, make([]byte, 12))
+	r := tcpExchange(req, resp, tcpSend, 47003, 9042)
+	info, ok := ProcessCassandraEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "PREPARE", info.Operation)
+	assert.Equal(t, "orders", info.Table)
+
+	req = cqlMessage(4, 0, 4, cqlOpExecute, cqlShort(len(id)), id, cqlShort(6), []byte{0})
+	resp = cqlMessage(0x84, 0, 4, cqlOpResult, cqlInt(1))
+	r = tcpExchange(req, resp, tcpSend, 47003, 9042)
+	info, ok = ProcessCassandraEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "INSERT", info.Operation)
+	assert.Equal(t, "orders", info.Table)
+	assert.Equal(t, "shop", info.Database)
+	assert.Equal(t, "local_quorum", info.Consistency)
+	assert.Equal(t, "INSERT INTO shop.orders (id, total) VALUES (?, ?)", info.Statement)
+}
+
+func TestCassandraUnknownPreparedStatement(t *testing.T) {
+	id := []byte{1, 2, 3}
+	req := cqlMessage(4, 0, 1, cqlOpExecute, cqlShort(len(id)), id, cqlShort(1), []byte{0})
+	r := tcpExchange(req, cqlVoidResult, tcpSend, 47004, 9042)
+	info, ok := ProcessCassandraEvent(&r, req, cqlVoidResult)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "EXECUTE", info.Operation)
+	assert.Equal(t, "one", info.Consistency)
+}
+
+func TestCassandraBatch(t *testing.T) {
+	stmt := func(q string) []byte {
+		return bytes.Join([][]byte{{0}, cqlLongStr(q), cqlShort(1), cqlInt(1), {7}}, nil)
+	}
+	req := cqlMessage(4, 0, 1, cqlOpBatch, []byte{0}, cqlShort(3),
+		stmt("INSERT INTO shop.a (id) VALUES (?)"),
+		stmt("INSERT INTO shop.b (id) VALUES (?)"),
+		stmt("INSERT INTO shop.c (id) VALUES (?)"),
+		cqlShort(5), []byte{0})
+	r := tcpExchange(req, cqlVoidResult, tcpSend, 47005, 9042)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.DBCassandra, span.SQLKind)
+	assert.Equal(t, "BATCH", span.Method)
+	assert.Equal(t, "a", span.Path)
+	assert.Equal(t, "shop", span.DBNamespace)
+	assert.Equal(t, 3, span.DBBatchSize)
+	assert.Equal(t, "all", span.DBConsistency)
+}
+
+func TestCassandraError(t *testing.T) {
+	req := cqlQuery(7, "SELECT * FROM shop.missing", 1)
+	// the warning flag prepends a string list to the body
+	resp := cqlMessage(0x84, cqlFlagWarning, 7, cqlOpError,
+		cqlShort(1), cqlStr("Aggregation query used without partition key"),
+		cqlInt(0x2200), cqlStr("unconfigured table missing"))
+	r := tcpExchange(req, resp, tcpSend, 47006, 9042)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, 1, span.Status)
+	assert.Equal(t, "0x2200", span.DBError.ErrorCode)
+	assert.Equal(t, "unconfigured table missing", span.DBError.Description)
+}
+
+func TestCassandraProtocolV5Segment(t *testing.T) {
+	req := cqlSegment(cqlMessage(5, 0, 1, cqlOpQuery, cqlLongStr("UPDATE shop.users SET name = ? WHERE id = ?"),
+		cqlShort(4), cqlInt(0)))
+	resp := cqlSegment(cqlMessage(0x85, 0, 1, cqlOpResult, cqlInt(1)))
+	r := tcpExchange(req, resp, tcpSend, 47007, 9042)
+
+	info, ok := ProcessCassandraEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "UPDATE", info.Operation)
+	assert.Equal(t, "users", info.Table)
+	assert.Equal(t, "quorum", info.Consistency)
+}
+
+func TestCassandraStartupIgnored(t *testing.T) {
+	startup := cqlMessage(4, 0, 0, cqlOpStartup, cqlShort(1), cqlStr("CQL_VERSION"), cqlStr("3.0.0"))
+	ready := cqlMessage(0x84, 0, 0, cqlOpReady)
+	r := tcpExchange(startup, ready, tcpSend, 47009, 9042)
+	info, ok := ProcessCassandraEvent(&r, startup, ready)
+	assert.True(t, ok)
+	assert.Nil(t, info)
+}
@@ -72,8 +72,20 @@ type TracerConfig struct {
 	// headers to process any 'Traceparent' fields.
 	TrackRequestHeaders bool `yaml:"track_request_headers" env:"BEYLA_BPF_TRACK_REQUEST_HEADERS"`
 
+	// HTTPRequestHeaders lists the HTTP request headers whose values are captured by the kprobes based HTTP request
+	// tracking, and reported as http.request.header.<name> attributes.
+	HTTPRequestHeaders []string `yaml:"http_request_headers" env:"BEYLA_BPF_HTTP_REQUEST_HEADERS" envSeparator:","`
+
+	// HTTPUnmaskCredentialHeaders reports the values of the captured credential headers (e.g. Authorization or Cookie)
+	// in cleartext. Otherwise, their values are masked.
+	HTTPUnmaskCredentialHeaders bool `yaml:"http_unmask_credential_headers" env:"BEYLA_BPF_HTTP_UNMASK_CREDENTIAL_HEADERS"`
+
 	HTTPRequestTimeout time.Duration `yaml:"http_request_timeout" env:"BEYLA_BPF_HTTP_REQUEST_TIMEOUT"`
 
+	// If enabled, the kprobes based TCP request tracking will report the requests that can't be
+	// classified into any of the supported protocols as generic TCP client/server spans.
+	TrackUnclassifiedTCP bool `yaml:"track_unclassified_tcp" env:"BEYLA_BPF_TRACK_UNCLASSIFIED_TCP"`
+
 	// Enables Linux Traffic Control probes for context propagation
 	UseLinuxTC bool `yaml:"enable_traffic_control" env:"BEYLA_BPF_TC"`
 }
@@ -107,7 +119,7 @@ var MisclassifiedEvents = make(chan MisclassifiedEvent)
 
 func ptlog() *slog.Logger { return slog.With("component", "ebpf.ProcessTracer") }
 
-func ReadBPFTraceAsSpan(record *ringbuf.Record, filter ServiceFilter) (request.Span, bool, error) {
+func ReadBPFTraceAsSpan(cfg *TracerConfig, record *ringbuf.Record, filter ServiceFilter) (request.Span, bool, error) {
 	var eventType uint8
 
 	// we read the type first, depending on the type we decide what kind of record we have
@@ -120,11 +132,11 @@ func ReadBPFTraceAsSpan(record *ringbuf.Record, filter ServiceFilter) (request.S
 	case EventTypeSQL:
 		return ReadSQLRequestTraceAsSpan(record)
 	case EventTypeKHTTP:
-		return ReadHTTPInfoIntoSpan(record, filter)
+		return ReadHTTPInfoIntoSpan(cfg, record, filter)
 	case EventTypeKHTTP2:
 		return ReadHTTP2InfoIntoSpan(record, filter)
 	case EventTypeTCP:
-		return ReadTCPRequestIntoSpan(record, filter)
+		return ReadTCPRequestIntoSpan(cfg, record, filter)
 	case EventTypeGoSarama:
 		return ReadGoSaramaRequestIntoSpan(record)
 	case EventTypeGoRedis:
@@ -0,0 +1,244 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	trace2 "go.opentelemetry.io/otel/trace"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// https://fastcgi-archives.github.io/FastCGI_Specification.html
+const (
+	fcgiHeaderLen      = 8
+	fcgiVersion1       = 1
+	fcgiBeginBodyLen   = 8
+	fcgiRoleResponder  = 1
+	fcgiDefaultStatus  = 200
+	fcgiMaxParamLength = 64 * 1024
+)
+
+// record types
+const (
+	fcgiBeginRequest = 1
+	fcgiAbortRequest = 2
+	fcgiEndRequest   = 3
+	fcgiParams       = 4
+	fcgiStdin        = 5
+	fcgiStdout       = 6
+	fcgiStderr       = 7
+)
+
+type FastCGIInfo struct {
+	Method        string
+	URI           string
+	Status        int
+	ContentLength int64
+}
+
+// fcgiRecords iterates the records of the buffer, invoking the provided function with the
+// record content, truncated to the buffer length. It returns false if the buffer doesn't
+// look like a sequence of FastCGI records whose types are accepted by validType.
+func fcgiRecords(buf []byte, validType func(t byte) bool, onRecord func(t byte, content []byte)) bool {
+	if len(buf) < fcgiHeaderLen {
+		return false
+	}
+	for len(buf) >= fcgiHeaderLen {
+		t := buf[1]
+		if buf[0] != fcgiVersion1 || !validType(t) {
+			return false
+		}
+		size := int(binary.BigEndian.Uint16(buf[4:6]))
+		padding := int(buf[6])
+		end := fcgiHeaderLen + size
+		if onRecord != nil {
+			onRecord(t, buf[fcgiHeaderLen:min(end, len(buf))])
+		}
+		if end+padding >= len(buf) {
+			break
+		}
+		buf = buf[end+padding:]
+	}
+	return true
+}
+
+func isFastCGIRequestType(t byte) bool {
+	return t == fcgiBeginRequest || t == fcgiAbortRequest || t == fcgiParams || t == fcgiStdin
+}
+
+func isFastCGIResponseType(t byte) bool {
+	return t == fcgiStdout || t == fcgiStderr || t == fcgiEndRequest
+}
+
+// isFastCGIRequest checks that the buffer starts with a BEGIN_REQUEST record for the responder role
+func isFastCGIRequest(buf []byte) bool {
+	if len(buf) < fcgiHeaderLen+fcgiBeginBodyLen || buf[1] != fcgiBeginRequest ||
+		binary.BigEndian.Uint16(buf[4:6]) != fcgiBeginBodyLen {
+		return false
+	}
+	if binary.BigEndian.Uint16(buf[fcgiHeaderLen:]) != fcgiRoleResponder {
+		return false
+	}
+	return fcgiRecords(buf, isFastCGIRequestType, nil)
+}
+
+func isFastCGIResponse(buf []byte) bool {
+	return fcgiRecords(buf, isFastCGIResponseType, nil)
+}
+
+// fcgiParamLength decodes the 1 or 4 bytes length of a name-value pair element,
+// returning also the number of bytes used to encode it.
+func fcgiParamLength(buf []byte) (int, int) {
+	if len(buf) == 0 {
+		return -1, 0
+	}
+	if buf[0]&0x80 == 0 {
+		return int(buf[0]), 1
+	}
+	if len(buf) < 4 {
+		return -1, 0
+	}
+	return int(binary.BigEndian.Uint32(buf) & 0x7fffffff), 4
+}
+
+// fcgiParamsPairs iterates the name-value pairs of the PARAMS records content. The last
+// value might be truncated, as the buffer could be truncated.
+func fcgiParamsPairs(buf []byte, onParam func(name, value string)) {
+	for len(buf) > 0 {
+		nameLen, n := fcgiParamLength(buf)
+		if n == 0 {
+			return
+		}
+		buf = buf[n:]
+		valueLen, n := fcgiParamLength(buf)
+		if n == 0 || nameLen > fcgiMaxParamLength || valueLen > fcgiMaxParamLength || nameLen > len(buf)-n {
+			return
+		}
+		buf = buf[n:]
+		name := string(buf[:nameLen])
+		buf = buf[nameLen:]
+		onParam(name, string(buf[:min(valueLen, len(buf))]))
+		if valueLen >= len(buf) {
+			return
+		}
+		buf = buf[valueLen:]
+	}
+}
+
+// fcgiStatus returns the status code of the CGI response headers sent to STDOUT, which
+// defaults to 200 if no Status header is provided.
+func fcgiStatus(stdout []byte) int {
+	for _, line := range bytes.Split(stdout, []byte("\r\n")) {
+		if len(line) == 0 {
+			// end of headers
+			break
+		}
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if !ok || !strings.EqualFold(string(name), "Status") {
+			continue
+		}
+		code, _, _ := strings.Cut(strings.TrimSpace(string(value)), " ")
+		if status, err := strconv.Atoi(code); err == nil {
+			return status
+		}
+	}
+	return fcgiDefaultStatus
+}
+
+// ProcessFastCGIEvent decodes the FastCGI request records received by an application server
+// (e.g. PHP-FPM) and the response records sent back to the web server. It returns false if
+// the buffers don't belong to a FastCGI conversation. A nil FastCGIInfo means that the traced
+// process is the web server side of the connection, which is already reported by its HTTP
+// spans, so the event should be ignored.
+func ProcessFastCGIEvent(event *TCPRequestInfo, req, resp []byte) (*FastCGIInfo, bool) {
+	reqRecv := event.Direction == 0
+	if !isFastCGIRequest(req) || (len(resp) > 0 && !isFastCGIResponse(resp)) {
+		// we might have caught the event reversed in the middle of communication
+		if !isFastCGIRequest(resp) || !isFastCGIResponse(req) {
+			return nil, false
+		}
+		req, resp = resp, req
+		reqRecv = !reqRecv
+		if reqRecv {
+			reverseTCPEvent(event)
+		}
+	}
+	if !reqRecv {
+		return nil, true
+	}
+
+	info := &FastCGIInfo{Status: fcgiDefaultStatus}
+	var params []byte
+	fcgiRecords(req, isFastCGIRequestType, func(t byte, content []byte) {
+		if t == fcgiParams {
+			params = append(params, content...)
+		}
+	})
+	uri, script := "", ""
+	fcgiParamsPairs(params, func(name, value string) {
+		switch name {
+		case "REQUEST_METHOD":
+			info.Method = value
+		case "REQUEST_URI":
+			uri = value
+		case "SCRIPT_NAME":
+			script = value
+		case "CONTENT_LENGTH":
+			info.ContentLength, _ = strconv.ParseInt(value, 10, 64)
+		}
+	})
+	// the request URI might not fit in the captured buffer
+	info.URI = uri
+	if info.URI == "" {
+		info.URI = script
+	}
+
+	stdoutFound := false
+	fcgiRecords(resp, isFastCGIResponseType, func(t byte, content []byte) {
+		if t == fcgiStdout && !stdoutFound && len(content) > 0 {
+			stdoutFound = true
+			info.Status = fcgiStatus(content)
+		}
+	})
+
+	return info, true
+}
+
+func TCPToFastCGIToSpan(trace *TCPRequestInfo, data *FastCGIInfo) request.Span {
+	peer := ""
+	hostname := ""
+	hostPort := 0
+
+	if trace.ConnInfo.S_port != 0 || trace.ConnInfo.D_port != 0 {
+		peer, hostname = (*BPFConnInfo)(unsafe.Pointer(&trace.ConnInfo)).reqHostInfo()
+		hostPort = int(trace.ConnInfo.D_port)
+	}
+
+	return request.Span{
+		Type:          request.EventTypeHTTP,
+		Method:        data.Method,
+		Path:          removeQuery(data.URI),
+		Peer:          peer,
+		PeerPort:      int(trace.ConnInfo.S_port),
+		Host:          hostname,
+		HostPort:      hostPort,
+		ContentLength: data.ContentLength,
+		RequestStart:  int64(trace.StartMonotimeNs),
+		Start:         int64(trace.StartMonotimeNs),
+		End:           int64(trace.EndMonotimeNs),
+		Status:        data.Status,
+		TraceID:       trace2.TraceID(trace.Tp.TraceId),
+		SpanID:        trace2.SpanID(trace.Tp.SpanId),
+		ParentSpanID:  trace2.SpanID(trace.Tp.ParentId),
+		Flags:         trace.Tp.Flags,
+		Pid: request.PidInfo{
+			HostPID:   trace.Pid.HostPid,
+			UserPID:   trace.Pid.UserPid,
+			Namespace: trace.Pid.Ns,
+		},
+	}
+}
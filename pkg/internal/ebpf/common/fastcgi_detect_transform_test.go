@@ -0,0 +1,89 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func fcgiRecord(t byte, content []byte) []byte {
+	rec := []byte{fcgiVersion1, t, 0, 1, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(rec[4:], uint16(len(content)))
+	padding := (8 - len(content)%8) % 8
+	rec[6] = byte(padding)
+	return append(append(rec, content...), make([]byte, padding)...)
+}
+
+func fcgiPair(name, value string) []byte {
+	return append(append([]byte{byte(len(name)), byte(len(value))}, name...), value...)
+}
+
+func fcgiRequest(params ...[]byte) []byte {
+	return bytes.Join([][]byte{
+		fcgiRecord(fcgiBeginRequest, []byte{0, fcgiRoleResponder, 0, 0, 0, 0, 0, 0}),
+		fcgiRecord(fcgiParams, bytes.Join(params, nil)),
+		fcgiRecord(fcgiParams, nil),
+		fcgiRecord(fcgiStdin, nil),
+	}, nil)
+}
+
+func fcgiResponse(stdout string) []byte {
+	return bytes.Join([][]byte{
+		fcgiRecord(fcgiStdout, []byte(stdout)),
+		fcgiRecord(fcgiEndRequest, make([]byte, 8)),
+	}, nil)
+}
+
+func TestFastCGIRequest(t *testing.T) {
+	req := fcgiRequest(
+		fcgiPair("REQUEST_METHOD", "POST"),
+		fcgiPair("CONTENT_LENGTH", "42"),
+		fcgiPair("SCRIPT_NAME", "/index.php"),
+		fcgiPair("REQUEST_URI", "/users/3?verbose=1"),
+	)
+	resp := fcgiResponse("Status: 201 Created\r\nContent-type: text/html\r\n\r\n<html>")
+	r := tcpExchange(req, resp, tcpRecv, 45001, 9000)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeHTTP, span.Type)
+	assert.Equal(t, "POST", span.Method)
+	assert.Equal(t, "/users/3", span.Path)
+	assert.Equal(t, 201, span.Status)
+	assert.Equal(t, int64(42), span.ContentLength)
+	assert.Equal(t, 9000, span.HostPort)
+	assert.Equal(t, 45001, span.PeerPort)
+}
+
+func TestFastCGIDefaultStatus(t *testing.T) {
+	req := fcgiRequest(fcgiPair("REQUEST_METHOD", "GET"), fcgiPair("SCRIPT_NAME", "/index.php"))
+	resp := fcgiResponse("Content-type: text/html\r\n\r\nStatus: 500\r\n")
+	r := tcpExchange(req, resp, tcpRecv, 45001, 9000)
+
+	info, ok := ProcessFastCGIEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "GET", info.Method)
+	// falls back to the script name if the request URI isn't found
+	assert.Equal(t, "/index.php", info.URI)
+	assert.Equal(t, 200, info.Status)
+}
+
+func TestFastCGIErrorStatus(t *testing.T) {
+	req := fcgiRequest(fcgiPair("REQUEST_METHOD", "GET"), fcgiPair("REQUEST_URI", "/missing"))
+	resp := fcgiResponse("Status: 404 Not Found\r\n\r\n")
+	r := tcpExchange(req, resp, tcpRecv, 45001, 9000)
+
+	info, ok := ProcessFastCGIEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, 404, info.Status)
+}
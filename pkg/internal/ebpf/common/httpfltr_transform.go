@@ -13,6 +13,7 @@ import (
 	"github.com/cilium/ebpf/ringbuf"
 	"go.opentelemetry.io/otel/trace"
 
+	attr "github.com/grafana/beyla/pkg/export/attributes/names"
 	"github.com/grafana/beyla/pkg/internal/request"
 	"github.com/grafana/beyla/pkg/internal/svc"
 )
@@ -61,7 +62,7 @@ type HTTPInfo struct {
 	Service svc.ID
 }
 
-func ReadHTTPInfoIntoSpan(record *ringbuf.Record, filter ServiceFilter) (request.Span, bool, error) {
+func ReadHTTPInfoIntoSpan(cfg *TracerConfig, record *ringbuf.Record, filter ServiceFilter) (request.Span, bool, error) {
 	var event BPFHTTPInfo
 	err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event)
 	if err != nil {
@@ -73,10 +74,10 @@ func ReadHTTPInfoIntoSpan(record *ringbuf.Record, filter ServiceFilter) (request
 		return request.Span{}, true, nil
 	}
 
-	return HTTPInfoEventToSpan(event)
+	return HTTPInfoEventToSpan(cfg, event)
 }
 
-func HTTPInfoEventToSpan(event BPFHTTPInfo) (request.Span, bool, error) {
+func HTTPInfoEventToSpan(cfg *TracerConfig, event BPFHTTPInfo) (request.Span, bool, error) {
 	result := HTTPInfo{BPFHTTPInfo: event}
 
 	// When we can't find the connection info, we signal that through making the
@@ -96,7 +97,15 @@ func HTTPInfoEventToSpan(event BPFHTTPInfo) (request.Span, bool, error) {
 	result.URL = event.url()
 	result.Method = event.method()
 
-	return httpInfoToSpan(&result), false, nil
+	span := httpInfoToSpan(&result)
+	if len(cfg.HTTPRequestHeaders) > 0 {
+		span.RequestHeaders = event.headers(cfg.HTTPRequestHeaders)
+		if !cfg.HTTPUnmaskCredentialHeaders {
+			maskCredentialHeaders(span.RequestHeaders)
+		}
+	}
+
+	return span, false, nil
 }
 
 func (event *BPFHTTPInfo) url() string {
@@ -138,6 +147,60 @@ func (event *BPFHTTPInfo) method() string {
 	return buf[:space]
 }
 
+// headers returns the values of the provided header names, keyed by their normalized name.
+// Only the headers that fit in the captured buffer are returned.
+func (event *BPFHTTPInfo) headers(names []string) map[string]string {
+	buf := cstr(event.Buf[:])
+	// if the buffer is full, its last line might be truncated, so we discard it
+	truncated := len(buf) == len(event.Buf)
+
+	var headers map[string]string
+	// skip the request line
+	_, buf, _ = strings.Cut(buf, "\r\n")
+	for len(buf) > 0 {
+		line, rest, found := strings.Cut(buf, "\r\n")
+		if line == "" || (!found && truncated) {
+			// end of the headers section, or truncated line
+			break
+		}
+		buf = rest
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		for _, n := range names {
+			if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(n)) {
+				if headers == nil {
+					headers = map[string]string{}
+				}
+				headers[attr.HTTPHeaderKey(n)] = strings.TrimSpace(value)
+				break
+			}
+		}
+	}
+	return headers
+}
+
+// credentialHeaders are the lowercase names of the headers whose values are masked by default
+var credentialHeaders = map[string]struct{}{
+	"authorization":        {},
+	"proxy-authorization":  {},
+	"cookie":               {},
+	"x-api-key":            {},
+	"x-auth-token":         {},
+	"x-amz-security-token": {},
+}
+
+const credentialHeaderMask = "*"
+
+func maskCredentialHeaders(headers map[string]string) {
+	for name := range headers {
+		if _, ok := credentialHeaders[name]; ok {
+			headers[name] = credentialHeaderMask
+		}
+	}
+}
+
 func (event *BPFHTTPInfo) hostFromBuf() (string, int) {
 	buf := cstr(event.Buf[:])
 
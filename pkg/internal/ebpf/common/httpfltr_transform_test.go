@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/grafana/beyla/pkg/internal/request"
 	"github.com/grafana/beyla/pkg/internal/svc"
@@ -59,6 +60,40 @@ func TestMethodURLParsing(t *testing.T) {
 	assert.Empty(t, i.url())
 }
 
+func TestHTTPHeadersParsing(t *testing.T) {
+	names := []string{"User-Agent", "x-tenant", "X-Request-ID"}
+
+	i := makeBPFInfoWithBuf([]uint8("GET /test HTTP/1.1\r\nHost: foo\r\nuser-agent: curl/8.0\r\nX-Tenant:  acme \r\n\r\n"))
+	assert.Equal(t, map[string]string{"user-agent": "curl/8.0", "x-tenant": "acme"}, i.headers(names))
+
+	// the last line of a full buffer might be truncated, so it is discarded
+	buf := "GET /test HTTP/1.1\r\nX-Tenant: acme\r\nX-Request-ID: "
+	i = makeBPFInfoWithBuf([]uint8(buf + strings.Repeat("a", len(i.Buf)-len(buf))))
+	assert.Equal(t, map[string]string{"x-tenant": "acme"}, i.headers(names))
+
+	// the last line of a non-full buffer is complete
+	i = makeBPFInfoWithBuf([]uint8("GET /test HTTP/1.1\r\nX-Request-ID: 1234"))
+	assert.Equal(t, map[string]string{"x-request-id": "1234"}, i.headers(names))
+
+	i = makeBPFInfoWithBuf([]uint8("GET /test HTTP/1.1\r\nHost: foo\r\n"))
+	assert.Empty(t, i.headers(names))
+}
+
+func TestHTTPHeaders_CredentialsMasked(t *testing.T) {
+	info := makeBPFInfoWithBuf([]uint8("GET /test HTTP/1.1\r\nAuthorization: Bearer s3cr3t\r\nCookie: session=1234\r\nX-Tenant: acme\r\n\r\n"))
+	cfg := &TracerConfig{HTTPRequestHeaders: []string{"authorization", "cookie", "x-tenant"}}
+
+	span, _, err := HTTPInfoEventToSpan(cfg, info)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "*", "cookie": "*", "x-tenant": "acme"}, span.RequestHeaders)
+
+	cfg.HTTPUnmaskCredentialHeaders = true
+	span, _, err = HTTPInfoEventToSpan(cfg, info)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer s3cr3t", "cookie": "session=1234", "x-tenant": "acme"},
+		span.RequestHeaders)
+}
+
 func makeHTTPInfo(method, path, peer, host, comm string, peerPort, hostPort uint32, status uint16, durationMs uint64) HTTPInfo {
 	bpfInfo := BPFHTTPInfo{
 		Type:            1,
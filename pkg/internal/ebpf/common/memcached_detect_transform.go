@@ -0,0 +1,291 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unsafe"
+
+	trace2 "go.opentelemetry.io/otel/trace"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// https://github.com/memcached/memcached/blob/master/doc/protocol.txt
+// https://github.com/memcached/memcached/wiki/BinaryProtocolRevamped
+const (
+	memcachedBinHeaderLen   = 24
+	memcachedBinRequest     = 0x80
+	memcachedBinResponse    = 0x81
+	memcachedMaxBodyLen     = 2 * 1024 * 1024
+	memcachedMaxTextLineLen = 2048
+)
+
+// binary protocol response status
+const (
+	memcachedStatusOK          = 0x00
+	memcachedStatusKeyNotFound = 0x01
+	memcachedStatusKeyExists   = 0x02
+	memcachedStatusNotStored   = 0x05
+)
+
+// binary protocol opcodes. Quiet variants are reported with the name of their
+// non-quiet counterpart.
+var memcachedBinOpcodes = map[byte]string{
+	0x00: "get", 0x01: "set", 0x02: "add", 0x03: "replace", 0x04: "delete",
+	0x05: "incr", 0x06: "decr", 0x07: "quit", 0x08: "flush_all", 0x09: "get",
+	0x0a: "noop", 0x0b: "version", 0x0c: "get", 0x0d: "get", 0x0e: "append",
+	0x0f: "prepend", 0x10: "stats", 0x11: "set", 0x12: "add", 0x13: "replace",
+	0x14: "delete", 0x15: "incr", 0x16: "decr", 0x17: "quit", 0x18: "flush_all",
+	0x19: "append", 0x1a: "prepend", 0x1b: "verbosity", 0x1c: "touch", 0x1d: "gat",
+	0x1e: "gat",
+}
+
+// text protocol commands, with the position of their first key and whether
+// the rest of the arguments are also keys
+var memcachedTextCommands = map[string]struct {
+	firstKey  int
+	multiKeys bool
+}{
+	"get": {1, true}, "gets": {1, true}, "gat": {2, true}, "gats": {2, true},
+	"set": {1, false}, "add": {1, false}, "replace": {1, false}, "append": {1, false},
+	"prepend": {1, false}, "cas": {1, false}, "delete": {1, false}, "incr": {1, false},
+	"decr": {1, false}, "touch": {1, false},
+	"mg": {1, false}, "ms": {1, false}, "md": {1, false}, "ma": {1, false}, "mn": {0, false},
+	"version": {0, false}, "stats": {0, false}, "flush_all": {0, false},
+	"verbosity": {0, false}, "quit": {0, false},
+}
+
+var memcachedTextResponses = []string{
+	"VALUE ", "END\r\n", "STORED\r\n", "NOT_STORED\r\n", "EXISTS\r\n", "NOT_FOUND\r\n",
+	"DELETED\r\n", "TOUCHED\r\n", "OK\r\n", "VERSION ", "STAT ", "ERROR", "CLIENT_ERROR ",
+	"SERVER_ERROR ", "VA ", "HD", "EN\r\n", "NF", "NS", "EX", "MN\r\n",
+}
+
+type MemcachedInfo struct {
+	Operation string
+	Query     string
+	KeyCount  int
+	Outcome   request.CacheOutcome
+	Error     bool
+}
+
+func isMemcachedRetrieval(op string) bool {
+	return op == "get" || op == "gets" || op == "gat" || op == "gats" || op == "mg"
+}
+
+// ProcessMemcachedEvent decodes memcached requests in both the text (ASCII) and binary protocol.
+// It returns false if the buffers don't belong to a memcached conversation. A nil MemcachedInfo
+// means that the traced process is the memcached server, so the event is ignored.
+func ProcessMemcachedEvent(event *TCPRequestInfo, req, resp []byte) (*MemcachedInfo, bool) {
+	info, ok := parseMemcached(req, resp, int(event.Len))
+	reversed := false
+	if !ok {
+		// we might have caught the event reversed in the middle of communication
+		if info, ok = parseMemcached(resp, req, int(event.RespLen)); !ok {
+			return nil, false
+		}
+		reversed = true
+	}
+
+	// the request was sent by the traced process if its direction is TCP_SEND
+	if (event.Direction == 1) == reversed {
+		return nil, true
+	}
+	if reversed {
+		reverseTCPEvent(event)
+	}
+	return info, true
+}
+
+func parseMemcached(req, resp []byte, reqLen int) (*MemcachedInfo, bool) {
+	if len(req) > 0 && req[0] == memcachedBinRequest {
+		return parseMemcachedBinary(req, resp)
+	}
+	return parseMemcachedText(req, resp, reqLen)
+}
+
+func parseMemcachedText(req, resp []byte, reqLen int) (*MemcachedInfo, bool) {
+	end := bytes.Index(req, []byte("\r\n"))
+	if end < 0 {
+		// the command line might be truncated by the size of the eBPF buffer
+		if reqLen <= len(req) {
+			return nil, false
+		}
+		end = len(req)
+	}
+	if end == 0 || end > memcachedMaxTextLineLen || !isMemcachedTextResponse(resp) {
+		return nil, false
+	}
+	line := string(req[:end])
+	for i := 0; i < len(line); i++ {
+		if line[i] < ' ' || line[i] > '~' {
+			return nil, false
+		}
+	}
+	tokens := strings.Fields(line)
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	cmd, ok := memcachedTextCommands[tokens[0]]
+	if !ok || (cmd.firstKey > 0 && len(tokens) <= cmd.firstKey) {
+		return nil, false
+	}
+
+	info := &MemcachedInfo{Operation: tokens[0], Query: line}
+	switch {
+	case cmd.firstKey == 0:
+	case cmd.multiKeys:
+		info.KeyCount = len(tokens) - cmd.firstKey
+	default:
+		info.KeyCount = 1
+	}
+
+	switch {
+	case bytes.HasPrefix(resp, []byte("ERROR")), bytes.HasPrefix(resp, []byte("CLIENT_ERROR ")),
+		bytes.HasPrefix(resp, []byte("SERVER_ERROR ")):
+		info.Error = true
+	case isMemcachedRetrieval(info.Operation):
+		if bytes.HasPrefix(resp, []byte("VALUE ")) || bytes.HasPrefix(resp, []byte("VA ")) ||
+			bytes.HasPrefix(resp, []byte("HD")) {
+			info.Outcome = request.CacheHit
+		} else if len(resp) > 0 {
+			info.Outcome = request.CacheMiss
+		}
+	}
+	return info, true
+}
+
+func isMemcachedTextResponse(resp []byte) bool {
+	// requests with the noreply option don't get any response
+	if len(resp) == 0 {
+		return true
+	}
+	for _, r := range memcachedTextResponses {
+		if bytes.HasPrefix(resp, []byte(r)) {
+			return true
+		}
+	}
+	// incr/decr responses
+	i := 0
+	for ; i < len(resp) && resp[i] >= '0' && resp[i] <= '9'; i++ {
+	}
+	return i > 0 && bytes.HasPrefix(resp[i:], []byte("\r\n"))
+}
+
+// memcachedBinPackets iterates the binary protocol packets of the buffer. It returns false
+// if the buffer doesn't look like a sequence of memcached packets with the given magic byte.
+func memcachedBinPackets(buf []byte, magic byte, onPacket func(opcode byte, status uint16, key []byte)) bool {
+	if len(buf) < memcachedBinHeaderLen {
+		return false
+	}
+	for len(buf) >= memcachedBinHeaderLen {
+		opcode := buf[1]
+		keyLen := int(binary.BigEndian.Uint16(buf[2:4]))
+		extrasLen := int(buf[4])
+		status := binary.BigEndian.Uint16(buf[6:8])
+		bodyLen := int(binary.BigEndian.Uint32(buf[8:12]))
+		if _, ok := memcachedBinOpcodes[opcode]; buf[0] != magic || !ok || buf[5] != 0 ||
+			bodyLen > memcachedMaxBodyLen || extrasLen+keyLen > bodyLen {
+			return false
+		}
+		key := buf[memcachedBinHeaderLen:]
+		key = key[min(extrasLen, len(key)):]
+		key = key[:min(keyLen, len(key))]
+		if onPacket != nil {
+			onPacket(opcode, status, key)
+		}
+		if memcachedBinHeaderLen+bodyLen >= len(buf) {
+			break
+		}
+		buf = buf[memcachedBinHeaderLen+bodyLen:]
+	}
+	return true
+}
+
+func parseMemcachedBinary(req, resp []byte) (*MemcachedInfo, bool) {
+	if len(resp) > 0 && !memcachedBinPackets(resp, memcachedBinResponse, nil) {
+		return nil, false
+	}
+	var info *MemcachedInfo
+	var keys []string
+	valid := memcachedBinPackets(req, memcachedBinRequest, func(opcode byte, _ uint16, key []byte) {
+		op := memcachedBinOpcodes[opcode]
+		if info == nil {
+			info = &MemcachedInfo{Operation: op}
+		}
+		// multi-gets are sent as a sequence of quiet gets ended by a noop
+		if op == info.Operation && len(key) > 0 {
+			keys = append(keys, string(key))
+		}
+	})
+	if !valid || info == nil {
+		return nil, false
+	}
+	info.KeyCount = len(keys)
+	info.Query = strings.Join(append([]string{info.Operation}, keys...), " ")
+
+	retrieval := isMemcachedRetrieval(info.Operation)
+	memcachedBinPackets(resp, memcachedBinResponse, func(opcode byte, status uint16, _ []byte) {
+		switch status {
+		case memcachedStatusOK:
+			if retrieval && memcachedBinOpcodes[opcode] == info.Operation {
+				info.Outcome = request.CacheHit
+			}
+		case memcachedStatusKeyNotFound:
+			if retrieval && info.Outcome == request.CacheUnknown {
+				info.Outcome = request.CacheMiss
+			}
+		case memcachedStatusKeyExists, memcachedStatusNotStored:
+		default:
+			info.Error = true
+		}
+	})
+	if retrieval && info.Outcome == request.CacheUnknown && len(resp) > 0 {
+		// quiet gets don't send any response for missing keys
+		info.Outcome = request.CacheMiss
+	}
+	return info, true
+}
+
+func TCPToMemcachedToSpan(trace *TCPRequestInfo, data *MemcachedInfo) request.Span {
+	peer := ""
+	hostname := ""
+	hostPort := 0
+
+	if trace.ConnInfo.S_port != 0 || trace.ConnInfo.D_port != 0 {
+		peer, hostname = (*BPFConnInfo)(unsafe.Pointer(&trace.ConnInfo)).reqHostInfo()
+		hostPort = int(trace.ConnInfo.D_port)
+	}
+
+	status := 0
+	if data.Error {
+		status = 1
+	}
+
+	return request.Span{
+		Type:          request.EventTypeMemcachedClient,
+		Method:        data.Operation,
+		Path:          data.Query,
+		Peer:          peer,
+		PeerPort:      int(trace.ConnInfo.S_port),
+		Host:          hostname,
+		HostPort:      hostPort,
+		ContentLength: 0,
+		RequestStart:  int64(trace.StartMonotimeNs),
+		Start:         int64(trace.StartMonotimeNs),
+		End:           int64(trace.EndMonotimeNs),
+		Status:        status,
+		TraceID:       trace2.TraceID(trace.Tp.TraceId),
+		SpanID:        trace2.SpanID(trace.Tp.SpanId),
+		ParentSpanID:  trace2.SpanID(trace.Tp.ParentId),
+		Flags:         trace.Tp.Flags,
+		Pid: request.PidInfo{
+			HostPID:   trace.Pid.HostPid,
+			UserPID:   trace.Pid.UserPid,
+			Namespace: trace.Pid.Ns,
+		},
+		CacheOutcome: data.Outcome,
+		KeyCount:     data.KeyCount,
+	}
+}
@@ -0,0 +1,153 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func mcBinPacket(magic, opcode byte, status uint16, extras, key, value []byte) []byte {
+	h := make([]byte, memcachedBinHeaderLen)
+	h[0] = magic
+	h[1] = opcode
+	binary.BigEndian.PutUint16(h[2:], uint16(len(key)))
+	h[4] = byte(len(extras))
+	binary.BigEndian.PutUint16(h[6:], status)
+	binary.BigEndian.PutUint32(h[8:], uint32(len(extras)+len(key)+len(value)))
+	return bytes.Join([][]byte{h, extras, key, value}, nil)
+}
+
+func TestMemcachedTextGetHit(t *testing.T) {
+	req := []byte("get user:1 user:2 user:3\r\n")
+	resp := []byte("VALUE user:1 0 5\r\nhello\r\nEND\r\n")
+	r := tcpExchange(req, resp, tcpSend, 46001, 11211)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeMemcachedClient, span.Type)
+	assert.Equal(t, "get", span.Method)
+	assert.Equal(t, "get user:1 user:2 user:3", span.Path)
+	assert.Equal(t, 3, span.KeyCount)
+	assert.Equal(t, request.CacheHit, span.CacheOutcome)
+	assert.Equal(t, 0, span.Status)
+	assert.Equal(t, 11211, span.HostPort)
+	assert.Equal(t, 46001, span.PeerPort)
+}
+
+func TestMemcachedTextGetMiss(t *testing.T) {
+	req := []byte("gets session\r\n")
+	resp := []byte("END\r\n")
+	r := tcpExchange(req, resp, tcpSend, 46002, 11211)
+
+	info, ok := ProcessMemcachedEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "gets", info.Operation)
+	assert.Equal(t, 1, info.KeyCount)
+	assert.Equal(t, request.CacheMiss, info.Outcome)
+	assert.False(t, info.Error)
+}
+
+func TestMemcachedTextStorage(t *testing.T) {
+	for _, ts := range []struct {
+		name string
+		req  []byte
+		resp []byte
+	}{
+		{name: "stored", req: []byte("set counter 0 3600 2\r\n42\r\n"), resp: []byte("STORED\r\n")},
+		{name: "noreply", req: []byte("set counter 0 3600 2 noreply\r\n42\r\n"), resp: nil},
+		{name: "not stored", req: []byte("add counter 0 0 2\r\n42\r\n"), resp: []byte("NOT_STORED\r\n")},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			r := tcpExchange(ts.req, ts.resp, tcpSend, 46003, 11211)
+			info, ok := ProcessMemcachedEvent(&r, ts.req, ts.resp)
+			require.True(t, ok)
+			require.NotNil(t, info)
+			assert.Equal(t, 1, info.KeyCount)
+			assert.Equal(t, request.CacheUnknown, info.Outcome)
+			assert.False(t, info.Error)
+		})
+	}
+}
+
+func TestMemcachedTextIncr(t *testing.T) {
+	req := []byte("incr hits 1\r\n")
+	resp := []byte("43\r\n")
+	r := tcpExchange(req, resp, tcpSend, 46004, 11211)
+
+	info, ok := ProcessMemcachedEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "incr", info.Operation)
+	assert.False(t, info.Error)
+}
+
+func TestMemcachedTextError(t *testing.T) {
+	req := []byte("set key 0 0 100\r\nshort\r\n")
+	resp := []byte("CLIENT_ERROR bad data chunk\r\n")
+	r := tcpExchange(req, resp, tcpSend, 46005, 11211)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeMemcachedClient, span.Type)
+	assert.Equal(t, 1, span.Status)
+}
+
+func TestMemcachedBinaryMultiGet(t *testing.T) {
+	// multi-get sent as a sequence of GETKQ ended by a NOOP
+	req := bytes.Join([][]byte{
+		mcBinPacket(memcachedBinRequest, 0x0d, 0, nil, []byte("k1"), nil),
+		mcBinPacket(memcachedBinRequest, 0x0d, 0, nil, []byte("k2"), nil),
+		mcBinPacket(memcachedBinRequest, 0x0a, 0, nil, nil, nil),
+	}, nil)
+	resp := bytes.Join([][]byte{
+		mcBinPacket(memcachedBinResponse, 0x0d, memcachedStatusOK, make([]byte, 4), []byte("k2"), []byte("value")),
+		mcBinPacket(memcachedBinResponse, 0x0a, memcachedStatusOK, nil, nil, nil),
+	}, nil)
+	r := tcpExchange(req, resp, tcpSend, 46006, 11211)
+
+	info, ok := ProcessMemcachedEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "get", info.Operation)
+	assert.Equal(t, "get k1 k2", info.Query)
+	assert.Equal(t, 2, info.KeyCount)
+	assert.Equal(t, request.CacheHit, info.Outcome)
+	assert.False(t, info.Error)
+}
+
+func TestMemcachedBinaryMiss(t *testing.T) {
+	req := mcBinPacket(memcachedBinRequest, 0x00, 0, nil, []byte("missing"), nil)
+	resp := mcBinPacket(memcachedBinResponse, 0x00, memcachedStatusKeyNotFound, nil, nil, []byte("Not found"))
+	r := tcpExchange(req, resp, tcpSend, 46007, 11211)
+
+	info, ok := ProcessMemcachedEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, 1, info.KeyCount)
+	assert.Equal(t, request.CacheMiss, info.Outcome)
+	assert.False(t, info.Error)
+}
+
+func TestMemcachedBinaryError(t *testing.T) {
+	req := mcBinPacket(memcachedBinRequest, 0x05, 0, make([]byte, 20), []byte("hits"), nil)
+	// non-numeric value
+	resp := mcBinPacket(memcachedBinResponse, 0x05, 0x06, nil, nil, []byte("Incr on non-numeric value"))
+	r := tcpExchange(req, resp, tcpSend, 46008, 11211)
+
+	info, ok := ProcessMemcachedEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "incr", info.Operation)
+	assert.True(t, info.Error)
+}
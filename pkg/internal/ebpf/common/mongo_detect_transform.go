@@ -0,0 +1,420 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	trace2 "go.opentelemetry.io/otel/trace"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// https://www.mongodb.com/docs/manual/reference/mongodb-wire-protocol/
+const (
+	mongoHeaderLen     = 16
+	mongoMaxMessageLen = 48 * 1000 * 1000
+
+	mongoOpReply = 1
+	mongoOpQuery = 2004
+	mongoOpMsg   = 2013
+)
+
+// OP_MSG section kinds
+const (
+	mongoSectionBody     = 0
+	mongoSectionSequence = 1
+)
+
+// https://bsonspec.org/spec.html
+const (
+	bsonDouble     = 0x01
+	bsonString     = 0x02
+	bsonDocument   = 0x03
+	bsonArray      = 0x04
+	bsonBinary     = 0x05
+	bsonUndefined  = 0x06
+	bsonObjectID   = 0x07
+	bsonBoolean    = 0x08
+	bsonDateTime   = 0x09
+	bsonNull       = 0x0a
+	bsonRegex      = 0x0b
+	bsonDBPointer  = 0x0c
+	bsonJSCode     = 0x0d
+	bsonSymbol     = 0x0e
+	bsonCodeScope  = 0x0f
+	bsonInt32      = 0x10
+	bsonTimestamp  = 0x11
+	bsonInt64      = 0x12
+	bsonDecimal128 = 0x13
+	bsonMinKey     = 0xff
+	bsonMaxKey     = 0x7f
+)
+
+type mongoHeader struct {
+	MessageLength int32
+	RequestID     int32
+	ResponseTo    int32
+	OpCode        int32
+}
+
+type MongoInfo struct {
+	Command    string
+	Collection string
+	Database   string
+	Error      *request.DBError
+}
+
+func parseMongoHeader(buf []byte) (mongoHeader, bool) {
+	if len(buf) < mongoHeaderLen {
+		return mongoHeader{}, false
+	}
+	h := mongoHeader{
+		MessageLength: int32(binary.LittleEndian.Uint32(buf[0:4])),
+		RequestID:     int32(binary.LittleEndian.Uint32(buf[4:8])),
+		ResponseTo:    int32(binary.LittleEndian.Uint32(buf[8:12])),
+		OpCode:        int32(binary.LittleEndian.Uint32(buf[12:16])),
+	}
+	if h.MessageLength <= mongoHeaderLen || h.MessageLength > mongoMaxMessageLen {
+		return h, false
+	}
+	return h, true
+}
+
+func isMongoRequest(buf []byte) (mongoHeader, bool) {
+	h, ok := parseMongoHeader(buf)
+	if !ok || h.ResponseTo != 0 {
+		return h, false
+	}
+	return h, h.OpCode == mongoOpMsg || h.OpCode == mongoOpQuery
+}
+
+func isMongoResponse(buf []byte, requestID int32) (mongoHeader, bool) {
+	h, ok := parseMongoHeader(buf)
+	if !ok || h.ResponseTo != requestID {
+		return h, false
+	}
+	return h, h.OpCode == mongoOpMsg || h.OpCode == mongoOpReply
+}
+
+// ProcessPossibleMongoEvent returns error if the request/response buffers are not a valid MongoDB
+// command/reply pair. Otherwise, it returns the decoded command information.
+func ProcessPossibleMongoEvent(event *TCPRequestInfo, req, resp []byte) (*MongoInfo, error) {
+	reversed := false
+	reqHeader, ok := isMongoRequest(req)
+	if !ok {
+		// we might have caught the event reversed in the middle of communication
+		if reqHeader, ok = isMongoRequest(resp); !ok {
+			return nil, errors.New("not a MongoDB request")
+		}
+		reversed = true
+		req, resp = resp, req
+	}
+	respHeader, ok := isMongoResponse(resp, reqHeader.RequestID)
+	if !ok {
+		return nil, errors.New("not a MongoDB response")
+	}
+
+	info, err := parseMongoRequest(reqHeader, req[mongoHeaderLen:])
+	if err != nil {
+		return nil, err
+	}
+	info.Error = parseMongoReply(respHeader, resp[mongoHeaderLen:])
+
+	if reversed {
+		reverseTCPEvent(event)
+	}
+	return info, nil
+}
+
+func parseMongoRequest(h mongoHeader, body []byte) (*MongoInfo, error) {
+	var doc []byte
+	database := ""
+	switch h.OpCode {
+	case mongoOpMsg:
+		doc = mongoMsgBody(body)
+	case mongoOpQuery:
+		// flags, fullCollectionName, numberToSkip, numberToReturn, query
+		if len(body) < 4 {
+			return nil, errors.New("OP_QUERY too short")
+		}
+		body = body[4:]
+		end := bytes.IndexByte(body, 0)
+		if end < 0 {
+			return nil, errors.New("OP_QUERY collection name not terminated")
+		}
+		// commands are sent to the <db>.$cmd collection
+		database, _, _ = strings.Cut(string(body[:end]), ".")
+		if len(body) < end+1+8 {
+			return nil, errors.New("OP_QUERY too short")
+		}
+		doc = body[end+1+8:]
+	}
+	if doc == nil {
+		return nil, errors.New("MongoDB command document not found")
+	}
+
+	info := &MongoInfo{Database: database}
+	first := true
+	err := bsonElements(doc, func(t byte, name string, value []byte) bool {
+		if first {
+			// the first element of the command document is the command name, and
+			// for collection commands its value is the collection name
+			first = false
+			info.Command = name
+			if t == bsonString {
+				info.Collection = bsonStringValue(value)
+			}
+		} else if name == "$db" && t == bsonString {
+			info.Database = bsonStringValue(value)
+		}
+		return true
+	})
+	if info.Command == "" {
+		if err == nil {
+			err = errors.New("empty MongoDB command")
+		}
+		return nil, err
+	}
+	if !isValidMongoName(info.Command) || !isValidMongoName(info.Collection) {
+		return nil, errors.New("invalid MongoDB command")
+	}
+	return info, nil
+}
+
+// mongoMsgBody returns the body document (kind 0 section) of an OP_MSG message
+func mongoMsgBody(body []byte) []byte {
+	if len(body) < 5 {
+		return nil
+	}
+	// skip flagBits
+	body = body[4:]
+	for len(body) > 0 {
+		kind := body[0]
+		body = body[1:]
+		switch kind {
+		case mongoSectionBody:
+			return body
+		case mongoSectionSequence:
+			// int32 size, identifier and sequence of documents
+			if len(body) < 4 {
+				return nil
+			}
+			size := int(binary.LittleEndian.Uint32(body))
+			if size < 4 || size > len(body) {
+				return nil
+			}
+			body = body[size:]
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseMongoReply returns the error information of the reply, if the command was not successful
+func parseMongoReply(h mongoHeader, body []byte) *request.DBError {
+	var doc []byte
+	switch h.OpCode {
+	case mongoOpMsg:
+		doc = mongoMsgBody(body)
+	case mongoOpReply:
+		// responseFlags, cursorID, startingFrom, numberReturned, documents
+		if len(body) > 20 {
+			doc = body[20:]
+		}
+	}
+	if doc == nil {
+		return nil
+	}
+
+	ok := true
+	dbErr := request.DBError{}
+	// the reply might be truncated, so if the "ok" field isn't found we assume it's successful
+	_ = bsonElements(doc, func(t byte, name string, value []byte) bool {
+		switch name {
+		case "ok":
+			ok = bsonNumberValue(t, value) == 1
+		case "code":
+			if t == bsonInt32 || t == bsonInt64 || t == bsonDouble {
+				dbErr.ErrorCode = strconv.Itoa(int(bsonNumberValue(t, value)))
+			}
+		case "errmsg":
+			if t == bsonString {
+				dbErr.Description = bsonStringValue(value)
+			}
+		}
+		return true
+	})
+	if ok {
+		return nil
+	}
+	return &dbErr
+}
+
+// bsonElements iterates the elements of a BSON document. The document can be truncated,
+// so the value of the last element might be incomplete.
+// nolint:cyclop
+func bsonElements(doc []byte, onElement func(t byte, name string, value []byte) bool) error {
+	if len(doc) < 5 {
+		return errors.New("BSON document too short")
+	}
+	size := int(int32(binary.LittleEndian.Uint32(doc)))
+	if size < 5 || size > mongoMaxMessageLen {
+		return errors.New("invalid BSON document size")
+	}
+	if size < len(doc) {
+		doc = doc[:size]
+	}
+	doc = doc[4:]
+	for len(doc) > 0 {
+		t := doc[0]
+		if t == 0 {
+			return nil
+		}
+		end := bytes.IndexByte(doc[1:], 0)
+		if end < 0 {
+			return errors.New("truncated BSON element name")
+		}
+		name := string(doc[1 : end+1])
+		doc = doc[end+2:]
+
+		var valueLen int
+		switch t {
+		case bsonDouble, bsonDateTime, bsonTimestamp, bsonInt64:
+			valueLen = 8
+		case bsonString, bsonJSCode, bsonSymbol:
+			valueLen = 4 + bsonInt32Value(doc)
+		case bsonDocument, bsonArray, bsonCodeScope:
+			valueLen = bsonInt32Value(doc)
+		case bsonBinary:
+			valueLen = 5 + bsonInt32Value(doc)
+		case bsonObjectID:
+			valueLen = 12
+		case bsonBoolean:
+			valueLen = 1
+		case bsonInt32:
+			valueLen = 4
+		case bsonDecimal128:
+			valueLen = 16
+		case bsonDBPointer:
+			valueLen = 4 + bsonInt32Value(doc) + 12
+		case bsonRegex:
+			valueLen = cstringsLen(doc, 2)
+		case bsonUndefined, bsonNull, bsonMinKey, bsonMaxKey:
+			valueLen = 0
+		default:
+			return errors.New("unknown BSON type")
+		}
+		if valueLen < 0 {
+			return errors.New("invalid BSON value length")
+		}
+		truncated := valueLen > len(doc)
+		if truncated {
+			valueLen = len(doc)
+		}
+		if !onElement(t, name, doc[:valueLen]) || truncated {
+			return nil
+		}
+		doc = doc[valueLen:]
+	}
+	return nil
+}
+
+func bsonInt32Value(value []byte) int {
+	if len(value) < 4 {
+		return len(value)
+	}
+	return int(int32(binary.LittleEndian.Uint32(value)))
+}
+
+func bsonStringValue(value []byte) string {
+	if len(value) < 4 {
+		return ""
+	}
+	return cstr(value[4:])
+}
+
+func bsonNumberValue(t byte, value []byte) float64 {
+	switch {
+	case t == bsonInt32 && len(value) >= 4:
+		return float64(int32(binary.LittleEndian.Uint32(value)))
+	case t == bsonInt64 && len(value) >= 8:
+		return float64(int64(binary.LittleEndian.Uint64(value)))
+	case t == bsonDouble && len(value) >= 8:
+		return math.Float64frombits(binary.LittleEndian.Uint64(value))
+	case t == bsonBoolean && len(value) >= 1:
+		return float64(value[0])
+	}
+	return math.NaN()
+}
+
+// cstringsLen returns the length of n consecutive zero-terminated strings, or -1
+func cstringsLen(buf []byte, n int) int {
+	l := 0
+	for i := 0; i < n; i++ {
+		end := bytes.IndexByte(buf[l:], 0)
+		if end < 0 {
+			return -1
+		}
+		l += end + 1
+	}
+	return l
+}
+
+func isValidMongoName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < ' ' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func TCPToMongoToSpan(trace *TCPRequestInfo, data *MongoInfo) request.Span {
+	peer := ""
+	hostname := ""
+	hostPort := 0
+
+	if trace.ConnInfo.S_port != 0 || trace.ConnInfo.D_port != 0 {
+		peer, hostname = (*BPFConnInfo)(unsafe.Pointer(&trace.ConnInfo)).reqHostInfo()
+		hostPort = int(trace.ConnInfo.D_port)
+	}
+
+	status := 0
+	dbError := request.DBError{}
+	if data.Error != nil {
+		status = 1
+		dbError = *data.Error
+	}
+
+	return request.Span{
+		Type:          request.EventTypeMongoClient,
+		Method:        data.Command,
+		Path:          data.Collection,
+		Peer:          peer,
+		PeerPort:      int(trace.ConnInfo.S_port),
+		Host:          hostname,
+		HostPort:      hostPort,
+		ContentLength: 0,
+		RequestStart:  int64(trace.StartMonotimeNs),
+		Start:         int64(trace.StartMonotimeNs),
+		End:           int64(trace.EndMonotimeNs),
+		Status:        status,
+		TraceID:       trace2.TraceID(trace.Tp.TraceId),
+		SpanID:        trace2.SpanID(trace.Tp.SpanId),
+		ParentSpanID:  trace2.SpanID(trace.Tp.ParentId),
+		Flags:         trace.Tp.Flags,
+		Pid: request.PidInfo{
+			HostPID:   trace.Pid.HostPid,
+			UserPID:   trace.Pid.UserPid,
+			Namespace: trace.Pid.Ns,
+		},
+		DBError:     dbError,
+		DBNamespace: data.Database,
+	}
+}
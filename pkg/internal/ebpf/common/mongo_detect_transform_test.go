@@ -0,0 +1,166 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func bsonElem(t byte, name string, value []byte) []byte {
+	return bytes.Join([][]byte{{t}, []byte(name), {0}, value}, nil)
+}
+
+func bsonStr(name, value string) []byte {
+	v := make([]byte, 4, 4+len(value)+1)
+	binary.LittleEndian.PutUint32(v, uint32(len(value)+1))
+	return bsonElem(bsonString, name, append(append(v, value...), 0))
+}
+
+func bsonInt(name string, value int32) []byte {
+	v := make([]byte, 4)
+	binary.LittleEndian.PutUint32(v, uint32(value))
+	return bsonElem(bsonInt32, name, v)
+}
+
+func bsonFloat(name string, value float64) []byte {
+	v := make([]byte, 8)
+	binary.LittleEndian.PutUint64(v, math.Float64bits(value))
+	return bsonElem(bsonDouble, name, v)
+}
+
+func bsonDoc(elems ...[]byte) []byte {
+	body := bytes.Join(elems, nil)
+	doc := make([]byte, 4, 4+len(body)+1)
+	binary.LittleEndian.PutUint32(doc, uint32(len(body)+5))
+	return append(append(doc, body...), 0)
+}
+
+func mongoMessage(requestID, responseTo, opCode int32, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	msg := make([]byte, mongoHeaderLen)
+	binary.LittleEndian.PutUint32(msg[0:], uint32(len(b)+mongoHeaderLen))
+	binary.LittleEndian.PutUint32(msg[4:], uint32(requestID))
+	binary.LittleEndian.PutUint32(msg[8:], uint32(responseTo))
+	binary.LittleEndian.PutUint32(msg[12:], uint32(opCode))
+	return append(msg, b...)
+}
+
+func mongoOpMsgBody(doc []byte) []byte {
+	return bytes.Join([][]byte{{0, 0, 0, 0, mongoSectionBody}, doc}, nil)
+}
+
+func TestMongoOpMsg(t *testing.T) {
+	req := mongoMessage(7, 0, mongoOpMsg, mongoOpMsgBody(bsonDoc(
+		bsonStr("find", "orders"),
+		bsonElem(bsonDocument, "filter", bsonDoc()),
+		bsonStr("$db", "shop"),
+	)))
+	resp := mongoMessage(100, 7, mongoOpMsg, mongoOpMsgBody(bsonDoc(
+		bsonElem(bsonDocument, "cursor", bsonDoc(bsonStr("ns", "shop.orders"))),
+		bsonFloat("ok", 1),
+	)))
+	r := tcpExchange(req, resp, tcpSend, 53001, 27017)
+
+	info, err := ProcessPossibleMongoEvent(&r, req, resp)
+	require.NoError(t, err)
+	assert.Equal(t, "find", info.Command)
+	assert.Equal(t, "orders", info.Collection)
+	assert.Equal(t, "shop", info.Database)
+	assert.Nil(t, info.Error)
+
+	s := TCPToMongoToSpan(&r, info)
+	assert.Equal(t, request.EventTypeMongoClient, s.Type)
+	assert.Equal(t, "find", s.Method)
+	assert.Equal(t, "orders", s.Path)
+	assert.Equal(t, "shop", s.DBNamespace)
+	assert.Equal(t, 27017, s.HostPort)
+	assert.Equal(t, 0, s.Status)
+}
+
+func TestMongoOpMsgDocumentSequence(t *testing.T) {
+	// insert commands send the documents in a kind 1 section before the body
+	docs := bsonDoc(bsonInt("_id", 1))
+	seq := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seq, uint32(4+len("documents")+1+len(docs)))
+	seq = bytes.Join([][]byte{seq, []byte("documents"), {0}, docs}, nil)
+
+	req := mongoMessage(8, 0, mongoOpMsg, []byte{0, 0, 0, 0, mongoSectionSequence}, seq,
+		[]byte{mongoSectionBody}, bsonDoc(bsonStr("insert", "users"), bsonStr("$db", "app")))
+	resp := mongoMessage(101, 8, mongoOpMsg, mongoOpMsgBody(bsonDoc(bsonInt("n", 1), bsonFloat("ok", 1))))
+	r := tcpExchange(req, resp, tcpSend, 53002, 27017)
+
+	info, err := ProcessPossibleMongoEvent(&r, req, resp)
+	require.NoError(t, err)
+	assert.Equal(t, "insert", info.Command)
+	assert.Equal(t, "users", info.Collection)
+	assert.Equal(t, "app", info.Database)
+}
+
+func TestMongoError(t *testing.T) {
+	req := mongoMessage(9, 0, mongoOpMsg, mongoOpMsgBody(bsonDoc(
+		bsonStr("aggregate", "orders"),
+		bsonStr("$db", "shop"),
+	)))
+	resp := mongoMessage(102, 9, mongoOpMsg, mongoOpMsgBody(bsonDoc(
+		bsonFloat("ok", 0),
+		bsonStr("errmsg", "Unrecognized pipeline stage name: '$foo'"),
+		bsonInt("code", 40324),
+		bsonStr("codeName", "Location40324"),
+	)))
+	r := tcpExchange(req, resp, tcpSend, 53003, 27017)
+
+	info, err := ProcessPossibleMongoEvent(&r, req, resp)
+	require.NoError(t, err)
+	require.NotNil(t, info.Error)
+	assert.Equal(t, "40324", info.Error.ErrorCode)
+	assert.Equal(t, "Unrecognized pipeline stage name: '$foo'", info.Error.Description)
+
+	s := TCPToMongoToSpan(&r, info)
+	assert.Equal(t, 1, s.Status)
+	assert.Equal(t, "40324", s.DBError.ErrorCode)
+}
+
+func TestMongoOpQuery(t *testing.T) {
+	req := mongoMessage(10, 0, mongoOpQuery,
+		[]byte{0, 0, 0, 0}, []byte("admin.$cmd\x00"), []byte{0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff},
+		bsonDoc(bsonInt("isMaster", 1)))
+	resp := mongoMessage(103, 10, mongoOpReply, make([]byte, 20), bsonDoc(bsonElem(bsonBoolean, "ismaster", []byte{1}), bsonFloat("ok", 1)))
+	r := tcpExchange(req, resp, tcpSend, 53004, 27017)
+
+	info, err := ProcessPossibleMongoEvent(&r, req, resp)
+	require.NoError(t, err)
+	assert.Equal(t, "isMaster", info.Command)
+	assert.Empty(t, info.Collection)
+	assert.Equal(t, "admin", info.Database)
+	assert.Nil(t, info.Error)
+}
+
+func TestMongoTruncatedResponse(t *testing.T) {
+	req := mongoMessage(11, 0, mongoOpMsg, mongoOpMsgBody(bsonDoc(
+		bsonStr("find", "products"),
+		bsonStr("$db", "shop"),
+	)))
+	// the "ok" field is missing from the truncated response, so we assume it succeeded
+	resp := mongoMessage(104, 11, mongoOpMsg, mongoOpMsgBody(bsonDoc(
+		bsonElem(bsonDocument, "cursor", bsonDoc(bsonStr("ns", "shop.products"), bsonStr("big", string(make([]byte, 300))))),
+		bsonFloat("ok", 0),
+	)))
+	r := tcpExchange(req, resp, tcpSend, 53005, 27017)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeMongoClient, span.Type)
+	assert.Equal(t, "find", span.Method)
+	assert.Equal(t, "products", span.Path)
+	assert.Equal(t, "shop", span.DBNamespace)
+	assert.Equal(t, 0, span.Status)
+}
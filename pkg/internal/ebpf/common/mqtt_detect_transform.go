@@ -0,0 +1,306 @@
+package ebpfcommon
+
+import (
+	"encoding/binary"
+	"strings"
+	"unicode/utf8"
+	"unsafe"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	trace2 "go.opentelemetry.io/otel/trace"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// https://docs.oasis-open.org/mqtt/mqtt/v3.1.1/mqtt-v3.1.1.html
+// https://docs.oasis-open.org/mqtt/mqtt/v5.0/mqtt-v5.0.html
+const (
+	mqttMaxRemainingLen = 268_435_455
+	mqttVersion5        = 5
+	mqttReasonFailure   = 0x80
+)
+
+// control packet types
+const (
+	mqttConnect     = 1
+	mqttConnAck     = 2
+	mqttPublish     = 3
+	mqttPubAck      = 4
+	mqttPubRec      = 5
+	mqttPubRel      = 6
+	mqttPubComp     = 7
+	mqttSubscribe   = 8
+	mqttSubAck      = 9
+	mqttUnsubscribe = 10
+	mqttUnsubAck    = 11
+	mqttPingReq     = 12
+	mqttPingResp    = 13
+	mqttDisconnect  = 14
+	mqttAuth        = 15
+)
+
+// well-known broker ports, used to guess the role of the traced process when
+// the CONNECT packet of the connection wasn't captured
+var mqttPorts = map[uint16]struct{}{1883: {}, 8883: {}}
+
+type mqttConnection struct {
+	client  bool
+	version byte
+}
+
+// the CONNECT packet tells us which side is the client, and the protocol version.
+// Connections are stored with the remote peer as the destination.
+var mqttConnections, _ = lru.New[BPFConnInfo, mqttConnection](1024)
+
+type MQTTInfo struct {
+	Operation string
+	Topic     string
+	Error     bool
+}
+
+// mqttRemainingLength decodes the variable byte integer of the fixed header, returning
+// the value and the number of bytes used to encode it. Zero read bytes means that the
+// value is invalid.
+func mqttRemainingLength(buf []byte) (int, int) {
+	value, mult := 0, 1
+	for i := 0; i < 4 && i < len(buf); i++ {
+		value += int(buf[i]&0x7f) * mult
+		if buf[i]&0x80 == 0 {
+			return value, i + 1
+		}
+		mult *= 128
+	}
+	return 0, 0
+}
+
+func mqttValidFlags(t, flags byte) bool {
+	switch t {
+	case mqttPublish:
+		// QoS 3 is malformed
+		return flags&0x06 != 0x06
+	case mqttPubRel, mqttSubscribe, mqttUnsubscribe:
+		return flags == 0x02
+	}
+	return flags == 0
+}
+
+// mqttPackets iterates the control packets of the buffer. It returns false if the buffer
+// doesn't look like a sequence of MQTT packets. As a binary protocol with a single-byte
+// header, the packet sizes must match the buffer, unless it's been truncated (its total
+// length, bufLen, is larger than the buffer).
+func mqttPackets(buf []byte, bufLen int, onPacket func(t, flags byte, body []byte)) bool {
+	if len(buf) < 2 {
+		return false
+	}
+	for len(buf) > 0 {
+		t, flags := buf[0]>>4, buf[0]&0x0f
+		if t < mqttConnect || t > mqttAuth || !mqttValidFlags(t, flags) {
+			return false
+		}
+		size, n := mqttRemainingLength(buf[1:])
+		if n == 0 {
+			return bufLen > len(buf) && len(buf) < 5
+		}
+		if size > mqttMaxRemainingLen {
+			return false
+		}
+		end := 1 + n + size
+		if end > len(buf) && bufLen <= len(buf) {
+			return false
+		}
+		if onPacket != nil {
+			onPacket(t, flags, buf[1+n:min(end, len(buf))])
+		}
+		if end >= len(buf) {
+			break
+		}
+		buf = buf[end:]
+	}
+	return true
+}
+
+// mqttConnectVersion returns the protocol level of a CONNECT packet, or zero if it isn't valid
+func mqttConnectVersion(body []byte) byte {
+	if len(body) < 7 {
+		return 0
+	}
+	nameLen := int(binary.BigEndian.Uint16(body))
+	if 2+nameLen >= len(body) {
+		return 0
+	}
+	name := string(body[2 : 2+nameLen])
+	level := body[2+nameLen]
+	if (name == "MQTT" && (level == 4 || level == mqttVersion5)) || (name == "MQIsdp" && level == 3) {
+		return level
+	}
+	return 0
+}
+
+// mqttTopic returns the topic name of a PUBLISH packet, which is not allowed to contain wildcards
+func mqttTopic(body []byte) (string, bool) {
+	if len(body) < 2 {
+		return "", false
+	}
+	l := int(binary.BigEndian.Uint16(body))
+	if l == 0 || 2+l > len(body) {
+		// empty topics are only allowed in MQTT 5 with a topic alias, which we can't resolve
+		return "", false
+	}
+	topic := string(body[2 : 2+l])
+	if !utf8.ValidString(topic) || strings.ContainsAny(topic, "+#\x00") {
+		return "", false
+	}
+	return topic, true
+}
+
+// mqttAckFailed returns true if the reason code of a PUBACK (MQTT 5) or the first
+// return code of a SUBACK reports a failure
+func mqttAckFailed(t byte, body []byte, version byte) bool {
+	switch t {
+	case mqttPubAck:
+		// packet identifier, and the reason code if the remaining length is bigger than 2
+		return len(body) > 2 && body[2] >= mqttReasonFailure
+	case mqttSubAck:
+		ptr := 2
+		if version == mqttVersion5 {
+			props, n := mqttRemainingLength(body[min(ptr, len(body)):])
+			ptr += n + props
+		}
+		return ptr < len(body) && body[ptr] >= mqttReasonFailure
+	}
+	return false
+}
+
+// mqttConnKey returns the connection info with the remote peer as the destination
+func mqttConnKey(event *TCPRequestInfo) BPFConnInfo {
+	conn := BPFConnInfo(event.ConnInfo)
+	// the connection info is oriented with the destination as the remote peer when
+	// the first buffer of the event was sent by the traced process
+	if event.Direction != 1 {
+		reverseConnInfo(&conn)
+	}
+	return conn
+}
+
+// ProcessMQTTEvent decodes the MQTT 3.1.1 and 5 control packets, looking for the messages
+// published by a client (PUBLISH sent) or delivered to it (PUBLISH received). It returns false
+// if the buffers don't belong to an MQTT conversation. A nil MQTTInfo means that there aren't
+// messages to report (e.g. it's a SUBSCRIBE or a PING) or that the traced process is the broker.
+// nolint:cyclop
+func ProcessMQTTEvent(event *TCPRequestInfo, req, resp []byte) (*MQTTInfo, bool) {
+	if !mqttPackets(req, int(event.Len), nil) || (len(resp) > 0 && !mqttPackets(resp, int(event.RespLen), nil)) {
+		return nil, false
+	}
+
+	key := mqttConnKey(event)
+	// the request was sent by the traced process if its direction is TCP_SEND
+	reqSent := event.Direction == 1
+	conn, known := mqttConnections.Get(key)
+
+	var info *MQTTInfo
+	var infoSent, valid bool
+	for _, b := range []struct {
+		buf    []byte
+		bufLen int
+		sent   bool
+	}{{req, int(event.Len), reqSent}, {resp, int(event.RespLen), !reqSent}} {
+		mqttPackets(b.buf, b.bufLen, func(t, _ byte, body []byte) {
+			switch t {
+			case mqttConnect:
+				if version := mqttConnectVersion(body); version != 0 {
+					conn, known, valid = mqttConnection{client: b.sent, version: version}, true, true
+					mqttConnections.Add(key, conn)
+				}
+			case mqttPublish:
+				topic, ok := mqttTopic(body)
+				if !ok {
+					return
+				}
+				valid = true
+				if info == nil {
+					info = &MQTTInfo{Operation: request.MessagingProcess, Topic: topic}
+					if b.sent {
+						info.Operation = request.MessagingPublish
+					}
+					infoSent = b.sent
+				}
+			case mqttPubAck, mqttSubAck:
+				valid = valid || len(body) >= 3 || (t == mqttPubAck && len(body) == 2)
+				if info != nil && info.Operation == request.MessagingPublish && b.sent != infoSent &&
+					mqttAckFailed(t, body, conn.version) {
+					info.Error = true
+				}
+			case mqttSubscribe:
+				// packet identifier, topic filter length and subscription options
+				valid = valid || len(body) >= 5
+			case mqttConnAck:
+				// the first byte only contains the session present flag
+				valid = valid || (len(body) >= 2 && body[0] <= 1)
+			}
+		})
+	}
+	if !valid {
+		// packets like PINGREQ or DISCONNECT are too short to tell that it's MQTT
+		return nil, false
+	}
+	if info == nil {
+		return nil, true
+	}
+
+	client := true
+	if known {
+		client = conn.client
+	} else if _, ok := mqttPorts[key.S_port]; ok {
+		// the broker port is the local one
+		client = false
+	}
+	if !client {
+		return nil, true
+	}
+	// the connection info is oriented according to the direction of the first buffer
+	// of the event: make sure the broker is the server side of the span
+	if !reqSent {
+		reverseTCPEvent(event)
+	}
+	return info, true
+}
+
+func TCPToMQTTToSpan(trace *TCPRequestInfo, data *MQTTInfo) request.Span {
+	peer := ""
+	hostname := ""
+	hostPort := 0
+
+	if trace.ConnInfo.S_port != 0 || trace.ConnInfo.D_port != 0 {
+		peer, hostname = (*BPFConnInfo)(unsafe.Pointer(&trace.ConnInfo)).reqHostInfo()
+		hostPort = int(trace.ConnInfo.D_port)
+	}
+
+	status := 0
+	if data.Error {
+		status = 1
+	}
+
+	return request.Span{
+		Type:          request.EventTypeMQTTClient,
+		Method:        data.Operation,
+		Path:          data.Topic,
+		Peer:          peer,
+		PeerPort:      int(trace.ConnInfo.S_port),
+		Host:          hostname,
+		HostPort:      hostPort,
+		ContentLength: 0,
+		RequestStart:  int64(trace.StartMonotimeNs),
+		Start:         int64(trace.StartMonotimeNs),
+		End:           int64(trace.EndMonotimeNs),
+		Status:        status,
+		TraceID:       trace2.TraceID(trace.Tp.TraceId),
+		SpanID:        trace2.SpanID(trace.Tp.SpanId),
+		ParentSpanID:  trace2.SpanID(trace.Tp.ParentId),
+		Flags:         trace.Tp.Flags,
+		Pid: request.PidInfo{
+			HostPID:   trace.Pid.HostPid,
+			UserPID:   trace.Pid.UserPid,
+			Namespace: trace.Pid.Ns,
+		},
+	}
+}
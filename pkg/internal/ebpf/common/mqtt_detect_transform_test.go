@@ -0,0 +1,125 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func mqttPacket(t, flags byte, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	p := []byte{t<<4 | flags}
+	l := len(b)
+	for {
+		d := byte(l % 128)
+		l /= 128
+		if l > 0 {
+			d |= 0x80
+		}
+		p = append(p, d)
+		if l == 0 {
+			break
+		}
+	}
+	return append(p, b...)
+}
+
+func mqttStr(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+func mqttConnectPacket(version byte) []byte {
+	return mqttPacket(mqttConnect, 0, mqttStr("MQTT"), []byte{version, 0x02, 0, 60}, mqttStr("sensor-1"))
+}
+
+func TestMQTTPublish(t *testing.T) {
+	// QoS 1 publish, acknowledged by the broker
+	req := mqttPacket(mqttPublish, 0x02, mqttStr("sensors/kitchen/temp"), []byte{0, 1}, []byte("21.5"))
+	resp := mqttPacket(mqttPubAck, 0, []byte{0, 1})
+	r := tcpExchange(req, resp, tcpSend, 49001, 1883)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeMQTTClient, span.Type)
+	assert.Equal(t, request.MessagingPublish, span.Method)
+	assert.Equal(t, "sensors/kitchen/temp", span.Path)
+	assert.Equal(t, 0, span.Status)
+	assert.Equal(t, 1883, span.HostPort)
+	assert.Equal(t, 49001, span.PeerPort)
+}
+
+func TestMQTT5PublishRejected(t *testing.T) {
+	// properties length after the packet identifier
+	req := mqttPacket(mqttPublish, 0x02, mqttStr("alerts"), []byte{0, 7}, []byte{0}, []byte("on"))
+	// 0x87: not authorized
+	resp := mqttPacket(mqttPubAck, 0, []byte{0, 7, 0x87, 0})
+	r := tcpExchange(req, resp, tcpSend, 49002, 1883)
+
+	info, ok := ProcessMQTTEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "alerts", info.Topic)
+	assert.True(t, info.Error)
+}
+
+func TestMQTTProcess(t *testing.T) {
+	// the connection was established in a previous event, on a non-standard port
+	connect := mqttConnectPacket(4)
+	connAck := mqttPacket(mqttConnAck, 0, []byte{0, 0})
+	r := tcpExchange(connect, connAck, tcpSend, 49003, 2883)
+	info, ok := ProcessMQTTEvent(&r, connect, connAck)
+	require.True(t, ok)
+	assert.Nil(t, info)
+
+	// the broker delivers a message to the client
+	req := mqttPacket(mqttPublish, 0, mqttStr("commands/sensor-1"), []byte("reboot"))
+	r = tcpExchange(req, nil, tcpRecv, 2883, 49003)
+	info, ok = ProcessMQTTEvent(&r, req, nil)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, request.MessagingProcess, info.Operation)
+	assert.Equal(t, "commands/sensor-1", info.Topic)
+	// the broker is the destination of the span
+	assert.Equal(t, uint16(49003), r.ConnInfo.S_port)
+	assert.Equal(t, uint16(2883), r.ConnInfo.D_port)
+}
+
+func TestMQTTSubscribe(t *testing.T) {
+	req := mqttPacket(mqttSubscribe, 0x02, []byte{0, 2}, mqttStr("sensors/#"), []byte{1})
+	resp := mqttPacket(mqttSubAck, 0, []byte{0, 2, 1})
+	r := tcpExchange(req, resp, tcpSend, 49004, 1883)
+
+	info, ok := ProcessMQTTEvent(&r, req, resp)
+	assert.True(t, ok)
+	assert.Nil(t, info)
+}
+
+func TestMQTTBrokerSide(t *testing.T) {
+	// the broker receives the CONNECT packet
+	connect := mqttConnectPacket(5)
+	connAck := mqttPacket(mqttConnAck, 0, []byte{0, 0, 0})
+	r := tcpExchange(connect, connAck, tcpRecv, 49005, 9883)
+	info, ok := ProcessMQTTEvent(&r, connect, connAck)
+	require.True(t, ok)
+	assert.Nil(t, info)
+
+	req := mqttPacket(mqttPublish, 0, mqttStr("sensors/door"), []byte("open"))
+	r = tcpExchange(req, nil, tcpRecv, 49005, 9883)
+	info, ok = ProcessMQTTEvent(&r, req, nil)
+	assert.True(t, ok)
+	assert.Nil(t, info)
+
+	// without a known connection, the well-known port tells that the traced process is the broker
+	r = tcpExchange(req, nil, tcpRecv, 49006, 1883)
+	info, ok = ProcessMQTTEvent(&r, req, nil)
+	assert.True(t, ok)
+	assert.Nil(t, info)
+}
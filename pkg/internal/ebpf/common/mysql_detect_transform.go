@@ -0,0 +1,309 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/sqlprune"
+)
+
+// https://dev.mysql.com/doc/dev/mysql-server/latest/PAGE_PROTOCOL.html
+const (
+	mysqlHeaderLen    = 4 // int<3> payload length + int<1> sequence ID
+	mysqlMaxPacketLen = 0xffffff
+)
+
+// command packets
+const (
+	mysqlComQuit        = 0x01
+	mysqlComInitDB      = 0x02
+	mysqlComQuery       = 0x03
+	mysqlComPing        = 0x0e
+	mysqlComStmtPrepare = 0x16
+	mysqlComStmtExecute = 0x17
+	mysqlComStmtClose   = 0x19
+	mysqlComStmtReset   = 0x1a
+)
+
+// response packets
+const (
+	mysqlRespOK  = 0x00
+	mysqlRespERR = 0xff
+)
+
+// handshake
+const (
+	mysqlHandshakeV10           = 0x0a
+	mysqlClientConnectWithDB    = 0x00000008
+	mysqlClientSecureConnection = 0x00008000
+	mysqlClientPluginAuthLenenc = 0x00200000
+	mysqlHandshakeFixedLen      = 32 // capabilities + max packet + charset + filler
+)
+
+type mysqlStatementKey struct {
+	conn BPFConnInfo
+	id   uint32
+}
+
+// server-side prepared statements are only sent once (COM_STMT_PREPARE) and later executed by
+// the ID that the server returned, so we need to remember them per connection
+var mysqlStatements, _ = lru.New[mysqlStatementKey, string](1024 * 10)
+
+// the default schema is set in the handshake or by COM_INIT_DB
+var mysqlDatabases, _ = lru.New[BPFConnInfo, string](1024)
+
+func mysqlHeader(buf []byte) (int, uint8) {
+	return int(buf[0]) | int(buf[1])<<8 | int(buf[2])<<16, buf[3]
+}
+
+func isMySQLCommand(c byte) bool {
+	switch c {
+	case mysqlComQuit, mysqlComInitDB, mysqlComQuery, mysqlComPing,
+		mysqlComStmtPrepare, mysqlComStmtExecute, mysqlComStmtClose, mysqlComStmtReset:
+		return true
+	}
+	return false
+}
+
+// mysqlCommands iterates all the command packets in the request buffer, whose total
+// length is reqLen (the buffer might be truncated). It returns false if the buffer
+// doesn't look like a sequence of MySQL commands.
+func mysqlCommands(buf []byte, reqLen int, onCommand func(cmd byte, payload []byte)) bool {
+	if len(buf) <= mysqlHeaderLen {
+		return false
+	}
+	ptr := 0
+	for ; ptr+mysqlHeaderLen < len(buf); ptr += mysqlHeaderLen {
+		size, seq := mysqlHeader(buf[ptr:])
+		cmd := buf[ptr+mysqlHeaderLen]
+		if seq != 0 || size == 0 || size == mysqlMaxPacketLen || !isMySQLCommand(cmd) {
+			return false
+		}
+		end := ptr + mysqlHeaderLen + size
+		if end > len(buf) {
+			end = len(buf)
+		}
+		if onCommand != nil {
+			onCommand(cmd, buf[ptr+mysqlHeaderLen+1:end])
+		}
+		ptr += size
+	}
+	// unless the buffer is truncated, the packet sizes must match the request length
+	return ptr == len(buf) || reqLen > len(buf)
+}
+
+func isMySQLResponse(buf []byte) bool {
+	if len(buf) <= mysqlHeaderLen {
+		return false
+	}
+	size, seq := mysqlHeader(buf)
+	return seq > 0 && size > 0 && size < mysqlMaxPacketLen
+}
+
+func isMySQLHandshake(buf []byte) bool {
+	if len(buf) <= mysqlHeaderLen {
+		return false
+	}
+	size, seq := mysqlHeader(buf)
+	return seq == 0 && size > 0 && buf[mysqlHeaderLen] == mysqlHandshakeV10
+}
+
+// mysqlHandshakeDatabase returns the database name from the client HandshakeResponse41 packet, if any
+func mysqlHandshakeDatabase(buf []byte) string {
+	if len(buf) <= mysqlHeaderLen+mysqlHandshakeFixedLen {
+		return ""
+	}
+	if _, seq := mysqlHeader(buf); seq != 1 {
+		return ""
+	}
+	payload := buf[mysqlHeaderLen:]
+	caps := binary.LittleEndian.Uint32(payload)
+	if caps&mysqlClientConnectWithDB == 0 {
+		return ""
+	}
+	ptr := mysqlHandshakeFixedLen
+	// username
+	end := bytes.IndexByte(payload[ptr:], 0)
+	if end < 0 {
+		return ""
+	}
+	ptr += end + 1
+	if ptr >= len(payload) {
+		return ""
+	}
+	// auth response
+	switch {
+	case caps&mysqlClientPluginAuthLenenc != 0:
+		l, n := mysqlLenencInt(payload[ptr:])
+		if n == 0 {
+			return ""
+		}
+		ptr += n + l
+	case caps&mysqlClientSecureConnection != 0:
+		ptr += 1 + int(payload[ptr])
+	default:
+		end := bytes.IndexByte(payload[ptr:], 0)
+		if end < 0 {
+			return ""
+		}
+		ptr += end + 1
+	}
+	if ptr >= len(payload) {
+		return ""
+	}
+	return cstr(payload[ptr:])
+}
+
+// mysqlLenencInt decodes a length-encoded integer, returning the value and the number of
+// bytes used to encode it. Zero read bytes means that the value couldn't be decoded.
+func mysqlLenencInt(buf []byte) (int, int) {
+	if len(buf) == 0 {
+		return 0, 0
+	}
+	switch buf[0] {
+	case 0xfc:
+		if len(buf) < 3 {
+			return 0, 0
+		}
+		return int(binary.LittleEndian.Uint16(buf[1:])), 3
+	case 0xfd:
+		if len(buf) < 4 {
+			return 0, 0
+		}
+		return int(buf[1]) | int(buf[2])<<8 | int(buf[3])<<16, 4
+	case 0xfe, 0xff:
+		// 8-byte integers are too big for our purposes
+		return 0, 0
+	}
+	return int(buf[0]), 1
+}
+
+// ProcessMySQLEvent decodes the MySQL client commands of the request and the server
+// response. It returns false if the buffers don't belong to a MySQL conversation.
+// A nil SQLWireInfo means that the event doesn't need to be reported as a span
+// (e.g. it's a handshake or a ping).
+func ProcessMySQLEvent(event *TCPRequestInfo, req, resp []byte) (*SQLWireInfo, bool) {
+	conn := BPFConnInfo(event.ConnInfo)
+
+	if isMySQLHandshake(req) {
+		if db := mysqlHandshakeDatabase(resp); db != "" {
+			mysqlDatabases.Add(conn, db)
+			return nil, true
+		}
+		return nil, false
+	}
+
+	reqLen := int(event.Len)
+	if !mysqlCommands(req, reqLen, nil) || (len(resp) > 0 && !isMySQLResponse(resp)) {
+		// we might have caught the event reversed in the middle of communication
+		if !mysqlCommands(resp, int(event.RespLen), nil) || !isMySQLResponse(req) {
+			return nil, false
+		}
+		reverseTCPEvent(event)
+		conn = BPFConnInfo(event.ConnInfo)
+		req, resp = resp, req
+		reqLen = int(event.RespLen)
+	}
+
+	info := parseMySQLCommands(conn, req, reqLen, resp)
+	if info == nil {
+		return nil, true
+	}
+	info.Database, _ = mysqlDatabases.Get(conn)
+	info.Error = parseMySQLError(resp)
+
+	return info, true
+}
+
+// nolint:cyclop
+func parseMySQLCommands(conn BPFConnInfo, req []byte, reqLen int, resp []byte) *SQLWireInfo {
+	var info *SQLWireInfo
+	setStatement := func(op, stmt string) {
+		if info != nil {
+			return
+		}
+		sqlOp, table := sqlprune.SQLParseOperationAndTable(stmt)
+		if op == "" {
+			op = sqlOp
+		}
+		info = &SQLWireInfo{Kind: request.DBMySQL, Operation: op, Table: table, Statement: stmt}
+	}
+
+	mysqlCommands(req, reqLen, func(cmd byte, payload []byte) {
+		switch cmd {
+		case mysqlComQuery:
+			setStatement("", mysqlQueryText(payload))
+		case mysqlComStmtPrepare:
+			// the statement ID is returned in the COM_STMT_PREPARE_OK response
+			if id, ok := mysqlPrepareOK(resp); ok {
+				mysqlStatements.Add(mysqlStatementKey{conn: conn, id: id}, string(payload))
+			}
+			setStatement("PREPARE", string(payload))
+		case mysqlComStmtExecute:
+			if len(payload) < 4 {
+				return
+			}
+			stmt, _ := mysqlStatements.Get(mysqlStatementKey{conn: conn, id: binary.LittleEndian.Uint32(payload)})
+			if stmt == "" {
+				setStatement("EXECUTE", "")
+			} else {
+				setStatement("", stmt)
+			}
+		case mysqlComStmtClose:
+			if len(payload) >= 4 {
+				mysqlStatements.Remove(mysqlStatementKey{conn: conn, id: binary.LittleEndian.Uint32(payload)})
+			}
+		case mysqlComInitDB:
+			mysqlDatabases.Add(conn, string(payload))
+		case mysqlComQuit:
+			mysqlDatabases.Remove(conn)
+		}
+	})
+
+	return info
+}
+
+func mysqlPrepareOK(resp []byte) (uint32, bool) {
+	if len(resp) < mysqlHeaderLen+5 || resp[mysqlHeaderLen] != mysqlRespOK {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(resp[mysqlHeaderLen+1:]), true
+}
+
+// parseMySQLError decodes an ERR_Packet:
+// int<1> 0xFF, int<2> error code, string[1] '#', string[5] SQL state, string<EOF> message
+func parseMySQLError(resp []byte) *request.DBError {
+	if len(resp) < mysqlHeaderLen+3 || resp[mysqlHeaderLen] != mysqlRespERR {
+		return nil
+	}
+	size, _ := mysqlHeader(resp)
+	end := mysqlHeaderLen + size
+	if end > len(resp) {
+		end = len(resp)
+	}
+	payload := resp[mysqlHeaderLen+1 : end]
+	if len(payload) < 2 {
+		return nil
+	}
+	msg := payload[2:]
+	if len(msg) >= 6 && msg[0] == '#' {
+		msg = msg[6:]
+	}
+	return &request.DBError{
+		ErrorCode:   strconv.Itoa(int(binary.LittleEndian.Uint16(payload))),
+		Description: string(msg),
+	}
+}
+
+// mysqlQueryText returns the query of a COM_QUERY payload, skipping the empty
+// query attributes that are sent when the CLIENT_QUERY_ATTRIBUTES capability is enabled
+func mysqlQueryText(payload []byte) string {
+	if len(payload) >= 2 && payload[0] == 0 && payload[1] == 1 {
+		payload = payload[2:]
+	}
+	return string(payload)
+}
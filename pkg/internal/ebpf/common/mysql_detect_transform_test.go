@@ -0,0 +1,154 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func mysqlPacket(seq uint8, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	l := len(body)
+	return append([]byte{byte(l), byte(l >> 8), byte(l >> 16), seq}, body...)
+}
+
+func mysqlStmtID(id uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, id)
+	return b
+}
+
+var mysqlOKPacket = mysqlPacket(1, []byte{0, 0, 0, 2, 0, 0, 0})
+
+func TestMySQLQuery(t *testing.T) {
+	req := mysqlPacket(0, []byte{mysqlComQuery}, []byte("SELECT id, name FROM customers WHERE id = 4"))
+	resp := mysqlPacket(1, []byte{2})
+	r := tcpExchange(req, resp, tcpSend, 43001, 3306)
+
+	info, ok := ProcessMySQLEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, request.DBMySQL, info.Kind)
+	assert.Equal(t, "SELECT", info.Operation)
+	assert.Equal(t, "customers", info.Table)
+	assert.Equal(t, "SELECT id, name FROM customers WHERE id = 4", info.Statement)
+	assert.Nil(t, info.Error)
+
+	s := TCPToSQLWireToSpan(&r, info)
+	assert.Equal(t, request.EventTypeSQLClient, s.Type)
+	assert.Equal(t, request.DBMySQL, s.SQLKind)
+	assert.Equal(t, 0, s.Status)
+}
+
+func TestMySQLQueryWithAttributes(t *testing.T) {
+	req := mysqlPacket(0, []byte{mysqlComQuery, 0, 1}, []byte("DELETE FROM orders"))
+	r := tcpExchange(req, mysqlOKPacket, tcpSend, 43002, 3306)
+
+	info, ok := ProcessMySQLEvent(&r, req, mysqlOKPacket)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "DELETE", info.Operation)
+	assert.Equal(t, "orders", info.Table)
+	assert.Equal(t, "DELETE FROM orders", info.Statement)
+}
+
+func TestMySQLError(t *testing.T) {
+	req := mysqlPacket(0, []byte{mysqlComQuery}, []byte("SELECT * FROM nonexisting"))
+	resp := mysqlPacket(1, []byte{0xff, 0x7a, 0x04}, []byte("#42S02"), []byte("Table 'shop.nonexisting' doesn't exist"))
+	r := tcpExchange(req, resp, tcpSend, 43003, 3306)
+
+	info, ok := ProcessMySQLEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	require.NotNil(t, info.Error)
+	assert.Equal(t, "1146", info.Error.ErrorCode)
+	assert.Equal(t, "Table 'shop.nonexisting' doesn't exist", info.Error.Description)
+
+	s := TCPToSQLWireToSpan(&r, info)
+	assert.Equal(t, 1, s.Status)
+	assert.Equal(t, "1146", s.DBError.ErrorCode)
+}
+
+func TestMySQLPreparedStatements(t *testing.T) {
+	prepare := mysqlPacket(0, []byte{mysqlComStmtPrepare}, []byte("UPDATE products SET stock = ? WHERE id = ?"))
+	prepareOK := mysqlPacket(1, []byte{mysqlRespOK}, mysqlStmtID(7), []byte{0, 0, 2, 0, 0, 0, 0})
+	r := tcpExchange(prepare, prepareOK, tcpSend, 43004, 3306)
+
+	info, ok := ProcessMySQLEvent(&r, prepare, prepareOK)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "PREPARE", info.Operation)
+	assert.Equal(t, "products", info.Table)
+
+	execute := mysqlPacket(0, []byte{mysqlComStmtExecute}, mysqlStmtID(7), []byte{0, 1, 0, 0, 0})
+	r = tcpExchange(execute, mysqlOKPacket, tcpSend, 43004, 3306)
+	info, ok = ProcessMySQLEvent(&r, execute, mysqlOKPacket)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "UPDATE", info.Operation)
+	assert.Equal(t, "products", info.Table)
+	assert.Equal(t, "UPDATE products SET stock = ? WHERE id = ?", info.Statement)
+
+	// statements from other connections are unknown
+	r = tcpExchange(execute, mysqlOKPacket, tcpSend, 43005, 3306)
+	info, ok = ProcessMySQLEvent(&r, execute, mysqlOKPacket)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "EXECUTE", info.Operation)
+	assert.Empty(t, info.Table)
+
+	// closing the statement forgets it
+	closeStmt := mysqlPacket(0, []byte{mysqlComStmtClose}, mysqlStmtID(7))
+	req := append(closeStmt, execute...)
+	r = tcpExchange(req, mysqlOKPacket, tcpSend, 43004, 3306)
+	info, ok = ProcessMySQLEvent(&r, req, mysqlOKPacket)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "EXECUTE", info.Operation)
+}
+
+func TestMySQLHandshakeDatabase(t *testing.T) {
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+
+	greeting := mysqlPacket(0, []byte{mysqlHandshakeV10}, []byte("8.0.36\x00"), make([]byte, 40))
+	caps := make([]byte, mysqlHandshakeFixedLen)
+	binary.LittleEndian.PutUint32(caps, mysqlClientConnectWithDB|mysqlClientSecureConnection)
+	handshake := mysqlPacket(1, caps, []byte("root\x00"), []byte{4, 1, 2, 3, 4}, []byte("shop\x00"),
+		[]byte("mysql_native_password\x00"))
+
+	r := tcpExchange(greeting, handshake, tcpSend, 43006, 3306)
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	assert.True(t, ignore)
+	assert.Equal(t, request.Span{}, span)
+
+	req := mysqlPacket(0, []byte{mysqlComQuery}, []byte("INSERT INTO carts VALUES (1, 2)"))
+	r = tcpExchange(req, mysqlOKPacket, tcpSend, 43006, 3306)
+	span, ignore, err = ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeSQLClient, span.Type)
+	assert.Equal(t, "INSERT", span.Method)
+	assert.Equal(t, "carts", span.Path)
+	assert.Equal(t, "shop", span.DBNamespace)
+	assert.Equal(t, request.DBMySQL, span.SQLKind)
+
+	// COM_INIT_DB changes the default schema
+	req = mysqlPacket(0, []byte{mysqlComInitDB}, []byte("inventory"))
+	r = tcpExchange(req, mysqlOKPacket, tcpSend, 43006, 3306)
+	_, ignore, err = ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	assert.True(t, ignore)
+
+	req = mysqlPacket(0, []byte{mysqlComQuery}, []byte("SELECT * FROM items"))
+	r = tcpExchange(req, mysqlPacket(1, []byte{1}), tcpSend, 43006, 3306)
+	span, _, err = ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	assert.Equal(t, "inventory", span.DBNamespace)
+}
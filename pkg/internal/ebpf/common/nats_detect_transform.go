@@ -0,0 +1,185 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	trace2 "go.opentelemetry.io/otel/trace"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// https://docs.nats.io/reference/reference-protocols/nats-protocol
+const natsMaxLineLen = 4096
+
+type NATSInfo struct {
+	Operation string
+	Subject   string
+	Error     bool
+}
+
+// natsOperations contains the minimum and maximum number of arguments of each operation
+// (-1 means unlimited) and, for the operations followed by a payload, the position of the
+// argument with the total payload size, counting from the end.
+var natsOperations = map[string]struct {
+	minArgs, maxArgs int
+	sizeArg          int
+}{
+	"PUB":     {2, 3, 1},
+	"HPUB":    {3, 4, 1},
+	"MSG":     {3, 4, 1},
+	"HMSG":    {4, 5, 1},
+	"SUB":     {2, 3, 0},
+	"UNSUB":   {1, 2, 0},
+	"PING":    {0, 0, 0},
+	"PONG":    {0, 0, 0},
+	"+OK":     {0, 0, 0},
+	"-ERR":    {1, -1, 0},
+	"INFO":    {1, -1, 0},
+	"CONNECT": {1, -1, 0},
+}
+
+// natsOps iterates the protocol operations of the buffer, skipping the message payloads.
+// It returns false if the buffer doesn't look like a sequence of NATS operations. Only the
+// last operation is allowed to be truncated by the size of the eBPF buffer.
+func natsOps(buf []byte, onOp func(op string, args []string)) bool {
+	if len(buf) == 0 {
+		return false
+	}
+	for first := true; len(buf) > 0; first = false {
+		end := bytes.Index(buf, []byte("\r\n"))
+		if end < 0 {
+			return !first
+		}
+		if end > natsMaxLineLen {
+			return false
+		}
+		line := string(buf[:end])
+		buf = buf[end+2:]
+		op, rest, _ := strings.Cut(line, " ")
+		spec, ok := natsOperations[op]
+		if !ok {
+			return false
+		}
+		var args []string
+		switch op {
+		case "-ERR":
+			args = []string{strings.Trim(rest, "' ")}
+		case "INFO", "CONNECT":
+			if !strings.HasPrefix(strings.TrimSpace(rest), "{") {
+				return false
+			}
+			args = []string{rest}
+		default:
+			args = strings.Fields(rest)
+		}
+		if len(args) < spec.minArgs || (spec.maxArgs >= 0 && len(args) > spec.maxArgs) {
+			return false
+		}
+		if spec.sizeArg > 0 {
+			size, err := strconv.Atoi(args[len(args)-spec.sizeArg])
+			if err != nil || size < 0 {
+				return false
+			}
+			// payload + \r\n
+			if size+2 >= len(buf) {
+				buf = nil
+			} else {
+				buf = buf[size+2:]
+			}
+		}
+		if onOp != nil {
+			onOp(op, args)
+		}
+	}
+	return true
+}
+
+// ProcessNATSEvent decodes the NATS text protocol, looking for the messages published (PUB, HPUB)
+// or received (MSG, HMSG) by a client. It returns false if the buffers don't belong to a NATS
+// conversation that carries messages. A nil NATSInfo means that the traced process is the
+// NATS server, and the event should be ignored.
+func ProcessNATSEvent(event *TCPRequestInfo, req, resp []byte) (*NATSInfo, bool) {
+	if !natsOps(req, nil) || (len(resp) > 0 && !natsOps(resp, nil)) {
+		return nil, false
+	}
+
+	// the request was sent by the traced process if its direction is TCP_SEND
+	reqSent := event.Direction == 1
+	var info *NATSInfo
+	clientSide, infoSent := false, false
+	for _, b := range []struct {
+		buf  []byte
+		sent bool
+	}{{req, reqSent}, {resp, !reqSent}} {
+		natsOps(b.buf, func(op string, args []string) {
+			switch {
+			case info != nil:
+				// the server rejected the published message
+				if op == "-ERR" && info.Operation == request.MessagingPublish && b.sent != infoSent {
+					info.Error = true
+				}
+			case op == "PUB" || op == "HPUB":
+				info = &NATSInfo{Operation: request.MessagingPublish, Subject: args[0]}
+				clientSide, infoSent = b.sent, b.sent
+			case op == "MSG" || op == "HMSG":
+				info = &NATSInfo{Operation: request.MessagingProcess, Subject: args[0]}
+				clientSide, infoSent = !b.sent, b.sent
+			}
+		})
+	}
+	if info == nil {
+		return nil, false
+	}
+	if !clientSide {
+		return nil, true
+	}
+	// the connection info is oriented according to the direction of the first buffer
+	// of the event: make sure the server is the server side of the span
+	if !reqSent {
+		reverseTCPEvent(event)
+	}
+	return info, true
+}
+
+func TCPToNATSToSpan(trace *TCPRequestInfo, data *NATSInfo) request.Span {
+	peer := ""
+	hostname := ""
+	hostPort := 0
+
+	if trace.ConnInfo.S_port != 0 || trace.ConnInfo.D_port != 0 {
+		peer, hostname = (*BPFConnInfo)(unsafe.Pointer(&trace.ConnInfo)).reqHostInfo()
+		hostPort = int(trace.ConnInfo.D_port)
+	}
+
+	status := 0
+	if data.Error {
+		status = 1
+	}
+
+	return request.Span{
+		Type:          request.EventTypeNATSClient,
+		Method:        data.Operation,
+		Path:          data.Subject,
+		Peer:          peer,
+		PeerPort:      int(trace.ConnInfo.S_port),
+		Host:          hostname,
+		HostPort:      hostPort,
+		ContentLength: 0,
+		RequestStart:  int64(trace.StartMonotimeNs),
+		Start:         int64(trace.StartMonotimeNs),
+		End:           int64(trace.EndMonotimeNs),
+		Status:        status,
+		TraceID:       trace2.TraceID(trace.Tp.TraceId),
+		SpanID:        trace2.SpanID(trace.Tp.SpanId),
+		ParentSpanID:  trace2.SpanID(trace.Tp.ParentId),
+		Flags:         trace.Tp.Flags,
+		Pid: request.PidInfo{
+			HostPID:   trace.Pid.HostPid,
+			UserPID:   trace.Pid.UserPid,
+			Namespace: trace.Pid.Ns,
+		},
+	}
+}
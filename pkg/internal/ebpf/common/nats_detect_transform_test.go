@@ -0,0 +1,56 @@
+package ebpfcommon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func TestNATSPublish(t *testing.T) {
+	r := tcpExchange([]byte("PUB orders.created 5\r\nhello\r\n"), []byte("+OK\r\n"), tcpSend, 48001, 4222)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeNATSClient, span.Type)
+	assert.Equal(t, request.MessagingPublish, span.Method)
+	assert.Equal(t, "orders.created", span.Path)
+	assert.Equal(t, 0, span.Status)
+	assert.Equal(t, 4222, span.HostPort)
+	assert.Equal(t, 48001, span.PeerPort)
+}
+
+func TestNATSPublishWithHeaders(t *testing.T) {
+	req := "PING\r\nHPUB events.login _INBOX.42 21 26\r\nNATS/1.0\r\nX-Id: 1\r\n\r\nhello\r\n"
+	resp := "PONG\r\n-ERR 'Permissions Violation for Publish to events.login'\r\n"
+	r := tcpExchange([]byte(req), []byte(resp), tcpSend, 48002, 4222)
+
+	info, ok := ProcessNATSEvent(&r, []byte(req), []byte(resp))
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, request.MessagingPublish, info.Operation)
+	assert.Equal(t, "events.login", info.Subject)
+	assert.True(t, info.Error)
+}
+
+func TestNATSProcess(t *testing.T) {
+	// the client receives the message and then publishes the reply
+	req := "MSG requests.users 7 _INBOX.abc 3\r\nfoo\r\n"
+	resp := "PUB _INBOX.abc 2\r\nok\r\n"
+	r := tcpExchange([]byte(req), []byte(resp), tcpRecv, 4222, 48003)
+
+	info, ok := ProcessNATSEvent(&r, []byte(req), []byte(resp))
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, request.MessagingProcess, info.Operation)
+	assert.Equal(t, "requests.users", info.Subject)
+	assert.False(t, info.Error)
+	// the NATS server is the destination of the span
+	assert.Equal(t, uint16(48003), r.ConnInfo.S_port)
+	assert.Equal(t, uint16(4222), r.ConnInfo.D_port)
+}
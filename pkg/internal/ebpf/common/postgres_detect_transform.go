@@ -0,0 +1,303 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/sqlprune"
+)
+
+// https://www.postgresql.org/docs/current/protocol-message-formats.html
+const (
+	postgresHeaderLen     = 5                // message type + int32 length
+	postgresMaxMessageLen = 16 * 1024 * 1024 // bigger lengths are considered false positives
+	postgresProtocolV3    = 196608           // StartupMessage protocol version 3.0
+	postgresSSLRequest    = 80877103
+	postgresGSSENCRequest = 80877104
+	postgresCancelRequest = 80877102
+)
+
+// postgres frontend (client) message types
+const (
+	pgQuery     = 'Q'
+	pgParse     = 'P'
+	pgBind      = 'B'
+	pgExecute   = 'E'
+	pgDescribe  = 'D'
+	pgSync      = 'S'
+	pgFlush     = 'H'
+	pgClose     = 'C'
+	pgTerminate = 'X'
+	pgFuncCall  = 'F'
+	pgPassword  = 'p'
+	pgCopyData  = 'd'
+	pgCopyDone  = 'c'
+	pgCopyFail  = 'f'
+)
+
+// postgres backend (server) message type for errors
+const pgErrorResponse = 'E'
+
+// ErrorResponse field identifiers
+const (
+	pgErrFieldCode    = 'C'
+	pgErrFieldMessage = 'M'
+)
+
+type postgresStatementKey struct {
+	conn BPFConnInfo
+	// portal is true if the name refers to a portal instead of a prepared statement
+	portal bool
+	name   string
+}
+
+// prepared statements and portals are sent once (Parse/Bind messages) and then referenced
+// by name, so we need to remember them per connection
+var postgresStatements, _ = lru.New[postgresStatementKey, string](1024 * 10)
+
+// the database name is only sent in the StartupMessage, at the beginning of the connection
+var postgresDatabases, _ = lru.New[BPFConnInfo, string](1024)
+
+func isPostgresFrontendType(t byte) bool {
+	switch t {
+	case pgQuery, pgParse, pgBind, pgExecute, pgDescribe, pgSync, pgFlush, pgClose,
+		pgTerminate, pgFuncCall, pgPassword, pgCopyData, pgCopyDone, pgCopyFail:
+		return true
+	}
+	return false
+}
+
+func isPostgresBackendType(t byte) bool {
+	switch t {
+	case 'R', 'K', 'S', 'Z', 'T', 'D', 'C', 'E', 'N', 'I', 'n', 't', 's',
+		'1', '2', '3', 'A', 'G', 'H', 'W', 'd', 'c', 'V', 'v':
+		return true
+	}
+	return false
+}
+
+// postgresMessages iterates the messages in the buffer, invoking the provided function
+// for each message, with the body truncated to the buffer length. It returns false if the
+// buffer doesn't look like a sequence of postgres messages.
+func postgresMessages(buf []byte, validType func(byte) bool, onMessage func(t byte, body []byte)) bool {
+	if len(buf) < postgresHeaderLen {
+		return false
+	}
+	for ptr := 0; ptr+postgresHeaderLen <= len(buf); {
+		t := buf[ptr]
+		size := int(int32(binary.BigEndian.Uint32(buf[ptr+1 : ptr+postgresHeaderLen])))
+		if !validType(t) || size < 4 || size > postgresMaxMessageLen {
+			return false
+		}
+		// the last message might be truncated by the size of the eBPF buffer
+		end := ptr + 1 + size
+		if end > len(buf) {
+			end = len(buf)
+		}
+		if onMessage != nil {
+			onMessage(t, buf[ptr+postgresHeaderLen:end])
+		}
+		ptr = end
+	}
+	return true
+}
+
+func isPostgresFrontend(buf []byte) bool {
+	return isPostgresStartup(buf) || postgresMessages(buf, isPostgresFrontendType, nil)
+}
+
+func isPostgresBackend(buf []byte) bool {
+	return postgresMessages(buf, isPostgresBackendType, nil)
+}
+
+// isPostgresStartup checks for any of the untyped messages that can be sent at the beginning of a connection
+func isPostgresStartup(buf []byte) bool {
+	if len(buf) < 8 {
+		return false
+	}
+	size := int32(binary.BigEndian.Uint32(buf[0:4]))
+	if size < 8 || size > 10000 {
+		return false
+	}
+	switch binary.BigEndian.Uint32(buf[4:8]) {
+	case postgresProtocolV3, postgresSSLRequest, postgresGSSENCRequest, postgresCancelRequest:
+		return true
+	}
+	return false
+}
+
+// cstrings splits a sequence of zero-terminated strings. The last string
+// is returned even if it isn't terminated, because the buffer could be truncated.
+func cstrings(buf []byte, max int) []string {
+	var res []string
+	for len(buf) > 0 && len(res) < max {
+		i := bytes.IndexByte(buf, 0)
+		if i < 0 {
+			res = append(res, string(buf))
+			break
+		}
+		res = append(res, string(buf[:i]))
+		buf = buf[i+1:]
+	}
+	return res
+}
+
+func postgresStartupDatabase(buf []byte) string {
+	if binary.BigEndian.Uint32(buf[4:8]) != postgresProtocolV3 {
+		return ""
+	}
+	size := int(binary.BigEndian.Uint32(buf[0:4]))
+	if size > len(buf) {
+		size = len(buf)
+	}
+	params := cstrings(buf[8:size], 64)
+	user := ""
+	for i := 0; i+1 < len(params); i += 2 {
+		switch params[i] {
+		case "database":
+			return params[i+1]
+		case "user":
+			user = params[i+1]
+		}
+	}
+	// if not specified, the database name defaults to the user name
+	return user
+}
+
+// ProcessPostgresEvent decodes the Postgres frontend messages of the request and the
+// backend messages of the response. It returns false if the buffers don't belong to a
+// Postgres conversation. A nil SQLWireInfo means that the messages did not execute
+// any statement (e.g. it's an authentication message) and the event should be ignored.
+func ProcessPostgresEvent(event *TCPRequestInfo, req, resp []byte) (*SQLWireInfo, bool) {
+	reversed := false
+	if !isPostgresFrontend(req) || (len(resp) > 0 && !isPostgresBackend(resp)) {
+		// we might have caught the event reversed in the middle of communication
+		if len(resp) == 0 || !isPostgresFrontend(resp) || !isPostgresBackend(req) {
+			return nil, false
+		}
+		reversed = true
+		req, resp = resp, req
+	}
+
+	conn := BPFConnInfo(event.ConnInfo)
+	if reversed {
+		reverseConnInfo(&conn)
+	}
+
+	var info *SQLWireInfo
+	if isPostgresStartup(req) {
+		if db := postgresStartupDatabase(req); db != "" {
+			postgresDatabases.Add(conn, db)
+		}
+	} else {
+		info = parsePostgresFrontend(conn, req)
+		if info == nil {
+			// let the generic SQL detection try to find something
+			return nil, false
+		}
+		info.Database, _ = postgresDatabases.Get(conn)
+		info.Error = parsePostgresError(resp)
+	}
+
+	if reversed {
+		reverseTCPEvent(event)
+	}
+
+	return info, true
+}
+
+// nolint:cyclop
+func parsePostgresFrontend(conn BPFConnInfo, req []byte) *SQLWireInfo {
+	var info *SQLWireInfo
+	setStatement := func(stmt string) {
+		if stmt == "" || info != nil {
+			return
+		}
+		op, table := sqlprune.SQLParseOperationAndTable(stmt)
+		if op == "" && strings.HasPrefix(asciiToUpper(stmt), "EXECUTE ") {
+			// execution of a statement prepared with a PREPARE query
+			parts := strings.Fields(stmt)
+			op = parts[0]
+			if len(parts) > 1 {
+				table = parts[1]
+			}
+		}
+		info = &SQLWireInfo{Kind: request.DBPostgres, Operation: op, Table: table, Statement: stmt}
+	}
+
+	postgresMessages(req, isPostgresFrontendType, func(t byte, body []byte) {
+		switch t {
+		case pgQuery:
+			setStatement(cstr(body))
+		case pgParse:
+			// statement name, query text
+			args := cstrings(body, 2)
+			if len(args) == 2 {
+				postgresStatements.Add(postgresStatementKey{conn: conn, name: args[0]}, args[1])
+				setStatement(args[1])
+			}
+		case pgBind:
+			// portal name, statement name
+			args := cstrings(body, 2)
+			if len(args) == 2 {
+				if stmt, ok := postgresStatements.Get(postgresStatementKey{conn: conn, name: args[1]}); ok {
+					postgresStatements.Add(postgresStatementKey{conn: conn, portal: true, name: args[0]}, stmt)
+					setStatement(stmt)
+				}
+			}
+		case pgExecute:
+			// portal name
+			args := cstrings(body, 1)
+			if len(args) == 1 {
+				if stmt, ok := postgresStatements.Get(postgresStatementKey{conn: conn, portal: true, name: args[0]}); ok {
+					setStatement(stmt)
+				}
+			}
+		case pgClose:
+			// 'S' for statement or 'P' for portal, followed by the name
+			if len(body) > 1 {
+				args := cstrings(body[1:], 1)
+				if len(args) == 1 {
+					postgresStatements.Remove(postgresStatementKey{conn: conn, portal: body[0] == 'P', name: args[0]})
+				}
+			}
+		case pgTerminate:
+			postgresDatabases.Remove(conn)
+		}
+	})
+
+	return info
+}
+
+func parsePostgresError(resp []byte) *request.DBError {
+	var dbErr *request.DBError
+	postgresMessages(resp, isPostgresBackendType, func(t byte, body []byte) {
+		if t != pgErrorResponse || dbErr != nil {
+			return
+		}
+		dbErr = &request.DBError{}
+		// sequence of fields: one byte for the field type, followed by a zero-terminated string
+		for len(body) > 1 && body[0] != 0 {
+			field := body[0]
+			value := cstrings(body[1:], 1)
+			if len(value) == 0 {
+				break
+			}
+			switch field {
+			case pgErrFieldCode:
+				dbErr.ErrorCode = value[0]
+			case pgErrFieldMessage:
+				dbErr.Description = value[0]
+			}
+			body = body[1+len(value[0]):]
+			if len(body) > 0 {
+				body = body[1:]
+			}
+		}
+	})
+	return dbErr
+}
@@ -0,0 +1,164 @@
+package ebpfcommon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+func pgMessage(t byte, fields ...[]byte) []byte {
+	body := bytes.Join(fields, nil)
+	msg := []byte{t, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(msg[1:], uint32(len(body)+4))
+	return append(msg, body...)
+}
+
+func pgStr(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func pgStartup(params ...string) []byte {
+	body := []byte{0, 0, 0, 0, 0, 3, 0, 0}
+	for _, p := range params {
+		body = append(body, pgStr(p)...)
+	}
+	body = append(body, 0)
+	binary.BigEndian.PutUint32(body, uint32(len(body)))
+	return body
+}
+
+func TestPostgresSimpleQuery(t *testing.T) {
+	req := pgMessage('Q', pgStr("SELECT * FROM accounts WHERE id = 3"))
+	resp := bytes.Join([][]byte{
+		pgMessage('T', []byte{0, 1}, pgStr("id")),
+		pgMessage('C', pgStr("SELECT 1")),
+		pgMessage('Z', []byte{'I'}),
+	}, nil)
+	r := tcpExchange(req, resp, tcpSend, 33001, 5432)
+
+	info, ok := ProcessPostgresEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "SELECT", info.Operation)
+	assert.Equal(t, "accounts", info.Table)
+	assert.Equal(t, "SELECT * FROM accounts WHERE id = 3", info.Statement)
+	assert.Nil(t, info.Error)
+
+	s := TCPToSQLWireToSpan(&r, info)
+	assert.Equal(t, request.EventTypeSQLClient, s.Type)
+	assert.Equal(t, request.DBPostgres, s.SQLKind)
+	assert.Equal(t, 0, s.Status)
+	assert.Equal(t, 5432, s.HostPort)
+}
+
+func TestPostgresErrorResponse(t *testing.T) {
+	req := pgMessage('Q', pgStr("SELECT * FROM nonexisting"))
+	resp := bytes.Join([][]byte{
+		pgMessage('E',
+			[]byte{'S'}, pgStr("ERROR"),
+			[]byte{'C'}, pgStr("42P01"),
+			[]byte{'M'}, pgStr(`relation "nonexisting" does not exist`),
+			[]byte{0}),
+		pgMessage('Z', []byte{'I'}),
+	}, nil)
+	r := tcpExchange(req, resp, tcpSend, 33002, 5432)
+
+	info, ok := ProcessPostgresEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	require.NotNil(t, info.Error)
+	assert.Equal(t, "42P01", info.Error.ErrorCode)
+	assert.Equal(t, `relation "nonexisting" does not exist`, info.Error.Description)
+
+	s := TCPToSQLWireToSpan(&r, info)
+	assert.Equal(t, 1, s.Status)
+	assert.Equal(t, "42P01", s.DBError.ErrorCode)
+}
+
+func TestPostgresExtendedQuery(t *testing.T) {
+	// Parse, Bind, Describe, Execute and Sync sent together
+	parse := pgMessage('P', pgStr("stmt_1"), pgStr("UPDATE users SET name = $1 WHERE id = $2"), []byte{0, 0})
+	bind := pgMessage('B', pgStr(""), pgStr("stmt_1"), []byte{0, 0, 0, 0, 0, 0})
+	execute := pgMessage('E', pgStr(""), []byte{0, 0, 0, 0})
+	sync := pgMessage('S')
+	resp := bytes.Join([][]byte{
+		pgMessage('1'),
+		pgMessage('2'),
+		pgMessage('C', pgStr("UPDATE 1")),
+		pgMessage('Z', []byte{'I'}),
+	}, nil)
+
+	req := bytes.Join([][]byte{parse, bind, pgMessage('D', []byte{'P'}, pgStr("")), execute, sync}, nil)
+	r := tcpExchange(req, resp, tcpSend, 33003, 5432)
+	info, ok := ProcessPostgresEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "UPDATE", info.Operation)
+	assert.Equal(t, "users", info.Table)
+	assert.Equal(t, "UPDATE users SET name = $1 WHERE id = $2", info.Statement)
+
+	// later, the prepared statement is reused by name in the same connection
+	req = bytes.Join([][]byte{bind, execute, sync}, nil)
+	r = tcpExchange(req, resp[5:], tcpSend, 33003, 5432)
+	info, ok = ProcessPostgresEvent(&r, req, resp[5:])
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "UPDATE", info.Operation)
+	assert.Equal(t, "users", info.Table)
+
+	// but the statement isn't known from other connections
+	r = tcpExchange(req, resp[5:], tcpSend, 33004, 5432)
+	info, ok = ProcessPostgresEvent(&r, req, resp[5:])
+	assert.False(t, ok)
+	assert.Nil(t, info)
+}
+
+func TestPostgresExecutePreparedQuery(t *testing.T) {
+	// execution of a statement prepared with a PREPARE query
+	req := pgMessage('Q', pgStr("execute my_contacts (1)"))
+	resp := pgMessage('C', pgStr("SELECT 1"))
+	r := tcpExchange(req, resp, tcpSend, 33008, 5432)
+
+	info, ok := ProcessPostgresEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "execute", info.Operation)
+	assert.Equal(t, "my_contacts", info.Table)
+	assert.Equal(t, "execute my_contacts (1)", info.Statement)
+}
+
+func TestPostgresStartupDatabase(t *testing.T) {
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+
+	startup := pgStartup("user", "beyla", "database", "inventory", "application_name", "psql")
+	authOk := pgMessage('R', []byte{0, 0, 0, 0})
+
+	r := tcpExchange(startup, authOk, tcpSend, 33005, 5432)
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	assert.True(t, ignore)
+	assert.Equal(t, request.Span{}, span)
+
+	req := pgMessage('Q', pgStr("DELETE FROM items WHERE id = 1"))
+	resp := pgMessage('C', pgStr("DELETE 1"))
+	r = tcpExchange(req, resp, tcpSend, 33005, 5432)
+	span, ignore, err = ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeSQLClient, span.Type)
+	assert.Equal(t, "DELETE", span.Method)
+	assert.Equal(t, "items", span.Path)
+	assert.Equal(t, "inventory", span.DBNamespace)
+	assert.Equal(t, request.DBPostgres, span.SQLKind)
+}
+
+func TestPostgresStartupDefaultsToUser(t *testing.T) {
+	assert.Equal(t, "beyla", postgresStartupDatabase(pgStartup("user", "beyla")))
+	assert.Equal(t, "", postgresStartupDatabase(pgStartup()))
+}
@@ -66,8 +66,10 @@ func SharedRingbuf(
 	log := slog.With("component", "ringbuf.Tracer")
 	rbf := ringBufForwarder{
 		cfg: cfg, logger: log, ringbuffer: ringbuffer,
-		closers: nil, reader: ReadBPFTraceAsSpan,
-		filter: filter, metrics: metrics,
+		closers: nil, filter: filter, metrics: metrics,
+	}
+	rbf.reader = func(record *ringbuf.Record, filter ServiceFilter) (request.Span, bool, error) {
+		return ReadBPFTraceAsSpan(cfg, record, filter)
 	}
 	singleRbf = &rbf
 	return singleRbf.sharedReadAndForward
@@ -1,9 +1,6 @@
 package ebpfcommon
 
 import (
-	"encoding/binary"
-	"errors"
-	"fmt"
 	"strings"
 	"unsafe"
 
@@ -13,6 +10,19 @@ import (
 	"github.com/grafana/beyla/pkg/internal/sqlprune"
 )
 
+// SQLWireInfo contains the information decoded from the binary protocol
+// of a given database server (e.g. PostgreSQL, MySQL or Cassandra)
+type SQLWireInfo struct {
+	Kind        request.SQLKind
+	Operation   string
+	Table       string
+	Statement   string
+	Database    string
+	Consistency string
+	BatchSize   int
+	Error       *request.DBError
+}
+
 func validSQL(op, table string) bool {
 	return op != "" && table != ""
 }
@@ -32,50 +42,10 @@ func asciiToUpper(input string) string {
 	return string(out)
 }
 
-func isASCII(s string) bool {
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
-			c == '.' || c == '_' || c == ' ' || c == '-' {
-			continue
-		}
-		return false
-	}
-
-	return true
-}
-
+// detectSQLBytes looks for a plain-text SQL statement in the buffer. It is the fallback for the
+// database protocols that aren't explicitly decoded.
 func detectSQLBytes(b []byte) (string, string, string) {
-	op, table, sql := detectSQL(string(b))
-	if !validSQL(op, table) {
-		if isPostgresBindCommand(b) {
-			statement, portal, args, err := parsePostgresBindCommand(b)
-			if err == nil {
-				op = "BIND"
-				table = fmt.Sprintf("%s.%s", statement, portal)
-				for _, arg := range args {
-					if isASCII(arg) {
-						sql += arg + " "
-					}
-				}
-			}
-		} else if isPostgresQueryCommand(b) {
-			text, err := parsePosgresQueryCommand(b)
-			if err == nil {
-				query := asciiToUpper(text)
-				if strings.HasPrefix(query, "EXECUTE ") {
-					parts := strings.Split(text, " ")
-					op = parts[0]
-					if len(parts) > 1 {
-						table = parts[1]
-					}
-					sql = text
-				}
-			}
-		}
-	}
-
-	return op, table, sql
+	return detectSQL(string(b))
 }
 
 func detectSQL(buf string) (string, string, string) {
@@ -93,120 +63,6 @@ func detectSQL(buf string) (string, string, string) {
 	return "", "", ""
 }
 
-func isPostgresBindCommand(b []byte) bool {
-	return isPostgresCommand('B', b)
-}
-
-func isPostgresQueryCommand(b []byte) bool {
-	return isPostgresCommand('Q', b)
-}
-
-func isPostgresCommand(lookup byte, b []byte) bool {
-	if len(b) < 5 {
-		return false
-	}
-
-	if b[0] == lookup {
-		size := int32(binary.BigEndian.Uint32(b[1:5]))
-		if size < 0 || size > 1000 {
-			return false
-		}
-		return true
-	}
-
-	return false
-}
-
-// nolint:cyclop
-func parsePostgresBindCommand(buf []byte) (string, string, []string, error) {
-	statement := []byte{}
-	portal := []byte{}
-	args := []string{}
-
-	size := int(binary.BigEndian.Uint32(buf[1:5]))
-	if size > len(buf) {
-		size = len(buf)
-	}
-	ptr := 5
-
-	// parse statement, zero terminated string
-	for {
-		if ptr >= size {
-			return string(statement), string(portal), args, errors.New("too short, while parsing statement")
-		}
-		b := buf[ptr]
-		ptr++
-
-		if b == 0 {
-			break
-		}
-		statement = append(statement, b)
-	}
-
-	// parse portal, zero terminated string
-	for {
-		if ptr >= size {
-			return string(statement), string(portal), args, errors.New("too short, while parsing portal")
-		}
-		b := buf[ptr]
-		ptr++
-
-		if b == 0 {
-			break
-		}
-		portal = append(portal, b)
-	}
-
-	if ptr+2 >= size {
-		return string(statement), string(portal), args, errors.New("too short, while parsing format codes")
-	}
-
-	formats := int16(binary.BigEndian.Uint16(buf[ptr : ptr+2]))
-	ptr += 2
-	for i := 0; i < int(formats); i++ {
-		// ignore format codes
-		if ptr+2 >= size {
-			return string(statement), string(portal), args, errors.New("too short, while parsing format codes")
-		}
-		ptr += 2
-	}
-
-	params := int16(binary.BigEndian.Uint16(buf[ptr : ptr+2]))
-	ptr += 2
-	for i := 0; i < int(params); i++ {
-		if ptr+4 >= size {
-			return string(statement), string(portal), args, errors.New("too short, while parsing params")
-		}
-		argLen := int(binary.BigEndian.Uint32(buf[ptr : ptr+4]))
-		ptr += 4
-		arg := []byte{}
-		for j := 0; j < int(argLen); j++ {
-			if ptr >= size {
-				break
-			}
-			arg = append(arg, buf[ptr])
-			ptr++
-		}
-		args = append(args, string(arg))
-	}
-
-	return string(statement), string(portal), args, nil
-}
-
-func parsePosgresQueryCommand(buf []byte) (string, error) {
-	size := int(binary.BigEndian.Uint32(buf[1:5]))
-	if size > len(buf) {
-		size = len(buf)
-	}
-	ptr := 5
-
-	if ptr > size {
-		return "", errors.New("too short")
-	}
-
-	return string(buf[ptr:size]), nil
-}
-
 func TCPToSQLToSpan(trace *TCPRequestInfo, op, table, sql string) request.Span {
 	peer := ""
 	hostname := ""
@@ -242,3 +98,16 @@ func TCPToSQLToSpan(trace *TCPRequestInfo, op, table, sql string) request.Span {
 		Statement: sql,
 	}
 }
+
+func TCPToSQLWireToSpan(trace *TCPRequestInfo, data *SQLWireInfo) request.Span {
+	span := TCPToSQLToSpan(trace, data.Operation, data.Table, data.Statement)
+	span.SQLKind = data.Kind
+	span.DBNamespace = data.Database
+	span.DBConsistency = data.Consistency
+	span.DBBatchSize = data.BatchSize
+	if data.Error != nil {
+		span.Status = 1
+		span.DBError = *data.Error
+	}
+	return span
+}
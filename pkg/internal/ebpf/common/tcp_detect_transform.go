@@ -3,14 +3,16 @@ package ebpfcommon
 import (
 	"bytes"
 	"encoding/binary"
+	"unsafe"
 
 	"github.com/cilium/ebpf/ringbuf"
+	trace2 "go.opentelemetry.io/otel/trace"
 
 	"github.com/grafana/beyla/pkg/internal/request"
 )
 
 // nolint:cyclop
-func ReadTCPRequestIntoSpan(record *ringbuf.Record, filter ServiceFilter) (request.Span, bool, error) {
+func ReadTCPRequestIntoSpan(cfg *TracerConfig, record *ringbuf.Record, filter ServiceFilter) (request.Span, bool, error) {
 	var event TCPRequestInfo
 
 	err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event)
@@ -34,6 +36,63 @@ func ReadTCPRequestIntoSpan(record *ringbuf.Record, filter ServiceFilter) (reque
 
 	b := event.Buf[:l]
 
+	// Postgres, MySQL and Cassandra are checked first, as their binary protocols carry more
+	// information (prepared statements, errors, database name) than the plain SQL text
+	if pg, ok := ProcessPostgresEvent(&event, b, event.Rbuf[:rl]); ok {
+		if pg == nil {
+			return request.Span{}, true, nil // startup or authentication messages
+		}
+		return TCPToSQLWireToSpan(&event, pg), false, nil
+	}
+	if my, ok := ProcessMySQLEvent(&event, b, event.Rbuf[:rl]); ok {
+		if my == nil {
+			return request.Span{}, true, nil // handshake or commands without statements
+		}
+		return TCPToSQLWireToSpan(&event, my), false, nil
+	}
+	if cql, ok := ProcessCassandraEvent(&event, b, event.Rbuf[:rl]); ok {
+		if cql == nil {
+			return request.Span{}, true, nil // handshake, compressed frames or server side
+		}
+		return TCPToSQLWireToSpan(&event, cql), false, nil
+	}
+	if mongo, err := ProcessPossibleMongoEvent(&event, b, event.Rbuf[:rl]); err == nil {
+		return TCPToMongoToSpan(&event, mongo), false, nil
+	}
+	if fcgi, ok := ProcessFastCGIEvent(&event, b, event.Rbuf[:rl]); ok {
+		if fcgi == nil {
+			return request.Span{}, true, nil // web server side of the connection
+		}
+		return TCPToFastCGIToSpan(&event, fcgi), false, nil
+	}
+	if amqp, ok := ProcessAMQPEvent(&event, b, event.Rbuf[:rl]); ok {
+		if amqp == nil {
+			return request.Span{}, true, nil // frames without messages
+		}
+		return TCPToAMQPToSpan(&event, amqp), false, nil
+	}
+	if mc, ok := ProcessMemcachedEvent(&event, b, event.Rbuf[:rl]); ok {
+		if mc == nil {
+			return request.Span{}, true, nil // memcached server side
+		}
+		return TCPToMemcachedToSpan(&event, mc), false, nil
+	}
+	if nats, ok := ProcessNATSEvent(&event, b, event.Rbuf[:rl]); ok {
+		if nats == nil {
+			return request.Span{}, true, nil // NATS server side
+		}
+		return TCPToNATSToSpan(&event, nats), false, nil
+	}
+	if mqtt, ok := ProcessMQTTEvent(&event, b, event.Rbuf[:rl]); ok {
+		if mqtt == nil {
+			return request.Span{}, true, nil // packets without messages or broker side
+		}
+		return TCPToMQTTToSpan(&event, mqtt), false, nil
+	}
+	if thrift, ok := ProcessThriftEvent(&event, b, event.Rbuf[:rl]); ok {
+		return TCPToThriftToSpan(&event, thrift), false, nil
+	}
+
 	// Check if we have a SQL statement
 	op, table, sql := detectSQLBytes(b)
 	switch {
@@ -64,6 +123,7 @@ func ReadTCPRequestIntoSpan(record *ringbuf.Record, filter ServiceFilter) (reque
 		// We try gRPC first because it's more reliable in detecting false gRPC sequences.
 		if isHTTP2(b, int(event.Len)) || isHTTP2(event.Rbuf[:rl], int(event.RespLen)) {
 			MisclassifiedEvents <- MisclassifiedEvent{EventType: EventTypeKHTTP2, TCPInfo: &event}
+			return request.Span{}, true, nil
 		} else {
 			k, err := ProcessPossibleKafkaEvent(&event, b, event.Rbuf[:rl])
 			if err == nil {
@@ -72,9 +132,55 @@ func ReadTCPRequestIntoSpan(record *ringbuf.Record, filter ServiceFilter) (reque
 		}
 	}
 
+	if cfg.TrackUnclassifiedTCP {
+		return TCPToGenericToSpan(&event), false, nil
+	}
+
 	return request.Span{}, true, nil // ignore if we couldn't parse it
 }
 
+// TCPToGenericToSpan converts a TCP request that couldn't be classified into any of the
+// supported protocols into a generic TCP client or server span. The role of the traced
+// process is given by the direction of the first buffer of the request: it's the client
+// if it sent the first bytes of the conversation.
+func TCPToGenericToSpan(trace *TCPRequestInfo) request.Span {
+	peer := ""
+	hostname := ""
+	hostPort := 0
+
+	if trace.ConnInfo.S_port != 0 || trace.ConnInfo.D_port != 0 {
+		peer, hostname = (*BPFConnInfo)(unsafe.Pointer(&trace.ConnInfo)).reqHostInfo()
+		hostPort = int(trace.ConnInfo.D_port)
+	}
+
+	eventType := request.EventTypeTCPServer
+	if trace.Direction == 1 {
+		eventType = request.EventTypeTCPClient
+	}
+
+	return request.Span{
+		Type:           eventType,
+		Peer:           peer,
+		PeerPort:       int(trace.ConnInfo.S_port),
+		Host:           hostname,
+		HostPort:       hostPort,
+		ContentLength:  int64(trace.Len),
+		ResponseLength: int64(trace.RespLen),
+		RequestStart:   int64(trace.StartMonotimeNs),
+		Start:          int64(trace.StartMonotimeNs),
+		End:            int64(trace.EndMonotimeNs),
+		TraceID:        trace2.TraceID(trace.Tp.TraceId),
+		SpanID:         trace2.SpanID(trace.Tp.SpanId),
+		ParentSpanID:   trace2.SpanID(trace.Tp.ParentId),
+		Flags:          trace.Tp.Flags,
+		Pid: request.PidInfo{
+			HostPID:   trace.Pid.HostPid,
+			UserPID:   trace.Pid.UserPid,
+			Namespace: trace.Pid.Ns,
+		},
+	}
+}
+
 func reverseTCPEvent(trace *TCPRequestInfo) {
 	if trace.Direction == 0 {
 		trace.Direction = 1
@@ -82,10 +188,14 @@ func reverseTCPEvent(trace *TCPRequestInfo) {
 		trace.Direction = 0
 	}
 
-	port := trace.ConnInfo.S_port
-	addr := trace.ConnInfo.S_addr
-	trace.ConnInfo.S_addr = trace.ConnInfo.D_addr
-	trace.ConnInfo.S_port = trace.ConnInfo.D_port
-	trace.ConnInfo.D_addr = addr
-	trace.ConnInfo.D_port = port
+	reverseConnInfo((*BPFConnInfo)(&trace.ConnInfo))
+}
+
+func reverseConnInfo(conn *BPFConnInfo) {
+	port := conn.S_port
+	addr := conn.S_addr
+	conn.S_addr = conn.D_addr
+	conn.S_port = conn.D_port
+	conn.D_addr = addr
+	conn.D_port = port
 }
@@ -99,7 +99,7 @@ func TestReadTCPRequestIntoSpan_Overflow(t *testing.T) {
 	}
 	binaryRecord := bytes.Buffer{}
 	require.NoError(t, binary.Write(&binaryRecord, binary.LittleEndian, tri))
-	span, ignore, err := ReadTCPRequestIntoSpan(&ringbuf.Record{RawSample: binaryRecord.Bytes()}, &fltr)
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, &ringbuf.Record{RawSample: binaryRecord.Bytes()}, &fltr)
 	require.NoError(t, err)
 	require.False(t, ignore)
 
@@ -108,6 +108,38 @@ func TestReadTCPRequestIntoSpan_Overflow(t *testing.T) {
 	assert.Equal(t, "foo", span.Path)
 }
 
+func TestUnclassifiedTCP(t *testing.T) {
+	req, resp := "#LEGACY v2 fetch 42\n", "#LEGACY v2 ok 1024 bytes\n"
+	r := makeTCPReq(req, tcpSend, 46001, 7070, 2000)
+	copy(r.Rbuf[:], resp)
+	r.RespLen = uint32(len(resp))
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	_, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	assert.True(t, ignore)
+
+	cfg := &TracerConfig{TrackUnclassifiedTCP: true}
+	span, ignore, err := ReadTCPRequestIntoSpan(cfg, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeTCPClient, span.Type)
+	assert.Equal(t, 7070, span.HostPort)
+	assert.Equal(t, 46001, span.PeerPort)
+	assert.Equal(t, int64(len(req)), span.ContentLength)
+	assert.Equal(t, int64(len(resp)), span.ResponseLength)
+	assert.Equal(t, int64(2000_000_000), span.End-span.Start)
+
+	// the traced process received the first bytes: it's the server side
+	r.Direction = tcpRecv
+	span, ignore, err = ReadTCPRequestIntoSpan(cfg, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeTCPServer, span.Type)
+	assert.Equal(t, 7070, span.HostPort)
+	assert.Equal(t, 46001, span.PeerPort)
+}
+
 func TestRedisDetection(t *testing.T) {
 	for _, s := range []string{
 		`*2|$3|GET|$5|beyla|`,
@@ -194,3 +226,290 @@ func makeTCPReq(buf string, direction int, peerPort, hostPort uint32, durationMs
 
 	return i
 }
+
+// tcpExchange returns a TCP event with the request and response buffers of a
+// connection, as captured by the eBPF probes
+func tcpExchange(req, resp []byte, direction int, peerPort, hostPort uint32) TCPRequestInfo {
+	r := makeTCPReq(string(req), direction, peerPort, hostPort, 2000)
+	copy(r.Rbuf[:], resp)
+	r.RespLen = uint32(len(resp))
+	return r
+}
+
+func tcpRecord(t *testing.T, r *TCPRequestInfo) *ringbuf.Record {
+	binaryRecord := bytes.Buffer{}
+	require.NoError(t, binary.Write(&binaryRecord, binary.LittleEndian, r))
+	return &ringbuf.Record{RawSample: binaryRecord.Bytes()}
+}
+
+// tcpDecoders mirrors the order in which ReadTCPRequestIntoSpan tries the protocol
+// decoders. Each function returns whether the decoder claims the event.
+var tcpDecoders = []struct {
+	protocol string
+	claims   func(event *TCPRequestInfo, req, resp []byte) bool
+}{
+	{protocol: "postgres", claims: func(event *TCPRequestInfo, req, resp []byte) bool {
+		_, ok := ProcessPostgresEvent(event, req, resp)
+		return ok
+	}},
+	{protocol: "mysql", claims: func(event *TCPRequestInfo, req, resp []byte) bool {
+		_, ok := ProcessMySQLEvent(event, req, resp)
+		return ok
+	}},
+	{protocol: "cassandra", claims: func(event *TCPRequestInfo, req, resp []byte) bool {
+		_, ok := ProcessCassandraEvent(event, req, resp)
+		return ok
+	}},
+	{protocol: "mongo", claims: func(event *TCPRequestInfo, req, resp []byte) bool {
+		_, err := ProcessPossibleMongoEvent(event, req, resp)
+		return err == nil
+	}},
+	{protocol: "fastcgi", claims: func(event *TCPRequestInfo, req, resp []byte) bool {
+		_, ok := ProcessFastCGIEvent(event, req, resp)
+		return ok
+	}},
+	{protocol: "amqp", claims: func(event *TCPRequestInfo, req, resp []byte) bool {
+		_, ok := ProcessAMQPEvent(event, req, resp)
+		return ok
+	}},
+	{protocol: "memcached", claims: func(event *TCPRequestInfo, req, resp []byte) bool {
+		_, ok := ProcessMemcachedEvent(event, req, resp)
+		return ok
+	}},
+	{protocol: "nats", claims: func(event *TCPRequestInfo, req, resp []byte) bool {
+		_, ok := ProcessNATSEvent(event, req, resp)
+		return ok
+	}},
+	{protocol: "mqtt", claims: func(event *TCPRequestInfo, req, resp []byte) bool {
+		_, ok := ProcessMQTTEvent(event, req, resp)
+		return ok
+	}},
+	{protocol: "thrift", claims: func(event *TCPRequestInfo, req, resp []byte) bool {
+		_, ok := ProcessThriftEvent(event, req, resp)
+		return ok
+	}},
+}
+
+// tcpSample is a request/response exchange of a given protocol
+type tcpSample struct {
+	name     string
+	protocol string
+	req      []byte
+	resp     []byte
+	// client and server ports of the connection
+	clientPort uint32
+	serverPort uint32
+	// span types when the exchange is captured from the client and from the server
+	// sides of the connection. Zero means that the event is ignored.
+	client request.EventType
+	server request.EventType
+}
+
+var tcpSamples = []tcpSample{
+	{
+		name: "postgres query", protocol: "postgres",
+		req:        pgMessage('Q', pgStr("INSERT INTO logs VALUES (1)")),
+		resp:       pgMessage('C', pgStr("INSERT 0 1")),
+		clientPort: 33006, serverPort: 5432,
+		client: request.EventTypeSQLClient, server: request.EventTypeSQLClient,
+	},
+	{
+		name: "mysql query", protocol: "mysql",
+		req:        mysqlPacket(0, []byte{mysqlComQuery}, []byte("SELECT * FROM users")),
+		resp:       mysqlPacket(1, []byte{3}),
+		clientPort: 43007, serverPort: 3306,
+		client: request.EventTypeSQLClient, server: request.EventTypeSQLClient,
+	},
+	{
+		name: "mongo command", protocol: "mongo",
+		req:        mongoMessage(12, 0, mongoOpMsg, mongoOpMsgBody(bsonDoc(bsonStr("delete", "sessions"), bsonStr("$db", "auth")))),
+		resp:       mongoMessage(105, 12, mongoOpMsg, mongoOpMsgBody(bsonDoc(bsonInt("n", 3), bsonFloat("ok", 1)))),
+		clientPort: 53006, serverPort: 27017,
+		client: request.EventTypeMongoClient, server: request.EventTypeMongoClient,
+	},
+	{
+		name: "amqp publish", protocol: "amqp",
+		req:        amqpPublish("orders", "orders.created"),
+		resp:       amqpHeartbeat,
+		clientPort: 44005, serverPort: 5672,
+		client: request.EventTypeAMQPClient, server: request.EventTypeAMQPServer,
+	},
+	{
+		// the web server side is already reported by its HTTP spans
+		name: "fastcgi request", protocol: "fastcgi",
+		req:        fcgiRequest(fcgiPair("REQUEST_METHOD", "DELETE"), fcgiPair("REQUEST_URI", "/items/1")),
+		resp:       fcgiResponse("Status: 204 No Content\r\n\r\n"),
+		clientPort: 45002, serverPort: 9000,
+		server: request.EventTypeHTTP,
+	},
+	{
+		name: "memcached text", protocol: "memcached",
+		req:        []byte("delete user:1\r\n"),
+		resp:       []byte("DELETED\r\n"),
+		clientPort: 46009, serverPort: 11211,
+		client: request.EventTypeMemcachedClient,
+	},
+	{
+		name: "memcached binary", protocol: "memcached",
+		req:        mcBinPacket(memcachedBinRequest, 0x00, 0, nil, []byte("user:1"), nil),
+		resp:       mcBinPacket(memcachedBinResponse, 0x00, 1, nil, nil, nil),
+		clientPort: 46010, serverPort: 11211,
+		client: request.EventTypeMemcachedClient,
+	},
+	{
+		name: "cassandra query", protocol: "cassandra",
+		req:        cqlQuery(1, "SELECT * FROM shop.users", 1),
+		resp:       cqlVoidResult,
+		clientPort: 47008, serverPort: 9042,
+		client: request.EventTypeSQLClient,
+	},
+	{
+		name: "nats publish", protocol: "nats",
+		req:        []byte("PUB orders.created 5\r\nhello\r\n"),
+		resp:       []byte("+OK\r\n"),
+		clientPort: 48004, serverPort: 4222,
+		client: request.EventTypeNATSClient,
+	},
+	{
+		name: "mqtt publish", protocol: "mqtt",
+		req:        mqttPacket(mqttPublish, 0x02, mqttStr("sensors/kitchen/temp"), []byte{0, 1}, []byte("21.5")),
+		resp:       mqttPacket(mqttPubAck, 0, []byte{0, 1}),
+		clientPort: 49008, serverPort: 1883,
+		client: request.EventTypeMQTTClient,
+	},
+	{
+		name: "thrift binary", protocol: "thrift",
+		req:        thriftBinary(thriftCall, "getUser", 7, 10, 0, 1, 0, 0, 0, 0, 0, 0, 0, 42, 0),
+		resp:       thriftBinary(thriftReply, "getUser", 7, 12, 0, 0, 0, 0),
+		clientPort: 50006, serverPort: 9090,
+		client: request.EventTypeGRPCClient, server: request.EventTypeGRPC,
+	},
+	{
+		name: "thrift compact", protocol: "thrift",
+		req:        thriftCompact(thriftCall, "getUser", 7, 0),
+		resp:       thriftCompact(thriftReply, "getUser", 7, 0),
+		clientPort: 50007, serverPort: 9090,
+		client: request.EventTypeGRPCClient, server: request.EventTypeGRPC,
+	},
+}
+
+// tcpUnknownSamples are exchanges that no protocol decoder must claim: other
+// protocols and malformed messages
+var tcpUnknownSamples = []struct {
+	name string
+	req  []byte
+	resp []byte
+}{
+	{name: "http", req: []byte("GET /foo HTTP/1.1\r\nHost: localhost\r\n\r\n"), resp: []byte("HTTP/1.1 200 OK\r\n\r\n")},
+	{name: "http post", req: []byte("POST /foo HTTP/1.1\r\n"), resp: []byte("HTTP/1.1 200 OK\r\n\r\n")},
+	{name: "redis", req: []byte("*2\r\n$3\r\nGET\r\n$5\r\nbeyla\r\n"), resp: []byte("+OK\r\n")},
+	{name: "sql text", req: []byte("SELECT * FROM accounts")},
+	{name: "empty"},
+	{name: "postgres too short", req: []byte("Q\x00\x00")},
+	{name: "postgres bad response", req: pgMessage('Q', pgStr("SELECT 1")), resp: []byte("HTTP/1.1 200 OK\r\n\r\n")},
+	{name: "mysql wrong length", req: append(mysqlPacket(0, []byte{mysqlComQuery}, []byte("SELECT 1")), 'x'), resp: mysqlOKPacket},
+	{name: "mysql unknown command", req: mysqlPacket(0, []byte{0x55}, []byte("SELECT 1")), resp: mysqlOKPacket},
+	{name: "mysql wrong sequence", req: mysqlPacket(3, []byte{mysqlComQuery}, []byte("SELECT 1")), resp: mysqlOKPacket},
+	{name: "mysql too short", req: []byte{1, 0, 0}},
+	{name: "mongo wrong response id",
+		req:  mongoMessage(13, 0, mongoOpMsg, mongoOpMsgBody(bsonDoc(bsonStr("find", "orders")))),
+		resp: mongoMessage(106, 14, mongoOpMsg, mongoOpMsgBody(bsonDoc(bsonFloat("ok", 1))))},
+	{name: "mongo unknown opcode",
+		req:  mongoMessage(13, 0, 2012, mongoOpMsgBody(bsonDoc(bsonStr("find", "orders")))),
+		resp: mongoMessage(106, 13, mongoOpMsg, mongoOpMsgBody(bsonDoc(bsonFloat("ok", 1))))},
+	{name: "mongo empty command",
+		req:  mongoMessage(13, 0, mongoOpMsg, mongoOpMsgBody(bsonDoc())),
+		resp: mongoMessage(106, 13, mongoOpMsg, mongoOpMsgBody(bsonDoc(bsonFloat("ok", 1))))},
+	{name: "mongo too short",
+		req:  mongoMessage(13, 0, mongoOpMsg, mongoOpMsgBody(bsonDoc(bsonStr("find", "orders"))))[:10],
+		resp: mongoMessage(106, 13, mongoOpMsg, mongoOpMsgBody(bsonDoc(bsonFloat("ok", 1))))},
+	{name: "amqp unknown class", req: amqpMethod(33, 10)},
+	{name: "amqp wrong frame end", req: func() []byte {
+		frames := amqpPublish("a", "b")
+		frames[18] = 0
+		return frames
+	}()},
+	{name: "amqp truncated body", req: []byte{amqpFrameBody, 0, 1, 0, 0, 1, 0, 'x', 'y'}},
+	{name: "amqp bad response", req: amqpPublish("a", "b"), resp: []byte("HTTP/1.1 200 OK\r\n\r\n")},
+	{name: "amqp too short", req: []byte{1, 0, 1}},
+	{name: "fastcgi no begin request", req: fcgiRecord(fcgiParams, fcgiPair("REQUEST_METHOD", "GET")), resp: fcgiResponse("\r\n")},
+	{name: "fastcgi authorizer role", req: fcgiRecord(fcgiBeginRequest, []byte{0, 2, 0, 0, 0, 0, 0, 0}), resp: fcgiResponse("\r\n")},
+	{name: "fastcgi bad response", req: fcgiRequest(fcgiPair("REQUEST_METHOD", "GET")), resp: []byte("HTTP/1.1 200 OK\r\n\r\n")},
+	{name: "memcached unknown command", req: []byte("fetch key\r\n"), resp: []byte("END\r\n")},
+	{name: "memcached missing key", req: []byte("get\r\n"), resp: []byte("END\r\n")},
+	{name: "memcached bad response", req: []byte("get key\r\n"), resp: []byte("+OK\r\n")},
+	{name: "memcached binary bad magic", req: mcBinPacket(memcachedBinRequest, 0x00, 0, nil, []byte("k"), nil),
+		resp: mcBinPacket(memcachedBinRequest, 0x00, 0, nil, nil, nil)},
+	{name: "cassandra protocol v3", req: cqlMessage(3, 0, 1, cqlOpQuery, cqlLongStr("SELECT 1"))},
+	{name: "cassandra unknown opcode", req: cqlMessage(4, 0, 1, 0x42, cqlLongStr("SELECT 1"))},
+	{name: "cassandra response opcode", req: cqlMessage(4, 0, 1, cqlOpResult, cqlInt(1))},
+	{name: "cassandra wrong response", req: cqlQuery(1, "SELECT 1", 1), resp: cqlQuery(1, "SELECT 1", 1)},
+	{name: "nats no messages", req: []byte("PING\r\n"), resp: []byte("PONG\r\n")},
+	{name: "nats wrong size", req: []byte("PUB orders abc\r\nhello\r\n")},
+	{name: "nats missing arguments", req: []byte("MSG orders 5\r\nhello\r\n")},
+	{name: "nats bad response", req: []byte("PUB orders 5\r\nhello\r\n"), resp: []byte("HTTP/1.1 200 OK\r\n")},
+	{name: "mqtt ping", req: mqttPacket(mqttPingReq, 0), resp: mqttPacket(mqttPingResp, 0)},
+	{name: "mqtt wildcard topic", req: mqttPacket(mqttPublish, 0, mqttStr("sensors/+"), []byte("x"))},
+	{name: "mqtt wrong length", req: append(mqttPacket(mqttPublish, 0, mqttStr("sensors"), []byte("x")), 'x')},
+	{name: "mqtt invalid flags", req: mqttPacket(mqttSubscribe, 0, []byte{0, 2}, mqttStr("sensors"), []byte{1})},
+	{name: "thrift reply first", req: thriftBinary(thriftReply, "getUser", 1, 0)},
+	{name: "thrift different method", req: thriftBinary(thriftCall, "getUser", 1, 0), resp: thriftBinary(thriftReply, "getGroup", 1, 0)},
+	{name: "thrift mixed protocols", req: thriftBinary(thriftCall, "getUser", 1, 0), resp: thriftCompact(thriftReply, "getUser", 1, 0)},
+	{name: "thrift invalid name", req: thriftBinary(thriftCall, "get User", 1, 0)},
+	{name: "thrift invalid type", req: thriftCompact(5, "getUser", 1, 0)},
+	{name: "thrift invalid version", req: []byte{thriftCompactProtocolID, 0x22, 1, 3, 'f', 'o', 'o'}},
+}
+
+func TestTCPProtocolDetection(t *testing.T) {
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	for _, s := range tcpSamples {
+		for _, c := range []struct {
+			name     string
+			event    TCPRequestInfo
+			expected request.EventType
+		}{
+			{name: "client", event: tcpExchange(s.req, s.resp, tcpSend, s.clientPort, s.serverPort), expected: s.client},
+			// the first captured bytes were the response to a previous request
+			{name: "client reversed", event: tcpExchange(s.resp, s.req, tcpRecv, s.serverPort, s.clientPort), expected: s.client},
+			{name: "server", event: tcpExchange(s.req, s.resp, tcpRecv, s.clientPort, s.serverPort), expected: s.server},
+			{name: "server reversed", event: tcpExchange(s.resp, s.req, tcpSend, s.serverPort, s.clientPort), expected: s.server},
+		} {
+			t.Run(s.name+" "+c.name, func(t *testing.T) {
+				span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &c.event), &fltr)
+				require.NoError(t, err)
+				if c.expected == 0 {
+					assert.True(t, ignore)
+					return
+				}
+				require.False(t, ignore)
+				assert.Equal(t, c.expected, span.Type)
+				assert.Equal(t, int(s.serverPort), span.HostPort)
+				assert.Equal(t, int(s.clientPort), span.PeerPort)
+			})
+		}
+	}
+}
+
+func TestTCPProtocolMisdetection(t *testing.T) {
+	for _, d := range tcpDecoders {
+		for _, s := range tcpSamples {
+			if s.protocol == d.protocol {
+				continue
+			}
+			t.Run(d.protocol+" decoder "+s.name, func(t *testing.T) {
+				client := tcpExchange(s.req, s.resp, tcpSend, s.clientPort, s.serverPort)
+				assert.False(t, d.claims(&client, s.req, s.resp))
+				server := tcpExchange(s.req, s.resp, tcpRecv, s.clientPort, s.serverPort)
+				assert.False(t, d.claims(&server, s.req, s.resp))
+				reversed := tcpExchange(s.resp, s.req, tcpRecv, s.serverPort, s.clientPort)
+				assert.False(t, d.claims(&reversed, s.resp, s.req))
+			})
+		}
+		for _, s := range tcpUnknownSamples {
+			t.Run(d.protocol+" decoder "+s.name, func(t *testing.T) {
+				event := tcpExchange(s.req, s.resp, tcpSend, 33007, 8080)
+				assert.False(t, d.claims(&event, s.req, s.resp))
+			})
+		}
+	}
+}
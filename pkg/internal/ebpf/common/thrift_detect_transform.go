@@ -0,0 +1,257 @@
+package ebpfcommon
+
+import (
+	"encoding/binary"
+	"unsafe"
+
+	trace2 "go.opentelemetry.io/otel/trace"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+)
+
+// https://github.com/apache/thrift/blob/master/doc/specs/thrift-binary-protocol.md
+// https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+const (
+	thriftBinaryVersionMask = 0xffff0000
+	thriftBinaryVersion1    = 0x80010000
+	thriftCompactProtocolID = 0x82
+	thriftCompactVersion    = 1
+	thriftMaxNameLen        = 256
+)
+
+// message types
+const (
+	thriftCall      = 1
+	thriftReply     = 2
+	thriftException = 3
+	thriftOneway    = 4
+)
+
+type ThriftInfo struct {
+	Method string
+	// Server is true if the traced process received the call
+	Server bool
+	Error  bool
+}
+
+type thriftMessage struct {
+	name    string
+	msgType byte
+	seqID   int32
+	compact bool
+	// body contains the (probably truncated) struct that follows the message header
+	body []byte
+}
+
+// thriftUnframe removes the frame size of the framed transport, if the buffer starts with it.
+// bufLen is the total length of the buffer, which might have been truncated by eBPF.
+func thriftUnframe(buf []byte, bufLen int) []byte {
+	if len(buf) < 4 {
+		return buf
+	}
+	if size := binary.BigEndian.Uint32(buf); int64(size)+4 == int64(bufLen) {
+		return buf[4:]
+	}
+	return buf
+}
+
+func thriftValidName(name []byte) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for _, c := range name {
+		// service and method names are identifiers. The colon separates
+		// the service name from the method in the multiplexed protocol.
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') &&
+			c != '_' && c != '.' && c != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// thriftVarint reads an unsigned LEB128 integer of up to 32 bits, returning zero read bytes
+// if the buffer doesn't contain a valid one
+func thriftVarint(buf []byte) (uint32, int) {
+	var value uint32
+	for i := 0; i < 5 && i < len(buf); i++ {
+		value |= uint32(buf[i]&0x7f) << (7 * i)
+		if buf[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// parseThriftMessage parses the header of a message in the strict binary protocol or in the
+// compact protocol. The old non-strict binary protocol isn't supported, as its header is too
+// generic to distinguish it from other protocols.
+func parseThriftMessage(buf []byte) (thriftMessage, bool) {
+	if len(buf) < 2 {
+		return thriftMessage{}, false
+	}
+	if buf[0] == thriftCompactProtocolID {
+		return parseThriftCompactMessage(buf)
+	}
+	// version and type (4 bytes), name length (4 bytes), name, sequence id (4 bytes)
+	if len(buf) < 12 {
+		return thriftMessage{}, false
+	}
+	version := binary.BigEndian.Uint32(buf)
+	if version&thriftBinaryVersionMask != thriftBinaryVersion1 || buf[2] != 0 {
+		return thriftMessage{}, false
+	}
+	msg := thriftMessage{msgType: buf[3]}
+	nameLen := binary.BigEndian.Uint32(buf[4:])
+	if nameLen > thriftMaxNameLen || 8+int(nameLen)+4 > len(buf) {
+		return thriftMessage{}, false
+	}
+	name := buf[8 : 8+nameLen]
+	if !thriftValidName(name) {
+		return thriftMessage{}, false
+	}
+	msg.name = string(name)
+	msg.seqID = int32(binary.BigEndian.Uint32(buf[8+nameLen:]))
+	msg.body = buf[8+nameLen+4:]
+	return msg, msg.msgType >= thriftCall && msg.msgType <= thriftOneway
+}
+
+func parseThriftCompactMessage(buf []byte) (thriftMessage, bool) {
+	// the version is stored in the 5 least significant bits, the message type in the 3 most significant bits
+	if buf[1]&0x1f != thriftCompactVersion {
+		return thriftMessage{}, false
+	}
+	msg := thriftMessage{msgType: buf[1] >> 5, compact: true}
+	seqID, n := thriftVarint(buf[2:])
+	if n == 0 {
+		return thriftMessage{}, false
+	}
+	ptr := 2 + n
+	nameLen, n := thriftVarint(buf[ptr:])
+	if n == 0 || nameLen > thriftMaxNameLen || ptr+n+int(nameLen) > len(buf) {
+		return thriftMessage{}, false
+	}
+	ptr += n
+	name := buf[ptr : ptr+int(nameLen)]
+	if !thriftValidName(name) {
+		return thriftMessage{}, false
+	}
+	msg.name = string(name)
+	msg.seqID = int32(seqID)
+	msg.body = buf[ptr+int(nameLen):]
+	return msg, msg.msgType >= thriftCall && msg.msgType <= thriftOneway
+}
+
+// thriftDeclaredException returns true if the result struct of a reply doesn't contain the
+// success value (field id 0) but one of the exceptions declared by the method (field id > 0)
+func thriftDeclaredException(msg *thriftMessage) bool {
+	if len(msg.body) == 0 || msg.body[0] == 0 {
+		// truncated or void result (STOP field)
+		return false
+	}
+	if !msg.compact {
+		// field type (1 byte) and field id (2 bytes)
+		return len(msg.body) >= 3 && int16(binary.BigEndian.Uint16(msg.body[1:])) > 0
+	}
+	// the field id delta is stored in the 4 most significant bits. If it's zero, the field id
+	// follows as a zigzag varint.
+	if delta := msg.body[0] >> 4; delta != 0 {
+		return true
+	}
+	id, n := thriftVarint(msg.body[1:])
+	if n == 0 {
+		return false
+	}
+	return int32(id>>1)^-int32(id&1) > 0
+}
+
+// ProcessThriftEvent decodes the Apache Thrift binary and compact protocols, over the buffered or
+// the framed transport. The request must contain a CALL or ONEWAY message, and the response, if
+// captured, a REPLY or EXCEPTION message to the same method. It returns false if the buffers
+// don't belong to a Thrift conversation.
+func ProcessThriftEvent(event *TCPRequestInfo, req, resp []byte) (*ThriftInfo, bool) {
+	reqLen, respLen := int(event.Len), int(event.RespLen)
+	reversed := false
+	call, ok := parseThriftMessage(thriftUnframe(req, reqLen))
+	if !ok || !thriftRequest(&call) {
+		// we might have caught the event reversed in the middle of communication
+		if call, ok = parseThriftMessage(thriftUnframe(resp, respLen)); !ok || !thriftRequest(&call) {
+			return nil, false
+		}
+		reversed = true
+		req, resp = resp, req
+		reqLen, respLen = respLen, reqLen
+	}
+
+	info := &ThriftInfo{Method: call.name}
+	if len(resp) > 0 {
+		reply, ok := parseThriftMessage(thriftUnframe(resp, respLen))
+		if !ok || reply.compact != call.compact || reply.name != call.name {
+			return nil, false
+		}
+		switch reply.msgType {
+		case thriftException:
+			info.Error = true
+		case thriftReply:
+			info.Error = thriftDeclaredException(&reply)
+		default:
+			return nil, false
+		}
+	}
+
+	if reversed {
+		reverseTCPEvent(event)
+	}
+	// the request was sent by the traced process if its direction is TCP_SEND
+	info.Server = event.Direction != 1
+	return info, true
+}
+
+func thriftRequest(msg *thriftMessage) bool {
+	return msg.msgType == thriftCall || msg.msgType == thriftOneway
+}
+
+func TCPToThriftToSpan(trace *TCPRequestInfo, data *ThriftInfo) request.Span {
+	peer := ""
+	hostname := ""
+	hostPort := 0
+
+	if trace.ConnInfo.S_port != 0 || trace.ConnInfo.D_port != 0 {
+		peer, hostname = (*BPFConnInfo)(unsafe.Pointer(&trace.ConnInfo)).reqHostInfo()
+		hostPort = int(trace.ConnInfo.D_port)
+	}
+
+	eventType := request.EventTypeGRPCClient
+	if data.Server {
+		eventType = request.EventTypeGRPC
+	}
+
+	status := 0
+	if data.Error {
+		status = 1
+	}
+
+	return request.Span{
+		Type:          eventType,
+		RPCKind:       request.RPCThrift,
+		Path:          data.Method,
+		Peer:          peer,
+		PeerPort:      int(trace.ConnInfo.S_port),
+		Host:          hostname,
+		HostPort:      hostPort,
+		ContentLength: int64(trace.Len),
+		RequestStart:  int64(trace.StartMonotimeNs),
+		Start:         int64(trace.StartMonotimeNs),
+		End:           int64(trace.EndMonotimeNs),
+		Status:        status,
+		TraceID:       trace2.TraceID(trace.Tp.TraceId),
+		SpanID:        trace2.SpanID(trace.Tp.SpanId),
+		ParentSpanID:  trace2.SpanID(trace.Tp.ParentId),
+		Flags:         trace.Tp.Flags,
+		Pid: request.PidInfo{
+			HostPID:   trace.Pid.HostPid,
+			UserPID:   trace.Pid.UserPid,
+			Namespace: trace.Pid.Ns,
+		},
+	}
+}
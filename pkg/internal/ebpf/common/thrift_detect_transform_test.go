@@ -0,0 +1,127 @@
+package ebpfcommon
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
+)
+
+// thriftBinary returns a framed message in the strict binary protocol
+func thriftBinary(msgType byte, name string, seqID uint32, body ...byte) []byte {
+	msg := binary.BigEndian.AppendUint32(nil, thriftBinaryVersion1|uint32(msgType))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(name)))
+	msg = append(msg, name...)
+	msg = binary.BigEndian.AppendUint32(msg, seqID)
+	msg = append(msg, body...)
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(msg))), msg...)
+}
+
+// thriftCompact returns an unframed message in the compact protocol
+func thriftCompact(msgType byte, name string, seqID byte, body ...byte) []byte {
+	msg := []byte{thriftCompactProtocolID, msgType<<5 | thriftCompactVersion, seqID, byte(len(name))}
+	msg = append(msg, name...)
+	return append(msg, body...)
+}
+
+func TestThriftBinaryClient(t *testing.T) {
+	// getUser(1: i64 id): field 1, type i64
+	req := thriftBinary(thriftCall, "getUser", 7, 10, 0, 1, 0, 0, 0, 0, 0, 0, 0, 42, 0)
+	// success field (id 0), type struct, with an empty struct
+	resp := thriftBinary(thriftReply, "getUser", 7, 12, 0, 0, 0, 0)
+	r := tcpExchange(req, resp, tcpSend, 50001, 9090)
+
+	fltr := TestPidsFilter{services: map[uint32]svc.ID{}}
+	span, ignore, err := ReadTCPRequestIntoSpan(&TracerConfig{}, tcpRecord(t, &r), &fltr)
+	require.NoError(t, err)
+	require.False(t, ignore)
+	assert.Equal(t, request.EventTypeGRPCClient, span.Type)
+	assert.Equal(t, request.RPCThrift, span.RPCKind)
+	assert.Equal(t, "getUser", span.Path)
+	assert.Equal(t, 0, span.Status)
+	assert.Equal(t, codes.Unset, request.SpanStatusCode(&span))
+	assert.Equal(t, 9090, span.HostPort)
+	assert.Equal(t, 50001, span.PeerPort)
+}
+
+func TestThriftCompactServer(t *testing.T) {
+	req := thriftCompact(thriftCall, "Users:ping", 1, 0)
+	// void reply
+	resp := thriftCompact(thriftReply, "Users:ping", 1, 0)
+	r := tcpExchange(req, resp, tcpRecv, 50002, 9090)
+
+	info, ok := ProcessThriftEvent(&r, req, resp)
+	require.True(t, ok)
+	require.NotNil(t, info)
+	assert.Equal(t, "Users:ping", info.Method)
+	assert.True(t, info.Server)
+	assert.False(t, info.Error)
+
+	span := TCPToThriftToSpan(&r, info)
+	assert.Equal(t, request.EventTypeGRPC, span.Type)
+	assert.Equal(t, 9090, span.HostPort)
+}
+
+func TestThriftExceptions(t *testing.T) {
+	for _, ts := range []struct {
+		name string
+		req  []byte
+		resp []byte
+	}{{
+		name: "binary application exception",
+		req:  thriftBinary(thriftCall, "deleteUser", 3, 0),
+		// TApplicationException struct: 1: string message
+		resp: thriftBinary(thriftException, "deleteUser", 3, 11, 0, 1, 0, 0, 0, 2, 'k', 'o', 0),
+	}, {
+		name: "binary declared exception",
+		req:  thriftBinary(thriftCall, "deleteUser", 4, 0),
+		// field 1 of the result struct: the first exception declared by the method
+		resp: thriftBinary(thriftReply, "deleteUser", 4, 12, 0, 1, 0, 0),
+	}, {
+		name: "compact application exception",
+		req:  thriftCompact(thriftCall, "deleteUser", 5, 0),
+		resp: thriftCompact(thriftException, "deleteUser", 5, 0x18, 2, 'k', 'o', 0),
+	}, {
+		name: "compact declared exception",
+		req:  thriftCompact(thriftCall, "deleteUser", 6, 0),
+		// field delta 2, type struct
+		resp: thriftCompact(thriftReply, "deleteUser", 6, 0x2c, 0, 0),
+	}} {
+		t.Run(ts.name, func(t *testing.T) {
+			r := tcpExchange(ts.req, ts.resp, tcpSend, 50003, 9090)
+			info, ok := ProcessThriftEvent(&r, ts.req, ts.resp)
+			require.True(t, ok)
+			require.NotNil(t, info)
+			assert.True(t, info.Error)
+
+			span := TCPToThriftToSpan(&r, info)
+			assert.Equal(t, codes.Error, request.SpanStatusCode(&span))
+		})
+	}
+}
+
+func TestThriftCompactSuccessField(t *testing.T) {
+	req := thriftCompact(thriftCall, "count", 9, 0)
+	// field id 0 can't be encoded as a delta, so it follows as a zigzag varint. Type i32.
+	resp := thriftCompact(thriftReply, "count", 9, 0x05, 0, 0x54, 0)
+	r := tcpExchange(req, resp, tcpSend, 50004, 9090)
+
+	info, ok := ProcessThriftEvent(&r, req, resp)
+	require.True(t, ok)
+	assert.False(t, info.Error)
+}
+
+func TestThriftOneway(t *testing.T) {
+	req := thriftBinary(thriftOneway, "log", 1, 0)
+	r := tcpExchange(req, nil, tcpSend, 50005, 9090)
+
+	info, ok := ProcessThriftEvent(&r, req, nil)
+	require.True(t, ok)
+	assert.Equal(t, "log", info.Method)
+	assert.False(t, info.Error)
+}
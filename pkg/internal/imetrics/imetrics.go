@@ -26,6 +26,17 @@ type Reporter interface {
 	OTELTraceExport(i int)
 	// OTELTraceExportError is invoked every time the OpenTelemetry Traces export fails with an error
 	OTELTraceExportError(err error)
+	// OTELExportQueueLength is invoked every time the number of batches stored in the persistent queue
+	// of an OpenTelemetry exporter changes
+	OTELExportQueueLength(queue string, len int)
+	// OTELExportQueueDrop is invoked every time that an OpenTelemetry exporter can't store a batch in its persistent
+	// queue. It accounts the length, in spans or data points, of the dropped batch.
+	OTELExportQueueDrop(queue string, len int)
+	// TailSamplingDecision is invoked every time that the tail sampler decides whether a trace is sampled or not.
+	// The policy is the name of the first matching policy, or empty if the trace is not sampled.
+	TailSamplingDecision(policy string, sampled bool)
+	// TailSamplingBufferedSpans is invoked every time the number of spans buffered by the tail sampler changes
+	TailSamplingBufferedSpans(len int)
 	// PrometheusRequest is invoked every time the Prometheus exporter is invoked, for a given port and path
 	PrometheusRequest(port, path string)
 	// InstrumentProcess is invoked every time a new process is instrumented
@@ -37,12 +48,16 @@ type Reporter interface {
 // NoopReporter is a metrics Reporter that just does nothing
 type NoopReporter struct{}
 
-func (n NoopReporter) Start(_ context.Context)       {}
-func (n NoopReporter) TracerFlush(_ int)             {}
-func (n NoopReporter) OTELMetricExport(_ int)        {}
-func (n NoopReporter) OTELMetricExportError(_ error) {}
-func (n NoopReporter) OTELTraceExport(_ int)         {}
-func (n NoopReporter) OTELTraceExportError(_ error)  {}
-func (n NoopReporter) PrometheusRequest(_, _ string) {}
-func (n NoopReporter) InstrumentProcess(_ string)    {}
-func (n NoopReporter) UninstrumentProcess(_ string)  {}
+func (n NoopReporter) Start(_ context.Context)               {}
+func (n NoopReporter) TracerFlush(_ int)                     {}
+func (n NoopReporter) OTELMetricExport(_ int)                {}
+func (n NoopReporter) OTELMetricExportError(_ error)         {}
+func (n NoopReporter) OTELTraceExport(_ int)                 {}
+func (n NoopReporter) OTELTraceExportError(_ error)          {}
+func (n NoopReporter) OTELExportQueueLength(_ string, _ int) {}
+func (n NoopReporter) OTELExportQueueDrop(_ string, _ int)   {}
+func (n NoopReporter) TailSamplingDecision(_ string, _ bool) {}
+func (n NoopReporter) TailSamplingBufferedSpans(_ int)       {}
+func (n NoopReporter) PrometheusRequest(_, _ string)         {}
+func (n NoopReporter) InstrumentProcess(_ string)            {}
+func (n NoopReporter) UninstrumentProcess(_ string)          {}
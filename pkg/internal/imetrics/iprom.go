@@ -29,6 +29,10 @@ type PrometheusReporter struct {
 	otelMetricExportErrs  *prometheus.CounterVec
 	otelTraceExports      prometheus.Counter
 	otelTraceExportErrs   *prometheus.CounterVec
+	otelExportQueueLength *prometheus.GaugeVec
+	otelExportQueueDrops  *prometheus.CounterVec
+	tailSamplingTraces    *prometheus.CounterVec
+	tailSamplingSpans     prometheus.Gauge
 	prometheusRequests    *prometheus.CounterVec
 	instrumentedProcesses *prometheus.GaugeVec
 	beylaInfo             prometheus.Gauge
@@ -61,6 +65,22 @@ func NewPrometheusReporter(cfg *PrometheusConfig, manager *connector.PrometheusM
 			Name: "beyla_otel_trace_export_errors_total",
 			Help: "Error count on each failed OTEL trace export",
 		}, []string{"error"}),
+		otelExportQueueLength: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "beyla_otel_export_queue_length",
+			Help: "Number of batches stored in the persistent queue of the OTEL exporters",
+		}, []string{"queue"}),
+		otelExportQueueDrops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_otel_export_queue_dropped_total",
+			Help: "Spans or data points dropped because the persistent queue of the OTEL exporters is full",
+		}, []string{"queue"}),
+		tailSamplingTraces: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "beyla_tail_sampling_traces_total",
+			Help: "Traces evaluated by the tail sampler, by decision and first matching policy",
+		}, []string{"decision", "policy"}),
+		tailSamplingSpans: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "beyla_tail_sampling_buffered_spans",
+			Help: "Number of spans buffered by the tail sampler, waiting for a sampling decision",
+		}),
 		prometheusRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "beyla_prometheus_http_requests_total",
 			Help: "Requests towards the Prometheus Scrape endpoint",
@@ -88,6 +108,10 @@ func NewPrometheusReporter(cfg *PrometheusConfig, manager *connector.PrometheusM
 			pr.otelMetricExportErrs,
 			pr.otelTraceExports,
 			pr.otelTraceExportErrs,
+			pr.otelExportQueueLength,
+			pr.otelExportQueueDrops,
+			pr.tailSamplingTraces,
+			pr.tailSamplingSpans,
 			pr.prometheusRequests,
 			pr.instrumentedProcesses,
 			pr.beylaInfo)
@@ -98,6 +122,10 @@ func NewPrometheusReporter(cfg *PrometheusConfig, manager *connector.PrometheusM
 			pr.otelMetricExportErrs,
 			pr.otelTraceExports,
 			pr.otelTraceExportErrs,
+			pr.otelExportQueueLength,
+			pr.otelExportQueueDrops,
+			pr.tailSamplingTraces,
+			pr.tailSamplingSpans,
 			pr.prometheusRequests,
 			pr.instrumentedProcesses,
 			pr.beylaInfo)
@@ -133,6 +161,26 @@ func (p *PrometheusReporter) OTELTraceExportError(err error) {
 	p.otelTraceExportErrs.WithLabelValues(err.Error()).Inc()
 }
 
+func (p *PrometheusReporter) OTELExportQueueLength(queue string, len int) {
+	p.otelExportQueueLength.WithLabelValues(queue).Set(float64(len))
+}
+
+func (p *PrometheusReporter) OTELExportQueueDrop(queue string, len int) {
+	p.otelExportQueueDrops.WithLabelValues(queue).Add(float64(len))
+}
+
+func (p *PrometheusReporter) TailSamplingDecision(policy string, sampled bool) {
+	decision := "dropped"
+	if sampled {
+		decision = "sampled"
+	}
+	p.tailSamplingTraces.WithLabelValues(decision, policy).Inc()
+}
+
+func (p *PrometheusReporter) TailSamplingBufferedSpans(len int) {
+	p.tailSamplingSpans.Set(float64(len))
+}
+
 func (p *PrometheusReporter) PrometheusRequest(port, path string) {
 	p.prometheusRequests.WithLabelValues(port, path).Inc()
 }
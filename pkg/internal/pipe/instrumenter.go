@@ -6,12 +6,15 @@ import (
 	"github.com/mariomac/pipes/pipe"
 
 	"github.com/grafana/beyla/pkg/beyla"
+	"github.com/grafana/beyla/pkg/export/accesslog"
 	"github.com/grafana/beyla/pkg/export/alloy"
 	"github.com/grafana/beyla/pkg/export/attributes"
 	attr "github.com/grafana/beyla/pkg/export/attributes/names"
 	"github.com/grafana/beyla/pkg/export/debug"
 	"github.com/grafana/beyla/pkg/export/otel"
 	"github.com/grafana/beyla/pkg/export/prom"
+	"github.com/grafana/beyla/pkg/export/statsd"
+	"github.com/grafana/beyla/pkg/export/zipkin"
 	"github.com/grafana/beyla/pkg/internal/filter"
 	"github.com/grafana/beyla/pkg/internal/imetrics"
 	"github.com/grafana/beyla/pkg/internal/pipe/global"
@@ -35,11 +38,23 @@ type nodesMap struct {
 
 	AttributeFilter pipe.Middle[[]request.Span, []request.Span]
 
-	AlloyTraces pipe.Final[[]request.Span]
-	Metrics     pipe.Final[[]request.Span]
-	Traces      pipe.Final[[]request.Span]
-	Prometheus  pipe.Final[[]request.Span]
-	Printer     pipe.Final[[]request.Span]
+	// Redactor is an optional pipe. If not enabled, data will be bypassed to the exporters.
+	Redactor pipe.Middle[[]request.Span, []request.Span]
+
+	// TailSampler is an optional pipe. If not enabled, data will be bypassed to the OTEL traces exporter.
+	TailSampler pipe.Middle[[]request.Span, []request.Span]
+
+	AlloyTraces  pipe.Final[[]request.Span]
+	AlloyMetrics pipe.Final[[]request.Span]
+	Metrics      pipe.Final[[]request.Span]
+	Traces       pipe.Final[[]request.Span]
+	FileMetrics  pipe.Final[[]request.Span]
+	FileTraces   pipe.Final[[]request.Span]
+	Zipkin       pipe.Final[[]request.Span]
+	AccessLog    pipe.Final[[]request.Span]
+	Prometheus   pipe.Final[[]request.Span]
+	StatsD       pipe.Final[[]request.Span]
+	Printer      pipe.Final[[]request.Span]
 
 	ProcessReport pipe.Final[[]request.Span]
 }
@@ -52,7 +67,9 @@ func (n *nodesMap) Connect() {
 	n.Routes.SendTo(n.Kubernetes)
 	n.Kubernetes.SendTo(n.NameResolver)
 	n.NameResolver.SendTo(n.AttributeFilter)
-	n.AttributeFilter.SendTo(n.AlloyTraces, n.Metrics, n.Traces, n.Prometheus, n.Printer, n.ProcessReport)
+	n.AttributeFilter.SendTo(n.Redactor)
+	n.Redactor.SendTo(n.AlloyTraces, n.AlloyMetrics, n.Metrics, n.TailSampler, n.FileMetrics, n.FileTraces, n.Zipkin, n.AccessLog, n.Prometheus, n.StatsD, n.Printer, n.ProcessReport)
+	n.TailSampler.SendTo(n.Traces)
 }
 
 // accessor functions to each field. Grouped here for code brevity during the pipeline build
@@ -61,11 +78,19 @@ func router(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span]       { re
 func kubernetes(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span]   { return &n.Kubernetes }
 func nameResolver(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span] { return &n.NameResolver }
 func attrFilter(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span]   { return &n.AttributeFilter }
+func redactor(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span]     { return &n.Redactor }
+func tailSampler(n *nodesMap) *pipe.Middle[[]request.Span, []request.Span]  { return &n.TailSampler }
 func alloyTraces(n *nodesMap) *pipe.Final[[]request.Span]                   { return &n.AlloyTraces }
+func alloyMetrics(n *nodesMap) *pipe.Final[[]request.Span]                  { return &n.AlloyMetrics }
 func otelMetrics(n *nodesMap) *pipe.Final[[]request.Span]                   { return &n.Metrics }
 func otelTraces(n *nodesMap) *pipe.Final[[]request.Span]                    { return &n.Traces }
+func fileMetrics(n *nodesMap) *pipe.Final[[]request.Span]                   { return &n.FileMetrics }
+func fileTraces(n *nodesMap) *pipe.Final[[]request.Span]                    { return &n.FileTraces }
+func zipkinTraces(n *nodesMap) *pipe.Final[[]request.Span]                  { return &n.Zipkin }
+func accessLog(n *nodesMap) *pipe.Final[[]request.Span]                     { return &n.AccessLog }
 func printer(n *nodesMap) *pipe.Final[[]request.Span]                       { return &n.Printer }
 func prometheus(n *nodesMap) *pipe.Final[[]request.Span]                    { return &n.Prometheus }
+func statsdMetrics(n *nodesMap) *pipe.Final[[]request.Span]                 { return &n.StatsD }
 func processReport(n *nodesMap) *pipe.Final[[]request.Span]                 { return &n.ProcessReport }
 
 // builder with injectable instantiators for unit testing
@@ -106,16 +131,24 @@ func newGraphBuilder(ctx context.Context, config *beyla.Config, ctxInfo *global.
 		TracesInput: gb.tracesCh,
 	}))
 
-	pipe.AddMiddleProvider(gnb, router, transform.RoutesProvider(config.Routes))
+	pipe.AddMiddleProvider(gnb, router, transform.RoutesProvider(config.Routes, config.Discovery.Services))
 	pipe.AddMiddleProvider(gnb, kubernetes, transform.KubeDecoratorProvider(ctx, &config.Attributes.Kubernetes, ctxInfo))
 	pipe.AddMiddleProvider(gnb, nameResolver, transform.NameResolutionProvider(gb.ctxInfo, config.NameResolver))
 	pipe.AddMiddleProvider(gnb, attrFilter, filter.ByAttribute(config.Filters.Application, spanPtrPromGetters))
+	pipe.AddMiddleProvider(gnb, redactor, transform.RedactProvider(&config.Redact))
 	config.Metrics.Grafana = &gb.config.Grafana.OTLP
 	pipe.AddFinalProvider(gnb, otelMetrics, otel.ReportMetrics(ctx, gb.ctxInfo, &config.Metrics, config.Attributes.Select))
 	config.Traces.Grafana = &gb.config.Grafana.OTLP
+	pipe.AddMiddleProvider(gnb, tailSampler, otel.TailSamplerProvider(ctx, &config.Traces, gb.ctxInfo))
 	pipe.AddFinalProvider(gnb, otelTraces, otel.TracesReceiver(ctx, config.Traces, gb.ctxInfo, config.Attributes.Select))
+	pipe.AddFinalProvider(gnb, fileMetrics, otel.FileMetricsReporter(ctx, gb.ctxInfo, &config.OTLPFile, &config.Metrics, config.Attributes.Select))
+	pipe.AddFinalProvider(gnb, fileTraces, otel.FileTracesReceiver(ctx, &config.OTLPFile, config.Traces, gb.ctxInfo, config.Attributes.Select))
+	pipe.AddFinalProvider(gnb, zipkinTraces, zipkin.TracesReceiver(ctx, gb.ctxInfo, &config.Zipkin, config.Attributes.Select))
+	pipe.AddFinalProvider(gnb, accessLog, accesslog.Exporter(ctx, gb.ctxInfo, &config.AccessLog))
 	pipe.AddFinalProvider(gnb, prometheus, prom.PrometheusEndpoint(ctx, gb.ctxInfo, &config.Prometheus, config.Attributes.Select))
+	pipe.AddFinalProvider(gnb, statsdMetrics, statsd.ReportMetrics(ctx, gb.ctxInfo, &config.StatsD, config.Attributes.Select))
 	pipe.AddFinalProvider(gnb, alloyTraces, alloy.TracesReceiver(ctx, gb.ctxInfo, &config.TracesReceiver, config.Attributes.Select))
+	pipe.AddFinalProvider(gnb, alloyMetrics, alloy.MetricsReceiver(ctx, gb.ctxInfo, &config.TracesReceiver, &config.Metrics, config.Attributes.Select))
 
 	pipe.AddFinalProvider(gnb, printer, debug.PrinterNode(config.TracePrinter))
 
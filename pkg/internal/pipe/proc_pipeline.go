@@ -8,6 +8,7 @@ import (
 	"github.com/mariomac/pipes/pipe"
 
 	"github.com/grafana/beyla/pkg/beyla"
+	"github.com/grafana/beyla/pkg/export/alloy"
 	"github.com/grafana/beyla/pkg/export/otel"
 	"github.com/grafana/beyla/pkg/export/prom"
 	"github.com/grafana/beyla/pkg/internal/infraolly/process"
@@ -19,23 +20,25 @@ import (
 // Its management is moved here because it's only activated if the process
 // metrics are activated.
 type processSubPipeline struct {
-	Collector  pipe.Start[[]*process.Status]
-	OtelExport pipe.Final[[]*process.Status]
-	PromExport pipe.Final[[]*process.Status]
+	Collector   pipe.Start[[]*process.Status]
+	OtelExport  pipe.Final[[]*process.Status]
+	PromExport  pipe.Final[[]*process.Status]
+	AlloyExport pipe.Final[[]*process.Status]
 }
 
 func procCollect(sp *processSubPipeline) *pipe.Start[[]*process.Status] { return &sp.Collector }
 func otelExport(sp *processSubPipeline) *pipe.Final[[]*process.Status]  { return &sp.OtelExport }
 func promExport(sp *processSubPipeline) *pipe.Final[[]*process.Status]  { return &sp.PromExport }
+func alloyExport(sp *processSubPipeline) *pipe.Final[[]*process.Status] { return &sp.AlloyExport }
 
 func (sp *processSubPipeline) Connect() {
-	sp.Collector.SendTo(sp.OtelExport, sp.PromExport)
+	sp.Collector.SendTo(sp.OtelExport, sp.PromExport, sp.AlloyExport)
 }
 
-// the sub-pipe is enabled only if there is a metrics exporter enabled,
+// the sub-pipe is enabled only if there is a metrics exporter (or Alloy metrics consumer) enabled,
 // and both the "application" and "application_process" features are enabled
 func isSubPipeEnabled(cfg *beyla.Config) bool {
-	return (cfg.Metrics.EndpointEnabled() && cfg.Metrics.OTelMetricsEnabled() &&
+	return ((cfg.Metrics.EndpointEnabled() || cfg.TracesReceiver.MetricsEnabled()) && cfg.Metrics.OTelMetricsEnabled() &&
 		slices.Contains(cfg.Metrics.Features, otel.FeatureProcess)) ||
 		(cfg.Prometheus.EndpointEnabled() && cfg.Prometheus.OTelMetricsEnabled() &&
 			slices.Contains(cfg.Prometheus.Features, otel.FeatureProcess))
@@ -57,6 +60,11 @@ func SubPipelineProvider(ctx context.Context, ctxInfo *global.ContextInfo, cfg *
 				Metrics:            &cfg.Metrics,
 				AttributeSelectors: cfg.Attributes.Select,
 			}))
+		pipe.AddFinalProvider(nb, alloyExport, alloy.ProcMetricsReceiver(ctx, ctxInfo, &cfg.TracesReceiver,
+			&otel.ProcMetricsConfig{
+				Metrics:            &cfg.Metrics,
+				AttributeSelectors: cfg.Attributes.Select,
+			}))
 		pipe.AddFinalProvider(nb, promExport, prom.ProcPrometheusEndpoint(ctx, ctxInfo,
 			&prom.ProcPrometheusConfig{
 				Metrics:            &cfg.Prometheus,
@@ -95,6 +95,52 @@ func DBSystem(val string) attribute.KeyValue {
 	return attribute.Key(semconv.DBSystemKey).String(val)
 }
 
+func DBNamespace(val string) attribute.KeyValue {
+	return attribute.Key(attr.DBNamespace).String(val)
+}
+
+func DBOperationBatchSize(val int) attribute.KeyValue {
+	return attribute.Key(attr.DBOperationBatchSize).Int(val)
+}
+
+func CacheOutcomeMetric(val string) attribute.KeyValue {
+	return attribute.Key(attr.CacheOutcome).String(val)
+}
+
+func TCPRequestBytes(val int64) attribute.KeyValue {
+	return attribute.Key(attr.TCPRequestBytes).Int64(val)
+}
+
+func TCPResponseBytes(val int64) attribute.KeyValue {
+	return attribute.Key(attr.TCPResponseBytes).Int64(val)
+}
+
+func DBResponseStatusCode(val string) attribute.KeyValue {
+	return attribute.Key(attr.DBResponseStatusCode).String(val)
+}
+
+// RPCSystemName returns the rpc.system value of an RPC span
+func RPCSystemName(span *Span) attribute.KeyValue {
+	if span.RPCKind == RPCThrift {
+		return semconv.RPCSystemKey.String("thrift")
+	}
+	return semconv.RPCSystemGRPC
+}
+
+// DBSystemName returns the db.system value of a SQL client span, according to the
+// database flavour detected from the wire protocol
+func DBSystemName(span *Span) attribute.KeyValue {
+	switch span.SQLKind {
+	case DBPostgres:
+		return semconv.DBSystemPostgreSQL
+	case DBMySQL:
+		return semconv.DBSystemMySQL
+	case DBCassandra:
+		return semconv.DBSystemCassandra
+	}
+	return semconv.DBSystemOtherSQL
+}
+
 func ErrorType(val string) attribute.KeyValue {
 	return attribute.Key(attr.ErrorType).String(val)
 }
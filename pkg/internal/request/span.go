@@ -30,6 +30,14 @@ const (
 	EventTypeKafkaClient
 	EventTypeRedisServer
 	EventTypeKafkaServer
+	EventTypeMongoClient
+	EventTypeAMQPClient
+	EventTypeAMQPServer
+	EventTypeMemcachedClient
+	EventTypeNATSClient
+	EventTypeMQTTClient
+	EventTypeTCPClient
+	EventTypeTCPServer
 )
 
 const (
@@ -59,6 +67,22 @@ func (t EventType) String() string {
 		return "RedisServer"
 	case EventTypeKafkaServer:
 		return "KafkaServer"
+	case EventTypeMongoClient:
+		return "MongoClient"
+	case EventTypeAMQPClient:
+		return "AMQPClient"
+	case EventTypeAMQPServer:
+		return "AMQPServer"
+	case EventTypeMemcachedClient:
+		return "MemcachedClient"
+	case EventTypeNATSClient:
+		return "NATSClient"
+	case EventTypeMQTTClient:
+		return "MQTTClient"
+	case EventTypeTCPClient:
+		return "TCPClient"
+	case EventTypeTCPServer:
+		return "TCPServer"
 	default:
 		return fmt.Sprintf("UNKNOWN (%d)", t)
 	}
@@ -97,6 +121,65 @@ const (
 	MessagingProcess = "process"
 )
 
+// MessagingSystemName returns the messaging.system value of a messaging span
+func MessagingSystemName(span *Span) string {
+	switch span.Type {
+	case EventTypeKafkaClient, EventTypeKafkaServer:
+		return "kafka"
+	case EventTypeAMQPClient, EventTypeAMQPServer:
+		return "rabbitmq"
+	case EventTypeNATSClient:
+		return "nats"
+	case EventTypeMQTTClient:
+		return "mqtt"
+	}
+	return "unknown"
+}
+
+// SQLKind identifies the database system behind an EventTypeSQLClient span,
+// when it can be inferred from the wire protocol
+type SQLKind int
+
+const (
+	DBGeneric SQLKind = iota
+	DBPostgres
+	DBMySQL
+	DBCassandra
+)
+
+// RPCKind identifies the RPC framework behind an EventTypeGRPC or EventTypeGRPCClient span
+type RPCKind int
+
+const (
+	RPCGRPC RPCKind = iota
+	RPCThrift
+)
+
+// CacheOutcome is the result of the cache lookup of an EventTypeMemcachedClient span
+type CacheOutcome int
+
+const (
+	CacheUnknown CacheOutcome = iota
+	CacheHit
+	CacheMiss
+)
+
+func (c CacheOutcome) String() string {
+	switch c {
+	case CacheHit:
+		return "hit"
+	case CacheMiss:
+		return "miss"
+	}
+	return ""
+}
+
+// DBError contains the error information as reported by the database server
+type DBError struct {
+	ErrorCode   string
+	Description string
+}
+
 type converter struct {
 	clock     func() time.Time
 	monoClock func() time.Duration
@@ -144,6 +227,18 @@ type Span struct {
 	HostName       string         `json:"hostName"`
 	OtherNamespace string         `json:"-"`
 	Statement      string         `json:"-"`
+	SQLKind        SQLKind        `json:"-"`
+	RPCKind        RPCKind        `json:"-"`
+	CacheOutcome   CacheOutcome   `json:"-"`
+	DBError        DBError        `json:"-"`
+	DBNamespace    string         `json:"-"`
+	DBConsistency  string         `json:"-"`
+	DBBatchSize    int            `json:"-"`
+	KeyCount       int            `json:"-"`
+	ResponseLength int64          `json:"-"`
+	// RequestHeaders contains the values of the captured HTTP request headers, keyed by their
+	// normalized name, as returned by attr.HTTPHeaderKey
+	RequestHeaders map[string]string `json:"-"`
 }
 
 func (s *Span) Inside(parent *Span) bool {
@@ -213,6 +308,46 @@ func spanAttributes(s *Span) SpanAttributes {
 			"operation":  s.Method,
 			"clientId":   s.OtherNamespace,
 		}
+	case EventTypeMongoClient:
+		return SpanAttributes{
+			"serverAddr": SpanHost(s),
+			"serverPort": strconv.Itoa(s.HostPort),
+			"operation":  s.Method,
+			"collection": s.Path,
+			"database":   s.DBNamespace,
+		}
+	case EventTypeAMQPClient, EventTypeAMQPServer:
+		return SpanAttributes{
+			"serverAddr":  SpanHost(s),
+			"serverPort":  strconv.Itoa(s.HostPort),
+			"operation":   s.Method,
+			"destination": s.Path,
+			"routingKey":  s.Statement,
+		}
+	case EventTypeNATSClient, EventTypeMQTTClient:
+		return SpanAttributes{
+			"serverAddr":  SpanHost(s),
+			"serverPort":  strconv.Itoa(s.HostPort),
+			"operation":   s.Method,
+			"destination": s.Path,
+		}
+	case EventTypeMemcachedClient:
+		return SpanAttributes{
+			"serverAddr": SpanHost(s),
+			"serverPort": strconv.Itoa(s.HostPort),
+			"operation":  s.Method,
+			"query":      s.Path,
+			"keyCount":   strconv.Itoa(s.KeyCount),
+			"outcome":    s.CacheOutcome.String(),
+		}
+	case EventTypeTCPClient, EventTypeTCPServer:
+		return SpanAttributes{
+			"clientAddr":    SpanPeer(s),
+			"serverAddr":    SpanHost(s),
+			"serverPort":    strconv.Itoa(s.HostPort),
+			"requestBytes":  strconv.FormatInt(s.ContentLength, 10),
+			"responseBytes": strconv.FormatInt(s.ResponseLength, 10),
+		}
 	}
 
 	return SpanAttributes{}
@@ -290,7 +425,9 @@ func (s *Span) IsValid() bool {
 
 func (s *Span) IsClientSpan() bool {
 	switch s.Type {
-	case EventTypeGRPCClient, EventTypeHTTPClient, EventTypeRedisClient, EventTypeKafkaClient, EventTypeSQLClient:
+	case EventTypeGRPCClient, EventTypeHTTPClient, EventTypeRedisClient, EventTypeKafkaClient, EventTypeSQLClient,
+		EventTypeMongoClient, EventTypeAMQPClient, EventTypeMemcachedClient, EventTypeNATSClient, EventTypeMQTTClient,
+		EventTypeTCPClient:
 		return true
 	}
 
@@ -326,8 +463,17 @@ func SpanStatusCode(span *Span) codes.Code {
 	case EventTypeHTTP, EventTypeHTTPClient:
 		return HTTPSpanStatusCode(span)
 	case EventTypeGRPC, EventTypeGRPCClient:
+		if span.RPCKind == RPCThrift {
+			// Thrift spans only distinguish successful replies from exceptions
+			if span.Status != 0 {
+				return codes.Error
+			}
+			return codes.Unset
+		}
 		return GrpcSpanStatusCode(span)
-	case EventTypeSQLClient, EventTypeRedisClient, EventTypeRedisServer:
+	case EventTypeSQLClient, EventTypeRedisClient, EventTypeRedisServer, EventTypeMongoClient,
+		EventTypeMemcachedClient, EventTypeNATSClient, EventTypeMQTTClient,
+		EventTypeAMQPClient, EventTypeAMQPServer:
 		if span.Status != 0 {
 			return codes.Error
 		}
@@ -389,11 +535,13 @@ func (s *Span) RequestLength() int64 {
 // ServiceGraphKind returns the Kind string representation that is compliant with service graph metrics specification
 func (s *Span) ServiceGraphKind() string {
 	switch s.Type {
-	case EventTypeHTTP, EventTypeGRPC, EventTypeKafkaServer, EventTypeRedisServer:
+	case EventTypeHTTP, EventTypeGRPC, EventTypeKafkaServer, EventTypeRedisServer, EventTypeAMQPServer,
+		EventTypeTCPServer:
 		return "SPAN_KIND_SERVER"
-	case EventTypeHTTPClient, EventTypeGRPCClient, EventTypeSQLClient, EventTypeRedisClient:
+	case EventTypeHTTPClient, EventTypeGRPCClient, EventTypeSQLClient, EventTypeRedisClient, EventTypeMongoClient,
+		EventTypeMemcachedClient, EventTypeTCPClient:
 		return "SPAN_KIND_CLIENT"
-	case EventTypeKafkaClient:
+	case EventTypeKafkaClient, EventTypeAMQPClient, EventTypeNATSClient, EventTypeMQTTClient:
 		switch s.Method {
 		case MessagingPublish:
 			return "SPAN_KIND_PRODUCER"
@@ -416,9 +564,12 @@ func (s *Span) TraceName() string {
 		return s.Path
 	case EventTypeHTTPClient:
 		return s.Method
-	case EventTypeSQLClient:
+	case EventTypeSQLClient, EventTypeMongoClient:
 		operation := s.Method
 		if operation == "" {
+			if s.Type == EventTypeMongoClient {
+				return "MONGO"
+			}
 			return "SQL"
 		}
 		table := s.Path
@@ -431,11 +582,19 @@ func (s *Span) TraceName() string {
 			return "REDIS"
 		}
 		return s.Method
-	case EventTypeKafkaClient, EventTypeKafkaServer:
+	case EventTypeMemcachedClient:
+		if s.Method == "" {
+			return "MEMCACHED"
+		}
+		return s.Method
+	case EventTypeKafkaClient, EventTypeKafkaServer, EventTypeAMQPClient, EventTypeAMQPServer,
+		EventTypeNATSClient, EventTypeMQTTClient:
 		if s.Path == "" {
 			return s.Method
 		}
 		return fmt.Sprintf("%s %s", s.Path, s.Method)
+	case EventTypeTCPClient, EventTypeTCPServer:
+		return "TCP"
 	}
 	return ""
 }
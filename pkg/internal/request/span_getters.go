@@ -2,6 +2,7 @@ package request
 
 import (
 	"strconv"
+	"strings"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -43,9 +44,15 @@ func SpanOTELGetters(name attr.Name) (attributes.Getter[*Span, attribute.KeyValu
 	case attr.RPCMethod:
 		getter = func(s *Span) attribute.KeyValue { return semconv.RPCMethod(s.Path) }
 	case attr.RPCSystem:
-		getter = func(_ *Span) attribute.KeyValue { return semconv.RPCSystemGRPC }
+		getter = RPCSystemName
 	case attr.RPCGRPCStatusCode:
-		getter = func(s *Span) attribute.KeyValue { return semconv.RPCGRPCStatusCodeKey.Int(s.Status) }
+		getter = func(s *Span) attribute.KeyValue {
+			if s.RPCKind != RPCGRPC {
+				// an invalid attribute is omitted from the exported metric
+				return attribute.KeyValue{}
+			}
+			return semconv.RPCGRPCStatusCodeKey.Int(s.Status)
+		}
 	case attr.Server:
 		getter = func(s *Span) attribute.KeyValue { return ServerMetric(SpanHost(s)) }
 	case attr.ServerNamespace:
@@ -77,12 +84,20 @@ func SpanOTELGetters(name attr.Name) (attributes.Getter[*Span, attribute.KeyValu
 		getter = func(span *Span) attribute.KeyValue {
 			switch span.Type {
 			case EventTypeSQLClient:
-				return DBSystem(semconv.DBSystemOtherSQL.Value.AsString())
+				return DBSystemName(span)
 			case EventTypeRedisClient, EventTypeRedisServer:
 				return DBSystem(semconv.DBSystemRedis.Value.AsString())
+			case EventTypeMongoClient:
+				return DBSystem(semconv.DBSystemMongoDB.Value.AsString())
+			case EventTypeMemcachedClient:
+				return DBSystem(semconv.DBSystemMemcached.Value.AsString())
 			}
 			return DBSystem("unknown")
 		}
+	case attr.DBNamespace:
+		getter = func(span *Span) attribute.KeyValue { return DBNamespace(span.DBNamespace) }
+	case attr.CacheOutcome:
+		getter = func(span *Span) attribute.KeyValue { return CacheOutcomeMetric(cacheOutcome(span)) }
 	case attr.ErrorType:
 		getter = func(span *Span) attribute.KeyValue {
 			if SpanStatusCode(span) == codes.Error {
@@ -92,18 +107,21 @@ func SpanOTELGetters(name attr.Name) (attributes.Getter[*Span, attribute.KeyValu
 		}
 	case attr.MessagingSystem:
 		getter = func(span *Span) attribute.KeyValue {
-			if span.Type == EventTypeKafkaClient || span.Type == EventTypeKafkaServer {
-				return semconv.MessagingSystem("kafka")
-			}
-			return semconv.MessagingSystem("unknown")
+			return semconv.MessagingSystem(MessagingSystemName(span))
 		}
 	case attr.MessagingDestination:
 		getter = func(span *Span) attribute.KeyValue {
-			if span.Type == EventTypeKafkaClient || span.Type == EventTypeKafkaServer {
+			switch span.Type {
+			case EventTypeKafkaClient, EventTypeKafkaServer, EventTypeAMQPClient, EventTypeAMQPServer,
+				EventTypeNATSClient, EventTypeMQTTClient:
 				return semconv.MessagingDestinationName(span.Path)
 			}
 			return semconv.MessagingDestinationName("")
 		}
+	default:
+		if header, ok := strings.CutPrefix(string(name), attr.HTTPRequestHeaderPrefix); ok {
+			getter = func(s *Span) attribute.KeyValue { return name.OTEL().String(s.RequestHeaders[header]) }
+		}
 	}
 	// default: unlike the Prometheus getters, we don't check here for service name nor k8s metadata
 	// because they are already attributes of the Resource instead of the attributes.
@@ -133,9 +151,14 @@ func SpanPromGetters(attrName attr.Name) (attributes.Getter[*Span, string], bool
 	case attr.RPCMethod:
 		getter = func(s *Span) string { return s.Path }
 	case attr.RPCSystem:
-		getter = func(_ *Span) string { return "grpc" }
+		getter = func(s *Span) string { return RPCSystemName(s).Value.AsString() }
 	case attr.RPCGRPCStatusCode:
-		getter = func(s *Span) string { return strconv.Itoa(s.Status) }
+		getter = func(s *Span) string {
+			if s.RPCKind != RPCGRPC {
+				return ""
+			}
+			return strconv.Itoa(s.Status)
+		}
 	case attr.DBOperation:
 		getter = func(span *Span) string { return span.Method }
 	case attr.ErrorType:
@@ -149,12 +172,20 @@ func SpanPromGetters(attrName attr.Name) (attributes.Getter[*Span, string], bool
 		getter = func(span *Span) string {
 			switch span.Type {
 			case EventTypeSQLClient:
-				return semconv.DBSystemOtherSQL.Value.AsString()
+				return DBSystemName(span).Value.AsString()
 			case EventTypeRedisClient, EventTypeRedisServer:
 				return semconv.DBSystemRedis.Value.AsString()
+			case EventTypeMongoClient:
+				return semconv.DBSystemMongoDB.Value.AsString()
+			case EventTypeMemcachedClient:
+				return semconv.DBSystemMemcached.Value.AsString()
 			}
 			return "unknown"
 		}
+	case attr.DBNamespace:
+		getter = func(span *Span) string { return span.DBNamespace }
+	case attr.CacheOutcome:
+		getter = cacheOutcome
 	case attr.DBCollectionName:
 		getter = func(span *Span) string {
 			if span.Type == EventTypeSQLClient {
@@ -164,14 +195,13 @@ func SpanPromGetters(attrName attr.Name) (attributes.Getter[*Span, string], bool
 		}
 	case attr.MessagingSystem:
 		getter = func(span *Span) string {
-			if span.Type == EventTypeKafkaClient || span.Type == EventTypeKafkaServer {
-				return "kafka"
-			}
-			return "unknown"
+			return MessagingSystemName(span)
 		}
 	case attr.MessagingDestination:
 		getter = func(span *Span) string {
-			if span.Type == EventTypeKafkaClient || span.Type == EventTypeKafkaServer {
+			switch span.Type {
+			case EventTypeKafkaClient, EventTypeKafkaServer, EventTypeAMQPClient, EventTypeAMQPServer,
+				EventTypeNATSClient, EventTypeMQTTClient:
 				return span.Path
 			}
 			return ""
@@ -189,7 +219,18 @@ func SpanPromGetters(attrName attr.Name) (attributes.Getter[*Span, string], bool
 	case attr.ServiceNamespace:
 		getter = func(s *Span) string { return s.ServiceID.Namespace }
 	default:
-		getter = func(s *Span) string { return s.ServiceID.Metadata[attrName] }
+		if header, ok := strings.CutPrefix(string(attrName), attr.HTTPRequestHeaderPrefix); ok {
+			getter = func(s *Span) string { return s.RequestHeaders[header] }
+		} else {
+			getter = func(s *Span) string { return s.ServiceID.Metadata[attrName] }
+		}
 	}
 	return getter, getter != nil
 }
+
+func cacheOutcome(span *Span) string {
+	if span.Type != EventTypeMemcachedClient {
+		return ""
+	}
+	return span.CacheOutcome.String()
+}
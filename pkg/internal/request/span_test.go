@@ -29,16 +29,24 @@ func TestSpanClientServer(t *testing.T) {
 
 func TestEventTypeString(t *testing.T) {
 	typeStringMap := map[EventType]string{
-		EventTypeHTTP:        "HTTP",
-		EventTypeGRPC:        "GRPC",
-		EventTypeHTTPClient:  "HTTPClient",
-		EventTypeGRPCClient:  "GRPCClient",
-		EventTypeSQLClient:   "SQLClient",
-		EventTypeRedisClient: "RedisClient",
-		EventTypeKafkaClient: "KafkaClient",
-		EventTypeRedisServer: "RedisServer",
-		EventTypeKafkaServer: "KafkaServer",
-		EventType(99):        "UNKNOWN (99)",
+		EventTypeHTTP:            "HTTP",
+		EventTypeGRPC:            "GRPC",
+		EventTypeHTTPClient:      "HTTPClient",
+		EventTypeGRPCClient:      "GRPCClient",
+		EventTypeSQLClient:       "SQLClient",
+		EventTypeRedisClient:     "RedisClient",
+		EventTypeKafkaClient:     "KafkaClient",
+		EventTypeRedisServer:     "RedisServer",
+		EventTypeKafkaServer:     "KafkaServer",
+		EventTypeMongoClient:     "MongoClient",
+		EventTypeAMQPClient:      "AMQPClient",
+		EventTypeAMQPServer:      "AMQPServer",
+		EventTypeMemcachedClient: "MemcachedClient",
+		EventTypeNATSClient:      "NATSClient",
+		EventTypeMQTTClient:      "MQTTClient",
+		EventTypeTCPClient:       "TCPClient",
+		EventTypeTCPServer:       "TCPServer",
+		EventType(99):            "UNKNOWN (99)",
 	}
 
 	for ev, str := range typeStringMap {
@@ -69,9 +77,17 @@ func TestKindString(t *testing.T) {
 		&Span{Type: EventTypeGRPCClient}:                            "SPAN_KIND_CLIENT",
 		&Span{Type: EventTypeSQLClient}:                             "SPAN_KIND_CLIENT",
 		&Span{Type: EventTypeRedisClient}:                           "SPAN_KIND_CLIENT",
+		&Span{Type: EventTypeMongoClient}:                           "SPAN_KIND_CLIENT",
 		&Span{Type: EventTypeKafkaClient, Method: MessagingPublish}: "SPAN_KIND_PRODUCER",
 		&Span{Type: EventTypeKafkaClient, Method: MessagingProcess}: "SPAN_KIND_CONSUMER",
-		&Span{}: "SPAN_KIND_INTERNAL",
+		&Span{Type: EventTypeAMQPClient, Method: MessagingPublish}:  "SPAN_KIND_PRODUCER",
+		&Span{Type: EventTypeMemcachedClient}:                       "SPAN_KIND_CLIENT",
+		&Span{Type: EventTypeNATSClient, Method: MessagingPublish}:  "SPAN_KIND_PRODUCER",
+		&Span{Type: EventTypeMQTTClient, Method: MessagingProcess}:  "SPAN_KIND_CONSUMER",
+		&Span{Type: EventTypeAMQPServer}:                            "SPAN_KIND_SERVER",
+		&Span{Type: EventTypeTCPClient}:                             "SPAN_KIND_CLIENT",
+		&Span{Type: EventTypeTCPServer}:                             "SPAN_KIND_SERVER",
+		&Span{}:                                                     "SPAN_KIND_INTERNAL",
 	}
 
 	for span, str := range m {
@@ -0,0 +1,170 @@
+// Package rotate provides an io.WriteCloser that writes into a file that is rotated when it
+// reaches a given size or age
+package rotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultPermissions = 0o644
+
+// injectable function reference for testing
+var timeNow = time.Now
+
+// File writes into the file in the given Path. When writing into it would exceed the MaxSize,
+// or the file was created more than Interval ago, the file is renamed by appending a .1 suffix
+// to its name, and a new empty file is created.
+// The previous backups are shifted (path.1 is renamed to path.2, and so on), and the backups
+// that exceed the MaxBackups number are removed.
+// File is safe for concurrent use.
+type File struct {
+	Path string
+	// MaxSize in bytes of the file before rotating it. If 0, the file is not rotated by size.
+	MaxSize int64
+	// Interval since the file is created until it is rotated. If 0, the file is not rotated by age.
+	// If the file already existed, its creation time is considered (or its modification time, if
+	// the filesystem does not record the creation time).
+	Interval time.Duration
+	// MaxBackups is the number of rotated files to keep. If 0, the rotated file is removed.
+	MaxBackups int
+	// Compress the rotated files with gzip, appending a .gz suffix to their names
+	// (path.1.gz, path.2.gz...). The compression is done synchronously during the Write
+	// invocation that triggers the rotation.
+	Compress bool
+
+	mt     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// Write the data to the file. The data of a single Write invocation is never split between
+// two files.
+func (f *File) Write(p []byte) (int, error) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && (f.exceedsSize(len(p)) || f.expired()) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close the current file. Successive writes will open it again.
+func (f *File) Close() error {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *File) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return fmt.Errorf("creating directory for %s: %w", f.Path, err)
+	}
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, defaultPermissions)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", f.Path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("reading size of %s: %w", f.Path, err)
+	}
+	f.file = file
+	f.size = info.Size()
+	if f.size == 0 {
+		f.opened = timeNow()
+	} else {
+		// the file existed before (e.g. Beyla was restarted), so its age is counted
+		// since it was created. Otherwise, restarts would indefinitely delay its rotation.
+		f.opened = fileStart(f.Path, info)
+	}
+	return nil
+}
+
+func (f *File) exceedsSize(writeLen int) bool {
+	return f.MaxSize > 0 && f.size+int64(writeLen) > f.MaxSize
+}
+
+func (f *File) expired() bool {
+	return f.Interval > 0 && timeNow().Sub(f.opened) >= f.Interval
+}
+
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", f.Path, err)
+	}
+	f.file = nil
+	if f.MaxBackups <= 0 {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing %s: %w", f.Path, err)
+		}
+		return f.open()
+	}
+	// the oldest backup is overwritten by the previous one
+	for i := f.MaxBackups - 1; i > 0; i-- {
+		if err := os.Rename(f.backupName(i), f.backupName(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rotating %s: %w", f.backupName(i), err)
+		}
+	}
+	if f.Compress {
+		if err := compress(f.Path, f.backupName(1)); err != nil {
+			return fmt.Errorf("compressing %s: %w", f.Path, err)
+		}
+		if err := os.Remove(f.Path); err != nil {
+			return fmt.Errorf("removing %s: %w", f.Path, err)
+		}
+	} else if err := os.Rename(f.Path, f.backupName(1)); err != nil {
+		return fmt.Errorf("rotating %s: %w", f.Path, err)
+	}
+	return f.open()
+}
+
+func (f *File) backupName(n int) string {
+	if f.Compress {
+		return fmt.Sprintf("%s.%d.gz", f.Path, n)
+	}
+	return fmt.Sprintf("%s.%d", f.Path, n)
+}
+
+// compress the src file into the gzipped dst file
+func compress(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, defaultPermissions)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
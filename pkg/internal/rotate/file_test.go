@@ -0,0 +1,147 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "access.log")
+	f := File{Path: path, MaxSize: 10, MaxBackups: 2}
+	defer f.Close()
+
+	write := func(s string) {
+		_, err := f.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	write("aaaa\n")
+	write("bbbb\n")
+	assertContent(t, path, "aaaa\nbbbb\n")
+	assert.NoFileExists(t, path+".1")
+
+	// rotates when the max size is exceeded
+	write("cccc\n")
+	assertContent(t, path, "cccc\n")
+	assertContent(t, path+".1", "aaaa\nbbbb\n")
+
+	// shifts the old backups
+	write("dddddddd\n")
+	write("eeeeeeeeeeeeeeeeeeee\n")
+	assertContent(t, path, "eeeeeeeeeeeeeeeeeeee\n")
+	assertContent(t, path+".1", "dddddddd\n")
+	assertContent(t, path+".2", "cccc\n")
+
+	// and removes the backups that exceed MaxBackups
+	write("f\n")
+	assertContent(t, path, "f\n")
+	assertContent(t, path+".1", "eeeeeeeeeeeeeeeeeeee\n")
+	assertContent(t, path+".2", "dddddddd\n")
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestFile_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(path, []byte("aaaa\n"), 0o644))
+
+	// keeps appending to the existing file, considering its size
+	f := File{Path: path, MaxSize: 10}
+	defer f.Close()
+	_, err := f.Write([]byte("bbbb\n"))
+	require.NoError(t, err)
+	assertContent(t, path, "aaaa\nbbbb\n")
+
+	// without backups, the file is just truncated
+	_, err = f.Write([]byte("cccc\n"))
+	require.NoError(t, err)
+	assertContent(t, path, "cccc\n")
+	assert.NoFileExists(t, path+".1")
+}
+
+func TestFile_Interval(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	f := File{Path: path, Interval: time.Hour, MaxBackups: 2}
+	defer f.Close()
+	_, err := f.Write([]byte("aaaa\n"))
+	require.NoError(t, err)
+	now = now.Add(30 * time.Minute)
+	_, err = f.Write([]byte("bbbb\n"))
+	require.NoError(t, err)
+	assertContent(t, path, "aaaa\nbbbb\n")
+
+	// rotates when the interval is reached, despite the file size
+	now = now.Add(30 * time.Minute)
+	_, err = f.Write([]byte("cccc\n"))
+	require.NoError(t, err)
+	assertContent(t, path, "cccc\n")
+	assertContent(t, path+".1", "aaaa\nbbbb\n")
+}
+
+func TestFile_IntervalReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(path, []byte("aaaa\n"), 0o644))
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	// reopening an existing file does not restart its age
+	now = now.Add(30 * time.Minute)
+	f := File{Path: path, Interval: time.Hour, MaxBackups: 2}
+	_, err := f.Write([]byte("bbbb\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assertContent(t, path, "aaaa\nbbbb\n")
+
+	now = now.Add(31 * time.Minute)
+	f = File{Path: path, Interval: time.Hour, MaxBackups: 2}
+	defer f.Close()
+	_, err = f.Write([]byte("cccc\n"))
+	require.NoError(t, err)
+	assertContent(t, path, "cccc\n")
+	assertContent(t, path+".1", "aaaa\nbbbb\n")
+}
+
+func TestFile_Compress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f := File{Path: path, MaxSize: 10, MaxBackups: 2, Compress: true}
+	defer f.Close()
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	assertContent(t, path, "gggg\n")
+	assertGzipContent(t, path+".1.gz", "eeee\nffff\n")
+	assertGzipContent(t, path+".2.gz", "cccc\ndddd\n")
+	assert.NoFileExists(t, path+".3.gz")
+	assert.NoFileExists(t, path+".1")
+}
+
+func assertGzipContent(t *testing.T, path, expected string) {
+	t.Helper()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	content, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(content))
+}
+
+func assertContent(t *testing.T, path, expected string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(content))
+}
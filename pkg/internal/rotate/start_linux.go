@@ -0,0 +1,19 @@
+package rotate
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileStart returns the creation time of the file. If the filesystem doesn't
+// record it, the modification time is returned.
+func fileStart(path string, info os.FileInfo) time.Time {
+	stx := unix.Statx_t{}
+	if err := unix.Statx(unix.AT_FDCWD, path, 0, unix.STATX_BTIME, &stx); err == nil &&
+		stx.Mask&unix.STATX_BTIME != 0 {
+		return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec))
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package rotate
+
+import (
+	"os"
+	"time"
+)
+
+// fileStart returns the modification time of the file, as its creation time
+// can't be portably retrieved
+func fileStart(_ string, info os.FileInfo) time.Time {
+	return info.ModTime()
+}
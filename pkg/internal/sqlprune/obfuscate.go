@@ -0,0 +1,94 @@
+package sqlprune
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sqlNumber matches hexadecimal and decimal numbers at the start of the text
+var sqlNumber = regexp.MustCompile(`^(?:0[xX][0-9a-fA-F]+|\d+(?:\.\d+)?(?:[eE][-+]?\d+)?)\b`)
+
+// sqlDollarTag matches the opening tag of a PostgreSQL dollar-quoted string (e.g. $$ or $body$)
+var sqlDollarTag = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// ObfuscateLiterals replaces the string and numeric literals of an SQL query by the '?' placeholder, so
+// the query keeps its structure without exposing the values that are submitted. Strings can be
+// single-quoted, with either doubled quotes or backslashes as escape characters, PostgreSQL escape
+// strings (E'...') or dollar-quoted strings ($$...$$ or $tag$...$tag$). If doubleQuotedStrings is true,
+// double-quoted text is a string (as in MySQL); otherwise it's an identifier and is kept.
+// Positional parameters (e.g. $1 in PostgreSQL) are kept.
+func ObfuscateLiterals(query string, doubleQuotedStrings bool) string {
+	sb := strings.Builder{}
+	sb.Grow(len(query))
+	last := 0
+	for i := 0; i < len(query); {
+		end := i + 1
+		literal := false
+		switch c := query[i]; {
+		case c == '\'':
+			end, literal = quotedEnd(query, i, '\''), true
+		case c == '"':
+			end, literal = quotedEnd(query, i, '"'), doubleQuotedStrings
+		case c == '`':
+			// MySQL quoted identifier
+			end = quotedEnd(query, i, '`')
+		case (c == 'E' || c == 'e') && i+1 < len(query) && query[i+1] == '\'' && (i == 0 || !isWordChar(query[i-1])):
+			end, literal = quotedEnd(query, i+1, '\''), true
+		case c == '$':
+			if tag := sqlDollarTag.FindString(query[i:]); tag != "" && (i == 0 || !isWordChar(query[i-1])) {
+				end, literal = len(query), true
+				if closing := strings.Index(query[i+len(tag):], tag); closing >= 0 {
+					end = i + len(tag) + closing + len(tag)
+				}
+			} else {
+				// positional parameter, or part of an identifier
+				for end < len(query) && isWordChar(query[end]) {
+					end++
+				}
+			}
+		case c >= '0' && c <= '9':
+			if n := sqlNumber.FindString(query[i:]); n != "" {
+				end, literal = i+len(n), true
+			}
+		case isWordChar(c):
+			// keywords and identifiers, which might contain digits
+			for end < len(query) && (isWordChar(query[end]) || query[end] == '$') {
+				end++
+			}
+		}
+		if literal {
+			sb.WriteString(query[last:i])
+			sb.WriteByte('?')
+			last = end
+		}
+		i = end
+	}
+	if last == 0 {
+		return query
+	}
+	sb.WriteString(query[last:])
+	return sb.String()
+}
+
+// quotedEnd returns the position after the closing quote of the text quoted at the start position,
+// or the length of the query if it's not closed (e.g. the query was truncated)
+func quotedEnd(query string, start int, quote byte) int {
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,33 @@
+package sqlprune
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObfuscateLiterals(t *testing.T) {
+	for query, expected := range map[string]string{
+		"SELECT * FROM users WHERE email = 'foo@bar.com' AND age > 42":   "SELECT * FROM users WHERE email = ? AND age > ?",
+		"INSERT INTO t1 (a, b) VALUES ('it''s', 3.14e-2), (0x1F, -7)":    "INSERT INTO t1 (a, b) VALUES (?, ?), (?, -?)",
+		`UPDATE accounts SET note = 'say \'hi\'' WHERE id = $1`:          "UPDATE accounts SET note = ? WHERE id = $1",
+		"SELECT col2 FROM table3 LIMIT 10":                               "SELECT col2 FROM table3 LIMIT ?",
+		"BEGIN":                                                          "BEGIN",
+		"SELECT * FROM logs WHERE msg = E'it\\'s\\n'":                    "SELECT * FROM logs WHERE msg = ?",
+		"SELECT $$O'Reilly$$, $fn$ SELECT 'x' $fn$ FROM t1 WHERE a = $2": "SELECT ?, ? FROM t1 WHERE a = $2",
+		`SELECT "user id" FROM "Users" WHERE name = 'bob'`:               `SELECT "user id" FROM "Users" WHERE name = ?`,
+		"SELECT * FROM users WHERE name = 'unterminated 42":              "SELECT * FROM users WHERE name = ?",
+	} {
+		assert.Equal(t, expected, ObfuscateLiterals(query, false), query)
+	}
+}
+
+func TestObfuscateLiterals_DoubleQuotedStrings(t *testing.T) {
+	for query, expected := range map[string]string{
+		`SELECT * FROM users WHERE name = "bob" AND city = 'Graz'`: "SELECT * FROM users WHERE name = ? AND city = ?",
+		`INSERT INTO notes VALUES ("say ""hi""", "it\"s", 'x"y')`:  "INSERT INTO notes VALUES (?, ?, ?)",
+		"SELECT `select` FROM `my table` WHERE `col 2` = \"x\"":    "SELECT `select` FROM `my table` WHERE `col 2` = ?",
+	} {
+		assert.Equal(t, expected, ObfuscateLiterals(query, true), query)
+	}
+}
@@ -78,6 +78,11 @@ type ID struct {
 	// by other metadata if available (e.g., Pod Name, Node Name, etc...)
 	HostName string
 
+	// RoutesCriteria is the position, starting at 1, of the discovery services criteria entry that
+	// selected this service, if that entry overrides the global routes configuration. Zero means
+	// that the service uses the global routes configuration.
+	RoutesCriteria int
+
 	flags idFlags
 }
 
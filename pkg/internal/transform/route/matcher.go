@@ -2,14 +2,19 @@ package route
 
 import (
 	"regexp"
+	"slices"
 	"strings"
 )
 
 // wildcard format. By now, we will suppport wildcards in the form:
 // - /user/:userId/details (Gin)
-// - /user/{userId}/details (Gorilla)
+// - /user/{userId}/details (Gorilla, OpenAPI)
+// - /files/{name}.{ext} (OpenAPI), where the path folder mixes parameters and text
 // More formats will be appended at some point
-var wildcard = regexp.MustCompile(`^((:\w*)|(\{\w*}))$`)
+var wildcard = regexp.MustCompile(`^((:\w*)|(\{[\w.-]*}))$`)
+
+// pathParam matches each parameter of a path folder that contains more than a parameter
+var pathParam = regexp.MustCompile(`\{[\w.-]*}`)
 
 // Matcher allows matching a given URL path towards a set of framework-like provided
 // patterns.
@@ -31,6 +36,16 @@ type node struct {
 
 	// AnyPath node is a node identified by '*', which terminates the search matching what's found
 	AnyPath *node
+
+	// Patterns are the child subtrees for the path folders that mix parameters and text
+	// (e.g. {name}.{ext}), in order of insertion
+	Patterns []*patternNode
+}
+
+// patternNode is a child subtree that matches the path folders fulfilling a regular expression
+type patternNode struct {
+	Folder *regexp.Regexp
+	*node
 }
 
 // NewMatcher creates a new Matcher that would allow validating given URL paths towards
@@ -60,6 +75,11 @@ func find(path []string, pathNode *node) string {
 	if child, ok := pathNode.Child[path[0]]; ok {
 		return find(path[1:], child)
 	}
+	for _, p := range pathNode.Patterns {
+		if p.Folder.MatchString(path[0]) {
+			return find(path[1:], p.node)
+		}
+	}
 	if pathNode.AnyPath != nil {
 		return pathNode.FullRoute
 	}
@@ -87,6 +107,18 @@ func appendRoute(fullRoute string, path []string, pathNode *node) {
 		return
 	}
 
+	if folder := folderPattern(currentName); folder != nil {
+		i := slices.IndexFunc(pathNode.Patterns, func(p *patternNode) bool {
+			return p.Folder.String() == folder.String()
+		})
+		if i < 0 {
+			i = len(pathNode.Patterns)
+			pathNode.Patterns = append(pathNode.Patterns, &patternNode{Folder: folder, node: &node{Child: map[string]*node{}}})
+		}
+		appendRoute(fullRoute, path[1:], pathNode.Patterns[i].node)
+		return
+	}
+
 	if currentName == "*" {
 		pathNode.FullRoute = fullRoute
 		pathNode.AnyPath = &node{Child: map[string]*node{}}
@@ -103,6 +135,26 @@ func appendRoute(fullRoute string, path []string, pathNode *node) {
 	appendRoute(fullRoute, path[1:], child)
 }
 
+// folderPattern returns the regular expression that matches a path folder containing parameters
+// along with other text, or nil if the folder doesn't contain any parameter
+func folderPattern(folder string) *regexp.Regexp {
+	params := pathParam.FindAllStringIndex(folder, -1)
+	if len(params) == 0 {
+		return nil
+	}
+	sb := strings.Builder{}
+	sb.WriteByte('^')
+	last := 0
+	for _, p := range params {
+		sb.WriteString(regexp.QuoteMeta(folder[last:p[0]]))
+		sb.WriteString(".+")
+		last = p[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(folder[last:]))
+	sb.WriteByte('$')
+	return regexp.MustCompile(sb.String())
+}
+
 // tokenizes and normalizes the resulting slice, so we make sure
 // that neither the first nor last tokens are empty tokens
 func tokenize(path string) []string {
@@ -36,3 +36,25 @@ func TestFind(t *testing.T) {
 	assert.Equal(t, "/snow/mobile/*", m.Find("/snow/mobile"))
 	assert.Equal(t, "/snow/mobile/*", m.Find("/snow/mobile/long"))
 }
+
+func TestFind_ParametersWithText(t *testing.T) {
+	m := NewMatcher([]string{
+		"/files/{name}.{ext}",
+		"/files/{name}.{ext}/meta",
+		"/files/{id}",
+		"/api/v{version}/users/{id}",
+		"/reports/{year}-{month}.csv",
+	})
+
+	assert.Equal(t, "/files/{name}.{ext}", m.Find("/files/photo.png"))
+	assert.Equal(t, "/files/{name}.{ext}", m.Find("/files/backup.tar.gz"))
+	assert.Equal(t, "/files/{name}.{ext}/meta", m.Find("/files/photo.png/meta"))
+	assert.Equal(t, "/files/{id}", m.Find("/files/1234"))
+	assert.Equal(t, "/api/v{version}/users/{id}", m.Find("/api/v2/users/42"))
+	assert.Equal(t, "/reports/{year}-{month}.csv", m.Find("/reports/2024-05.csv"))
+
+	assert.Empty(t, m.Find("/api/2/users/42"))
+	assert.Empty(t, m.Find("/api/v/users/42"))
+	assert.Empty(t, m.Find("/reports/2024-05.pdf"))
+	assert.Empty(t, m.Find("/reports/2024.csv"))
+}
@@ -0,0 +1,92 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIDocument contains the subset of the OpenAPI 3 and Swagger 2 fields that are
+// required to extract the route patterns
+type openAPIDocument struct {
+	// Swagger version, for Swagger 2 documents
+	Swagger string `yaml:"swagger"`
+	// OpenAPI version, for OpenAPI 3 documents
+	OpenAPI string `yaml:"openapi"`
+	// BasePath of the Swagger 2 APIs
+	BasePath string `yaml:"basePath"`
+	// Servers of the OpenAPI 3 APIs, whose URLs might contain a base path
+	Servers []openAPIServer      `yaml:"servers"`
+	Paths   map[string]yaml.Node `yaml:"paths"`
+}
+
+type openAPIServer struct {
+	URL string `yaml:"url"`
+}
+
+// OpenAPIRoutes returns the route patterns from the path templates (e.g. /users/{id}/orders) of an
+// OpenAPI 3 or Swagger 2 document, in YAML or JSON format. The path templates are prefixed with the
+// base path of the API (basePath in Swagger 2, or the path of the servers' URLs in OpenAPI 3).
+func OpenAPIRoutes(content []byte) ([]string, error) {
+	doc := openAPIDocument{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("parsing OpenAPI document: %w", err)
+	}
+	var basePaths []string
+	switch {
+	case strings.HasPrefix(doc.OpenAPI, "3."):
+		basePaths = serversBasePaths(doc.Servers)
+	case doc.Swagger == "2.0":
+		basePaths = []string{strings.TrimSuffix(doc.BasePath, "/")}
+	default:
+		return nil, errors.New("unsupported document: expecting OpenAPI 3.x or Swagger 2.0")
+	}
+	routes := make([]string, 0, len(doc.Paths)*len(basePaths))
+	for path := range doc.Paths {
+		if strings.HasPrefix(path, "x-") {
+			// specification extension
+			continue
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid OpenAPI path %q: it must start with '/'", path)
+		}
+		for _, base := range basePaths {
+			routes = append(routes, base+path)
+		}
+	}
+	// the paths are stored in a map, so we sort them for the sake of consistency
+	sort.Strings(routes)
+	return routes, nil
+}
+
+// serversBasePaths returns the distinct paths of the OpenAPI 3 servers' URLs, which might
+// be absolute (https://example.com/v1) or relative (/v1)
+func serversBasePaths(servers []openAPIServer) []string {
+	if len(servers) == 0 {
+		return []string{""}
+	}
+	found := map[string]struct{}{}
+	var basePaths []string
+	for _, server := range servers {
+		path := server.URL
+		if _, afterScheme, ok := strings.Cut(path, "://"); ok {
+			// discard scheme and host, which might contain server variables
+			path = ""
+			if slash := strings.IndexByte(afterScheme, '/'); slash >= 0 {
+				path = afterScheme[slash:]
+			}
+		}
+		path = strings.TrimSuffix(path, "/")
+		if path != "" && !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		if _, ok := found[path]; !ok {
+			found[path] = struct{}{}
+			basePaths = append(basePaths, path)
+		}
+	}
+	return basePaths
+}
@@ -0,0 +1,64 @@
+package route
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPIRoutes_OpenAPI3(t *testing.T) {
+	routes, err := OpenAPIRoutes([]byte(`
+openapi: 3.0.3
+info:
+  title: users
+  version: 1.0.0
+servers:
+  - url: https://{region}.example.com/api/v1/
+  - url: /api/v1
+  - url: http://localhost:8080
+paths:
+  /users:
+    get: {}
+  /users/{user-id}/orders/{orderId}:
+    get: {}
+  x-internal: true
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/api/v1/users",
+		"/api/v1/users/{user-id}/orders/{orderId}",
+		"/users",
+		"/users/{user-id}/orders/{orderId}",
+	}, routes)
+
+	m := NewMatcher(routes)
+	assert.Equal(t, "/api/v1/users/{user-id}/orders/{orderId}", m.Find("/api/v1/users/123/orders/456"))
+	assert.Equal(t, "/users", m.Find("/users"))
+}
+
+func TestOpenAPIRoutes_Swagger2(t *testing.T) {
+	// JSON documents are also accepted
+	routes, err := OpenAPIRoutes([]byte(`{
+  "swagger": "2.0",
+  "basePath": "/v2/",
+  "paths": {
+    "/pet/{petId}": {"get": {}},
+    "/store/inventory": {"get": {}}
+  }
+}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/v2/pet/{petId}", "/v2/store/inventory"}, routes)
+}
+
+func TestOpenAPIRoutes_Errors(t *testing.T) {
+	_, err := OpenAPIRoutes([]byte(`{"swagger": "1.2", "paths": {"/pets": {}}}`))
+	assert.Error(t, err)
+	_, err = OpenAPIRoutes([]byte(`openapi: 3.1.0
+paths:
+  pets: {}
+`))
+	assert.Error(t, err)
+	_, err = OpenAPIRoutes([]byte(`openapi: [3.1.0`))
+	assert.Error(t, err)
+}
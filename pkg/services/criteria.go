@@ -97,6 +97,16 @@ func (dc DefinitionCriteria) Validate() error {
 	return nil
 }
 
+// HasRoutes returns true if any of the criteria overrides the global routes configuration
+func (dc DefinitionCriteria) HasRoutes() bool {
+	for i := range dc {
+		if dc[i].Routes != nil {
+			return true
+		}
+	}
+	return false
+}
+
 func (dc DefinitionCriteria) PortOfInterest(port int) bool {
 	for i := range dc {
 		if dc[i].OpenPorts.Matches(port) {
@@ -129,6 +139,23 @@ type Attributes struct {
 
 	// PodLabels allows matching against the labels of a pod
 	PodLabels map[string]*RegexpAttr `yaml:"k8s_pod_labels"`
+
+	// Routes overrides the global routes configuration for the matching services
+	Routes *RoutesConfig `yaml:"routes"`
+}
+
+// RoutesConfig overrides, for the services matching a given selection criteria, the properties of the
+// global routes configuration. Any unset property is taken from the global routes configuration.
+// The accepted values are the same as in the global routes configuration.
+type RoutesConfig struct {
+	// Unmatch specifies what to do when a route pattern is not matched
+	Unmatch string `yaml:"unmatched"`
+	// Patterns of the paths that will match to a route
+	Patterns       []string `yaml:"patterns"`
+	IgnorePatterns []string `yaml:"ignored_patterns"`
+	IgnoredEvents  string   `yaml:"ignore_mode"`
+	// OpenAPI is a list of OpenAPI document files whose path templates are used as route patterns
+	OpenAPI []string `yaml:"openapi"`
 }
 
 // PortEnum defines an enumeration of ports. It allows defining a set of single ports as well a set of
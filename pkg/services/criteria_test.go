@@ -51,6 +51,36 @@ func TestYAMLParse_PathRegexp_Errors(t *testing.T) {
 	})
 }
 
+func TestYAMLParse_Routes(t *testing.T) {
+	yf := yamlFile{}
+	require.NoError(t, yaml.Unmarshal([]byte(`services:
+  - name: foo
+    k8s_namespace: bar
+    routes:
+      unmatched: path
+      patterns: ["/users/{id}"]
+      ignored_patterns: ["/health"]
+      ignore_mode: traces
+      openapi: ["/specs/foo.yaml"]
+  - name: baz
+    open_ports: 80
+`), &yf))
+	require.Len(t, yf.Services, 2)
+	require.NoError(t, yf.Services.Validate())
+	assert.True(t, yf.Services.HasRoutes())
+
+	assert.Equal(t, &RoutesConfig{
+		Unmatch:        "path",
+		Patterns:       []string{"/users/{id}"},
+		IgnorePatterns: []string{"/health"},
+		IgnoredEvents:  "traces",
+		OpenAPI:        []string{"/specs/foo.yaml"},
+	}, yf.Services[0].Routes)
+	assert.Len(t, yf.Services[0].Metadata, 1)
+	assert.Nil(t, yf.Services[1].Routes)
+	assert.False(t, yf.Services[1:].HasRoutes())
+}
+
 func TestYAMLParse_PortEnum(t *testing.T) {
 	var portEnumYAML = func(enum string) PortEnum {
 		yf := yamlFile{}
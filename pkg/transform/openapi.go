@@ -0,0 +1,139 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/gobwas/glob"
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+
+	"github.com/grafana/beyla/pkg/internal/svc"
+	"github.com/grafana/beyla/pkg/internal/transform/route"
+)
+
+// maximum number of services whose route matchers are cached
+const serviceMatchersCacheLen = 1024
+
+// OpenAPIConfig loads the route patterns of the matching services from the path templates
+// (e.g. /users/{id}/orders) of an OpenAPI 3 or Swagger 2 document.
+type OpenAPIConfig struct {
+	// File path of the OpenAPI document, in YAML or JSON format
+	File string `yaml:"file"`
+	// ServiceName is a glob pattern. If set, the routes of the document are only applied to the
+	// services whose name matches it.
+	ServiceName string `yaml:"service_name"`
+	// ServiceNamespace is a glob pattern. If set, the routes of the document are only applied to the
+	// services whose namespace matches it.
+	ServiceNamespace string `yaml:"service_namespace"`
+}
+
+func (oc *OpenAPIConfig) Validate() error {
+	if oc.File == "" {
+		return errors.New("missing OpenAPI document file")
+	}
+	_, err := oc.selector()
+	return err
+}
+
+func (oc *OpenAPIConfig) selector() (openAPIRoutes, error) {
+	sel := openAPIRoutes{}
+	var err error
+	if oc.ServiceName != "" {
+		if sel.name, err = glob.Compile(oc.ServiceName); err != nil {
+			return sel, fmt.Errorf("invalid service_name pattern %q: %w", oc.ServiceName, err)
+		}
+	}
+	if oc.ServiceNamespace != "" {
+		if sel.namespace, err = glob.Compile(oc.ServiceNamespace); err != nil {
+			return sel, fmt.Errorf("invalid service_namespace pattern %q: %w", oc.ServiceNamespace, err)
+		}
+	}
+	return sel, nil
+}
+
+// openAPIRoutes are the route patterns of an OpenAPI document, and the selector of the
+// services they apply to. A nil glob matches any service.
+type openAPIRoutes struct {
+	name      glob.Glob
+	namespace glob.Glob
+	routes    []string
+}
+
+func (o *openAPIRoutes) matches(id *svc.ID) bool {
+	return (o.name == nil || o.name.Match(id.Name)) &&
+		(o.namespace == nil || o.namespace.Match(id.Namespace))
+}
+
+func loadOpenAPIRoutes(cfgs []OpenAPIConfig) ([]openAPIRoutes, error) {
+	docs := make([]openAPIRoutes, 0, len(cfgs))
+	for i := range cfgs {
+		cfg := &cfgs[i]
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		doc, _ := cfg.selector()
+		content, err := os.ReadFile(cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("reading OpenAPI document: %w", err)
+		}
+		if doc.routes, err = route.OpenAPIRoutes(content); err != nil {
+			return nil, fmt.Errorf("loading OpenAPI document %s: %w", cfg.File, err)
+		}
+		slog.With("component", "RoutesProvider").Debug("loaded routes from OpenAPI document",
+			"file", cfg.File, "routes", len(doc.routes))
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// serviceMatchers provides the route matcher of each service, which contains the globally configured
+// patterns plus the routes of the OpenAPI documents that apply to the service.
+type serviceMatchers struct {
+	patterns []string
+	openAPI  []openAPIRoutes
+	// global matcher, for the services that aren't selected by any OpenAPI document.
+	// It is nil if there aren't global patterns.
+	global *route.Matcher
+	cache  *simplelru.LRU[string, *route.Matcher]
+}
+
+func newServiceMatchers(patterns []string, openAPI []openAPIRoutes) *serviceMatchers {
+	sm := &serviceMatchers{patterns: patterns, openAPI: openAPI}
+	if len(patterns) > 0 {
+		m := route.NewMatcher(patterns)
+		sm.global = &m
+	}
+	if len(openAPI) > 0 {
+		// the error is only returned when the size is not positive
+		sm.cache, _ = simplelru.NewLRU[string, *route.Matcher](serviceMatchersCacheLen, nil)
+	}
+	return sm
+}
+
+// forService returns the route matcher of the service, or nil if it doesn't have any route pattern
+func (sm *serviceMatchers) forService(id *svc.ID) *route.Matcher {
+	if len(sm.openAPI) == 0 {
+		return sm.global
+	}
+	key := id.Job()
+	if m, ok := sm.cache.Get(key); ok {
+		return m
+	}
+	m := sm.global
+	var patterns []string
+	for i := range sm.openAPI {
+		if sm.openAPI[i].matches(id) {
+			patterns = append(patterns, sm.openAPI[i].routes...)
+		}
+	}
+	if len(patterns) > 0 {
+		// the globally configured patterns are added at the end, so they take precedence
+		// over any equivalent route from the OpenAPI documents
+		rm := route.NewMatcher(append(patterns, sm.patterns...))
+		m = &rm
+	}
+	sm.cache.Add(key, m)
+	return m
+}
@@ -0,0 +1,255 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gobwas/glob"
+	"github.com/mariomac/pipes/pipe"
+
+	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/sqlprune"
+)
+
+// RedactPattern is the name of a well-known kind of sensitive value
+type RedactPattern string
+
+const (
+	RedactEmail      = RedactPattern("email")
+	RedactCreditCard = RedactPattern("credit_card")
+	RedactJWT        = RedactPattern("jwt")
+	RedactUUID       = RedactPattern("uuid")
+)
+
+const defaultRedactMask = "*"
+
+var redactPatterns = map[RedactPattern]*regexp.Regexp{
+	// the @ might be URL-encoded
+	RedactEmail: regexp.MustCompile(`[a-zA-Z0-9._%+-]+(?:@|%40)[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`),
+	// 13 to 19 digits, optionally separated by spaces or dashes. They are later verified with the Luhn algorithm
+	RedactCreditCard: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+	RedactJWT:        regexp.MustCompile(`\beyJ[a-zA-Z0-9_-]*\.[a-zA-Z0-9_-]+\.[a-zA-Z0-9_-]*`),
+	RedactUUID:       regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`),
+}
+
+// RedactConfig scrubs sensitive values from the spans before they are submitted to any exporter.
+type RedactConfig struct {
+	// PathSegments is a list of glob patterns. The URL path segments that match any of them are replaced by the Mask.
+	PathSegments []string `yaml:"path_segments" env:"BEYLA_REDACT_PATH_SEGMENTS" envSeparator:","`
+	// PathSegmentsRegex is a list of regular expressions. The URL path segments that fully match any of them
+	// are replaced by the Mask.
+	PathSegmentsRegex []string `yaml:"path_segments_regex"`
+	// SQLLiterals replaces the string and numeric literals of the SQL statements by the '?' placeholder
+	SQLLiterals bool `yaml:"sql_literals" env:"BEYLA_REDACT_SQL_LITERALS"`
+	// RedisKeys replaces the keys and arguments of the Redis commands by the '?' placeholder
+	RedisKeys bool `yaml:"redis_keys" env:"BEYLA_REDACT_REDIS_KEYS"`
+	// Patterns of well-known sensitive values that are replaced by the Mask in any free-text field of the
+	// spans, such as URLs, routes, statements, topics, addresses and captured HTTP headers
+	Patterns []RedactPattern `yaml:"patterns" env:"BEYLA_REDACT_PATTERNS" envSeparator:","`
+	// Mask replaces the redacted path segments and patterns. Defaults to "*"
+	Mask string `yaml:"mask" env:"BEYLA_REDACT_MASK"`
+}
+
+func (rc *RedactConfig) Enabled() bool {
+	return len(rc.PathSegments) > 0 || len(rc.PathSegmentsRegex) > 0 ||
+		rc.SQLLiterals || rc.RedisKeys || len(rc.Patterns) > 0
+}
+
+func (rc *RedactConfig) Validate() error {
+	_, err := newRedactor(rc)
+	return err
+}
+
+func RedactProvider(rc *RedactConfig) pipe.MiddleProvider[[]request.Span, []request.Span] {
+	return func() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
+		if rc == nil || !rc.Enabled() {
+			// if no configuration is provided, we just bypass the node
+			return pipe.Bypass[[]request.Span](), nil
+		}
+		r, err := newRedactor(rc)
+		if err != nil {
+			return nil, err
+		}
+		return func(in <-chan []request.Span, out chan<- []request.Span) {
+			for spans := range in {
+				for i := range spans {
+					r.redact(&spans[i])
+				}
+				out <- spans
+			}
+		}, nil
+	}
+}
+
+type redactor struct {
+	cfg      *RedactConfig
+	mask     string
+	segments []glob.Glob
+	regexes  []*regexp.Regexp
+	patterns []*regexp.Regexp
+}
+
+func newRedactor(rc *RedactConfig) (*redactor, error) {
+	r := &redactor{cfg: rc, mask: rc.Mask}
+	if r.mask == "" {
+		r.mask = defaultRedactMask
+	}
+	for _, s := range rc.PathSegments {
+		g, err := glob.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact path segment glob %q: %w", s, err)
+		}
+		r.segments = append(r.segments, g)
+	}
+	for _, s := range rc.PathSegmentsRegex {
+		re, err := regexp.Compile("^(?:" + s + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact path segment regular expression %q: %w", s, err)
+		}
+		r.regexes = append(r.regexes, re)
+	}
+	for _, p := range rc.Patterns {
+		re, ok := redactPatterns[p]
+		if !ok {
+			return nil, fmt.Errorf("unknown redact pattern %q. Accepted values: %s, %s, %s, %s",
+				p, RedactEmail, RedactCreditCard, RedactJWT, RedactUUID)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+func (r *redactor) redact(s *request.Span) {
+	switch s.Type {
+	case request.EventTypeHTTP, request.EventTypeHTTPClient:
+		s.Path = r.redactPath(s.Path)
+		s.Route = r.redactPath(s.Route)
+	case request.EventTypeSQLClient:
+		if r.cfg.SQLLiterals {
+			// double quotes delimit identifiers in PostgreSQL and CQL, but strings in MySQL. The
+			// queries of other databases are obfuscated as in MySQL, so no string is leaked.
+			doubleQuotedStrings := s.SQLKind != request.DBPostgres && s.SQLKind != request.DBCassandra
+			s.Statement = sqlprune.ObfuscateLiterals(s.Statement, doubleQuotedStrings)
+		}
+	case request.EventTypeRedisClient, request.EventTypeRedisServer:
+		if r.cfg.RedisKeys {
+			s.Path = redactRedisKeys(s.Path)
+		}
+	}
+	if len(r.patterns) == 0 {
+		return
+	}
+	// Free-text fields that are exported, depending on the event type, as:
+	//   - Path: URL (HTTP), RPC method (gRPC, Thrift), table (SQL), command text (Redis, Memcached),
+	//     collection (MongoDB), topic or subject (Kafka, AMQP, NATS, MQTT)
+	//   - Route: HTTP route
+	//   - Statement: SQL or CQL query (SQL, Cassandra), routing key (AMQP)
+	//   - OtherNamespace: client ID (Kafka)
+	//   - DBNamespace: database (SQL, Cassandra, MongoDB)
+	//   - DBError.Description: status message of the failed database operations
+	//   - Host, HostName, Peer, PeerName: server and client addresses (all types)
+	//   - RequestHeaders: captured HTTP request headers
+	// The Method field is not redacted, as it only contains well-known operation names.
+	for _, field := range []*string{
+		&s.Path, &s.Route, &s.Statement, &s.OtherNamespace, &s.DBNamespace, &s.DBError.Description,
+		&s.Host, &s.HostName, &s.Peer, &s.PeerName,
+	} {
+		*field = r.redactPatterns(*field)
+	}
+	for name, value := range s.RequestHeaders {
+		s.RequestHeaders[name] = r.redactPatterns(value)
+	}
+}
+
+// redactPath masks the URL path segments that match any of the configured globs or regular expressions.
+// The query string is left as it is.
+func (r *redactor) redactPath(path string) string {
+	if path == "" || (len(r.segments) == 0 && len(r.regexes) == 0) {
+		return path
+	}
+	p, query, hasQuery := strings.Cut(path, "?")
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		if seg != "" && r.sensitiveSegment(seg) {
+			segments[i] = r.mask
+		}
+	}
+	p = strings.Join(segments, "/")
+	if hasQuery {
+		return p + "?" + query
+	}
+	return p
+}
+
+func (r *redactor) sensitiveSegment(seg string) bool {
+	for _, g := range r.segments {
+		if g.Match(seg) {
+			return true
+		}
+	}
+	for _, re := range r.regexes {
+		if re.MatchString(seg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) redactPatterns(str string) string {
+	if str == "" {
+		return str
+	}
+	for i, re := range r.patterns {
+		if r.cfg.Patterns[i] == RedactCreditCard {
+			str = re.ReplaceAllStringFunc(str, func(num string) string {
+				if luhnValid(num) {
+					return r.mask
+				}
+				return num
+			})
+		} else {
+			str = re.ReplaceAllLiteralString(str, r.mask)
+		}
+	}
+	return str
+}
+
+// redactRedisKeys keeps the command names of a Redis request text, replacing their arguments by '?'.
+// e.g. "SET key value ; GET key" is converted into "SET ? ?; GET ?"
+func redactRedisKeys(text string) string {
+	commands := strings.Split(text, ";")
+	redacted := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		fields := strings.Fields(cmd)
+		if len(fields) == 0 {
+			continue
+		}
+		for i := 1; i < len(fields); i++ {
+			fields[i] = "?"
+		}
+		redacted = append(redacted, strings.Join(fields, " "))
+	}
+	return strings.Join(redacted, "; ")
+}
+
+// luhnValid verifies the checksum of a credit card number, ignoring any non-digit separator
+func luhnValid(num string) bool {
+	sum, digits := 0, 0
+	for i := len(num) - 1; i >= 0; i-- {
+		c := num[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return sum%10 == 0
+}
@@ -2,12 +2,16 @@
 package transform
 
 import (
+	"fmt"
 	"log/slog"
+	"reflect"
+	"slices"
 
 	"github.com/mariomac/pipes/pipe"
 
 	"github.com/grafana/beyla/pkg/internal/request"
 	"github.com/grafana/beyla/pkg/internal/transform/route"
+	"github.com/grafana/beyla/pkg/services"
 )
 
 // UnmatchType defines which actions to do when a route pattern is not recognized
@@ -49,62 +53,161 @@ type RoutesConfig struct {
 	Patterns       []string   `yaml:"patterns"`
 	IgnorePatterns []string   `yaml:"ignored_patterns"`
 	IgnoredEvents  IgnoreMode `yaml:"ignore_mode"`
+	// OpenAPI documents whose path templates are used as route patterns for the matching services
+	OpenAPI []OpenAPIConfig `yaml:"openapi"`
 }
 
-func RoutesProvider(rc *RoutesConfig) pipe.MiddleProvider[[]request.Span, []request.Span] {
-	return (&routerNode{config: rc}).provideRoutes
+func (rc *RoutesConfig) Validate() error {
+	for i := range rc.OpenAPI {
+		if err := rc.OpenAPI[i].Validate(); err != nil {
+			return fmt.Errorf("routes.openapi[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// RoutesProvider sets the routes of the spans. The services whose discovery criteria define their own
+// routes block use it, overriding the properties of the global routes configuration.
+func RoutesProvider(rc *RoutesConfig, criteria services.DefinitionCriteria) pipe.MiddleProvider[[]request.Span, []request.Span] {
+	return (&routerNode{config: rc, criteria: criteria}).provideRoutes
 }
 
 type routerNode struct {
-	config *RoutesConfig
+	config   *RoutesConfig
+	criteria services.DefinitionCriteria
 }
 
 func (rn *routerNode) provideRoutes() (pipe.MiddleFunc[[]request.Span, []request.Span], error) {
-	rc := rn.config
-	if rc == nil {
+	if rn.config == nil && !rn.criteria.HasRoutes() {
 		// if no configuration is provided, we just bypass the node
 		return pipe.Bypass[[]request.Span](), nil
 	}
 
-	// set default value for Unmatch action
-	unmatchAction, err := chooseUnmatchPolicy(rc)
-	if err != nil {
-		return nil, err
+	var global *serviceRouter
+	if rn.config != nil {
+		var err error
+		if global, err = newServiceRouter(rn.config); err != nil {
+			return nil, err
+		}
 	}
-	matcher := route.NewMatcher(rc.Patterns)
-	discarder := route.NewMatcher(rc.IgnorePatterns)
-	routesEnabled := len(rc.Patterns) > 0
-	ignoreEnabled := len(rc.IgnorePatterns) > 0
-
-	ignoreMode := rc.IgnoredEvents
-	if ignoreMode == "" {
-		ignoreMode = IgnoreDefault
+	// routers for the services that override the global routes configuration, indexed by the
+	// position of their discovery criteria. Criteria with equal routes blocks share the router.
+	overrides := make([]*serviceRouter, len(rn.criteria))
+	for i := range rn.criteria {
+		sr := rn.criteria[i].Routes
+		if sr == nil {
+			continue
+		}
+		if j := slices.IndexFunc(rn.criteria[:i], func(c services.Attributes) bool {
+			return c.Routes != nil && reflect.DeepEqual(*c.Routes, *sr)
+		}); j >= 0 {
+			overrides[i] = overrides[j]
+			continue
+		}
+		router, err := newServiceRouter(rn.config.withOverrides(sr))
+		if err != nil {
+			return nil, fmt.Errorf("discovery.services[%d].routes: %w", i, err)
+		}
+		overrides[i] = router
 	}
 
 	return func(in <-chan []request.Span, out chan<- []request.Span) {
 		for spans := range in {
 			for i := range spans {
 				s := &spans[i]
-				if ignoreEnabled {
-					if discarder.Find(s.Path) != "" {
-						if ignoreMode == IgnoreAll {
-							s.SetIgnoreMetrics()
-							s.SetIgnoreTraces()
-						}
-						// we can't discard it here, ignoring is selective (metrics | traces)
-						setSpanIgnoreMode(ignoreMode, s)
-					}
+				router := global
+				if c := s.ServiceID.RoutesCriteria; c > 0 && c <= len(overrides) && overrides[c-1] != nil {
+					router = overrides[c-1]
 				}
-				if routesEnabled {
-					s.Route = matcher.Find(s.Path)
+				if router != nil {
+					router.route(s)
 				}
-				unmatchAction(s)
 			}
 			out <- spans
 		}
 	}, nil
 }
 
+// withOverrides returns a copy of the routes configuration, whose properties are overridden by
+// the non-empty properties of the routes block of a discovery criteria. A nil RoutesConfig
+// is considered empty.
+func (rc *RoutesConfig) withOverrides(sr *services.RoutesConfig) *RoutesConfig {
+	merged := RoutesConfig{}
+	if rc != nil {
+		merged = *rc
+	}
+	if sr.Unmatch != "" {
+		merged.Unmatch = UnmatchType(sr.Unmatch)
+	}
+	if len(sr.Patterns) > 0 {
+		merged.Patterns = sr.Patterns
+	}
+	if len(sr.IgnorePatterns) > 0 {
+		merged.IgnorePatterns = sr.IgnorePatterns
+	}
+	if sr.IgnoredEvents != "" {
+		merged.IgnoredEvents = IgnoreMode(sr.IgnoredEvents)
+	}
+	if len(sr.OpenAPI) > 0 {
+		// the OpenAPI documents of the service are added to the global documents, which
+		// might also select the service
+		merged.OpenAPI = slices.Clone(merged.OpenAPI)
+		for _, file := range sr.OpenAPI {
+			merged.OpenAPI = append(merged.OpenAPI, OpenAPIConfig{File: file})
+		}
+	}
+	return &merged
+}
+
+// serviceRouter sets the routes, and the ignore flags, of the spans according to a routes configuration
+type serviceRouter struct {
+	unmatchAction func(span *request.Span)
+	matchers      *serviceMatchers
+	discarder     route.Matcher
+	ignoreEnabled bool
+	ignoreMode    IgnoreMode
+}
+
+func newServiceRouter(rc *RoutesConfig) (*serviceRouter, error) {
+	// set default value for Unmatch action
+	unmatchAction, err := chooseUnmatchPolicy(rc)
+	if err != nil {
+		return nil, err
+	}
+	openAPI, err := loadOpenAPIRoutes(rc.OpenAPI)
+	if err != nil {
+		return nil, err
+	}
+	ignoreMode := rc.IgnoredEvents
+	if ignoreMode == "" {
+		ignoreMode = IgnoreDefault
+	}
+	return &serviceRouter{
+		unmatchAction: unmatchAction,
+		matchers:      newServiceMatchers(rc.Patterns, openAPI),
+		discarder:     route.NewMatcher(rc.IgnorePatterns),
+		ignoreEnabled: len(rc.IgnorePatterns) > 0,
+		ignoreMode:    ignoreMode,
+	}, nil
+}
+
+func (sr *serviceRouter) route(s *request.Span) {
+	if sr.ignoreEnabled {
+		if sr.discarder.Find(s.Path) != "" {
+			if sr.ignoreMode == IgnoreAll {
+				s.SetIgnoreMetrics()
+				s.SetIgnoreTraces()
+			}
+			// we can't discard it here, ignoring is selective (metrics | traces)
+			setSpanIgnoreMode(sr.ignoreMode, s)
+		}
+	}
+	if matcher := sr.matchers.forService(&s.ServiceID); matcher != nil {
+		s.Route = matcher.Find(s.Path)
+	}
+	sr.unmatchAction(s)
+}
+
 func chooseUnmatchPolicy(rc *RoutesConfig) (func(span *request.Span), error) {
 	var unmatchAction func(span *request.Span)
 
@@ -112,7 +215,7 @@ func chooseUnmatchPolicy(rc *RoutesConfig) (func(span *request.Span), error) {
 	case UnmatchWildcard, "":
 		unmatchAction = setUnmatchToWildcard
 
-		if len(rc.Patterns) == 0 {
+		if len(rc.Patterns) == 0 && len(rc.OpenAPI) == 0 {
 			slog.With("component", "RoutesProvider").
 				Warn("No route match patterns configured. " +
 					"Without route definitions Beyla will not be able to generate a low cardinality " +
@@ -1,6 +1,8 @@
 package transform
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -8,7 +10,9 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/grafana/beyla/pkg/internal/request"
+	"github.com/grafana/beyla/pkg/internal/svc"
 	"github.com/grafana/beyla/pkg/internal/testutil"
+	"github.com/grafana/beyla/pkg/services"
 )
 
 const testTimeout = 5 * time.Second
@@ -16,7 +20,7 @@ const testTimeout = 5 * time.Second
 func TestUnmatchedWildcard(t *testing.T) {
 	for _, tc := range []UnmatchType{"", UnmatchWildcard, "invalid_value"} {
 		t.Run(string(tc), func(t *testing.T) {
-			router, err := RoutesProvider(&RoutesConfig{Unmatch: tc, Patterns: []string{"/user/:id"}})()
+			router, err := RoutesProvider(&RoutesConfig{Unmatch: tc, Patterns: []string{"/user/:id"}}, nil)()
 			require.NoError(t, err)
 			in, out := make(chan []request.Span, 10), make(chan []request.Span, 10)
 			defer close(in)
@@ -36,7 +40,7 @@ func TestUnmatchedWildcard(t *testing.T) {
 }
 
 func TestUnmatchedPath(t *testing.T) {
-	router, err := RoutesProvider(&RoutesConfig{Unmatch: UnmatchPath, Patterns: []string{"/user/:id"}})()
+	router, err := RoutesProvider(&RoutesConfig{Unmatch: UnmatchPath, Patterns: []string{"/user/:id"}}, nil)()
 	require.NoError(t, err)
 	in, out := make(chan []request.Span, 10), make(chan []request.Span, 10)
 	defer close(in)
@@ -54,7 +58,7 @@ func TestUnmatchedPath(t *testing.T) {
 }
 
 func TestUnmatchedEmpty(t *testing.T) {
-	router, err := RoutesProvider(&RoutesConfig{Unmatch: UnmatchUnset, Patterns: []string{"/user/:id"}})()
+	router, err := RoutesProvider(&RoutesConfig{Unmatch: UnmatchUnset, Patterns: []string{"/user/:id"}}, nil)()
 	require.NoError(t, err)
 	in, out := make(chan []request.Span, 10), make(chan []request.Span, 10)
 	defer close(in)
@@ -73,7 +77,7 @@ func TestUnmatchedEmpty(t *testing.T) {
 func TestUnmatchedAuto(t *testing.T) {
 	for _, tc := range []UnmatchType{UnmatchHeuristic} {
 		t.Run(string(tc), func(t *testing.T) {
-			router, err := RoutesProvider(&RoutesConfig{Unmatch: tc, Patterns: []string{"/user/:id"}})()
+			router, err := RoutesProvider(&RoutesConfig{Unmatch: tc, Patterns: []string{"/user/:id"}}, nil)()
 			require.NoError(t, err)
 			in, out := make(chan []request.Span, 10), make(chan []request.Span, 10)
 			defer close(in)
@@ -106,7 +110,7 @@ func TestUnmatchedAuto(t *testing.T) {
 }
 
 func TestIgnoreRoutes(t *testing.T) {
-	router, err := RoutesProvider(&RoutesConfig{Unmatch: UnmatchPath, Patterns: []string{"/user/:id", "/v1/metrics"}, IgnorePatterns: []string{"/v1/metrics/*", "/v1/traces/*", "/exact"}})()
+	router, err := RoutesProvider(&RoutesConfig{Unmatch: UnmatchPath, Patterns: []string{"/user/:id", "/v1/metrics"}, IgnorePatterns: []string{"/v1/metrics/*", "/v1/traces/*", "/exact"}}, nil)()
 	require.NoError(t, err)
 	in, out := make(chan []request.Span, 10), make(chan []request.Span, 10)
 	defer close(in)
@@ -128,6 +132,162 @@ func TestIgnoreRoutes(t *testing.T) {
 	}}, filterIgnored(func() []request.Span { return testutil.ReadChannel(t, out, testTimeout) }))
 }
 
+func TestOpenAPIRoutes(t *testing.T) {
+	dir := t.TempDir()
+	usersSpec := filepath.Join(dir, "users.yaml")
+	require.NoError(t, os.WriteFile(usersSpec, []byte(`
+openapi: 3.0.0
+servers:
+  - url: https://example.com/api
+paths:
+  /users/{userId}:
+    get: {}
+  /users/{userId}/orders:
+    get: {}
+`), 0o600))
+	petsSpec := filepath.Join(dir, "pets.json")
+	require.NoError(t, os.WriteFile(petsSpec, []byte(`{"swagger": "2.0", "paths": {"/pets/{petId}": {"get": {}}}}`), 0o600))
+
+	router, err := RoutesProvider(&RoutesConfig{
+		Unmatch:  UnmatchUnset,
+		Patterns: []string{"/health", "/api/users/:id"},
+		OpenAPI: []OpenAPIConfig{
+			{File: usersSpec, ServiceName: "users-*"},
+			{File: petsSpec, ServiceName: "pets", ServiceNamespace: "shop"},
+		},
+	}, nil)()
+	require.NoError(t, err)
+	in, out := make(chan []request.Span, 10), make(chan []request.Span, 10)
+	defer close(in)
+	go router(in, out)
+
+	users := svc.ID{Name: "users-api"}
+	pets := svc.ID{Name: "pets", Namespace: "shop"}
+	in <- []request.Span{
+		{ServiceID: users, Path: "/api/users/123/orders"},
+		// global patterns take precedence over the equivalent OpenAPI routes
+		{ServiceID: users, Path: "/api/users/123"},
+		{ServiceID: users, Path: "/health"},
+		{ServiceID: users, Path: "/pets/1"},
+		{ServiceID: pets, Path: "/pets/1"},
+		{ServiceID: pets, Path: "/api/users/123/orders"},
+		{ServiceID: svc.ID{Name: "pets"}, Path: "/pets/1"},
+	}
+	assert.Equal(t, []string{
+		"/api/users/{userId}/orders",
+		"/api/users/:id",
+		"/health",
+		"",
+		"/pets/{petId}",
+		"",
+		"",
+	}, routes(testutil.ReadChannel(t, out, testTimeout)))
+}
+
+func TestOpenAPIRoutes_Errors(t *testing.T) {
+	_, err := RoutesProvider(&RoutesConfig{OpenAPI: []OpenAPIConfig{{File: "/does/not/exist.yaml"}}}, nil)()
+	assert.Error(t, err)
+	assert.Error(t, (&RoutesConfig{OpenAPI: []OpenAPIConfig{{}}}).Validate())
+	assert.Error(t, (&RoutesConfig{OpenAPI: []OpenAPIConfig{{File: "spec.yaml", ServiceName: "[abc"}}}).Validate())
+	assert.NoError(t, (&RoutesConfig{OpenAPI: []OpenAPIConfig{{File: "spec.yaml", ServiceName: "abc*"}}}).Validate())
+}
+
+func TestServiceRoutes(t *testing.T) {
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "orders.yaml")
+	require.NoError(t, os.WriteFile(spec, []byte(`
+openapi: 3.0.0
+paths:
+  /orders/{orderId}:
+    get: {}
+`), 0o600))
+	users := &services.RoutesConfig{Patterns: []string{"/users/{id}"}, IgnorePatterns: []string{"/status"}}
+	orders := &services.RoutesConfig{Unmatch: string(UnmatchPath), OpenAPI: []string{spec}}
+
+	router, err := RoutesProvider(
+		&RoutesConfig{Unmatch: UnmatchWildcard, Patterns: []string{"/api/:id"}, IgnorePatterns: []string{"/health"}},
+		services.DefinitionCriteria{
+			{Name: "users", Routes: users},
+			{Name: "orders", Routes: orders},
+			{Name: "other"},
+			// a copy of a routes block is resolved by the criteria position, as the original
+			{Name: "users-v2", Routes: &services.RoutesConfig{Patterns: []string{"/users/{id}"}, IgnorePatterns: []string{"/status"}}},
+		},
+	)()
+	require.NoError(t, err)
+	in, out := make(chan []request.Span, 10), make(chan []request.Span, 10)
+	defer close(in)
+	go router(in, out)
+
+	in <- []request.Span{
+		{ServiceID: svc.ID{Name: "users", RoutesCriteria: 1}, Path: "/users/123"},
+		{ServiceID: svc.ID{Name: "users", RoutesCriteria: 1}, Path: "/api/123"},
+		{ServiceID: svc.ID{Name: "orders", RoutesCriteria: 2}, Path: "/orders/1"},
+		{ServiceID: svc.ID{Name: "orders", RoutesCriteria: 2}, Path: "/api/123"},
+		{ServiceID: svc.ID{Name: "orders", RoutesCriteria: 2}, Path: "/unknown"},
+		{ServiceID: svc.ID{Name: "other"}, Path: "/api/123"},
+		{ServiceID: svc.ID{Name: "other"}, Path: "/users/123"},
+		{ServiceID: svc.ID{Name: "users-v2", RoutesCriteria: 4}, Path: "/users/123"},
+		// unknown criteria positions fall back to the global configuration
+		{ServiceID: svc.ID{Name: "unknown", RoutesCriteria: 9}, Path: "/users/123"},
+	}
+	assert.Equal(t, []string{
+		// overridden patterns
+		"/users/{id}",
+		"/**",
+		// global patterns and unmatch policy overridden, global patterns kept
+		"/orders/{orderId}",
+		"/api/:id",
+		"/unknown",
+		// global configuration
+		"/api/:id",
+		"/**",
+		// routes block copied from the users criteria
+		"/users/{id}",
+		// global configuration
+		"/**",
+	}, routes(testutil.ReadChannel(t, out, testTimeout)))
+
+	// ignored patterns are also overridden
+	in <- []request.Span{
+		{ServiceID: svc.ID{Name: "users", RoutesCriteria: 1}, Path: "/status"},
+		{ServiceID: svc.ID{Name: "users", RoutesCriteria: 1}, Path: "/health"},
+		{ServiceID: svc.ID{Name: "orders", RoutesCriteria: 2}, Path: "/status"},
+		{ServiceID: svc.ID{Name: "orders", RoutesCriteria: 2}, Path: "/health"},
+	}
+	assert.Equal(t, []request.Span{
+		{ServiceID: svc.ID{Name: "users", RoutesCriteria: 1}, Path: "/health", Route: "/**"},
+		{ServiceID: svc.ID{Name: "orders", RoutesCriteria: 2}, Path: "/status", Route: "/status"},
+	}, filterIgnored(func() []request.Span { return testutil.ReadChannel(t, out, testTimeout) }))
+}
+
+func TestServiceRoutes_NoGlobalConfig(t *testing.T) {
+	users := &services.RoutesConfig{Patterns: []string{"/users/{id}"}}
+	router, err := RoutesProvider(nil, services.DefinitionCriteria{{Name: "users", Routes: users}})()
+	require.NoError(t, err)
+	in, out := make(chan []request.Span, 10), make(chan []request.Span, 10)
+	defer close(in)
+	go router(in, out)
+
+	in <- []request.Span{
+		{ServiceID: svc.ID{Name: "users", RoutesCriteria: 1}, Path: "/users/123"},
+		// services without routes configuration are forwarded as they are
+		{ServiceID: svc.ID{Name: "other"}, Path: "/users/123"},
+	}
+	assert.Equal(t, []string{"/users/{id}", ""}, routes(testutil.ReadChannel(t, out, testTimeout)))
+
+	// the node is bypassed if there isn't any routes configuration
+	router, err = RoutesProvider(nil, services.DefinitionCriteria{{Name: "users"}})()
+	require.NoError(t, err)
+	assert.Nil(t, router)
+
+	// per-service routes are loaded when the node is created
+	_, err = RoutesProvider(nil, services.DefinitionCriteria{
+		{Name: "users", Routes: &services.RoutesConfig{OpenAPI: []string{"/does/not/exist.yaml"}}},
+	})()
+	assert.Error(t, err)
+}
+
 func TestIgnoreMode(t *testing.T) {
 	s := request.Span{Path: "/user/1234"}
 	setSpanIgnoreMode(IgnoreTraces, &s)
@@ -148,7 +308,7 @@ func benchProvider(b *testing.B, unmatch UnmatchType) {
 	router, err := RoutesProvider(&RoutesConfig{Unmatch: unmatch, Patterns: []string{
 		"/users/{id}",
 		"/users/{id}/product/{pid}",
-	}})()
+	}}, nil)()
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -168,6 +328,14 @@ func benchProvider(b *testing.B, unmatch UnmatchType) {
 	}
 }
 
+func routes(spans []request.Span) []string {
+	r := make([]string, 0, len(spans))
+	for i := range spans {
+		r = append(r, spans[i].Route)
+	}
+	return r
+}
+
 func filterIgnored(reader func() []request.Span) []request.Span {
 	for {
 		input := reader()